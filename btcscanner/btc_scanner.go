@@ -12,6 +12,9 @@ import (
 	"github.com/babylonlabs-io/staking-indexer/types"
 )
 
+// ConfirmedBlockBatchSize is the default number of blocks fetched in a
+// chunk during bootstrapping, which is also the maximum number of confirmed
+// blocks committed in a chain update
 const ConfirmedBlockBatchSize = 100
 
 var _ BtcScanner = (*BtcPoller)(nil)
@@ -42,6 +45,9 @@ type BtcPoller struct {
 
 	confirmationDepth uint16
 
+	// the number of blocks fetched in a chunk during bootstrapping
+	backfillChunkSize uint64
+
 	// the current tip BTC block
 	confirmedTipBlock *types.IndexedBlock
 
@@ -58,10 +64,15 @@ type BtcPoller struct {
 
 func NewBTCScanner(
 	confirmationDepth uint16,
+	backfillChunkSize uint64,
 	logger *zap.Logger,
 	btcClient Client,
 	btcNotifier notifier.ChainNotifier,
 ) (*BtcPoller, error) {
+	if backfillChunkSize == 0 {
+		return nil, fmt.Errorf("the backfill chunk size should be positive")
+	}
+
 	unconfirmedBlockCache, err := NewBTCCache(defaultMaxEntries)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create BTC cache for tail blocks: %w", err)
@@ -72,6 +83,7 @@ func NewBTCScanner(
 		btcClient:             btcClient,
 		btcNotifier:           btcNotifier,
 		confirmationDepth:     confirmationDepth,
+		backfillChunkSize:     backfillChunkSize,
 		chainUpdateInfoChan:   make(chan *ChainUpdateInfo),
 		unconfirmedBlockCache: unconfirmedBlockCache,
 		isStarted:             atomic.NewBool(false),
@@ -85,6 +97,11 @@ func (bs *BtcPoller) Start(startHeight, activationHeight uint64) error {
 		return fmt.Errorf("the BTC scanner is already started")
 	}
 
+	// Stop waits for the start to return so that the block
+	// event loop is never started after the scanner is stopped
+	bs.wg.Add(1)
+	defer bs.wg.Done()
+
 	if err := bs.waitUntilActivation(activationHeight); err != nil {
 		return err
 	}
@@ -118,7 +135,12 @@ func (bs *BtcPoller) waitUntilActivation(activationHeight uint64) error {
 		bs.logger.Info("waiting to reach the earliest activation height",
 			zap.Uint64("tip_height", tipHeight),
 			zap.Uint64("activation_height", activationHeight))
-		time.Sleep(10 * time.Second)
+
+		select {
+		case <-time.After(10 * time.Second):
+		case <-bs.quit:
+			return fmt.Errorf("the BTC scanner is stopped before reaching the activation height")
+		}
 	}
 
 	return nil
@@ -141,36 +163,50 @@ func (bs *BtcPoller) Bootstrap(startHeight uint64) error {
 	}
 
 	var confirmedBlocks []*types.IndexedBlock
-	for i := startHeight; i <= tipHeight; i++ {
-		ib, err := bs.btcClient.GetBlockByHeight(i)
-		if err != nil {
-			return fmt.Errorf("cannot get the block at height %d: %w", i, err)
+	for chunkStart := startHeight; chunkStart <= tipHeight; chunkStart += bs.backfillChunkSize {
+		select {
+		case <-bs.quit:
+			return ErrScannerStopped
+		default:
 		}
 
-		// the unconfirmed blocks should follow the canonical chain
-		tipCache := bs.unconfirmedBlockCache.Tip()
-		if tipCache != nil {
-			tipHash := tipCache.BlockHash()
-			if !tipHash.IsEqual(&ib.Header.PrevBlock) {
-				return fmt.Errorf("the block is not connected to the cache tip")
-			}
+		// the blocks are fetched in chunks to bound the memory usage
+		chunkEnd := chunkStart + bs.backfillChunkSize - 1
+		if chunkEnd > tipHeight {
+			chunkEnd = tipHeight
 		}
 
-		if err := bs.unconfirmedBlockCache.Add(ib); err != nil {
-			return fmt.Errorf("failed to add the block %d to cache: %w", ib.Height, err)
+		chunk, err := bs.FetchRange(chunkStart, chunkEnd)
+		if err != nil {
+			return err
 		}
 
-		tempConfirmedBlocks := bs.unconfirmedBlockCache.TrimConfirmedBlocks(int(bs.confirmationDepth) - 1)
-		confirmedBlocks = append(confirmedBlocks, tempConfirmedBlocks...)
+		for _, ib := range chunk {
+			// the unconfirmed blocks should follow the canonical chain
+			tipCache := bs.unconfirmedBlockCache.Tip()
+			if tipCache != nil {
+				tipHash := tipCache.BlockHash()
+				if !tipHash.IsEqual(&ib.Header.PrevBlock) {
+					return fmt.Errorf("the block is not connected to the cache tip")
+				}
+			}
+
+			if err := bs.unconfirmedBlockCache.Add(ib); err != nil {
+				return fmt.Errorf("failed to add the block %d to cache: %w", ib.Height, err)
+			}
+
+			tempConfirmedBlocks := bs.unconfirmedBlockCache.TrimConfirmedBlocks(int(bs.confirmationDepth) - 1)
+			confirmedBlocks = append(confirmedBlocks, tempConfirmedBlocks...)
 
-		// commit a batch to free up memory
-		if len(confirmedBlocks) >= ConfirmedBlockBatchSize {
-			// deep copy so that the copy will not be affected by memory release
-			blocksCopy := make([]*types.IndexedBlock, len(confirmedBlocks))
-			copy(blocksCopy, confirmedBlocks)
-			bs.commitChainUpdate(blocksCopy)
+			// commit a batch to free up memory
+			if uint64(len(confirmedBlocks)) >= bs.backfillChunkSize {
+				// deep copy so that the copy will not be affected by memory release
+				blocksCopy := make([]*types.IndexedBlock, len(confirmedBlocks))
+				copy(blocksCopy, confirmedBlocks)
+				bs.commitChainUpdate(blocksCopy)
 
-			confirmedBlocks = nil
+				confirmedBlocks = nil
+			}
 		}
 	}
 
@@ -184,6 +220,26 @@ func (bs *BtcPoller) Bootstrap(startHeight uint64) error {
 	return nil
 }
 
+// FetchRange fetches the blocks from the given heights, both inclusive, in
+// increasing height order
+func (bs *BtcPoller) FetchRange(from, to uint64) ([]*types.IndexedBlock, error) {
+	if from > to {
+		return nil, fmt.Errorf("the from height %d is higher than the to height %d", from, to)
+	}
+
+	blocks := make([]*types.IndexedBlock, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		ib, err := bs.btcClient.GetBlockByHeight(i)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get the block at height %d: %w", i, err)
+		}
+
+		blocks = append(blocks, ib)
+	}
+
+	return blocks, nil
+}
+
 func (bs *BtcPoller) getUnconfirmedBlocks() []*types.IndexedBlock {
 	tipBlock := bs.unconfirmedBlockCache.Tip()
 	if tipBlock == nil {
@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"sync"
 	"testing"
+	"time"
 
 	bbndatagen "github.com/babylonlabs-io/babylon/testutil/datagen"
 	"github.com/golang/mock/gomock"
@@ -45,7 +46,7 @@ func FuzzBootstrap(f *testing.F) {
 				Return(chainIndexedBlocks[i], nil).AnyTimes()
 		}
 
-		btcScanner, err := btcscanner.NewBTCScanner(uint16(k), zap.NewNop(), mockBtcClient, &mock.ChainNotifier{})
+		btcScanner, err := btcscanner.NewBTCScanner(uint16(k), btcscanner.ConfirmedBlockBatchSize, zap.NewNop(), mockBtcClient, &mock.ChainNotifier{})
 		require.NoError(t, err)
 
 		var wg sync.WaitGroup
@@ -83,6 +84,144 @@ func FuzzBootstrap(f *testing.F) {
 	})
 }
 
+// FuzzBootstrapInChunks tests that bootstrapping fetches the blocks in chunks
+// without dropping any block between the chunks and the new blocks
+func FuzzBootstrapInChunks(f *testing.F) {
+	bbndatagen.AddRandomSeedsToFuzzer(f, 100)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+		versionedParams := datagen.GenerateGlobalParamsVersions(r, t)
+		k := uint64(versionedParams.Versions[0].ConfirmationDepth)
+		startHeight := versionedParams.Versions[0].ActivationHeight
+		chunkSize := uint64(r.Intn(30) + 1)
+
+		numBlocks := bbndatagen.RandomIntOtherThan(r, 0, 100) + 1
+		initialChain := datagen.GetRandomIndexedBlocks(r, startHeight, numBlocks)
+		bestHeight := initialChain[len(initialChain)-1].Height
+		numNewBlocks := bbndatagen.RandomIntOtherThan(r, 0, 20)
+		newBlocks := datagen.GetRandomIndexedBlocksFromHeight(r, numNewBlocks, bestHeight, initialChain[len(initialChain)-1].BlockHash())
+		canonicalChain := append(initialChain, newBlocks...)
+
+		ctl := gomock.NewController(t)
+		mockBtcClient := mocks.NewMockClient(ctl)
+		mockBtcClient.EXPECT().GetTipHeight().Return(uint64(bestHeight), nil).AnyTimes()
+		var fetchedHeights []uint64
+		for _, b := range canonicalChain {
+			b := b
+			mockBtcClient.EXPECT().GetBlockByHeight(gomock.Eq(uint64(b.Height))).
+				DoAndReturn(func(height uint64) (*types.IndexedBlock, error) {
+					fetchedHeights = append(fetchedHeights, height)
+					return b, nil
+				}).AnyTimes()
+		}
+
+		btcScanner, err := btcscanner.NewBTCScanner(uint16(k), chunkSize, zap.NewNop(), mockBtcClient, &mock.ChainNotifier{})
+		require.NoError(t, err)
+
+		// the chunk boundaries are inclusive
+		from := startHeight + uint64(r.Int63n(int64(numBlocks)))
+		to := from + uint64(r.Int63n(int64(uint64(bestHeight)-from+1)))
+		chunk, err := btcScanner.FetchRange(from, to)
+		require.NoError(t, err)
+		require.Equal(t, initialChain[from-startHeight:to-startHeight+1], chunk)
+		_, err = btcScanner.FetchRange(to+1, to)
+		require.Error(t, err)
+		fetchedHeights = nil
+
+		errChan := make(chan error, 1)
+		go func() {
+			if err := btcScanner.Bootstrap(startHeight); err != nil {
+				errChan <- err
+				return
+			}
+			for _, b := range indexedBlocksToBlockEpochs(newBlocks) {
+				if err := btcScanner.HandleNewBlock(b); err != nil {
+					errChan <- err
+					return
+				}
+			}
+			errChan <- nil
+		}()
+
+		var confirmedBlocks []*types.IndexedBlock
+	recvLoop:
+		for {
+			select {
+			case updateInfo := <-btcScanner.ChainUpdateInfoChan():
+				require.LessOrEqual(t, uint64(len(updateInfo.ConfirmedBlocks)), chunkSize)
+				confirmedBlocks = append(confirmedBlocks, updateInfo.ConfirmedBlocks...)
+			case err := <-errChan:
+				require.NoError(t, err)
+				break recvLoop
+			}
+		}
+
+		// every block is fetched once in order and all the blocks
+		// out of the confirmation depth are confirmed in order
+		require.Len(t, fetchedHeights, len(canonicalChain))
+		for i, height := range fetchedHeights {
+			require.Equal(t, startHeight+uint64(i), height)
+		}
+		numConfirmed := 0
+		if len(canonicalChain) >= int(k)-1 {
+			numConfirmed = len(canonicalChain) - int(k) + 1
+		}
+		require.Len(t, confirmedBlocks, numConfirmed)
+		for i, b := range confirmedBlocks {
+			require.Equal(t, canonicalChain[i].BlockHash(), b.BlockHash())
+		}
+	})
+}
+
+// TestStopDuringBootstrap tests that stopping the scanner during the
+// bootstrapping makes the start return instead of starting the scanning
+func TestStopDuringBootstrap(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	versionedParams := datagen.GenerateGlobalParamsVersions(r, t)
+	k := uint64(versionedParams.Versions[0].ConfirmationDepth)
+	startHeight := versionedParams.Versions[0].ActivationHeight
+
+	// the chain is long enough that the bootstrapping blocks
+	// on committing the confirmed blocks nobody receives
+	chain := datagen.GetRandomIndexedBlocks(r, startHeight, k+10)
+	bestHeight := chain[len(chain)-1].Height
+
+	fetchingStarted := make(chan struct{})
+	var once sync.Once
+	ctl := gomock.NewController(t)
+	mockBtcClient := mocks.NewMockClient(ctl)
+	mockBtcClient.EXPECT().GetTipHeight().Return(uint64(bestHeight), nil).AnyTimes()
+	for _, b := range chain {
+		b := b
+		mockBtcClient.EXPECT().GetBlockByHeight(gomock.Eq(uint64(b.Height))).
+			DoAndReturn(func(uint64) (*types.IndexedBlock, error) {
+				once.Do(func() { close(fetchingStarted) })
+				return b, nil
+			}).AnyTimes()
+	}
+
+	btcScanner, err := btcscanner.NewBTCScanner(uint16(k), 1, zap.NewNop(), mockBtcClient, &mock.ChainNotifier{})
+	require.NoError(t, err)
+
+	startErrChan := make(chan error, 1)
+	go func() {
+		startErrChan <- btcScanner.Start(startHeight, startHeight)
+	}()
+
+	<-fetchingStarted
+	err = btcScanner.Stop()
+	require.NoError(t, err)
+
+	// the start has returned once the scanner is stopped
+	select {
+	case err := <-startErrChan:
+		require.ErrorIs(t, err, btcscanner.ErrScannerStopped)
+	default:
+		t.Fatal("the start does not return after the scanner is stopped")
+	}
+}
+
 // FuzzHandleNewBlock tests (1) happy path of handling an incoming block,
 // and (2) errors when the incoming block is not expected
 func FuzzHandleNewBlock(f *testing.F) {
@@ -117,7 +256,7 @@ func FuzzHandleNewBlock(f *testing.F) {
 		secondChainedIndexedBlocks := datagen.GetRandomIndexedBlocksFromHeight(r, numBlocks2, bestHeight, bestBlockHash)
 		secondChainedBlockEpochs := indexedBlocksToBlockEpochs(secondChainedIndexedBlocks)
 
-		btcScanner, err := btcscanner.NewBTCScanner(uint16(k), zap.NewNop(), mockBtcClient, &mock.ChainNotifier{})
+		btcScanner, err := btcscanner.NewBTCScanner(uint16(k), btcscanner.ConfirmedBlockBatchSize, zap.NewNop(), mockBtcClient, &mock.ChainNotifier{})
 		require.NoError(t, err)
 
 		// receive confirmed blocks
@@ -199,7 +338,7 @@ func FuzzBootstrapMajorReorg(f *testing.F) {
 			}
 		}
 
-		btcScanner, err := btcscanner.NewBTCScanner(uint16(k), zap.NewNop(), mockBtcClient, &mock.ChainNotifier{})
+		btcScanner, err := btcscanner.NewBTCScanner(uint16(k), btcscanner.ConfirmedBlockBatchSize, zap.NewNop(), mockBtcClient, &mock.ChainNotifier{})
 		require.NoError(t, err)
 
 		// receive confirmed blocks
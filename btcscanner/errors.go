@@ -7,4 +7,5 @@ var (
 	ErrInvalidMaxEntries = errors.New("invalid max entries")
 	ErrTooManyEntries    = errors.New("the number of blocks is more than maxEntries")
 	ErrUnsortedBlocks    = errors.New("blocks are not sorted by height")
+	ErrScannerStopped    = errors.New("the BTC scanner is stopped")
 )
@@ -0,0 +1,128 @@
+package btcscanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+
+	"github.com/babylonlabs-io/staking-indexer/types"
+)
+
+const pullRetryInterval = time.Second
+
+var _ BtcScanner = (*PullScanner)(nil)
+
+// BlockPuller is a pull-based source of confirmed blocks, for libraries
+// that do not deliver blocks through channels
+type BlockPuller interface {
+	// NextBlock blocks until the next confirmed block is available and
+	// returns it. Blocks must be returned in increasing height order
+	NextBlock(ctx context.Context) (*types.IndexedBlock, error)
+}
+
+// PullScanner adapts a BlockPuller to the push-based BtcScanner interface
+// by pulling the confirmed blocks and sending them to the chain update
+// info channel
+type PullScanner struct {
+	logger *zap.Logger
+
+	puller BlockPuller
+
+	lastConfirmedHeight *atomic.Uint64
+
+	// receives chain update info
+	chainUpdateInfoChan chan *ChainUpdateInfo
+
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	isStarted *atomic.Bool
+}
+
+func NewPullScanner(puller BlockPuller, logger *zap.Logger) *PullScanner {
+	return &PullScanner{
+		logger:              logger.With(zap.String("module", "btcscanner")),
+		puller:              puller,
+		lastConfirmedHeight: atomic.NewUint64(0),
+		chainUpdateInfoChan: make(chan *ChainUpdateInfo),
+		isStarted:           atomic.NewBool(false),
+	}
+}
+
+// Start starts pulling the confirmed blocks. The blocks lower than the
+// start height are skipped
+func (ps *PullScanner) Start(startHeight, _ uint64) error {
+	if ps.isStarted.Swap(true) {
+		return fmt.Errorf("the BTC scanner is already started")
+	}
+
+	ps.logger.Info("starting the BTC pull scanner", zap.Uint64("start_height", startHeight))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ps.cancel = cancel
+
+	ps.wg.Add(1)
+	go ps.pullLoop(ctx, startHeight)
+
+	ps.logger.Info("the BTC pull scanner is started")
+
+	return nil
+}
+
+func (ps *PullScanner) pullLoop(ctx context.Context, startHeight uint64) {
+	defer ps.wg.Done()
+
+	for {
+		b, err := ps.puller.NextBlock(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+				return
+			}
+
+			ps.logger.Error("failed to pull the next block", zap.Error(err))
+
+			select {
+			case <-time.After(pullRetryInterval):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if uint64(b.Height) < startHeight {
+			continue
+		}
+
+		select {
+		case ps.chainUpdateInfoChan <- &ChainUpdateInfo{ConfirmedBlocks: []*types.IndexedBlock{b}}:
+			ps.lastConfirmedHeight.Store(uint64(b.Height))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (ps *PullScanner) ChainUpdateInfoChan() <-chan *ChainUpdateInfo {
+	return ps.chainUpdateInfoChan
+}
+
+func (ps *PullScanner) LastConfirmedHeight() uint64 {
+	return ps.lastConfirmedHeight.Load()
+}
+
+func (ps *PullScanner) Stop() error {
+	if !ps.isStarted.Swap(false) {
+		return nil
+	}
+
+	ps.cancel()
+	ps.wg.Wait()
+
+	ps.logger.Info("the BTC pull scanner is stopped")
+
+	return nil
+}
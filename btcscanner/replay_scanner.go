@@ -0,0 +1,195 @@
+package btcscanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/btcsuite/btcd/wire"
+	"go.uber.org/zap"
+
+	"github.com/babylonlabs-io/staking-indexer/types"
+)
+
+var _ BtcScanner = (*ReplayScanner)(nil)
+
+// DumpBlocks writes the given blocks to the given writer in the format read
+// by the replay scanner, i.e., for each block the height as a big-endian
+// uint32 followed by the serialized block including the witness data
+func DumpBlocks(w io.Writer, blocks []*types.IndexedBlock) error {
+	for _, b := range blocks {
+		var heightBytes [4]byte
+		binary.BigEndian.PutUint32(heightBytes[:], uint32(b.Height))
+		if _, err := w.Write(heightBytes[:]); err != nil {
+			return err
+		}
+
+		if err := b.MsgBlock().Serialize(w); err != nil {
+			return fmt.Errorf("failed to serialize the block at height %d: %w", b.Height, err)
+		}
+	}
+
+	return nil
+}
+
+// FileBlockPuller is a pull-based source of the blocks dumped by DumpBlocks
+// into a file or into the files of a directory. The files of a directory
+// are read in the lexical order of their names
+type FileBlockPuller struct {
+	paths []string
+
+	file   *os.File
+	reader *bufio.Reader
+
+	lastHeight *int32
+
+	// the error of reading the dumped blocks, the source cannot be read
+	// any further after an error
+	err error
+}
+
+func NewFileBlockPuller(path string) (*FileBlockPuller, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return &FileBlockPuller{paths: []string{path}}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			paths = append(paths, filepath.Join(path, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+
+	return &FileBlockPuller{paths: paths}, nil
+}
+
+// NextBlock returns the next dumped block. After all the dumped blocks are
+// returned, it blocks until the given context is done
+func (p *FileBlockPuller) NextBlock(ctx context.Context) (*types.IndexedBlock, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	for {
+		if p.reader == nil {
+			if len(p.paths) == 0 {
+				// no more blocks, wait until the scanner is stopped
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+
+			f, err := os.Open(p.paths[0])
+			if err != nil {
+				p.err = err
+				return nil, err
+			}
+			p.file = f
+			p.reader = bufio.NewReader(f)
+			p.paths = p.paths[1:]
+		}
+
+		b, err := readBlock(p.reader)
+		if errors.Is(err, io.EOF) {
+			// move on to the next file
+			if err := p.Close(); err != nil {
+				p.err = err
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			p.err = fmt.Errorf("failed to read the dumped block from %s: %w", p.file.Name(), err)
+			return nil, p.err
+		}
+
+		if p.lastHeight != nil && b.Height <= *p.lastHeight {
+			p.err = fmt.Errorf("%w: the dumped block at height %d follows the one at height %d",
+				ErrUnsortedBlocks, b.Height, *p.lastHeight)
+			return nil, p.err
+		}
+		p.lastHeight = &b.Height
+
+		return b, nil
+	}
+}
+
+// Close closes the file being read
+func (p *FileBlockPuller) Close() error {
+	if p.file == nil {
+		return nil
+	}
+
+	err := p.file.Close()
+	p.file = nil
+	p.reader = nil
+
+	return err
+}
+
+// readBlock reads a block dumped by DumpBlocks, it returns io.EOF if there
+// is no more block to read
+func readBlock(r io.Reader) (*types.IndexedBlock, error) {
+	var heightBytes [4]byte
+	if _, err := io.ReadFull(r, heightBytes[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("truncated block height: %w", err)
+		}
+		return nil, err
+	}
+
+	var msgBlock wire.MsgBlock
+	if err := msgBlock.Deserialize(r); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("invalid block: %w", err)
+	}
+
+	return types.NewIndexedBlockFromMsgBlock(int32(binary.BigEndian.Uint32(heightBytes[:])), &msgBlock), nil
+}
+
+// ReplayScanner feeds the blocks dumped in a file or a directory to the
+// chain update info channel as the confirmed blocks, e.g., for
+// deterministic testing or disaster recovery without a BTC node
+type ReplayScanner struct {
+	*PullScanner
+
+	puller *FileBlockPuller
+}
+
+func NewReplayScanner(path string, logger *zap.Logger) (*ReplayScanner, error) {
+	puller, err := NewFileBlockPuller(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the replay source %s: %w", path, err)
+	}
+
+	return &ReplayScanner{
+		PullScanner: NewPullScanner(puller, logger),
+		puller:      puller,
+	}, nil
+}
+
+func (rs *ReplayScanner) Stop() error {
+	if err := rs.PullScanner.Stop(); err != nil {
+		return err
+	}
+
+	return rs.puller.Close()
+}
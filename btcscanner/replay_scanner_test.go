@@ -0,0 +1,117 @@
+package btcscanner_test
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/babylonlabs-io/staking-indexer/btcscanner"
+	"github.com/babylonlabs-io/staking-indexer/testutils/datagen"
+	"github.com/babylonlabs-io/staking-indexer/types"
+)
+
+func dumpBlocksToFile(t *testing.T, path string, blocks []*types.IndexedBlock) {
+	var buf bytes.Buffer
+	err := btcscanner.DumpBlocks(&buf, blocks)
+	require.NoError(t, err)
+	err = os.WriteFile(path, buf.Bytes(), 0600)
+	require.NoError(t, err)
+}
+
+// TestReplayScanner tests that the blocks dumped into the files of a
+// directory are replayed in order as the confirmed blocks
+func TestReplayScanner(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	blocks := datagen.GetRandomIndexedBlocks(r, 100, 30)
+
+	// the files are read in the order of their names
+	dir := t.TempDir()
+	dumpBlocksToFile(t, filepath.Join(dir, "0002.blk"), blocks[10:])
+	dumpBlocksToFile(t, filepath.Join(dir, "0001.blk"), blocks[:10])
+
+	replayScanner, err := btcscanner.NewReplayScanner(dir, zap.NewNop())
+	require.NoError(t, err)
+
+	// the blocks lower than the start height are skipped
+	startHeight := uint64(blocks[5].Height)
+	err = replayScanner.Start(startHeight, 0)
+	require.NoError(t, err)
+	defer func() {
+		err := replayScanner.Stop()
+		require.NoError(t, err)
+	}()
+
+	for _, expected := range blocks[5:] {
+		var update *btcscanner.ChainUpdateInfo
+		select {
+		case update = <-replayScanner.ChainUpdateInfoChan():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the block at height %d is not replayed", expected.Height)
+		}
+
+		require.Len(t, update.ConfirmedBlocks, 1)
+		b := update.ConfirmedBlocks[0]
+		require.Equal(t, expected.Height, b.Height)
+		require.Equal(t, expected.BlockHash(), b.BlockHash())
+		require.Len(t, b.Txs, len(expected.Txs))
+		for i := range b.Txs {
+			require.Equal(t, expected.Txs[i].Hash(), b.Txs[i].Hash())
+			require.Equal(t, expected.Txs[i].WitnessHash(), b.Txs[i].WitnessHash())
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		return replayScanner.LastConfirmedHeight() == uint64(blocks[len(blocks)-1].Height)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestFileBlockPullerInvalidSource(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	blocks := datagen.GetRandomIndexedBlocks(r, 100, 5)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the blocks are not in increasing height order
+	unsortedPath := filepath.Join(t.TempDir(), "unsorted.blk")
+	dumpBlocksToFile(t, unsortedPath, []*types.IndexedBlock{blocks[1], blocks[0]})
+	puller, err := btcscanner.NewFileBlockPuller(unsortedPath)
+	require.NoError(t, err)
+	b, err := puller.NextBlock(ctx)
+	require.NoError(t, err)
+	require.Equal(t, blocks[1].Height, b.Height)
+	_, err = puller.NextBlock(ctx)
+	require.ErrorIs(t, err, btcscanner.ErrUnsortedBlocks)
+	// the source is not read any further
+	_, err = puller.NextBlock(ctx)
+	require.ErrorIs(t, err, btcscanner.ErrUnsortedBlocks)
+	require.NoError(t, puller.Close())
+
+	// the last block is truncated
+	var buf bytes.Buffer
+	err = btcscanner.DumpBlocks(&buf, blocks)
+	require.NoError(t, err)
+	truncatedPath := filepath.Join(t.TempDir(), "truncated.blk")
+	err = os.WriteFile(truncatedPath, buf.Bytes()[:buf.Len()-1], 0600)
+	require.NoError(t, err)
+	puller, err = btcscanner.NewFileBlockPuller(truncatedPath)
+	require.NoError(t, err)
+	for i := 0; i < len(blocks)-1; i++ {
+		_, err := puller.NextBlock(ctx)
+		require.NoError(t, err)
+	}
+	_, err = puller.NextBlock(ctx)
+	require.Error(t, err)
+	require.NoError(t, puller.Close())
+
+	_, err = btcscanner.NewFileBlockPuller(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
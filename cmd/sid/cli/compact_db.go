@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+
+	"github.com/babylonlabs-io/staking-indexer/config"
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+var CompactDbCommand = cli.Command{
+	Name:        "compact-db",
+	Usage:       "Compact the database of the staking indexer to reclaim the space of the deleted records.",
+	Description: "Rewrite the database file into a fresh file holding only the live records and replace the original file with it. The staking indexer must be stopped during the compaction.",
+	UsageText:   "compact-db [--home=path/to/home]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  homeFlag,
+			Usage: "The path to the staking indexer home directory",
+			Value: config.DefaultHomeDir,
+		},
+	},
+	Action: compactDb,
+}
+
+func compactDb(ctx *cli.Context) error {
+	homePath, err := filepath.Abs(ctx.String(homeFlag))
+	if err != nil {
+		return err
+	}
+	homePath = utils.CleanAndExpandPath(homePath)
+
+	cfg, err := config.LoadConfig(homePath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	dbLock, err := cfg.DatabaseConfig.Lock()
+	if err != nil {
+		return err
+	}
+	defer dbLock.Unlock()
+
+	sizeBefore, sizeAfter, err := indexerstore.Compact(cfg.DatabaseConfig.DBDir(), cfg.DatabaseConfig.DBFileName)
+	if err != nil {
+		return fmt.Errorf("failed to compact the database: %w", err)
+	}
+
+	fmt.Printf("compacted the database from %d bytes to %d bytes\n", sizeBefore, sizeAfter)
+
+	return nil
+}
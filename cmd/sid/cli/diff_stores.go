@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+
+	"github.com/babylonlabs-io/staking-indexer/config"
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+var DiffStoresCommand = cli.Command{
+	Name:        "diff-stores",
+	Usage:       "Output the difference between the stores of two staking indexer home directories.",
+	Description: "Output the records present in one store but not the other and the records that differ as JSON, e.g., to validate a reindex against the original store. The stores are migrated to the latest version when opened.",
+	UsageText:   "diff-stores [home-a] [home-b]",
+	Action:      diffStores,
+}
+
+func diffStores(ctx *cli.Context) error {
+	args := ctx.Args()
+	if len(args) != 2 {
+		return fmt.Errorf("not enough params, please specify [home-a] and [home-b]")
+	}
+
+	storeA, closeA, err := openStore(args[0])
+	if err != nil {
+		return err
+	}
+	defer closeA()
+
+	storeB, closeB, err := openStore(args[1])
+	if err != nil {
+		return err
+	}
+	defer closeB()
+
+	diff, err := indexerstore.DiffStores(storeA, storeB)
+	if err != nil {
+		return fmt.Errorf("failed to diff the stores: %w", err)
+	}
+
+	bz, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to generate json of the diff: %w", err)
+	}
+
+	fmt.Println(string(bz))
+
+	return nil
+}
+
+// openStore opens the store of the staking indexer home directory
+// and returns a function closing it
+func openStore(home string) (*indexerstore.IndexerStore, func(), error) {
+	homePath, err := filepath.Abs(home)
+	if err != nil {
+		return nil, nil, err
+	}
+	homePath = utils.CleanAndExpandPath(homePath)
+
+	cfg, err := config.LoadConfig(homePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration of %s: %w", homePath, err)
+	}
+
+	dbBackend, err := cfg.DatabaseConfig.GetDbBackend()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create db backend of %s: %w", homePath, err)
+	}
+
+	store, err := indexerstore.NewIndexerStore(dbBackend)
+	if err != nil {
+		_ = dbBackend.Close()
+		return nil, nil, fmt.Errorf("failed to open the store of %s: %w", homePath, err)
+	}
+
+	return store, func() { _ = dbBackend.Close() }, nil
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/urfave/cli"
+	"go.uber.org/zap"
+
+	"github.com/babylonlabs-io/staking-indexer/config"
+	"github.com/babylonlabs-io/staking-indexer/indexer"
+	"github.com/babylonlabs-io/staking-indexer/params"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+var SelfTestCommand = cli.Command{
+	Name:        "self-test",
+	Usage:       "Check whether a staking tx would be indexed at a height with the global params.",
+	Description: "Run the checks a staking tx goes through when confirmed at the given height, i.e., whether there are params for the height and whether the tx parses, validates against the params, and would be eligible, and print the result of each check, e.g., to debug the tx construction. The eligibility is evaluated against the store of the home directory without changing it, so the staking indexer must be stopped, and the store must be migrated by the staking indexer of the same version.",
+	UsageText:   fmt.Sprintf("self-test [staking-tx-hex] [height] [--%s=path/to/global-params.json]", paramsPathFlag),
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  homeFlag,
+			Usage: "The path to the staking indexer home directory",
+			Value: config.DefaultHomeDir,
+		},
+		cli.StringFlag{
+			Name:  paramsPathFlag,
+			Usage: "The path to the global params file",
+			Value: config.DefaultParamsPath,
+		},
+	},
+	Action: selfTest,
+}
+
+func selfTest(ctx *cli.Context) error {
+	args := ctx.Args()
+	if len(args) != 2 {
+		return fmt.Errorf("not enough params, please specify [staking-tx-hex] and [height]")
+	}
+
+	txBytes, err := hex.DecodeString(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to decode the staking tx hex: %w", err)
+	}
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(txBytes)); err != nil {
+		return fmt.Errorf("unable to deserialize the staking tx: %w", err)
+	}
+
+	height, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("unable to parse %s: %w", args[1], err)
+	}
+
+	homePath, err := filepath.Abs(ctx.String(homeFlag))
+	if err != nil {
+		return err
+	}
+	homePath = utils.CleanAndExpandPath(homePath)
+
+	cfg, err := config.LoadConfig(homePath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	paramsRetriever, err := params.NewGlobalParamsRetriever(ctx.String(paramsPathFlag))
+	if err != nil {
+		return fmt.Errorf("failed to initialize params retriever: %w", err)
+	}
+
+	dbLock, err := cfg.DatabaseConfig.Lock()
+	if err != nil {
+		return err
+	}
+	defer dbLock.Unlock()
+
+	dbBackend, err := cfg.DatabaseConfig.GetDbBackend()
+	if err != nil {
+		return fmt.Errorf("failed to create db backend: %w", err)
+	}
+	defer dbBackend.Close()
+
+	// the store is neither initialized nor migrated
+	si, err := indexer.NewSelfTestStakingIndexer(cfg, zap.NewNop(), dbBackend, paramsRetriever.VersionedParams())
+	if err != nil {
+		return fmt.Errorf("failed to initialize the staking indexer app: %w", err)
+	}
+
+	checks := si.SelfTestStakingTx(&tx, height)
+	for _, check := range checks {
+		result := "PASS"
+		if !check.Passed {
+			result = "FAIL"
+		}
+		fmt.Printf("[%s] %s: %s\n", result, check.Name, check.Detail)
+	}
+
+	if last := checks[len(checks)-1]; !last.Passed {
+		return fmt.Errorf("the staking tx %s failed the %s check", tx.TxHash().String(), last.Name)
+	}
+
+	return nil
+}
@@ -22,6 +22,7 @@ const (
 	homeFlag        = "home"
 	startHeightFlag = "start-height"
 	paramsPathFlag  = "params-path"
+	replaySrcFlag   = "replay-source"
 )
 
 var StartCommand = cli.Command{
@@ -43,6 +44,10 @@ var StartCommand = cli.Command{
 			Usage: "The path to the global params file",
 			Value: config.DefaultParamsPath,
 		},
+		cli.StringFlag{
+			Name:  replaySrcFlag,
+			Usage: "The path to a file or a directory of dumped blocks to process instead of scanning the BTC node",
+		},
 	},
 	Action: start,
 }
@@ -82,6 +87,13 @@ func start(ctx *cli.Context) error {
 		return fmt.Errorf("failed to initialize the BTC notifier: %w", err)
 	}
 
+	// fail fast if another instance is using the database
+	dbLock, err := cfg.DatabaseConfig.Lock()
+	if err != nil {
+		return err
+	}
+	defer dbLock.Unlock()
+
 	dbBackend, err := cfg.DatabaseConfig.GetDbBackend()
 	if err != nil {
 		return fmt.Errorf("failed to create db backend: %w", err)
@@ -96,7 +108,12 @@ func start(ctx *cli.Context) error {
 	// create BTC scanner
 	// we don't expect the confirmation depth to change across different versions
 	// so we can always use the first one
-	scanner, err := btcscanner.NewBTCScanner(versionedParams.Versions[0].ConfirmationDepth, logger, btcClient, btcNotifier)
+	var scanner btcscanner.BtcScanner
+	if ctx.IsSet(replaySrcFlag) {
+		scanner, err = btcscanner.NewReplayScanner(ctx.String(replaySrcFlag), logger)
+	} else {
+		scanner, err = btcscanner.NewBTCScanner(versionedParams.Versions[0].ConfirmationDepth, cfg.BackfillChunkSize, logger, btcClient, btcNotifier)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to initialize the BTC scanner: %w", err)
 	}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"path/filepath"
+	"time"
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -19,6 +20,56 @@ const (
 	defaultParamsFileName = "global-params.json"
 	defaultBitcoinNetwork = "signet"
 	defaultDataDirname    = "data"
+
+	defaultProcessingErrorLogSize = 1000
+	defaultPruneInterval          = 10 * time.Minute
+	defaultBackfillChunkSize      = 100
+	defaultPushTimeout            = 30 * time.Second
+	defaultPushMaxRetries         = 3
+	defaultPushRetryBackoff       = time.Second
+	// the precision of satoshis in BTC
+	defaultFloatPrecision = 8
+	// the decimal places beyond which float64 is not precise anyway
+	maxFloatPrecision = 15
+)
+
+const (
+	// EventFieldTxHex is the raw tx of the staking and unbonding events
+	EventFieldTxHex = "txhex"
+	// EventFieldWitness is the witness data within the raw tx of the
+	// staking and unbonding events
+	EventFieldWitness = "witness"
+)
+
+const (
+	// StakingCapPolicyReach a staking tx is active if the TVL is below the
+	// staking cap before it, so the tx reaching or crossing the cap is active
+	StakingCapPolicyReach = "reach"
+	// StakingCapPolicyFill a staking tx is active if the TVL including it
+	// does not exceed the staking cap, so the tx exactly filling the cap is
+	// active while the tx crossing it is not
+	StakingCapPolicyFill = "fill"
+	// StakingCapPolicyBelow a staking tx is active if the TVL including it
+	// stays below the staking cap, so the tx exactly filling the cap is not
+	// active
+	StakingCapPolicyBelow = "below"
+)
+
+const (
+	// EventDeliveryOrderingStrict the events are pushed one at a time in
+	// the order of the txs
+	EventDeliveryOrderingStrict = "strict"
+	// EventDeliveryOrderingThroughput the events are pushed concurrently
+	// without an order guarantee
+	EventDeliveryOrderingThroughput = "throughput"
+)
+
+const (
+	// IndexKeyHashNone the pks are used as the index keys as they are
+	IndexKeyHashNone = "none"
+	// IndexKeyHashSha256 the index keys are the truncated SHA256 hashes of
+	// the pks
+	IndexKeyHashSha256 = "sha256"
 )
 
 var (
@@ -31,25 +82,64 @@ var (
 
 // Config is the main config for the fpd cli command
 type Config struct {
-	LogLevel          string         `long:"loglevel" description:"Logging level for all subsystems" choice:"trace" choice:"debug" choice:"info" choice:"warn" choice:"error" choice:"fatal"`
-	BitcoinNetwork    string         `long:"bitcoinnetwork" description:"Bitcoin network to run on" choice:"mainnet" choice:"regtest" choice:"testnet" choice:"simnet" choice:"signet"`
-	ExtraEventEnabled bool           `long:"extraeventenabled" description:"Whether emitting non-default events is allowed"`
-	BTCConfig         *BTCConfig     `group:"btcconfig" namespace:"btcconfig"`
-	DatabaseConfig    *DBConfig      `group:"dbconfig" namespace:"dbconfig"`
-	QueueConfig       *QueueConfig   `group:"queueconfig" namespace:"queueconfig"`
-	MetricsConfig     *MetricsConfig `group:"metricsconfig" namespace:"metricsconfig"`
+	LogLevel                    string         `long:"loglevel" description:"Logging level for all subsystems" choice:"trace" choice:"debug" choice:"info" choice:"warn" choice:"error" choice:"fatal"`
+	BitcoinNetwork              string         `long:"bitcoinnetwork" description:"Bitcoin network to run on" choice:"mainnet" choice:"regtest" choice:"testnet" choice:"simnet" choice:"signet"`
+	ExtraEventEnabled           bool           `long:"extraeventenabled" description:"Whether emitting non-default events is allowed"`
+	BatchBlockEventsEnabled     bool           `long:"batchblockeventsenabled" description:"Whether to push the events of the txs in a confirmed block in a single batch, the events are pushed one by one if the consumer does not support batches"`
+	EventDeliveryOrdering       string         `long:"eventdeliveryordering" description:"How the events of the txs in a confirmed block are pushed one by one, strict means one push is in flight at a time so that the consumer receives the events in order, and throughput means the pushes run concurrently so that a slow consumer costs less time while the order is not guaranteed, either way all the pushes are done before the block is saved as processed (empty means strict)" choice:"strict" choice:"throughput"`
+	ExcludedEventFields         []string       `long:"excludedeventfields" description:"The heavy fields omitted from the emitted events to save bandwidth, txhex omits the raw txs while witness only strips the witness data from them, the identifiers such as the tx hashes are always kept" choice:"txhex" choice:"witness"`
+	InclusionProofsEnabled      bool           `long:"inclusionproofsenabled" description:"Whether to store the merkle inclusion proofs of the staking and unbonding txs within their blocks for light-client consumers, which costs extra storage"`
+	BlockDataEnabled            bool           `long:"blockdataenabled" description:"Whether to store the full data of each processed block, i.e., the header and the txs, for replay and audit, which costs a lot of extra storage"`
+	IndexKeyHash                string         `long:"indexkeyhash" description:"The hash applied to the staker and finality provider pks before they are used as the index keys, sha256 bounds the keys to 16 bytes at the cost of an indirection when listing the finality providers, both indexes are rebuilt on startup once it is changed (empty means none)" choice:"none" choice:"sha256"`
+	DeadLetterEnabled           bool           `long:"deadletterenabled" description:"Whether to store the txs carrying the staking tag but failing parsing for later inspection"`
+	ProcessingErrorLogSize      uint64         `long:"processingerrorlogsize" description:"The number of the most recent errors of processing invalid txs kept in the db for later inspection (0 means not keeping the errors)"`
+	DeadLetterMaxEntries        uint64         `long:"deadlettermaxentries" description:"The maximum number of dead letters kept in the db, the ones of the lowest heights are pruned first (0 means no limit)"`
+	DiagnosticLogRetention      uint64         `long:"diagnosticlogretention" description:"The number of blocks below the last processed height within which the dead letters and processing errors are kept (0 means keeping them regardless of their heights)"`
+	PruneInterval               time.Duration  `long:"pruneinterval" description:"The interval of pruning the dead letters and processing errors in the background"`
+	StakingCapPolicy            string         `long:"stakingcappolicy" description:"How a staking tx at the boundary of the staking cap is classified, reach means it is active if the TVL is below the cap before it, fill means it is active if the TVL including it does not exceed the cap, and below means it is active if the TVL including it stays below the cap (empty means reach)" choice:"reach" choice:"fill" choice:"below"`
+	CapWindow                   time.Duration  `long:"capwindow" description:"The rolling period of block time over which the TVL is measured against the staking cap, i.e., only the active staking txs included within the period before the block of a staking tx count towards the cap (0 means the confirmed TVL is measured)"`
+	PerStakerCap                uint64         `long:"perstakercap" description:"The maximum amount in satoshis a single staker can have actively staked, staking txs exceeding it are marked as overflow (0 means no cap)"`
+	PerFinalityProviderCap      uint64         `long:"perfinalityprovidercap" description:"The maximum amount in satoshis a single finality provider can have actively staked to it, staking txs exceeding it are marked as overflow (0 means no cap)"`
+	CapWarningThreshold         uint32         `long:"capwarningthreshold" description:"The percentage of the staking cap at which a warning is logged once the TVL measured against the cap, i.e., the one within the cap window if configured, reaches it, which is logged again only after the TVL drops below it, the time-based caps are not checked (0 means no warning)"`
+	FloatPrecision              uint32         `long:"floatprecision" description:"The number of decimal places the float values, i.e., the TVL in BTC and the staking cap utilization percentage, are rounded to, which is the same for the metrics and the APIs so that the dashboards match the API responses"`
+	MaxStakingTxSize            uint64         `long:"maxstakingtxsize" description:"The maximum serialized size in bytes of an accepted staking tx including the witness data, larger staking txs are rejected as invalid (0 means no limit)"`
+	TagTransitionWindow         uint64         `long:"tagtransitionwindow" description:"The number of blocks around the activation height of a params version within which staking txs carrying the tag of the adjacent version are accepted as well (0 means only the tag of the params version at the tx height is accepted)"`
+	ExclusiveActivationHeight   bool           `long:"exclusiveactivationheight" description:"Whether a params version applies from the height after its activation height instead of from the activation height itself, which disagrees with the global params parser and the rest of the system, e.g., for a deployment counting the activation heights as the last height of the previous version (false means the activation height is inclusive)"`
+	MaxTxsPerBlock              uint64         `long:"maxtxsperblock" description:"The maximum number of txs in a confirmed block, a block exceeding it is not processed and the indexer halts for operator review as the BTC scanner might be feeding absurd blocks (0 means no limit)"`
+	UnbondingConfirmations      uint32         `long:"unbondingconfirmations" description:"The number of confirmations required before an unbonding tx is deducted from the TVL, the active stakes, and the stakes considered by the eligibility of later staking txs, it is pending until then (0 or 1 means deducting the unbonding txs in the unconfirmed blocks from the unconfirmed TVL once included, and a value not higher than the confirmation depth of the global parameters means applying the confirmed unbonding txs once confirmed)"`
+	StakingEventConfirmations   uint32         `long:"stakingeventconfirmations" description:"The number of confirmations required before emitting the staking events (0 or a value not higher than the confirmation depth of the global parameters means emitting once the tx is confirmed)"`
+	UnbondingEventConfirmations uint32         `long:"unbondingeventconfirmations" description:"The number of confirmations required before emitting the unbonding events (0 or a value not higher than the confirmation depth of the global parameters means emitting once the tx is confirmed)"`
+	WithdrawEventConfirmations  uint32         `long:"withdraweventconfirmations" description:"The number of confirmations required before emitting the withdraw events (0 or a value not higher than the confirmation depth of the global parameters means emitting once the tx is confirmed)"`
+	DevModeEnabled              bool           `long:"devmodeenabled" description:"Whether the development only options are allowed, which is refused on mainnet"`
+	DevCovenantQuorum           uint32         `long:"devcovenantquorum" description:"Overrides the covenant quorum of all the params versions, e.g., for testnets with a reduced quorum (0 means using the quorum of the params), requires devmodeenabled"`
+	BackfillChunkSize           uint64         `long:"backfillchunksize" description:"The number of blocks fetched in a chunk when catching up with the BTC tip on startup, a larger chunk uses more memory"`
+	PushTimeout                 time.Duration  `long:"pushtimeout" description:"The timeout of each attempt of a push to the consumer, a push of which all the attempts time out fails as any other failed push (0 means no timeout)"`
+	PushMaxRetries              uint32         `long:"pushmaxretries" description:"The maximum number of retries of a push to the consumer after its attempts time out (0 means failing the push once the first attempt times out)"`
+	PushRetryBackoff            time.Duration  `long:"pushretrybackoff" description:"The backoff before the first retry of a timed out push to the consumer, which is doubled for each of the following retries"`
+	BTCConfig                   *BTCConfig     `group:"btcconfig" namespace:"btcconfig"`
+	DatabaseConfig              *DBConfig      `group:"dbconfig" namespace:"dbconfig"`
+	QueueConfig                 *QueueConfig   `group:"queueconfig" namespace:"queueconfig"`
+	MetricsConfig               *MetricsConfig `group:"metricsconfig" namespace:"metricsconfig"`
 
 	BTCNetParams chaincfg.Params
 }
 
 func DefaultConfigWithHome(homePath string) *Config {
 	cfg := &Config{
-		LogLevel:       defaultLogLevel,
-		BitcoinNetwork: defaultBitcoinNetwork,
-		BTCConfig:      DefaultBTCConfig(),
-		DatabaseConfig: DefaultDBConfigWithHomePath(homePath),
-		QueueConfig:    DefaultQueueConfig(),
-		MetricsConfig:  DefaultMetricsConfig(),
+		LogLevel:               defaultLogLevel,
+		BitcoinNetwork:         defaultBitcoinNetwork,
+		StakingCapPolicy:       StakingCapPolicyReach,
+		ProcessingErrorLogSize: defaultProcessingErrorLogSize,
+		PruneInterval:          defaultPruneInterval,
+		BackfillChunkSize:      defaultBackfillChunkSize,
+		PushTimeout:            defaultPushTimeout,
+		PushMaxRetries:         defaultPushMaxRetries,
+		PushRetryBackoff:       defaultPushRetryBackoff,
+		FloatPrecision:         defaultFloatPrecision,
+		BTCConfig:              DefaultBTCConfig(),
+		DatabaseConfig:         DefaultDBConfigWithHomePath(homePath),
+		QueueConfig:            DefaultQueueConfig(),
+		MetricsConfig:          DefaultMetricsConfig(),
 	}
 
 	if err := cfg.Validate(); err != nil {
@@ -116,6 +206,18 @@ func LoadConfig(homePath string) (*Config, error) {
 	return &cfg, nil
 }
 
+// IsEventFieldExcluded returns whether the given field is omitted from the
+// emitted events
+func (cfg *Config) IsEventFieldExcluded(field string) bool {
+	for _, f := range cfg.ExcludedEventFields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Validate checks the given configuration to be sane. This makes sure no
 // illegal values or combination of values are set. All file system paths are
 // normalized. The cleaned up config is returned on success.
@@ -138,6 +240,75 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("invalid network: %v", cfg.BitcoinNetwork)
 	}
 
+	// an unbonding or withdraw event should not be emitted
+	// earlier than the event of the tx it spends
+	if cfg.StakingEventConfirmations > cfg.UnbondingEventConfirmations ||
+		cfg.UnbondingEventConfirmations > cfg.WithdrawEventConfirmations {
+		return fmt.Errorf("the event confirmations should satisfy staking (%d) <= unbonding (%d) <= withdraw (%d)",
+			cfg.StakingEventConfirmations, cfg.UnbondingEventConfirmations, cfg.WithdrawEventConfirmations)
+	}
+
+	for _, field := range cfg.ExcludedEventFields {
+		if field != EventFieldTxHex && field != EventFieldWitness {
+			return fmt.Errorf("invalid excluded event field: %s", field)
+		}
+	}
+
+	switch cfg.StakingCapPolicy {
+	case "", StakingCapPolicyReach, StakingCapPolicyFill, StakingCapPolicyBelow:
+	default:
+		return fmt.Errorf("invalid staking cap policy: %s", cfg.StakingCapPolicy)
+	}
+
+	switch cfg.EventDeliveryOrdering {
+	case "", EventDeliveryOrderingStrict, EventDeliveryOrderingThroughput:
+	default:
+		return fmt.Errorf("invalid event delivery ordering: %s", cfg.EventDeliveryOrdering)
+	}
+
+	switch cfg.IndexKeyHash {
+	case "", IndexKeyHashNone, IndexKeyHashSha256:
+	default:
+		return fmt.Errorf("invalid index key hash: %s", cfg.IndexKeyHash)
+	}
+
+	if cfg.CapWindow < 0 {
+		return fmt.Errorf("the cap window should not be negative, got %v", cfg.CapWindow)
+	}
+
+	if cfg.CapWarningThreshold > 100 {
+		return fmt.Errorf("the cap warning threshold should be a percentage not higher than 100, got %d", cfg.CapWarningThreshold)
+	}
+
+	if cfg.FloatPrecision > maxFloatPrecision {
+		return fmt.Errorf("the float precision should not be higher than %d, got %d", maxFloatPrecision, cfg.FloatPrecision)
+	}
+
+	if cfg.BackfillChunkSize == 0 {
+		return fmt.Errorf("the backfill chunk size should be positive")
+	}
+
+	if cfg.PushTimeout < 0 {
+		return fmt.Errorf("the push timeout should not be negative, got %v", cfg.PushTimeout)
+	}
+
+	if cfg.PushRetryBackoff < 0 {
+		return fmt.Errorf("the push retry backoff should not be negative, got %v", cfg.PushRetryBackoff)
+	}
+
+	if (cfg.DeadLetterMaxEntries != 0 || cfg.DiagnosticLogRetention != 0) && cfg.PruneInterval <= 0 {
+		return fmt.Errorf("the prune interval should be positive, got %v", cfg.PruneInterval)
+	}
+
+	// the development only options should never be enabled on mainnet
+	// and should not take effect accidentally
+	if cfg.DevModeEnabled && cfg.BitcoinNetwork == "mainnet" {
+		return fmt.Errorf("the dev mode cannot be enabled on mainnet")
+	}
+	if cfg.DevCovenantQuorum != 0 && !cfg.DevModeEnabled {
+		return fmt.Errorf("the covenant quorum override requires the dev mode to be enabled")
+	}
+
 	if err := cfg.DatabaseConfig.Validate(); err != nil {
 		return err
 	}
@@ -1,14 +1,20 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 	"time"
 
 	"github.com/lightningnetwork/lnd/kvdb"
+
+	"github.com/babylonlabs-io/staking-indexer/utils"
 )
 
 const (
-	defaultDbName = "staker.db"
+	defaultDbName         = "staker.db"
+	defaultTxMaxRetries   = 3
+	defaultTxRetryBackoff = 50 * time.Millisecond
 )
 
 type DBConfig struct {
@@ -16,6 +22,11 @@ type DBConfig struct {
 	// stored.
 	DBPath string `long:"dbpath" description:"The directory path in which the database file should be stored."`
 
+	// DataSubDir is an optional subdirectory of DBPath in which the
+	// database file should be stored. It allows multiple indexers, e.g.,
+	// one per bitcoin network, to share the same home directory.
+	DataSubDir string `long:"datasubdir" description:"The optional subdirectory of the DB path in which the database file should be stored."`
+
 	// DBFileName is the name of the database file.
 	DBFileName string `long:"dbfilename" description:"The name of the database file."`
 
@@ -39,6 +50,19 @@ type DBConfig struct {
 	// DBTimeout specifies the timeout value to use when opening the wallet
 	// database.
 	DBTimeout time.Duration `long:"dbtimeout" description:"Specifies the timeout value to use when opening the wallet database."`
+
+	// NoLock, if true, prevents locking the lock file of the database,
+	// which otherwise makes another process opening the same database
+	// fail fast instead of waiting for the database file.
+	NoLock bool `long:"nolock" description:"Prevents locking the lock file next to the database file, which otherwise makes another process opening the same database fail fast, e.g., for file systems not supporting locks."`
+
+	// TxMaxRetries is the maximum number of retries of a write transaction
+	// failing transiently, i.e., failing to begin or commit.
+	TxMaxRetries uint32 `long:"txmaxretries" description:"The maximum number of retries of a write transaction failing transiently, i.e., failing to begin or commit, the error is returned once the retries are exhausted (0 means no retry)."`
+
+	// TxRetryBackoff is the backoff before the first retry of a write
+	// transaction, which doubles after each retry.
+	TxRetryBackoff time.Duration `long:"txretrybackoff" description:"The backoff before the first retry of a write transaction failing transiently, which doubles after each retry."`
 }
 
 func DefaultDBConfig() *DBConfig {
@@ -53,13 +77,15 @@ func DefaultDBConfigWithHomePath(homePath string) *DBConfig {
 		AutoCompact:       false,
 		AutoCompactMinAge: kvdb.DefaultBoltAutoCompactMinAge,
 		DBTimeout:         kvdb.DefaultDBTimeout,
+		TxMaxRetries:      defaultTxMaxRetries,
+		TxRetryBackoff:    defaultTxRetryBackoff,
 	}
 
 }
 
 func (cfg *DBConfig) DBConfigToBoltBackenCondfig() *kvdb.BoltBackendConfig {
 	return &kvdb.BoltBackendConfig{
-		DBPath:            cfg.DBPath,
+		DBPath:            cfg.DBDir(),
 		DBFileName:        cfg.DBFileName,
 		NoFreelistSync:    cfg.NoFreelistSync,
 		AutoCompact:       cfg.AutoCompact,
@@ -76,9 +102,54 @@ func (cfg *DBConfig) Validate() error {
 	if cfg.DBFileName == "" {
 		return fmt.Errorf("DB file name cannot be empty")
 	}
+
+	if filepath.Base(cfg.DBFileName) != cfg.DBFileName {
+		return fmt.Errorf("DB file name %s must not contain a directory", cfg.DBFileName)
+	}
+
+	if cfg.TxRetryBackoff < 0 {
+		return fmt.Errorf("the tx retry backoff should not be negative, got %v", cfg.TxRetryBackoff)
+	}
+
+	if cfg.DataSubDir != "" {
+		if filepath.IsAbs(cfg.DataSubDir) {
+			return fmt.Errorf("data subdirectory %s must be a relative path", cfg.DataSubDir)
+		}
+
+		if !filepath.IsLocal(cfg.DataSubDir) {
+			return fmt.Errorf("data subdirectory %s must be within the DB path", cfg.DataSubDir)
+		}
+	}
+
 	return nil
 }
 
+// DBDir returns the directory in which the database file is stored
+func (cfg *DBConfig) DBDir() string {
+	return filepath.Join(cfg.DBPath, cfg.DataSubDir)
+}
+
+// LockFilePath returns the path of the lock file of the database
+func (cfg *DBConfig) LockFilePath() string {
+	return filepath.Join(cfg.DBDir(), cfg.DBFileName+".lock")
+}
+
+// Lock acquires the lock of the database so that no other process can open
+// it until the lock is released. It returns a nil lock if locking is
+// disabled, which can be unlocked as well
+func (cfg *DBConfig) Lock() (*utils.FileLock, error) {
+	if cfg.NoLock {
+		return nil, nil
+	}
+
+	lock, err := utils.LockFile(cfg.LockFilePath())
+	if errors.Is(err, utils.ErrFileLocked) {
+		return nil, fmt.Errorf("the database in %s is used by another process: %w", cfg.DBDir(), err)
+	}
+
+	return lock, err
+}
+
 func (cfg *DBConfig) GetDbBackend() (kvdb.Backend, error) {
 	return kvdb.GetBoltBackend(cfg.DBConfigToBoltBackenCondfig())
 }
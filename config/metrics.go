@@ -3,17 +3,21 @@ package config
 import (
 	"fmt"
 	"net"
+	"net/url"
 )
 
 const (
 	defaultMetricsPort = 2112
 	defaultMetricsHost = "127.0.0.1"
+	defaultPushJob     = "sid"
 )
 
 // MetricsConfig defines the server's basic configuration
 type MetricsConfig struct {
-	Host string `long:"host" description:"IP of the Prometheus server"`
-	Port int    `long:"port" description:"Port of the Prometheus server"`
+	Host           string `long:"host" description:"IP of the Prometheus server"`
+	Port           int    `long:"port" description:"Port of the Prometheus server"`
+	PushGatewayURL string `long:"pushgatewayurl" description:"The URL of the Prometheus pushgateway the metrics are pushed to once the staking indexer stops, e.g., so that short-lived runs do not lose their final numbers (empty means not pushing)"`
+	PushJob        string `long:"pushjob" description:"The job name of the metrics pushed to the pushgateway"`
 }
 
 func (cfg *MetricsConfig) Validate() error {
@@ -26,6 +30,19 @@ func (cfg *MetricsConfig) Validate() error {
 		return fmt.Errorf("invalid host: %v", cfg.Host)
 	}
 
+	if cfg.PushGatewayURL != "" {
+		u, err := url.Parse(cfg.PushGatewayURL)
+		if err != nil {
+			return fmt.Errorf("invalid pushgateway url: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid pushgateway url scheme: %v", u.Scheme)
+		}
+		if cfg.PushJob == "" {
+			return fmt.Errorf("the push job should be set with the pushgateway url")
+		}
+	}
+
 	return nil
 }
 
@@ -38,7 +55,8 @@ func (cfg *MetricsConfig) Address() (string, error) {
 
 func DefaultMetricsConfig() *MetricsConfig {
 	return &MetricsConfig{
-		Port: defaultMetricsPort,
-		Host: defaultMetricsHost,
+		Port:    defaultMetricsPort,
+		Host:    defaultMetricsHost,
+		PushJob: defaultPushJob,
 	}
 }
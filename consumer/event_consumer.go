@@ -1,7 +1,10 @@
 package consumer
 
 import (
+	"fmt"
+
 	"github.com/babylonlabs-io/staking-queue-client/client"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
 type EventConsumer interface {
@@ -13,3 +16,61 @@ type EventConsumer interface {
 	PushConfirmedInfoEvent(ev *client.ConfirmedInfoEvent) error
 	Stop() error
 }
+
+// BlockEventsConsumer is implemented by the consumers that can receive
+// the events of a confirmed block in a single push
+type BlockEventsConsumer interface {
+	PushBlockEvents(evs *BlockEvents) error
+}
+
+// BlockProcessedConsumer is implemented by the consumers that track their
+// progress by the confirmed blocks that have been fully processed
+type BlockProcessedConsumer interface {
+	PushBlockProcessedEvent(height uint64, hash *chainhash.Hash) error
+}
+
+// BlockEvent is the event of a tx in a confirmed block, exactly
+// one of the events is set
+type BlockEvent struct {
+	StakingEvent   *client.ActiveStakingEvent
+	UnbondingEvent *client.UnbondingStakingEvent
+	WithdrawEvent  *client.WithdrawStakingEvent
+}
+
+// BlockEvents are the events of the txs in a confirmed block in the
+// order they are emitted
+type BlockEvents struct {
+	Height uint64
+	Events []*BlockEvent
+}
+
+// PushEvent pushes the given event by the method of its type
+func PushEvent(c EventConsumer, ev *BlockEvent) error {
+	switch {
+	case ev.StakingEvent != nil:
+		return c.PushStakingEvent(ev.StakingEvent)
+	case ev.UnbondingEvent != nil:
+		return c.PushUnbondingEvent(ev.UnbondingEvent)
+	case ev.WithdrawEvent != nil:
+		return c.PushWithdrawEvent(ev.WithdrawEvent)
+	default:
+		return fmt.Errorf("empty block event")
+	}
+}
+
+// PushBlockEvents pushes the events of a block in a single push if the
+// consumer implements BlockEventsConsumer, otherwise the events are
+// pushed one by one in order
+func PushBlockEvents(c EventConsumer, evs *BlockEvents) error {
+	if bc, ok := c.(BlockEventsConsumer); ok {
+		return bc.PushBlockEvents(evs)
+	}
+
+	for _, ev := range evs.Events {
+		if err := PushEvent(c, ev); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package indexer
+
+import (
+	"time"
+
+	"github.com/babylonlabs-io/networks/parameters/parser"
+	"go.uber.org/zap"
+)
+
+// checkCapWarning logs a warning when the TVL measured against the staking
+// cap of the given params at the given block time, i.e., the confirmed TVL
+// or the one within the cap window, reaches the configured percentage of
+// the cap, so that the operators can react before the staking txs start
+// being overflow. The warning is logged once when the threshold is crossed
+// upward and the TVL dropping below it is logged as well. Note that the
+// crossing is tracked in memory, so the warning is logged again after
+// restart if the TVL is still above the threshold
+func (si *StakingIndexer) checkCapWarning(params *parser.ParsedVersionedGlobalParams, timestamp time.Time) error {
+	// the time-based caps are not related to the TVL
+	if si.cfg.CapWarningThreshold == 0 || params.CapHeight != 0 {
+		return nil
+	}
+
+	capTvl, err := si.getCapTvl(timestamp)
+	if err != nil {
+		return err
+	}
+
+	stakingCap := uint64(params.StakingCap)
+	// the staking cap is bounded by the BTC supply so
+	// the multiplications do not overflow
+	reached := capTvl*100 >= stakingCap*uint64(si.cfg.CapWarningThreshold)
+
+	switch {
+	case reached && !si.capWarningActive:
+		si.logger.Warn("the TVL has reached the warning threshold of the staking cap",
+			zap.Uint64("cap_tvl", capTvl),
+			zap.Uint64("staking_cap", stakingCap),
+			zap.Uint32("threshold_percentage", si.cfg.CapWarningThreshold))
+		stakingCapWarning.Set(1)
+	case !reached && si.capWarningActive:
+		si.logger.Info("the TVL has dropped below the warning threshold of the staking cap",
+			zap.Uint64("cap_tvl", capTvl),
+			zap.Uint64("staking_cap", stakingCap),
+			zap.Uint32("threshold_percentage", si.cfg.CapWarningThreshold))
+		stakingCapWarning.Set(0)
+	}
+	si.capWarningActive = reached
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxInFlightPushes is the maximum number of the events of a confirmed
+// block pushed concurrently if the event delivery ordering is throughput
+const maxInFlightPushes = 16
+
+// pushWithTimeout runs the given push to the consumer within the configured
+// push timeout so that a hanging consumer cannot stall the blocks loop. A
+// timed out attempt is retried up to the configured number of times with a
+// doubling backoff, and the push fails as any other failed push once all the
+// attempts time out. The timed out attempts cannot be cancelled, so they
+// keep running in the background alongside the retries, and the result of
+// whichever attempt returns first is taken. An attempt might therefore be
+// delivered after another one, which the consumers handle as a duplicate
+func (si *StakingIndexer) pushWithTimeout(name string, push func() error) error {
+	if si.cfg.PushTimeout == 0 {
+		return push()
+	}
+
+	// buffered for all the attempts so that the timed out
+	// attempts can return after the push has finished
+	errChan := make(chan error, si.cfg.PushMaxRetries+1)
+	backoff := si.cfg.PushRetryBackoff
+	for attempt := uint32(0); ; attempt++ {
+		go func() {
+			errChan <- push()
+		}()
+
+		timer := time.NewTimer(si.cfg.PushTimeout)
+		select {
+		case err := <-errChan:
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		si.logger.Error("the push to the consumer timed out",
+			zap.String("push", name),
+			zap.Uint32("attempt", attempt+1),
+			zap.Duration("timeout", si.cfg.PushTimeout))
+
+		// record metrics
+		consumerPushTimeoutsCounter.Inc()
+
+		if attempt >= si.cfg.PushMaxRetries {
+			return fmt.Errorf("%w: %s after %d attempts of %v", ErrPushTimeout, name, attempt+1, si.cfg.PushTimeout)
+		}
+
+		// a timed out attempt might still return during the backoff
+		timer = time.NewTimer(backoff)
+		select {
+		case err := <-errChan:
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
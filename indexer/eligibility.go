@@ -0,0 +1,356 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/babylonlabs-io/networks/parameters/parser"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"go.uber.org/zap"
+
+	"github.com/babylonlabs-io/staking-indexer/config"
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+// EligibilityStatus is whether a delegation counts towards the TVL
+type EligibilityStatus string
+
+const (
+	// EligibilityStatusActive the delegation counts towards the TVL
+	EligibilityStatusActive EligibilityStatus = "active"
+	// EligibilityStatusInactive the delegation is turned away, e.g., by the
+	// staking caps
+	EligibilityStatusInactive EligibilityStatus = "inactive"
+)
+
+// DelegationStatus is the status of a delegation in its lifecycle, every
+// delegation has exactly one status
+type DelegationStatus string
+
+const (
+	// DelegationStatusActive the delegation is staked and not overflow
+	DelegationStatusActive DelegationStatus = "active"
+	// DelegationStatusInactive the delegation is staked and overflow
+	DelegationStatusInactive DelegationStatus = "inactive"
+	// DelegationStatusUnbonding the delegation is spent by an applied
+	// unbonding tx and not withdrawn yet, whether overflow or not
+	DelegationStatusUnbonding DelegationStatus = "unbonding"
+	// DelegationStatusWithdrawn the delegation is withdrawn from the
+	// staking or unbonding tx, whether overflow or not
+	DelegationStatusWithdrawn DelegationStatus = "withdrawn"
+)
+
+// getDelegationStatus returns the lifecycle status of the given stored
+// staking tx
+func getDelegationStatus(stakingTx *indexerstore.StoredStakingTransaction) (DelegationStatus, error) {
+	switch stakingTx.Status {
+	case indexerstore.StakingStatusStaked:
+		if stakingTx.IsOverflow {
+			return DelegationStatusInactive, nil
+		}
+		return DelegationStatusActive, nil
+	case indexerstore.StakingStatusUnbonding:
+		return DelegationStatusUnbonding, nil
+	case indexerstore.StakingStatusWithdrawn:
+		return DelegationStatusWithdrawn, nil
+	default:
+		return "", fmt.Errorf("unknown staking status %d of the staking tx %s",
+			stakingTx.Status, stakingTx.Tx.TxHash().String())
+	}
+}
+
+// EligibilityCounts is the number of the delegations that count towards
+// the TVL and of those turned away by the staking caps
+type EligibilityCounts struct {
+	Active   int
+	Inactive int
+	// InactiveByReason is the number of the inactive delegations per
+	// inactive reason
+	InactiveByReason map[indexerstore.InactiveReason]int
+}
+
+// GetEligibilityCounts returns the current number of the active and
+// inactive delegations in the store
+func (si *StakingIndexer) GetEligibilityCounts() (*EligibilityCounts, error) {
+	countsByReason, err := si.is.GetStakingTxCountsByInactiveReason()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count staking txs by inactive reason: %w", err)
+	}
+
+	counts := &EligibilityCounts{
+		InactiveByReason: make(map[indexerstore.InactiveReason]int),
+	}
+	for reason, count := range countsByReason {
+		if reason == indexerstore.InactiveReasonNone {
+			counts.Active += count
+			continue
+		}
+		counts.Inactive += count
+		counts.InactiveByReason[reason] = count
+	}
+
+	// record metrics
+	delegationsByEligibility.WithLabelValues(string(EligibilityStatusActive)).Set(float64(counts.Active))
+	delegationsByEligibility.WithLabelValues(string(EligibilityStatusInactive)).Set(float64(counts.Inactive))
+	for _, reason := range []indexerstore.InactiveReason{
+		indexerstore.InactiveReasonStakingCap,
+		indexerstore.InactiveReasonPerStakerCap,
+		indexerstore.InactiveReasonManual,
+		indexerstore.InactiveReasonPerFinalityProviderCap,
+	} {
+		inactiveDelegationsByReason.WithLabelValues(reason.String()).Set(float64(counts.InactiveByReason[reason]))
+	}
+
+	return counts, nil
+}
+
+// OverrideEligibility manually marks the staking tx of the given hash as
+// eligible, i.e., counting towards the TVL, or as ineligible for the given
+// reason, e.g., for incident response. The reason must be
+// InactiveReasonNone if and only if the staking tx is marked as eligible.
+// The overridden eligibility is kept when the staking tx is processed again
+func (si *StakingIndexer) OverrideEligibility(
+	txHash *chainhash.Hash,
+	eligible bool,
+	reason indexerstore.InactiveReason,
+) error {
+	if eligible != (reason == indexerstore.InactiveReasonNone) {
+		return fmt.Errorf("%w: eligible %v with inactive reason %s",
+			ErrInvalidEligibilityOverride, eligible, reason)
+	}
+
+	previous, err := si.is.OverrideEligibility(txHash, !eligible, reason, time.Now().Unix())
+	if err != nil {
+		if errors.Is(err, indexerstore.ErrTransactionNotFound) {
+			return fmt.Errorf("%w: %s", ErrStakingTxNotFound, txHash.String())
+		}
+		return fmt.Errorf("failed to override the eligibility of the staking tx: %w", err)
+	}
+
+	si.logger.Warn("the eligibility of the staking tx is manually overridden",
+		zap.String("tx_hash", txHash.String()),
+		zap.Bool("previous_eligible", !previous.IsOverflow),
+		zap.String("previous_inactive_reason", previous.InactiveReason.String()),
+		zap.Bool("previously_overridden", previous.EligibilityOverridden),
+		zap.Bool("eligible", eligible),
+		zap.String("inactive_reason", reason.String()),
+	)
+
+	// the counts are refreshed from the store as the override
+	// might move a staking tx between the eligibility gauges
+	if _, err := si.GetEligibilityCounts(); err != nil {
+		si.logger.Warn("failed to get the eligibility counts", zap.Error(err))
+	}
+
+	return nil
+}
+
+// GetStakerDelegationsByStatus returns the delegations of the given staker
+// with the given lifecycle status, e.g., for a wallet to show only the
+// active delegations of a user. The statuses partition the delegations, so
+// every delegation of the staker is returned for exactly one status. Note
+// that a delegation withdrawn after its time lock expires without being
+// unbonded still counts towards the TVL and the active stakes, as only the
+// unbonding removes the stake, though it is no longer active
+func (si *StakingIndexer) GetStakerDelegationsByStatus(
+	stakerPk *btcec.PublicKey,
+	status DelegationStatus,
+) ([]*indexerstore.StoredStakingTransaction, error) {
+	switch status {
+	case DelegationStatusActive, DelegationStatusInactive,
+		DelegationStatusUnbonding, DelegationStatusWithdrawn:
+	default:
+		return nil, fmt.Errorf("unknown delegation status: %s", status)
+	}
+
+	stakingTxs, err := si.is.GetStakingTransactionsByStaker(stakerPk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the staking txs of the staker: %w", err)
+	}
+
+	delegations := make([]*indexerstore.StoredStakingTransaction, 0, len(stakingTxs))
+	for _, stakingTx := range stakingTxs {
+		txStatus, err := getDelegationStatus(stakingTx)
+		if err != nil {
+			return nil, err
+		}
+		if txStatus == status {
+			delegations = append(delegations, stakingTx)
+		}
+	}
+
+	return delegations, nil
+}
+
+// GetStakerDelegationCount returns the number of the delegations of the
+// given staker regardless of their status, e.g., for a wallet to show the
+// number of delegations of a user without loading them
+func (si *StakingIndexer) GetStakerDelegationCount(stakerPk *btcec.PublicKey) (int, error) {
+	return si.is.GetStakerDelegationCount(stakerPk)
+}
+
+// recordEligibility updates the eligibility metrics with a newly stored
+// staking tx of the given inactive reason
+func recordEligibility(isOverflow bool, inactiveReason indexerstore.InactiveReason) {
+	if !isOverflow {
+		delegationsByEligibility.WithLabelValues(string(EligibilityStatusActive)).Inc()
+		return
+	}
+
+	delegationsByEligibility.WithLabelValues(string(EligibilityStatusInactive)).Inc()
+	inactiveDelegationsByReason.WithLabelValues(inactiveReason.String()).Inc()
+}
+
+// getNextTvlCappedParams returns the params version of the next block to
+// process and the time of the last processed block, or ErrTimeBasedCap if
+// the params version caps the staking by height rather than by the TVL.
+// The time is the current time if no block has been processed or the
+// header of the last processed block has not been stored
+func (si *StakingIndexer) getNextTvlCappedParams() (*parser.ParsedVersionedGlobalParams, time.Time, error) {
+	height := si.paramsVersions.Versions[0].ActivationHeight
+	timestamp := time.Now()
+	lastProcessedHeight, err := si.is.GetLastProcessedHeight()
+	if err != nil && !errors.Is(err, indexerstore.ErrLastProcessedHeightNotFound) {
+		return nil, time.Time{}, fmt.Errorf("failed to get the last processed height: %w", err)
+	}
+	if err == nil {
+		height = lastProcessedHeight + 1
+
+		header, err := si.is.GetProcessedHeader(lastProcessedHeight)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to get the processed header at height %d: %w",
+				lastProcessedHeight, err)
+		}
+		if header != nil {
+			timestamp = header.Timestamp
+		}
+	}
+
+	params, err := si.getTvlCappedParams(height)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return params, timestamp, nil
+}
+
+// getTvlCappedParams returns the params version of the given height, or
+// ErrTimeBasedCap if the params version caps the staking by height rather
+// than by the TVL
+func (si *StakingIndexer) getTvlCappedParams(height uint64) (*parser.ParsedVersionedGlobalParams, error) {
+	params, err := si.getVersionedParams(height)
+	if err != nil {
+		return nil, err
+	}
+	if params.CapHeight != 0 {
+		return nil, fmt.Errorf("%w: the params version %d caps the staking at height %d",
+			ErrTimeBasedCap, params.Version, params.CapHeight)
+	}
+
+	return params, nil
+}
+
+// UnboundedRemainingCap is the remaining staking capacity returned under
+// the reach policy before the cap is reached, as a staking tx of any value
+// is active as long as the TVL before it is below the cap
+const UnboundedRemainingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+// GetRemainingCap returns the staking capacity remaining under the staking
+// cap of the params version of the next block to process, i.e., the largest
+// staking value a staking tx included in the next block can have to be
+// active under the configured staking cap policy, e.g., for a wallet to show
+// the remaining capacity. The TVL is measured as for the eligibility of the
+// staking txs, with the cap window anchored at the time of the last
+// processed block. The remaining capacity is
+//   - UnboundedRemainingCap under the reach policy if the TVL is below the
+//     cap, and 0 otherwise
+//   - the cap minus the TVL under the fill policy, floored at 0
+//   - the cap minus the TVL minus 1 under the below policy, floored at 0
+//
+// It returns ErrTimeBasedCap if the params version caps the staking by height
+func (si *StakingIndexer) GetRemainingCap() (btcutil.Amount, error) {
+	params, timestamp, err := si.getNextTvlCappedParams()
+	if err != nil {
+		return 0, err
+	}
+
+	tvl, err := si.getCapTvl(timestamp)
+	if err != nil {
+		return 0, err
+	}
+	capTvl, err := utils.AmountFromUint64(tvl)
+	if err != nil {
+		return 0, err
+	}
+
+	// the TVL might exceed the cap under the reach policy
+	if capTvl >= params.StakingCap {
+		return 0, nil
+	}
+
+	switch si.cfg.StakingCapPolicy {
+	case config.StakingCapPolicyFill:
+		return params.StakingCap - capTvl, nil
+	case config.StakingCapPolicyBelow:
+		// the tx reaching the cap is not active under the below policy
+		return params.StakingCap - capTvl - 1, nil
+	default:
+		return UnboundedRemainingCap, nil
+	}
+}
+
+// capUtilization returns the percentage of the staking cap of the given
+// params used by the TVL measured against the cap at the given time, which
+// might exceed 100 as the TVL might exceed the cap under the reach policy
+func (si *StakingIndexer) capUtilization(params *parser.ParsedVersionedGlobalParams, timestamp time.Time) (float64, error) {
+	capTvl, err := si.getCapTvl(timestamp)
+	if err != nil {
+		return 0, err
+	}
+
+	return si.roundFloat(float64(capTvl) / float64(params.StakingCap) * 100), nil
+}
+
+// updateCapUtilization updates the metric of the staking cap utilization
+// of the given params at the given block time, the time-based caps are not
+// related to the TVL
+func (si *StakingIndexer) updateCapUtilization(params *parser.ParsedVersionedGlobalParams, timestamp time.Time) error {
+	if params.CapHeight != 0 {
+		return nil
+	}
+
+	utilization, err := si.capUtilization(params, timestamp)
+	if err != nil {
+		return err
+	}
+	stakingCapUtilization.Set(utilization)
+
+	return nil
+}
+
+// GetCapUtilization returns the percentage of the staking cap of the params
+// version of the last processed block used by the TVL measured against the
+// cap now, rounded to the configured precision as the metric of it, which is
+// updated with the same params version. It returns ErrTimeBasedCap if the
+// params version caps the staking by height
+func (si *StakingIndexer) GetCapUtilization() (float64, error) {
+	height := si.paramsVersions.Versions[0].ActivationHeight
+	lastProcessedHeight, err := si.is.GetLastProcessedHeight()
+	if err != nil && !errors.Is(err, indexerstore.ErrLastProcessedHeightNotFound) {
+		return 0, fmt.Errorf("failed to get the last processed height: %w", err)
+	}
+	if err == nil {
+		height = lastProcessedHeight
+	}
+
+	params, err := si.getTvlCappedParams(height)
+	if err != nil {
+		return 0, err
+	}
+
+	return si.capUtilization(params, time.Now())
+}
@@ -6,9 +6,48 @@ var (
 	// ErrInvalidUnbondingTx the transaction spends the unbonding path but is invalid
 	ErrInvalidUnbondingTx = errors.New("invalid unbonding tx")
 
+	// ErrUnbondingTxFlagged the unbonding transaction is flagged by a validator but still applied as it spends the staking transaction on BTC
+	ErrUnbondingTxFlagged = errors.New("unbonding tx flagged by a validator")
+
 	// ErrInvalidStakingTx the stake transaction is invalid as it does not follow the global parameters
 	ErrInvalidStakingTx = errors.New("invalid staking tx")
 
 	// ErrInvalidWithdrawalTx the withdrawal transaction is invalid as it does not unlock the expected time lock path
 	ErrInvalidWithdrawalTx = errors.New("invalid withdrawal tx")
+
+	// ErrNotStakingTx the transaction does not carry the staking tag
+	ErrNotStakingTx = errors.New("not staking tx")
+
+	// ErrUnparseableStakingTx the transaction carries the staking tag but cannot be parsed
+	ErrUnparseableStakingTx = errors.New("unparseable staking tx")
+
+	// ErrNoMatchingStakingOutput the transaction carries a well-formed op return but none of its outputs is the staking output built from the params
+	ErrNoMatchingStakingOutput = errors.New("no staking output matches the params")
+
+	// ErrInvalidStakingAddress the address is not a valid address of the configured network
+	ErrInvalidStakingAddress = errors.New("invalid staking address")
+
+	// ErrStakingTxNotFound the staking transaction is not found in the store
+	ErrStakingTxNotFound = errors.New("staking tx not found")
+
+	// ErrOutOfOrderBlock the confirmed block is not higher than the last handled block
+	ErrOutOfOrderBlock = errors.New("out of order block")
+
+	// ErrInvalidEligibilityOverride the inactive reason does not match the overridden eligibility
+	ErrInvalidEligibilityOverride = errors.New("invalid eligibility override")
+
+	// ErrTimeBasedCap the params version caps the staking by height instead of by amount
+	ErrTimeBasedCap = errors.New("time-based staking cap")
+
+	// ErrParamsHeightMismatch the params version does not apply to the height of the transaction
+	ErrParamsHeightMismatch = errors.New("params version does not apply to the height")
+
+	// ErrPushTimeout none of the attempts of the push to the consumer returns within the configured timeout
+	ErrPushTimeout = errors.New("consumer push timeout")
+
+	// ErrReorgDetected the confirmed block does not extend the processed blocks
+	ErrReorgDetected = errors.New("reorg detected")
+
+	// ErrTooManyTxs the confirmed block has more txs than the configured maximum
+	ErrTooManyTxs = errors.New("too many txs in block")
 )
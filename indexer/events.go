@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"encoding/hex"
+
+	queuecli "github.com/babylonlabs-io/staking-queue-client/client"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/babylonlabs-io/staking-indexer/consumer"
+)
+
+// the event builders are shared by the processing of the txs and the replay
+// of the events from the store so that the replayed events are the same as
+// the ones pushed when the txs are processed
+
+// newStakingEvent builds the event of the given staking tx included at the
+// given height and unix timestamp
+func (si *StakingIndexer) newStakingEvent(
+	tx *wire.MsgTx,
+	height uint64,
+	timestamp int64,
+	stakerPk *btcec.PublicKey,
+	fpPk *btcec.PublicKey,
+	stakingValue uint64,
+	stakingTime uint32,
+	stakingOutputIndex uint32,
+	isOverflow bool,
+) (*consumer.BlockEvent, error) {
+	txHex, err := si.getEventTxHex(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	stakingEvent := queuecli.NewActiveStakingEvent(
+		tx.TxHash().String(),
+		hex.EncodeToString(schnorr.SerializePubKey(stakerPk)),
+		hex.EncodeToString(schnorr.SerializePubKey(fpPk)),
+		stakingValue,
+		height,
+		timestamp,
+		uint64(stakingTime),
+		uint64(stakingOutputIndex),
+		txHex,
+		isOverflow,
+	)
+
+	return &consumer.BlockEvent{StakingEvent: &stakingEvent}, nil
+}
+
+// newUnbondingEvent builds the event of the given unbonding tx spending the
+// staking tx of the given hash, included at the given height and unix
+// timestamp
+func (si *StakingIndexer) newUnbondingEvent(
+	tx *wire.MsgTx,
+	stakingTxHash *chainhash.Hash,
+	height uint64,
+	timestamp int64,
+	unbondingTime uint16,
+) (*consumer.BlockEvent, error) {
+	txHex, err := si.getEventTxHex(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	unbondingEvent := queuecli.NewUnbondingStakingEvent(
+		stakingTxHash.String(),
+		height,
+		timestamp,
+		uint64(unbondingTime),
+		// valid unbonding tx always has one output
+		0,
+		txHex,
+		tx.TxHash().String(),
+	)
+
+	return &consumer.BlockEvent{UnbondingEvent: &unbondingEvent}, nil
+}
+
+// newWithdrawEvent builds the event of the withdrawal of the staking tx of
+// the given hash
+func newWithdrawEvent(stakingTxHash *chainhash.Hash) *consumer.BlockEvent {
+	withdrawEvent := queuecli.NewWithdrawStakingEvent(stakingTxHash.String())
+
+	return &consumer.BlockEvent{WithdrawEvent: &withdrawEvent}
+}
@@ -0,0 +1,64 @@
+package indexer
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"strconv"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+)
+
+// csvHeader is the header row of the delegations exported as CSV
+var csvHeader = []string{
+	"staking_tx_hash",
+	"staker_pk",
+	"finality_provider_pk",
+	"staking_value",
+	"staking_time",
+	"inclusion_height",
+	"status",
+	"unbonded",
+	"withdrawn",
+}
+
+// ExportCSV writes all the delegations to the given writer as CSV with a
+// header row followed by one row per delegation in the order of the staking
+// tx hashes, e.g., for analysts using spreadsheets. The status is the
+// eligibility status of the delegation, i.e., active or inactive. A
+// delegation of which the unbonding is pending is not unbonded until the
+// unbonding is applied, in line with its stake counted towards the TVL
+func (si *StakingIndexer) ExportCSV(w io.Writer) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(csvHeader); err != nil {
+		return err
+	}
+
+	err := si.is.ForEachStakingTransaction(func(storedTx *indexerstore.StoredStakingTransaction, isUnbonded bool) error {
+		status := EligibilityStatusActive
+		if storedTx.IsOverflow {
+			status = EligibilityStatusInactive
+		}
+
+		return csvWriter.Write([]string{
+			storedTx.Tx.TxHash().String(),
+			hex.EncodeToString(schnorr.SerializePubKey(storedTx.StakerPk)),
+			hex.EncodeToString(schnorr.SerializePubKey(storedTx.FinalityProviderPk)),
+			strconv.FormatUint(storedTx.StakingValue, 10),
+			strconv.FormatUint(uint64(storedTx.StakingTime), 10),
+			strconv.FormatUint(storedTx.InclusionHeight, 10),
+			string(status),
+			strconv.FormatBool(isUnbonded),
+			strconv.FormatBool(storedTx.Status == indexerstore.StakingStatusWithdrawn),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
@@ -0,0 +1,67 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+	"github.com/babylonlabs-io/staking-indexer/types"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+// storeInclusionProofs stores the merkle inclusion proofs of the staking and
+// unbonding txs stored from the given block. The txs of the block should be
+// all the txs in the order of the block
+func (si *StakingIndexer) storeInclusionProofs(b *types.IndexedBlock) error {
+	stakingTxHashes, unbondingTxHashes, err := si.is.GetBlockTxHashes(uint64(b.Height))
+	if err != nil {
+		return fmt.Errorf("failed to get the txs of the block: %w", err)
+	}
+	if len(stakingTxHashes) == 0 && len(unbondingTxHashes) == 0 {
+		return nil
+	}
+
+	merkleTree := blockchain.BuildMerkleTreeStore(b.Txs, false)
+	if merkleRoot := merkleTree[len(merkleTree)-1]; !merkleRoot.IsEqual(&b.Header.MerkleRoot) {
+		return fmt.Errorf("the merkle root %s of the txs does not match the block header %s",
+			merkleRoot.String(), b.Header.MerkleRoot.String())
+	}
+
+	txIndexes := make(map[chainhash.Hash]int, len(b.Txs))
+	for i, tx := range b.Txs {
+		txIndexes[*tx.Hash()] = i
+	}
+
+	for _, txHash := range append(stakingTxHashes, unbondingTxHashes...) {
+		idx, ok := txIndexes[*txHash]
+		if !ok {
+			return fmt.Errorf("the tx %s is not found in the block", txHash.String())
+		}
+
+		merkleNodes, err := utils.MerkleBranch(merkleTree, len(b.Txs), idx)
+		if err != nil {
+			return err
+		}
+
+		if err := si.is.AddInclusionProof(txHash, &indexerstore.StoredInclusionProof{
+			BlockHeader: b.Header,
+			Height:      uint64(b.Height),
+			TxIndex:     uint32(idx),
+			MerkleNodes: merkleNodes,
+		}); err != nil {
+			return fmt.Errorf("failed to add the inclusion proof of the tx %s: %w", txHash.String(), err)
+		}
+	}
+
+	return nil
+}
+
+// GetInclusionProof returns the merkle inclusion proof of the staking or
+// unbonding tx of the given hash within its block, e.g., for light-client
+// consumers. It returns nil if the proof is not stored, which is always
+// the case if storing the proofs is not enabled
+func (si *StakingIndexer) GetInclusionProof(txHash *chainhash.Hash) (*indexerstore.StoredInclusionProof, error) {
+	return si.is.GetInclusionProof(txHash)
+}
@@ -2,9 +2,12 @@ package indexer
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,22 +15,27 @@ import (
 	"github.com/babylonlabs-io/networks/parameters/parser"
 	queuecli "github.com/babylonlabs-io/staking-queue-client/client"
 	"github.com/btcsuite/btcd/btcec/v2"
-	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/lightningnetwork/lnd/kvdb"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/babylonlabs-io/staking-indexer/btcscanner"
 	"github.com/babylonlabs-io/staking-indexer/config"
 	"github.com/babylonlabs-io/staking-indexer/consumer"
 	"github.com/babylonlabs-io/staking-indexer/indexerstore"
 	"github.com/babylonlabs-io/staking-indexer/types"
+	"github.com/babylonlabs-io/staking-indexer/utils"
 )
 
 type StakingIndexer struct {
-	startOnce sync.Once
+	// isStarted is never reset so that the indexer cannot be
+	// started again after it is stopped
+	isStarted *atomic.Bool
 	stopOnce  sync.Once
 
 	consumer       consumer.EventConsumer
@@ -40,6 +48,39 @@ type StakingIndexer struct {
 
 	btcScanner btcscanner.BtcScanner
 
+	// nextBlockHeight is the lowest height of the confirmed block that is
+	// accepted by the blocks event loop, which ensures blocks are handled
+	// in a strictly increasing order
+	nextBlockHeight uint64
+
+	// pendingEventSeq is the sequence number of the next event held back
+	// among the events of the txs in the confirmed block being handled
+	pendingEventSeq uint32
+
+	// blockEvents are the events of the confirmed block being handled,
+	// which are pushed in batch once the block is handled. It is nil
+	// if the events are not pushed in batch
+	blockEvents *consumer.BlockEvents
+
+	// inFlightPushes are the concurrent pushes of the events of the
+	// confirmed block being handled, which are done before the block is
+	// saved as processed. It is nil if the events are pushed in order
+	inFlightPushes *errgroup.Group
+
+	// scoreFunc computes the score of new staking txs
+	scoreFunc ScoreFunc
+
+	// validators are run on the new staking and unbonding txs after
+	// the built-in checks
+	validators []Validator
+
+	// capWarningActive is whether the confirmed TVL has reached the cap
+	// warning threshold, so that the warning is logged once per crossing
+	capWarningActive bool
+
+	// cancelLoops stops the loops started by the last successful start
+	cancelLoops context.CancelFunc
+
 	wg   sync.WaitGroup
 	quit chan struct{}
 }
@@ -52,48 +93,142 @@ func NewStakingIndexer(
 	paramsVersions *parser.ParsedGlobalParams,
 	btcScanner btcscanner.BtcScanner,
 ) (*StakingIndexer, error) {
+	if err := validateCovenantQuorumOverride(cfg, paramsVersions); err != nil {
+		return nil, err
+	}
+
 	is, err := indexerstore.NewIndexerStore(db)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initiate staking indexer store: %w", err)
 	}
+	is.SetDbTxRetry(cfg.DatabaseConfig.TxMaxRetries, cfg.DatabaseConfig.TxRetryBackoff)
+
+	indexKeyHash := indexerstore.IndexKeyHashNone
+	if cfg.IndexKeyHash != "" {
+		indexKeyHash = indexerstore.IndexKeyHash(cfg.IndexKeyHash)
+	}
+	if err := is.SetIndexKeyHash(indexKeyHash); err != nil {
+		return nil, fmt.Errorf("failed to set the index key hash: %w", err)
+	}
+
+	return newStakingIndexer(cfg, logger, consumer, is, paramsVersions, btcScanner), nil
+}
+
+func newStakingIndexer(
+	cfg *config.Config,
+	logger *zap.Logger,
+	consumer consumer.EventConsumer,
+	is *indexerstore.IndexerStore,
+	paramsVersions *parser.ParsedGlobalParams,
+	btcScanner btcscanner.BtcScanner,
+) *StakingIndexer {
+	logger = logger.With(zap.String("module", "staking indexer"))
+	if cfg.DevModeEnabled && cfg.DevCovenantQuorum != 0 {
+		logger.Warn("the covenant quorum of the params is overridden for development",
+			zap.Uint32("covenant_quorum", cfg.DevCovenantQuorum))
+	}
+	if cfg.ExclusiveActivationHeight {
+		logger.Warn("the params versions apply from the height after their activation heights")
+		paramsVersions = shiftActivationHeights(paramsVersions)
+	}
 
 	return &StakingIndexer{
 		cfg:            cfg,
-		logger:         logger.With(zap.String("module", "staking indexer")),
+		logger:         logger,
 		consumer:       consumer,
 		is:             is,
 		paramsVersions: paramsVersions,
 		btcScanner:     btcScanner,
+		scoreFunc:      DefaultScoreFunc,
+		isStarted:      atomic.NewBool(false),
 		quit:           make(chan struct{}),
-	}, nil
+	}
 }
 
 // Start starts the staking indexer core
 func (si *StakingIndexer) Start(startHeight uint64) error {
-	var startErr error
-	si.startOnce.Do(func() {
-		si.logger.Info("Starting Staking Indexer App")
+	return si.StartWithContext(context.Background(), startHeight)
+}
 
+// StartWithContext starts the staking indexer core. The startup is aborted
+// if the given context is cancelled before the BTC scanner is started, in
+// which case the scanner is stopped and its start is waited for before
+// returning, and the blocks event loop exits once the context is cancelled.
+// An error is returned if the indexer has been started before. The indexer
+// is left stopped if the start fails, so that it can be started again
+func (si *StakingIndexer) StartWithContext(ctx context.Context, startHeight uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := si.ValidateStartHeight(startHeight); err != nil {
+		return fmt.Errorf("invalid start height %d: %w", startHeight, err)
+	}
+
+	if si.isStarted.Swap(true) {
+		return fmt.Errorf("the staking indexer is already started")
+	}
+
+	si.logger.Info("Starting Staking Indexer App")
+
+	si.nextBlockHeight = startHeight
+
+	// the loops are stopped if the start fails so that
+	// the indexer can be started again
+	loopCtx, cancelLoops := context.WithCancel(ctx)
+	abortStart := func() {
+		cancelLoops()
+		si.wg.Wait()
+		si.isStarted.Store(false)
+	}
+
+	si.wg.Add(1)
+	go si.blocksEventLoop(loopCtx)
+
+	if si.pruningEnabled() {
 		si.wg.Add(1)
-		go si.blocksEventLoop()
+		go si.pruneLoop(loopCtx)
+	}
 
-		if err := si.ValidateStartHeight(startHeight); err != nil {
-			startErr = fmt.Errorf("invalid start height %d: %w", startHeight, err)
-			return
-		}
+	// starting the BTC scanner might take long as it waits
+	// for the activation height and bootstraps
+	scannerStartErrChan := make(chan error, 1)
+	go func() {
+		scannerStartErrChan <- si.btcScanner.Start(startHeight, si.paramsVersions.Versions[0].ActivationHeight)
+	}()
 
-		if err := si.btcScanner.Start(startHeight, si.paramsVersions.Versions[0].ActivationHeight); err != nil {
-			startErr = err
-			return
+	select {
+	case err := <-scannerStartErrChan:
+		if err != nil {
+			abortStart()
+			return err
+		}
+	case <-ctx.Done():
+		si.logger.Info("the start of the Staking Indexer App is cancelled")
+		if err := si.btcScanner.Stop(); err != nil {
+			si.logger.Error("failed to stop the BTC scanner", zap.Error(err))
+		}
+		// the scanner returns from the start once it is stopped
+		if err := <-scannerStartErrChan; err != nil {
+			si.logger.Info("the BTC scanner stops starting", zap.Error(err))
 		}
+		abortStart()
+		return ctx.Err()
+	}
 
-		// record metrics
-		startBtcHeight.Set(float64(startHeight))
+	si.cancelLoops = cancelLoops
 
-		si.logger.Info("Staking Indexer App is successfully started!")
-	})
+	// record metrics
+	startBtcHeight.Set(float64(startHeight))
+	if _, err := si.GetEligibilityCounts(); err != nil {
+		si.logger.Warn("failed to get the eligibility counts", zap.Error(err))
+	}
+
+	si.logStartupSummary(startHeight)
 
-	return startErr
+	si.logger.Info("Staking Indexer App is successfully started!")
+
+	return nil
 }
 
 // ValidateStartHeight validates the given startHeight and returns an error
@@ -132,7 +267,7 @@ func (si *StakingIndexer) GetStartHeight() uint64 {
 	return lastProcessedHeight + 1
 }
 
-func (si *StakingIndexer) blocksEventLoop() {
+func (si *StakingIndexer) blocksEventLoop(ctx context.Context) {
 	defer si.wg.Done()
 
 	for {
@@ -143,12 +278,34 @@ func (si *StakingIndexer) blocksEventLoop() {
 				si.logger.Info("received confirmed block",
 					zap.Int32("height", block.Height))
 
+				if err := si.checkBlockOrder(uint64(block.Height)); err != nil {
+					// the block has been handled, reject it
+					// rather than re-indexing it
+					si.logger.Error("rejected confirmed block",
+						zap.Int32("height", block.Height),
+						zap.Error(err))
+
+					outOfOrderBlocksCounter.Inc()
+					continue
+				}
+
 				if err := si.HandleConfirmedBlock(block); err != nil {
 					// this indicates systematic failure
 					si.logger.Fatal("failed to handle block",
 						zap.Int32("height", block.Height),
 						zap.Error(err))
 				}
+
+				si.nextBlockHeight = uint64(block.Height) + 1
+			}
+
+			if tipHeight, ok := getTipHeight(update); ok {
+				if err := si.emitPendingEvents(tipHeight); err != nil {
+					// this indicates systematic failure
+					si.logger.Fatal("failed to emit pending events",
+						zap.Uint64("tip_height", tipHeight),
+						zap.Error(err))
+				}
 			}
 
 			if err := si.processUnconfirmedInfo(update.UnconfirmedBlocks); err != nil {
@@ -158,6 +315,10 @@ func (si *StakingIndexer) blocksEventLoop() {
 				failedProcessingUnconfirmedBlockCounter.Inc()
 			}
 
+		case <-ctx.Done():
+			si.logger.Info("closing the confirmed blocks loop as the context is cancelled")
+			return
+
 		case <-si.quit:
 			si.logger.Info("closing the confirmed blocks loop")
 			return
@@ -165,6 +326,52 @@ func (si *StakingIndexer) blocksEventLoop() {
 	}
 }
 
+// getTipHeight returns the height of the highest block in the given update
+func getTipHeight(update *btcscanner.ChainUpdateInfo) (uint64, bool) {
+	if len(update.UnconfirmedBlocks) != 0 {
+		return uint64(update.UnconfirmedBlocks[len(update.UnconfirmedBlocks)-1].Height), true
+	}
+
+	if len(update.ConfirmedBlocks) != 0 {
+		return uint64(update.ConfirmedBlocks[len(update.ConfirmedBlocks)-1].Height), true
+	}
+
+	return 0, false
+}
+
+// checkBlockOrder returns an error if the confirmed block at the given height
+// is lower than the height of the next expected block, i.e., the block is
+// delivered out of order
+func (si *StakingIndexer) checkBlockOrder(height uint64) error {
+	if height < si.nextBlockHeight {
+		return fmt.Errorf("%w: got block at height %d, expected height not lower than %d",
+			ErrOutOfOrderBlock, height, si.nextBlockHeight)
+	}
+
+	return nil
+}
+
+// checkBlockTxCount returns an error if the confirmed block has more txs
+// than the configured maximum, which halts the indexer for operator review
+// instead of processing the block
+func (si *StakingIndexer) checkBlockTxCount(b *types.IndexedBlock) error {
+	maxTxs := si.cfg.MaxTxsPerBlock
+	if maxTxs == 0 || uint64(len(b.Txs)) <= maxTxs {
+		return nil
+	}
+
+	si.logger.Error("the confirmed block has too many txs, halting for operator review",
+		zap.Int32("height", b.Height),
+		zap.Int("tx_count", len(b.Txs)),
+		zap.Uint64("max_txs_per_block", maxTxs))
+
+	// record metrics
+	oversizedBlocksCounter.Inc()
+
+	return fmt.Errorf("%w: got %d txs in the block at height %d, expected at most %d",
+		ErrTooManyTxs, len(b.Txs), b.Height, maxTxs)
+}
+
 // processUnconfirmedInfo processes information from given unconfirmed blocks
 // It follows the steps below:
 // 1. iterate all txs of each unconfirmed block to identify staking and unbonding transactions,
@@ -195,7 +402,14 @@ func (si *StakingIndexer) processUnconfirmedInfo(unconfirmedBlocks []*types.Inde
 		return fmt.Errorf("failed to get the confirmed TVL: %w", err)
 	}
 
-	unconfirmedTvl := btcutil.Amount(confirmedTvl) + tvlInUnconfirmedBlocks
+	confirmedTvlAmount, err := utils.AmountFromUint64(confirmedTvl)
+	if err != nil {
+		return fmt.Errorf("invalid confirmed TVL: %w", err)
+	}
+	unconfirmedTvl, err := utils.AddAmounts(confirmedTvlAmount, tvlInUnconfirmedBlocks)
+	if err != nil {
+		return fmt.Errorf("failed to calculate unconfirmed tvl: %w", err)
+	}
 	if unconfirmedTvl < 0 {
 		return fmt.Errorf("total tvl %d is negative", unconfirmedTvl)
 	}
@@ -207,18 +421,50 @@ func (si *StakingIndexer) processUnconfirmedInfo(unconfirmedBlocks []*types.Inde
 		zap.Int64("unconfirmed_tvl", int64(unconfirmedTvl)))
 
 	btcInfoEvent := queuecli.NewBtcInfoEvent(uint64(tipBlockCache.Height), confirmedTvl, uint64(unconfirmedTvl))
-	if err := si.consumer.PushBtcInfoEvent(&btcInfoEvent); err != nil {
+	if err := si.pushWithTimeout("btc info event", func() error {
+		return si.consumer.PushBtcInfoEvent(&btcInfoEvent)
+	}); err != nil {
 		return fmt.Errorf("failed to push the unconfirmed event: %w", err)
 	}
 
 	// record metrics
 	lastCalculatedTvl.Set(float64(unconfirmedTvl))
+	lastCalculatedTvlBtc.Set(si.roundFloat(utils.AmountToBtc(unconfirmedTvl)))
 
 	return nil
 }
 
+// CalculateTvlInUnconfirmedBlocks returns the change of the TVL by the given
+// unconfirmed blocks, ordered by height. An unbonding tx is deducted from the
+// TVL only if it has the configured number of confirmations given the last
+// block as the tip, otherwise it is pending as it might still be reorged out.
+// The pending unbonding txs in the confirmed blocks reaching the configured
+// number of confirmations given the tip are deducted as well
 func (si *StakingIndexer) CalculateTvlInUnconfirmedBlocks(unconfirmedBlocks []*types.IndexedBlock) (btcutil.Amount, error) {
 	tvl := btcutil.Amount(0)
+	if len(unconfirmedBlocks) == 0 {
+		return tvl, nil
+	}
+	tipHeight := unconfirmedBlocks[len(unconfirmedBlocks)-1].Height
+
+	pendingStakingTxs, err := si.is.GetPendingUnbondingStakingTxs(uint64(tipHeight))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the pending unbonding txs: %w", err)
+	}
+	for _, stakingTx := range pendingStakingTxs {
+		if stakingTx.IsOverflow {
+			continue
+		}
+		stakingValue, err := utils.AmountFromUint64(stakingTx.StakingValue)
+		if err != nil {
+			return 0, err
+		}
+		tvl, err = utils.SubAmounts(tvl, stakingValue)
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	unconfirmedStakingTxs := make(map[chainhash.Hash]*indexerstore.StoredStakingTransaction)
 	for _, b := range unconfirmedBlocks {
 		params, err := si.getVersionedParams(uint64(b.Height))
@@ -226,14 +472,14 @@ func (si *StakingIndexer) CalculateTvlInUnconfirmedBlocks(unconfirmedBlocks []*t
 			return 0, err
 		}
 
-		for _, tx := range b.Txs {
+		for _, tx := range utils.SortTxsByDependency(b.Txs) {
 			msgTx := tx.MsgTx()
 
 			// 1. try to parse staking tx
-			stakingData, err := si.tryParseStakingTx(msgTx, params)
+			stakingData, err := si.tryParseStakingTx(msgTx, uint64(b.Height), params)
 			if err == nil {
 				// this is a new staking tx, validate it against staking requirement
-				if err := si.validateStakingTx(params, stakingData); err != nil {
+				if err := si.validateStakingTx(msgTx, uint64(b.Height), params, stakingData); err != nil {
 					// Note: the metrics and logs will be repeated when the tx is confirmed
 					invalidTransactionsCounter.WithLabelValues("unconfirmed_staking_transaction").Inc()
 					si.logger.Warn("found an invalid staking tx",
@@ -247,7 +493,10 @@ func (si *StakingIndexer) CalculateTvlInUnconfirmedBlocks(unconfirmedBlocks []*t
 					continue
 				}
 
-				tvl += btcutil.Amount(stakingData.StakingOutput.Value)
+				tvl, err = utils.AddAmounts(tvl, btcutil.Amount(stakingData.StakingOutput.Value))
+				if err != nil {
+					return 0, err
+				}
 				// save the staking tx in memory for later identifying unbonding tx
 				stakingValue := uint64(stakingData.StakingOutput.Value)
 				unconfirmedStakingTxs[msgTx.TxHash()] = &indexerstore.StoredStakingTransaction{
@@ -305,9 +554,26 @@ func (si *StakingIndexer) CalculateTvlInUnconfirmedBlocks(unconfirmedBlocks []*t
 						zap.String("staking_tx_hash", stakingTx.Tx.TxHash().String()),
 						zap.Uint64("value", stakingTx.StakingValue))
 
+					confirmations := uint32(tipHeight - b.Height + 1)
+					if confirmations < si.cfg.UnbondingConfirmations {
+						si.logger.Info("the unconfirmed unbonding tx is pending",
+							zap.String("tx_hash", msgTx.TxHash().String()),
+							zap.Uint32("confirmations", confirmations),
+							zap.Uint32("required_confirmations", si.cfg.UnbondingConfirmations))
+
+						continue
+					}
+
 					// only subtract the tvl if the staking tx is not overflow
 					if !stakingTx.IsOverflow {
-						tvl -= btcutil.Amount(stakingTx.StakingValue)
+						stakingValue, err := utils.AmountFromUint64(stakingTx.StakingValue)
+						if err != nil {
+							return 0, err
+						}
+						tvl, err = utils.SubAmounts(tvl, stakingValue)
+						if err != nil {
+							return 0, err
+						}
 					}
 				} else {
 					// TODO 1. Identify withdraw txs
@@ -332,11 +598,63 @@ func (si *StakingIndexer) HandleConfirmedBlock(b *types.IndexedBlock) error {
 	if err != nil {
 		return err
 	}
-	for _, tx := range b.Txs {
+
+	// the scanner is not trusted to deliver a consistent chain
+	if err := si.checkBlockLinkage(b); err != nil {
+		return err
+	}
+
+	if err := si.checkBlockTxCount(b); err != nil {
+		return err
+	}
+
+	if err := si.applyPendingUnbondings(uint64(b.Height), params); err != nil {
+		return err
+	}
+
+	if si.cfg.BatchBlockEventsEnabled {
+		si.blockEvents = &consumer.BlockEvents{Height: uint64(b.Height)}
+		defer func() {
+			si.blockEvents = nil
+		}()
+	} else if si.cfg.EventDeliveryOrdering == config.EventDeliveryOrderingThroughput {
+		si.inFlightPushes = new(errgroup.Group)
+		si.inFlightPushes.SetLimit(maxInFlightPushes)
+		defer func() {
+			// no push outlives the handling of the block
+			_ = si.inFlightPushes.Wait()
+			si.inFlightPushes = nil
+		}()
+	}
+
+	// the held back events of the block are saved under the same
+	// sequence numbers if the block is handled again after restart
+	si.pendingEventSeq = 0
+
+	// txs spending other txs in the same block should be processed
+	// after them so that the events are emitted in order
+	for _, tx := range utils.SortTxsByDependency(b.Txs) {
 		msgTx := tx.MsgTx()
 
 		// 1. try to parse staking tx
-		stakingData, err := si.tryParseStakingTx(msgTx, params)
+		stakingData, err := si.tryParseStakingTx(msgTx, uint64(b.Height), params)
+		if errors.Is(err, ErrUnparseableStakingTx) {
+			if err := si.handleUnparseableStakingTx(msgTx, uint64(b.Height), err); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, ErrInvalidStakingTx) {
+			invalidTransactionsCounter.WithLabelValues("confirmed_staking_transaction").Inc()
+			si.logger.Warn("found an invalid staking tx",
+				zap.String("tx_hash", msgTx.TxHash().String()),
+				zap.Int32("height", b.Height),
+				zap.Bool("is_confirmed", true),
+				zap.Error(err),
+			)
+			if err := si.recordProcessingError(msgTx, uint64(b.Height), err); err != nil {
+				return err
+			}
+		}
 		if err == nil {
 			if err := si.ProcessStakingTx(
 				msgTx, stakingData, uint64(b.Height), b.Header.Timestamp, params,
@@ -372,13 +690,58 @@ func (si *StakingIndexer) HandleConfirmedBlock(b *types.IndexedBlock) error {
 		for i, unbondingTx := range unbondingTxs {
 			// this is a spending tx from the unbonding, validate it, and processes it
 			if err := si.handleSpendingUnbondingTransaction(
-				msgTx, unbondingTx, spendUnbondingInputIndexes[i], uint64(b.Height)); err != nil {
+				msgTx, unbondingTx, spendUnbondingInputIndexes[i],
+				uint64(b.Height), b.Header.Timestamp); err != nil {
 
 				return err
 			}
 		}
 	}
 
+	// the batched and the concurrent events are pushed before the height
+	// is saved so that they are emitted again if the indexer restarts in
+	// between
+	if si.inFlightPushes != nil {
+		if err := si.inFlightPushes.Wait(); err != nil {
+			return fmt.Errorf("failed to push the events of the block: %w", err)
+		}
+	}
+	if si.blockEvents != nil && len(si.blockEvents.Events) != 0 {
+		if err := si.pushWithTimeout("block events", func() error {
+			return consumer.PushBlockEvents(si.consumer, si.blockEvents)
+		}); err != nil {
+			return fmt.Errorf("failed to push the events of the block: %w", err)
+		}
+	}
+
+	if si.cfg.InclusionProofsEnabled {
+		if err := si.storeInclusionProofs(b); err != nil {
+			return fmt.Errorf("failed to store the inclusion proofs: %w", err)
+		}
+	}
+
+	if si.cfg.BlockDataEnabled {
+		if err := si.is.AddIndexedBlock(b); err != nil {
+			return fmt.Errorf("failed to store the block data: %w", err)
+		}
+	}
+
+	if err := si.checkCapWarning(params, b.Header.Timestamp); err != nil {
+		return err
+	}
+
+	if err := si.updateCapUtilization(params, b.Header.Timestamp); err != nil {
+		return err
+	}
+
+	if err := si.saveProcessedHeader(b); err != nil {
+		return fmt.Errorf("failed to save the processed header: %w", err)
+	}
+
+	if _, err := si.is.AddStateHash(uint64(b.Height)); err != nil {
+		return fmt.Errorf("failed to add the state hash: %w", err)
+	}
+
 	if err := si.is.SaveLastProcessedHeight(uint64(b.Height)); err != nil {
 		return fmt.Errorf("failed to save the last processed height: %w", err)
 	}
@@ -390,11 +753,24 @@ func (si *StakingIndexer) HandleConfirmedBlock(b *types.IndexedBlock) error {
 			return fmt.Errorf("failed to get the confirmed tvl: %w", err)
 		}
 		confirmedInfoEvent := queuecli.NewConfirmedInfoEvent(uint64(b.Height), confirmedTvl)
-		if err := si.consumer.PushConfirmedInfoEvent(&confirmedInfoEvent); err != nil {
+		if err := si.pushWithTimeout("confirmed info event", func() error {
+			return si.consumer.PushConfirmedInfoEvent(&confirmedInfoEvent)
+		}); err != nil {
 			return fmt.Errorf("failed to push the confirmed info event: %w", err)
 		}
 	}
 
+	// the block is checkpointed, which is notified even if it has no
+	// staking activity so that the consumer can advance its watermark
+	if pc, ok := si.consumer.(consumer.BlockProcessedConsumer); ok {
+		blockHash := b.BlockHash()
+		if err := si.pushWithTimeout("block processed event", func() error {
+			return pc.PushBlockProcessedEvent(uint64(b.Height), &blockHash)
+		}); err != nil {
+			return fmt.Errorf("failed to push the block processed event: %w", err)
+		}
+	}
+
 	// record metrics
 	lastProcessedBtcHeight.Set(float64(b.Height))
 
@@ -406,6 +782,7 @@ func (si *StakingIndexer) handleSpendingUnbondingTransaction(
 	unbondingTx *indexerstore.StoredUnbondingTransaction,
 	spendingInputIdx int,
 	height uint64,
+	timestamp time.Time,
 ) error {
 	// get the stored staking tx for later validation
 	storedStakingTx, err := si.GetStakingTxByHash(unbondingTx.StakingTxHash)
@@ -432,15 +809,17 @@ func (si *StakingIndexer) handleSpendingUnbondingTransaction(
 				zap.Error(err),
 			)
 
-			return nil
+			return si.recordProcessingError(tx, height, err)
 		}
 
 		failedProcessingWithdrawTxsFromUnbondingCounter.Inc()
 		return err
 	}
 
+	// the withdrawn value is the staking value on both paths, so that a
+	// staking tx counts the same whether it is unbonded or not
 	unbondingTxHash := unbondingTx.Tx.TxHash()
-	if err := si.processWithdrawTx(tx, unbondingTx.StakingTxHash, &unbondingTxHash, height); err != nil {
+	if err := si.processWithdrawTx(tx, spendingInputIdx, unbondingTx.StakingTxHash, &unbondingTxHash, storedStakingTx.StakingValue, height, timestamp); err != nil {
 		// record metrics
 		failedProcessingWithdrawTxsFromUnbondingCounter.Inc()
 
@@ -475,7 +854,7 @@ func (si *StakingIndexer) handleSpendingStakingTransaction(
 				zap.Error(err),
 			)
 
-			return nil
+			return si.recordProcessingError(tx, height, err)
 		}
 		// record metrics
 		failedVerifyingUnbondingTxsCounter.Inc()
@@ -495,13 +874,13 @@ func (si *StakingIndexer) handleSpendingStakingTransaction(
 					zap.Error(err),
 				)
 
-				return nil
+				return si.recordProcessingError(tx, height, err)
 			}
 
 			failedProcessingWithdrawTxsFromStakingCounter.Inc()
 			return err
 		}
-		if err := si.processWithdrawTx(tx, &stakingTxHash, nil, height); err != nil {
+		if err := si.processWithdrawTx(tx, spendingInputIndex, &stakingTxHash, nil, stakingTx.StakingValue, height, timestamp); err != nil {
 			// record metrics
 			failedProcessingWithdrawTxsFromStakingCounter.Inc()
 
@@ -542,7 +921,7 @@ func (si *StakingIndexer) ValidateWithdrawalTxFromStaking(
 		stakingTx.StakerPk,
 		[]*btcec.PublicKey{stakingTx.FinalityProviderPk},
 		params.CovenantPks,
-		params.CovenantQuorum,
+		si.covenantQuorum(params),
 		uint16(stakingTx.StakingTime),
 		btcutil.Amount(stakingTx.StakingValue),
 		&si.cfg.BTCNetParams,
@@ -582,7 +961,7 @@ func (si *StakingIndexer) ValidateWithdrawalTxFromUnbonding(
 		stakingTx.StakerPk,
 		[]*btcec.PublicKey{stakingTx.FinalityProviderPk},
 		params.CovenantPks,
-		params.CovenantQuorum,
+		si.covenantQuorum(params),
 		params.UnbondingTime,
 		expectedUnbondingOutputValue,
 		&si.cfg.BTCNetParams,
@@ -708,7 +1087,7 @@ func (si *StakingIndexer) IsValidUnbondingTx(tx *wire.MsgTx, stakingTx *indexers
 		stakingTx.StakerPk,
 		[]*btcec.PublicKey{stakingTx.FinalityProviderPk},
 		params.CovenantPks,
-		params.CovenantQuorum,
+		si.covenantQuorum(params),
 		uint16(stakingTx.StakingTime),
 		btcutil.Amount(stakingTx.StakingValue),
 		&si.cfg.BTCNetParams,
@@ -753,7 +1132,7 @@ func (si *StakingIndexer) IsValidUnbondingTx(tx *wire.MsgTx, stakingTx *indexers
 		stakingTx.StakerPk,
 		[]*btcec.PublicKey{stakingTx.FinalityProviderPk},
 		params.CovenantPks,
-		params.CovenantQuorum,
+		si.covenantQuorum(params),
 		params.UnbondingTime,
 		expectedUnbondingOutputValue,
 		&si.cfg.BTCNetParams,
@@ -781,8 +1160,14 @@ func (si *StakingIndexer) ProcessStakingTx(
 	var (
 		// whether the staking tx is overflow
 		isOverflow bool
+		// the reason why the staking tx is overflow
+		inactiveReason indexerstore.InactiveReason
 	)
 
+	if err := si.checkParamsHeight(height, params); err != nil {
+		return err
+	}
+
 	si.logger.Info("found a staking tx",
 		zap.Uint64("height", height),
 		zap.String("tx_hash", tx.TxHash().String()),
@@ -800,9 +1185,16 @@ func (si *StakingIndexer) ProcessStakingTx(
 	}
 	if storedStakingTx != nil {
 		isOverflow = storedStakingTx.IsOverflow
+		inactiveReason = storedStakingTx.InactiveReason
+		if storedStakingTx.EligibilityOverridden {
+			si.logger.Info("keeping the manually overridden eligibility of the staking tx",
+				zap.String("tx_hash", txHash.String()),
+				zap.Bool("is_overflow", isOverflow),
+				zap.String("inactive_reason", inactiveReason.String()))
+		}
 	} else {
 		// this is a new staking tx, validate it against staking requirement
-		if err := si.validateStakingTx(params, stakingData); err != nil {
+		if err := si.validateStakingTx(tx, height, params, stakingData); err != nil {
 			invalidTransactionsCounter.WithLabelValues("confirmed_staking_transaction").Inc()
 			si.logger.Warn("found an invalid staking tx",
 				zap.String("tx_hash", tx.TxHash().String()),
@@ -811,21 +1203,57 @@ func (si *StakingIndexer) ProcessStakingTx(
 				zap.Error(err),
 			)
 			// TODO handle invalid staking tx (storing and pushing events)
-			return nil
+			return si.recordProcessingError(tx, height, err)
 		}
 
 		// check if the staking tvl is overflow with this staking tx
-		stakingOverflow, err := si.isOverflow(height, params)
+		stakingOverflow, err := si.isOverflow(height, timestamp, uint64(stakingData.StakingOutput.Value), params)
 		if err != nil {
 			return fmt.Errorf("failed to check the overflow of staking tx: %w", err)
 		}
 
 		isOverflow = stakingOverflow
+		if isOverflow {
+			inactiveReason = indexerstore.InactiveReasonStakingCap
+		} else {
+			// check if the staker's active stake exceeds the
+			// per-staker cap with this staking tx
+			stakerOverflow, err := si.isStakerOverflow(
+				stakingData.OpReturnData.StakerPublicKey.PubKey,
+				uint64(stakingData.StakingOutput.Value),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to check the per-staker overflow of staking tx: %w", err)
+			}
+
+			if stakerOverflow {
+				isOverflow = true
+				inactiveReason = indexerstore.InactiveReasonPerStakerCap
+			}
+		}
+
+		if !isOverflow {
+			// check if the finality provider's active stake exceeds
+			// the per-finality-provider cap with this staking tx
+			fpOverflow, err := si.isFinalityProviderOverflow(
+				stakingData.OpReturnData.FinalityProviderPublicKey.PubKey,
+				uint64(stakingData.StakingOutput.Value),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to check the per-finality-provider overflow of staking tx: %w", err)
+			}
+
+			if fpOverflow {
+				isOverflow = true
+				inactiveReason = indexerstore.InactiveReasonPerFinalityProviderCap
+			}
+		}
 	}
 
 	if isOverflow {
 		si.logger.Info("the staking tx is overflow",
-			zap.String("tx_hash", tx.TxHash().String()))
+			zap.String("tx_hash", tx.TxHash().String()),
+			zap.Uint32("inactive_reason", uint32(inactiveReason)))
 	}
 
 	// add the staking transaction to the system state
@@ -837,6 +1265,8 @@ func (si *StakingIndexer) ProcessStakingTx(
 		uint32(stakingData.OpReturnData.StakingTime),
 		uint32(stakingData.StakingOutputIdx),
 		isOverflow,
+		inactiveReason,
+		uint32(stakingData.OpReturnData.Version),
 	); err != nil {
 		return err
 	}
@@ -856,43 +1286,58 @@ func (si *StakingIndexer) addStakingTransaction(
 	stakingTime uint32,
 	stakingOutputIndex uint32,
 	isOverflow bool,
+	inactiveReason indexerstore.InactiveReason,
+	opReturnVersion uint32,
 ) error {
-	txHex, err := getTxHex(tx)
+	stakingEvent, err := si.newStakingEvent(
+		tx, height, timestamp.Unix(), stakerPk, fpPk,
+		stakingValue, stakingTime, stakingOutputIndex, isOverflow,
+	)
 	if err != nil {
 		return err
 	}
 
-	stakingEvent := queuecli.NewActiveStakingEvent(
-		tx.TxHash().String(),
-		hex.EncodeToString(schnorr.SerializePubKey(stakerPk)),
-		hex.EncodeToString(schnorr.SerializePubKey(fpPk)),
-		stakingValue,
-		height,
-		timestamp.Unix(),
-		uint64(stakingTime),
-		uint64(stakingOutputIndex),
-		txHex,
-		isOverflow,
-	)
-
 	// push the events first then save the tx due to the assumption
 	// that the consumer can handle duplicate events
-	if err := si.consumer.PushStakingEvent(&stakingEvent); err != nil {
+	// the events held back for more confirmations are saved and
+	// pushed once the tip reaches the required depth. The batched
+	// events are pushed once the block is handled and emitted again
+	// after restart as the block is handled again
+	if err := si.emitEvent(height, si.cfg.StakingEventConfirmations, stakingEvent); err != nil {
 		return fmt.Errorf("failed to push the staking event to the queue: %w", err)
 	}
 
+	// the staking output is indexed by its pk script in the store,
+	// the address is only derived for logging
+	stakingAddr := "unknown"
+	if addr, err := utils.GetOutputAddress(tx, stakingOutputIndex, &si.cfg.BTCNetParams); err != nil {
+		si.logger.Warn("failed to derive the address of the staking output",
+			zap.String("tx_hash", tx.TxHash().String()),
+			zap.Error(err),
+		)
+	} else {
+		stakingAddr = addr.EncodeAddress()
+	}
+
 	si.logger.Info("saving the staking transaction",
 		zap.String("tx_hash", tx.TxHash().String()),
+		zap.String("staking_address", stakingAddr),
 	)
 
 	// save the staking tx in the db
-	if err := si.is.AddStakingTransaction(
-		tx, stakingOutputIndex, height,
+	err = si.is.AddStakingTransaction(
+		tx, stakingOutputIndex, height, timestamp.Unix(),
 		stakerPk, stakingTime, fpPk,
-		stakingValue, isOverflow,
-	); err != nil && !errors.Is(err, indexerstore.ErrDuplicateTransaction) {
+		stakingValue, isOverflow, inactiveReason, opReturnVersion,
+		si.scoreFunc(stakingValue, stakingTime),
+	)
+	if err != nil && !errors.Is(err, indexerstore.ErrDuplicateTransaction) {
 		return fmt.Errorf("failed to add the staking tx to store: %w", err)
 	}
+	if err == nil {
+		// the duplicate staking tx is already counted
+		recordEligibility(isOverflow, inactiveReason)
+	}
 
 	si.logger.Info("successfully saved the staking transaction",
 		zap.String("tx_hash", tx.TxHash().String()),
@@ -921,34 +1366,99 @@ func (si *StakingIndexer) ProcessUnbondingTx(
 		zap.String("staking_tx_hash", stakingTxHash.String()),
 	)
 
-	unbondingTxHex, err := getTxHex(tx)
+	unbondingTxHash := tx.TxHash()
+
+	// the unbonding tx might be processed again after restarts, while
+	// a different unbonding tx spending the same staking output can
+	// never be valid on BTC, so it is rejected rather than halting the
+	// indexer on the block
+	storedUnbondingTx, err := si.is.GetUnbondingTransactionByStakingTxHash(stakingTxHash)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to get the unbonding tx of the staking tx %s: %w",
+			stakingTxHash.String(), err)
 	}
+	if storedUnbondingTx != nil {
+		if storedUnbondingTxHash := storedUnbondingTx.Tx.TxHash(); !storedUnbondingTxHash.IsEqual(&unbondingTxHash) {
+			conflictErr := fmt.Errorf("%w: the staking tx %s is already unbonded by %s",
+				indexerstore.ErrStakingOutputAlreadySpent, stakingTxHash.String(),
+				storedUnbondingTxHash.String())
 
-	unbondingTxHash := tx.TxHash()
-	unbondingEvent := queuecli.NewUnbondingStakingEvent(
-		stakingTxHash.String(),
-		height,
-		timestamp.Unix(),
-		uint64(params.UnbondingTime),
-		// valid unbonding tx always has one output
-		0,
-		unbondingTxHex,
-		unbondingTxHash.String(),
+			invalidTransactionsCounter.WithLabelValues("confirmed_unbonding_transactions").Inc()
+			si.logger.Warn("found an unbonding tx conflicting with the stored one",
+				zap.String("tx_hash", unbondingTxHash.String()),
+				zap.Uint64("height", height),
+				zap.Bool("is_confirmed", true),
+				zap.Error(conflictErr),
+			)
+
+			return si.recordProcessingError(tx, height, conflictErr)
+		}
+	}
+
+	if storedUnbondingTx == nil && len(si.validators) != 0 {
+		storedStakingTx, err := si.is.GetStakingTransaction(stakingTxHash)
+		if err != nil {
+			return fmt.Errorf("failed to get the staking tx %s: %w", stakingTxHash.String(), err)
+		}
+		if storedStakingTx == nil {
+			return fmt.Errorf("%w: %s", ErrStakingTxNotFound, stakingTxHash.String())
+		}
+
+		// the unbonding tx spends the staking tx on BTC regardless of the
+		// audit, so it is still applied to keep the TVL and the stakes
+		// consistent with BTC
+		if err := si.runUnbondingTxAudits(tx, storedStakingTx, height); err != nil {
+			flaggedUnbondingTxsCounter.Inc()
+			si.logger.Warn("an unbonding tx is flagged by a validator",
+				zap.String("tx_hash", unbondingTxHash.String()),
+				zap.Uint64("height", height),
+				zap.Bool("is_confirmed", true),
+				zap.Error(err),
+			)
+
+			if err := si.recordProcessingError(tx, height, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	unbondingEvent, err := si.newUnbondingEvent(
+		tx, stakingTxHash, height, timestamp.Unix(), params.UnbondingTime,
 	)
+	if err != nil {
+		return err
+	}
 
-	if err := si.consumer.PushUnbondingEvent(&unbondingEvent); err != nil {
+	if err := si.emitEvent(height, si.cfg.UnbondingEventConfirmations, unbondingEvent); err != nil {
 		return fmt.Errorf("failed to push the unbonding event to the queue: %w", err)
 	}
 
 	si.logger.Info("saving the unbonding tx",
 		zap.String("tx_hash", unbondingTxHash.String()))
 
-	if err := si.is.AddUnbondingTransaction(
-		tx,
-		stakingTxHash,
-	); err != nil && !errors.Is(err, indexerstore.ErrDuplicateTransaction) {
+	// the unbonding tx is held pending until it has the configured number
+	// of unbonding confirmations, as it might still be reorged out
+	applyHeight, err := si.unbondingApplyHeight(height)
+	if err != nil {
+		return err
+	}
+	if applyHeight != 0 {
+		err = si.is.AddPendingUnbondingTransaction(
+			tx,
+			stakingTxHash,
+			height,
+			timestamp.Unix(),
+			applyHeight,
+		)
+	} else {
+		err = si.is.AddUnbondingTransaction(
+			tx,
+			stakingTxHash,
+			height,
+			timestamp.Unix(),
+		)
+	}
+	if err != nil && !errors.Is(err, indexerstore.ErrDuplicateTransaction) {
 		return fmt.Errorf("failed to add the unbonding tx to store: %w", err)
 	}
 
@@ -962,7 +1472,15 @@ func (si *StakingIndexer) ProcessUnbondingTx(
 	return nil
 }
 
-func (si *StakingIndexer) processWithdrawTx(tx *wire.MsgTx, stakingTxHash *chainhash.Hash, unbondingTxHash *chainhash.Hash, height uint64) error {
+func (si *StakingIndexer) processWithdrawTx(
+	tx *wire.MsgTx,
+	spendingInputIdx int,
+	stakingTxHash *chainhash.Hash,
+	unbondingTxHash *chainhash.Hash,
+	withdrawnValue uint64,
+	height uint64,
+	timestamp time.Time,
+) error {
 	txHashHex := tx.TxHash().String()
 	if unbondingTxHash == nil {
 		si.logger.Info("found a withdraw tx from staking",
@@ -977,12 +1495,20 @@ func (si *StakingIndexer) processWithdrawTx(tx *wire.MsgTx, stakingTxHash *chain
 		)
 	}
 
-	withdrawEvent := queuecli.NewWithdrawStakingEvent(stakingTxHash.String())
-
-	if err := si.consumer.PushWithdrawEvent(&withdrawEvent); err != nil {
+	if err := si.emitEvent(height, si.cfg.WithdrawEventConfirmations, newWithdrawEvent(stakingTxHash)); err != nil {
 		return fmt.Errorf("failed to push the withdraw event to the consumer: %w", err)
 	}
 
+	// the withdrawal tx spends either the staking output or the output
+	// of the unbonding tx
+	withdrawTxHash := tx.TxHash()
+	if err := si.is.AddWithdrawalTransaction(
+		stakingTxHash, &withdrawTxHash, &tx.TxIn[spendingInputIdx].PreviousOutPoint,
+		withdrawnValue, height, timestamp.Unix(),
+	); err != nil && !errors.Is(err, indexerstore.ErrDuplicateTransaction) {
+		return fmt.Errorf("failed to add the withdrawal tx to store: %w", err)
+	}
+
 	// record metrics
 	if unbondingTxHash == nil {
 		totalWithdrawTxsFromStaking.Inc()
@@ -995,39 +1521,312 @@ func (si *StakingIndexer) processWithdrawTx(tx *wire.MsgTx, stakingTxHash *chain
 	return nil
 }
 
-func (si *StakingIndexer) tryParseStakingTx(tx *wire.MsgTx, params *parser.ParsedVersionedGlobalParams) (*btcstaking.ParsedV0StakingTx, error) {
-	possible := btcstaking.IsPossibleV0StakingTx(tx, params.Tag)
-	if !possible {
-		return nil, fmt.Errorf("not staking tx")
+// handleUnparseableStakingTx records the tx that carries the staking tag
+// but cannot be parsed, and stores it as a dead letter if enabled
+func (si *StakingIndexer) handleUnparseableStakingTx(tx *wire.MsgTx, height uint64, parseErr error) error {
+	invalidTransactionsCounter.WithLabelValues("confirmed_unparseable_staking_transaction").Inc()
+	si.logger.Warn("found a tx carrying the staking tag but cannot be parsed",
+		zap.String("tx_hash", tx.TxHash().String()),
+		zap.Uint64("height", height),
+		zap.Error(parseErr),
+	)
+
+	if err := si.recordProcessingError(tx, height, parseErr); err != nil {
+		return err
 	}
 
-	parsedData, err := btcstaking.ParseV0StakingTx(
-		tx,
-		params.Tag,
-		params.CovenantPks,
-		params.CovenantQuorum,
-		&si.cfg.BTCNetParams)
-	if err != nil {
-		return nil, fmt.Errorf("not staking tx")
+	if !si.cfg.DeadLetterEnabled {
+		return nil
+	}
+
+	if err := si.is.AddDeadLetter(
+		tx, height, parseErr.Error(),
+	); err != nil && !errors.Is(err, indexerstore.ErrDuplicateTransaction) {
+		return fmt.Errorf("failed to add the dead letter to store: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeadLetters returns the stored txs that carry the staking
+// tag but cannot be parsed
+func (si *StakingIndexer) GetDeadLetters() ([]*indexerstore.StoredDeadLetter, error) {
+	return si.is.GetDeadLetters()
+}
+
+// tryParseStakingTx parses the tx included at the given height as a staking
+// tx under the given params. Any of the tags accepted at the height is allowed.
+// The returned ErrUnparseableStakingTx wraps ErrNoMatchingStakingOutput if the
+// tx carries a well-formed op return but no staking output matches the params
+func (si *StakingIndexer) tryParseStakingTx(tx *wire.MsgTx, height uint64, params *parser.ParsedVersionedGlobalParams) (*btcstaking.ParsedV0StakingTx, error) {
+	var parseErr error
+	for _, tag := range si.getAcceptedTags(height, params) {
+		possible := btcstaking.IsPossibleV0StakingTx(tx, tag)
+		if !possible {
+			continue
+		}
+
+		parsedData, err := btcstaking.ParseV0StakingTx(
+			tx,
+			tag,
+			params.CovenantPks,
+			si.covenantQuorum(params),
+			&si.cfg.BTCNetParams)
+		if err != nil {
+			// the mismatch of the staking output is the more specific
+			// reason, so it is kept over the parsing errors of other tags
+			if matchErr := checkStakingOutputMatch(
+				tx, tag, params, si.covenantQuorum(params), &si.cfg.BTCNetParams,
+			); matchErr != nil {
+				parseErr = matchErr
+			} else if !errors.Is(parseErr, ErrNoMatchingStakingOutput) {
+				parseErr = err
+			}
+			continue
+		}
+
+		return parsedData, nil
+	}
+
+	if parseErr != nil {
+		// the tx carries a staking tag but cannot be parsed
+		return nil, fmt.Errorf("%w: %w", ErrUnparseableStakingTx, parseErr)
 	}
 
-	return parsedData, nil
+	return nil, ErrNotStakingTx
+}
+
+// getAcceptedTags returns the staking tags accepted at the given height,
+// starting with the tag of the given params of the height. During a params
+// transition, the tag of the adjacent version is accepted as well if the
+// height is within the configured window around the activation height
+func (si *StakingIndexer) getAcceptedTags(height uint64, params *parser.ParsedVersionedGlobalParams) [][]byte {
+	tags := [][]byte{params.Tag}
+
+	window := si.cfg.TagTransitionWindow
+	if window == 0 {
+		return tags
+	}
+
+	versions := si.paramsVersions.Versions
+	for i, p := range versions {
+		if p.Version != params.Version {
+			continue
+		}
+
+		// the tag of the previous version is accepted shortly
+		// after the activation of the current version
+		if i > 0 && height < p.ActivationHeight+window {
+			tags = appendTag(tags, versions[i-1].Tag)
+		}
+
+		// the tag of the next version is accepted shortly
+		// before the activation of the next version
+		if i+1 < len(versions) && height+window >= versions[i+1].ActivationHeight {
+			tags = appendTag(tags, versions[i+1].Tag)
+		}
+
+		break
+	}
+
+	return tags
+}
+
+func appendTag(tags [][]byte, tag []byte) [][]byte {
+	for _, t := range tags {
+		if bytes.Equal(t, tag) {
+			return tags
+		}
+	}
+
+	return append(tags, tag)
 }
 
 func (si *StakingIndexer) GetStakingTxByHash(hash *chainhash.Hash) (*indexerstore.StoredStakingTransaction, error) {
 	return si.is.GetStakingTransaction(hash)
 }
 
+// GetStakingTransactionWitness returns the witness stack of the input of
+// the staking tx of the given hash, which is parsed from the stored tx. If
+// the staking tx has more than one input, the witness of the first input
+// is returned. The stack is empty if the input is not a segwit one, and
+// ErrStakingTxNotFound is returned if the staking tx is not stored
+func (si *StakingIndexer) GetStakingTransactionWitness(txHash *chainhash.Hash) ([][]byte, error) {
+	storedTx, err := si.is.GetStakingTransaction(txHash)
+	if err != nil {
+		return nil, err
+	}
+	if storedTx == nil {
+		return nil, fmt.Errorf("%w: %s", ErrStakingTxNotFound, txHash.String())
+	}
+
+	if len(storedTx.Tx.TxIn) == 0 {
+		return nil, fmt.Errorf("the staking tx %s has no input", txHash.String())
+	}
+
+	return storedTx.Tx.TxIn[0].Witness, nil
+}
+
+// ListFinalityProviders returns the pks of all the distinct finality
+// providers that have received at least one delegation, e.g., for explorers
+// to build a directory of the finality providers
+func (si *StakingIndexer) ListFinalityProviders() ([]*btcec.PublicKey, error) {
+	return si.is.ListFinalityProviders()
+}
+
+// GetStakingTransactionsByAddress returns the staking txs of which the
+// staking output pays to the given address of the configured network
+func (si *StakingIndexer) GetStakingTransactionsByAddress(addr string) ([]*indexerstore.StoredStakingTransaction, error) {
+	decodedAddr, err := btcutil.DecodeAddress(addr, &si.cfg.BTCNetParams)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidStakingAddress, err.Error())
+	}
+
+	if !decodedAddr.IsForNet(&si.cfg.BTCNetParams) {
+		return nil, fmt.Errorf("%w: the address is not for network %s",
+			ErrInvalidStakingAddress, si.cfg.BTCNetParams.Name)
+	}
+
+	pkScript, err := txscript.PayToAddrScript(decodedAddr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidStakingAddress, err.Error())
+	}
+
+	return si.is.GetStakingTransactionsByPkScript(pkScript)
+}
+
+// GetExpiringDelegations returns the delegations that are neither unbonded,
+// including the ones of which the unbonding is pending, nor withdrawn and of
+// which the staking timelock expires within the given number of blocks after
+// the given tip height, i.e., at a height in (tipHeight, tipHeight +
+// withinBlocks], e.g., for notification services to alert the stakers. The
+// inactive delegations are included as their stake is locked all the same.
+// The delegations are sorted by the expiry height
+func (si *StakingIndexer) GetExpiringDelegations(tipHeight, withinBlocks uint64) ([]*indexerstore.StoredStakingTransaction, error) {
+	if withinBlocks == 0 || tipHeight == math.MaxUint64 {
+		return nil, nil
+	}
+
+	toHeight := tipHeight + withinBlocks
+	if toHeight < tipHeight {
+		// the window is cut at the max height
+		toHeight = math.MaxUint64
+	}
+
+	delegations, err := si.is.GetStakingTransactionsExpiringBetween(tipHeight+1, toHeight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the expiring staking txs: %w", err)
+	}
+
+	sortByExpiryHeight(delegations)
+
+	return delegations, nil
+}
+
+// GetStaleMaturedDelegations returns the delegations of which the staking
+// timelock has expired at the given tip height, i.e., at a height not higher
+// than it, while neither an unbonding, including a pending one, nor a
+// withdrawal is recorded, which might indicate stuck funds or missed
+// indexing. The inactive delegations are included as their stake is locked
+// all the same. The delegations are sorted by the expiry height
+func (si *StakingIndexer) GetStaleMaturedDelegations(tipHeight uint64) ([]*indexerstore.StoredStakingTransaction, error) {
+	delegations, err := si.is.GetStakingTransactionsExpiringBetween(0, tipHeight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the matured staking txs: %w", err)
+	}
+
+	sortByExpiryHeight(delegations)
+
+	return delegations, nil
+}
+
+func sortByExpiryHeight(delegations []*indexerstore.StoredStakingTransaction) {
+	sort.SliceStable(delegations, func(i, j int) bool {
+		return delegations[i].InclusionHeight+uint64(delegations[i].StakingTime) <
+			delegations[j].InclusionHeight+uint64(delegations[j].StakingTime)
+	})
+}
+
+// GetRemainingLockTime returns the number of blocks after the given tip
+// height until the staking timelock of the staking tx of the given hash
+// expires, e.g., for wallets to show a countdown. The timelock expires at
+// the inclusion height plus the staking time, so zero is returned once the
+// tip reaches it, and the full staking time is returned for a tip below the
+// inclusion height. It is computed regardless of whether the staking tx is
+// unbonded or withdrawn, and ErrStakingTxNotFound is returned if the
+// staking tx is not stored
+func (si *StakingIndexer) GetRemainingLockTime(txHash *chainhash.Hash, tipHeight uint64) (uint32, error) {
+	storedTx, err := si.is.GetStakingTransaction(txHash)
+	if err != nil {
+		return 0, err
+	}
+	if storedTx == nil {
+		return 0, fmt.Errorf("%w: %s", ErrStakingTxNotFound, txHash.String())
+	}
+
+	if tipHeight < storedTx.InclusionHeight {
+		return storedTx.StakingTime, nil
+	}
+
+	expiryHeight := storedTx.InclusionHeight + uint64(storedTx.StakingTime)
+	if tipHeight >= expiryHeight {
+		return 0, nil
+	}
+
+	return uint32(expiryHeight - tipHeight), nil
+}
+
+// ResolveStakingFromUnbonding returns the stored staking tx of which the
+// staking output is spent by the single input of the given unbonding tx,
+// e.g., for tools observing the unbonding txs first. It returns nil if the
+// input does not spend the staking output of a stored staking tx. Note that
+// the unbonding tx is not validated against the staking tx
+func (si *StakingIndexer) ResolveStakingFromUnbonding(unbondingTx *wire.MsgTx) (*indexerstore.StoredStakingTransaction, error) {
+	if len(unbondingTx.TxIn) != 1 {
+		return nil, fmt.Errorf("%w: the unbonding tx should have exactly one input, got %d",
+			ErrInvalidUnbondingTx, len(unbondingTx.TxIn))
+	}
+
+	outpoint := unbondingTx.TxIn[0].PreviousOutPoint
+	stakingTx, err := si.is.GetStakingTransaction(&outpoint.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the staking tx %s: %w", outpoint.Hash.String(), err)
+	}
+
+	if stakingTx == nil || stakingTx.StakingOutputIdx != outpoint.Index {
+		return nil, nil
+	}
+
+	return stakingTx, nil
+}
+
+// GetSpendingTx returns the hash of the unbonding or withdrawal tx spending
+// the given staking or unbonding outpoint, it returns nil if the outpoint is
+// not known to be spent. The withdrawal txs processed before the spending
+// txs are recorded are not known
+func (si *StakingIndexer) GetSpendingTx(outpoint *wire.OutPoint) (*chainhash.Hash, error) {
+	return si.is.GetSpendingTx(outpoint)
+}
+
 func (si *StakingIndexer) GetUnbondingTxByHash(hash *chainhash.Hash) (*indexerstore.StoredUnbondingTransaction, error) {
 	return si.is.GetUnbondingTransaction(hash)
 }
 
+// Stop stops the staking indexer core. It is a no-op if the indexer
+// is not started or is already stopped
 func (si *StakingIndexer) Stop() error {
+	if !si.isStarted.Load() {
+		return nil
+	}
+
 	var stopErr error
 	si.stopOnce.Do(func() {
 		si.logger.Info("Stopping Staking Indexer App")
 
 		close(si.quit)
+		if si.cancelLoops != nil {
+			si.cancelLoops()
+		}
 		si.wg.Wait()
 
 		if err := si.btcScanner.Stop(); err != nil {
@@ -1035,6 +1834,9 @@ func (si *StakingIndexer) Stop() error {
 			return
 		}
 
+		// the final numbers are pushed once nothing is processed anymore
+		si.pushMetrics()
+
 		si.logger.Info("Staking Indexer App is successfully stopped!")
 
 	})
@@ -1051,9 +1853,51 @@ func getTxHex(tx *wire.MsgTx) (string, error) {
 	return txHex, nil
 }
 
+// getEventTxHex returns the hex of the given tx carried by the events, which
+// is empty if the raw tx is excluded from the events or does not have the
+// witness data if the witness is excluded
+func (si *StakingIndexer) getEventTxHex(tx *wire.MsgTx) (string, error) {
+	if si.cfg.IsEventFieldExcluded(config.EventFieldTxHex) {
+		return "", nil
+	}
+
+	if si.cfg.IsEventFieldExcluded(config.EventFieldWitness) {
+		var buf bytes.Buffer
+		if err := tx.SerializeNoWitness(&buf); err != nil {
+			return "", fmt.Errorf("failed to serialize the tx: %w", err)
+		}
+
+		return hex.EncodeToString(buf.Bytes()), nil
+	}
+
+	return getTxHex(tx)
+}
+
 // validateStakingTx performs the validation checks for the staking tx
-// such as min and max staking amount and staking time
-func (si *StakingIndexer) validateStakingTx(params *parser.ParsedVersionedGlobalParams, stakingData *btcstaking.ParsedV0StakingTx) error {
+// such as max tx size, min and max staking amount and staking time,
+// followed by the registered validators
+func (si *StakingIndexer) validateStakingTx(
+	tx *wire.MsgTx,
+	height uint64,
+	params *parser.ParsedVersionedGlobalParams,
+	stakingData *btcstaking.ParsedV0StakingTx,
+) error {
+	// Maximum tx size check
+	if si.cfg.MaxStakingTxSize != 0 && uint64(tx.SerializeSize()) > si.cfg.MaxStakingTxSize {
+		return fmt.Errorf("%w: staking tx is too large, expected: %v, got: %v",
+			ErrInvalidStakingTx, si.cfg.MaxStakingTxSize, tx.SerializeSize())
+	}
+
+	if err := validateStakingDataAgainstParams(stakingData, params); err != nil {
+		return err
+	}
+
+	return si.runStakingTxValidators(tx, stakingData, height)
+}
+
+// validateStakingDataAgainstParams checks the staking amount and staking
+// time of the parsed staking tx against the given params
+func validateStakingDataAgainstParams(stakingData *btcstaking.ParsedV0StakingTx, params *parser.ParsedVersionedGlobalParams) error {
 	value := btcutil.Amount(stakingData.StakingOutput.Value)
 	// Minimum staking amount check
 	if value < params.MinStakingAmount {
@@ -1082,7 +1926,15 @@ func (si *StakingIndexer) validateStakingTx(params *parser.ParsedVersionedGlobal
 	return nil
 }
 
-func (si *StakingIndexer) isOverflow(height uint64, params *parser.ParsedVersionedGlobalParams) (bool, error) {
+// isOverflow checks whether a staking tx of the given value included at the
+// given height and time exceeds the staking cap of the given params under
+// the configured staking cap policy
+func (si *StakingIndexer) isOverflow(
+	height uint64,
+	timestamp time.Time,
+	stakingValue uint64,
+	params *parser.ParsedVersionedGlobalParams,
+) (bool, error) {
 	isTimeBased := params.CapHeight != 0
 
 	if isTimeBased && height < params.ActivationHeight {
@@ -1098,12 +1950,117 @@ func (si *StakingIndexer) isOverflow(height uint64, params *parser.ParsedVersion
 		return false, nil
 	}
 
-	confirmedTvl, err := si.is.GetConfirmedTvl()
+	tvl, err := si.getCapTvl(timestamp)
+	if err != nil {
+		return false, err
+	}
+
+	stakingCap := uint64(params.StakingCap)
+	switch si.cfg.StakingCapPolicy {
+	case config.StakingCapPolicyFill, config.StakingCapPolicyBelow:
+		newTvl, err := utils.AddUint64(tvl, stakingValue)
+		if err != nil {
+			return false, err
+		}
+		if si.cfg.StakingCapPolicy == config.StakingCapPolicyFill {
+			return newTvl > stakingCap, nil
+		}
+		return newTvl >= stakingCap, nil
+	default:
+		return tvl >= stakingCap, nil
+	}
+}
+
+// getCapTvl returns the TVL measured against the staking cap for a staking
+// tx included at the given time, which is the active stake of the staking
+// txs included within the configured cap window before the time, or the
+// confirmed TVL if the window is not configured
+func (si *StakingIndexer) getCapTvl(timestamp time.Time) (uint64, error) {
+	if si.cfg.CapWindow == 0 {
+		confirmedTvl, err := si.is.GetConfirmedTvl()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get the confirmed TVL: %w", err)
+		}
+		return confirmedTvl, nil
+	}
+
+	windowTvl, err := si.is.GetActiveStakeSince(timestamp.Add(-si.cfg.CapWindow).Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the TVL within the cap window: %w", err)
+	}
+
+	return windowTvl, nil
+}
+
+// isStakerOverflow checks whether the active stake of the given staker
+// would exceed the per-staker cap with the given staking value. It always
+// returns false if the per-staker cap is not configured
+func (si *StakingIndexer) isStakerOverflow(stakerPk *btcec.PublicKey, stakingValue uint64) (bool, error) {
+	if si.cfg.PerStakerCap == 0 {
+		return false, nil
+	}
+
+	activeStake, err := si.is.GetStakerActiveStake(stakerPk)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the active stake of the staker: %w", err)
+	}
+
+	newActiveStake, err := utils.AddUint64(activeStake, stakingValue)
+	if err != nil {
+		return false, err
+	}
+
+	return newActiveStake > si.cfg.PerStakerCap, nil
+}
+
+// isFinalityProviderOverflow checks whether the active stake of the given
+// finality provider would exceed the per-finality-provider cap with the
+// given staking value. It always returns false if the cap is not configured
+func (si *StakingIndexer) isFinalityProviderOverflow(fpPk *btcec.PublicKey, stakingValue uint64) (bool, error) {
+	if si.cfg.PerFinalityProviderCap == 0 {
+		return false, nil
+	}
+
+	activeStake, err := si.is.GetFinalityProviderActiveStake(fpPk)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the active stake of the finality provider: %w", err)
+	}
+
+	newActiveStake, err := utils.AddUint64(activeStake, stakingValue)
 	if err != nil {
-		return false, fmt.Errorf("failed to get the confirmed TVL: %w", err)
+		return false, err
 	}
 
-	return confirmedTvl >= uint64(params.StakingCap), nil
+	return newActiveStake > si.cfg.PerFinalityProviderCap, nil
+}
+
+// GetTotalWithdrawnValue returns the total staking value of all the
+// withdrawn staking txs, whether they are withdrawn from the staking or
+// the unbonding output
+func (si *StakingIndexer) GetTotalWithdrawnValue() (btcutil.Amount, error) {
+	return si.is.GetTotalWithdrawnValue()
+}
+
+// GetStakingValueStats returns the minimum, maximum, and mean staking values
+// of all the staking txs along with their count, which are all 0 if no
+// staking tx has been indexed
+func (si *StakingIndexer) GetStakingValueStats() (min, max, mean btcutil.Amount, count int, err error) {
+	return si.is.GetStakingValueStats()
+}
+
+// GetBlockStats returns the number of the staking, unbonding, and
+// withdrawal txs processed from the block at the given height, which are
+// all 0 if the height is not processed
+func (si *StakingIndexer) GetBlockStats(height uint64) (stakingCount, unbondingCount, withdrawalCount int, err error) {
+	return si.is.GetBlockStats(height)
+}
+
+// GetStateHash returns the state hash of the given height, which commits to
+// the records processed up to the height, so that two indexers processing
+// the same blocks from the same height have the same state hash. It returns
+// nil if the height is not processed
+func (si *StakingIndexer) GetStateHash(height uint64) (*chainhash.Hash, error) {
+	return si.is.GetStateHash(height)
 }
 
 func (si *StakingIndexer) GetConfirmedTvl() (uint64, error) {
@@ -1118,3 +2075,22 @@ func (si *StakingIndexer) getVersionedParams(height uint64) (*parser.ParsedVersi
 
 	return params, nil
 }
+
+// checkParamsHeight checks that the given params version is the one applying
+// to the given height. The activation height is inclusive by default, i.e.,
+// a params version applies from its activation height up to the height
+// before the activation height of the next version, and every height is
+// shifted by one if the activation height is configured as exclusive
+func (si *StakingIndexer) checkParamsHeight(height uint64, params *parser.ParsedVersionedGlobalParams) error {
+	expectedParams := si.paramsVersions.GetVersionedGlobalParamsByHeight(height)
+	if expectedParams == nil {
+		return fmt.Errorf("%w: no params version applies to the height %d, which is lower than the activation height of params version %d",
+			ErrParamsHeightMismatch, height, params.Version)
+	}
+	if expectedParams.Version != params.Version {
+		return fmt.Errorf("%w: params version %d does not apply to the height %d where version %d applies",
+			ErrParamsHeightMismatch, params.Version, height, expectedParams.Version)
+	}
+
+	return nil
+}
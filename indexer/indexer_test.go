@@ -1,9 +1,20 @@
 package indexer_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -11,20 +22,32 @@ import (
 	"github.com/babylonlabs-io/babylon/btcstaking"
 	bbndatagen "github.com/babylonlabs-io/babylon/testutil/datagen"
 	"github.com/babylonlabs-io/networks/parameters/parser"
+	queuecli "github.com/babylonlabs-io/staking-queue-client/client"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 
 	"github.com/babylonlabs-io/staking-indexer/btcscanner"
 	"github.com/babylonlabs-io/staking-indexer/config"
+	"github.com/babylonlabs-io/staking-indexer/consumer"
 	"github.com/babylonlabs-io/staking-indexer/indexer"
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
 	"github.com/babylonlabs-io/staking-indexer/testutils"
 	"github.com/babylonlabs-io/staking-indexer/testutils/datagen"
 	"github.com/babylonlabs-io/staking-indexer/testutils/mocks"
 	"github.com/babylonlabs-io/staking-indexer/types"
+	"github.com/babylonlabs-io/staking-indexer/utils"
 )
 
 type StakingEvent struct {
@@ -108,13 +131,15 @@ func NewTestScenario(r *rand.Rand, t *testing.T, versionedParams *parser.ParsedG
 	}
 
 	blocks := make([]*types.IndexedBlock, 0)
+	var prevHash chainhash.Hash
 	for h := startHeight; h <= lastEventHeight; h++ {
 		block := &types.IndexedBlock{
 			Height: h,
-			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Header: &wire.BlockHeader{PrevBlock: prevHash, Timestamp: time.Now()},
 			Txs:    txsPerHeight[h],
 		}
 		blocks = append(blocks, block)
+		prevHash = block.BlockHash()
 		_, ok := tvlToHeight[h]
 		if !ok {
 			tvlToHeight[h] = tvlToHeight[h-1]
@@ -272,306 +297,4565 @@ func FuzzBlockHandler(f *testing.F) {
 	})
 }
 
-func FuzzGetStartHeight(f *testing.F) {
-	// use small seed because db open/close is slow
-	bbndatagen.AddRandomSeedsToFuzzer(f, 6)
-
-	f.Fuzz(func(t *testing.T, seed int64) {
-		r := rand.New(rand.NewSource(seed))
+// TestIndexersWithDifferentDbConfigs tests that two indexers sharing the
+// same home path but with different data subdirectories and db file names
+// do not collide
+func TestIndexersWithDifferentDbConfigs(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-		homePath := filepath.Join(t.TempDir(), "indexer")
-		cfg := config.DefaultConfigWithHome(homePath)
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg1 := config.DefaultConfigWithHome(homePath)
+	cfg1.DatabaseConfig.DataSubDir = "signet"
+	cfg1.DatabaseConfig.DBFileName = "signet.db"
+	require.NoError(t, cfg1.Validate())
+	cfg2 := config.DefaultConfigWithHome(homePath)
+	cfg2.DatabaseConfig.DataSubDir = "testnet"
+	cfg2.DatabaseConfig.DBFileName = "testnet.db"
+	require.NoError(t, cfg2.Validate())
 
-		sysParams := datagen.GenerateGlobalParamsVersions(r, t)
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	testScenario := NewTestScenario(r, t, sysParamsVersions, 100, 10, false)
 
-		db, err := cfg.DatabaseConfig.GetDbBackend()
+	db1, err := cfg1.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db1.Close()
 		require.NoError(t, err)
-		chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
-		mockBtcScanner := NewMockedBtcScanner(t, chainUpdateInfoChan)
-		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParams, mockBtcScanner)
+	}()
+	db2, err := cfg2.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db2.Close()
 		require.NoError(t, err)
+	}()
 
-		// 1. no blocks have been processed, the start height should be equal to the base height
-		initialHeight := stakingIndexer.GetStartHeight()
-		require.Equal(t, sysParams.Versions[0].ActivationHeight, initialHeight)
-		err = stakingIndexer.ValidateStartHeight(initialHeight)
-		require.NoError(t, err)
+	require.FileExists(t, filepath.Join(config.DataDir(homePath), "signet", "signet.db"))
+	require.FileExists(t, filepath.Join(config.DataDir(homePath), "testnet", "testnet.db"))
 
-		err = stakingIndexer.ValidateStartHeight(bbndatagen.RandomIntOtherThan(r, int(initialHeight), 100))
-		require.Error(t, err)
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer1, err := indexer.NewStakingIndexer(cfg1, zap.NewNop(), NewMockedConsumer(t), db1, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+	stakingIndexer2, err := indexer.NewStakingIndexer(cfg2, zap.NewNop(), NewMockedConsumer(t), db2, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
 
-		err = stakingIndexer.Start(initialHeight)
+	// only the first indexer handles the blocks
+	for _, b := range testScenario.Blocks {
+		err := stakingIndexer1.HandleConfirmedBlock(b)
 		require.NoError(t, err)
-		defer func() {
-			err := stakingIndexer.Stop()
-			require.NoError(t, err)
-			err = db.Close()
-			require.NoError(t, err)
-		}()
-
-		// 2. generate some blocks and let the last processed height grow
-		numBlocks := r.Intn(10) + 1
-		var wg sync.WaitGroup
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			confirmedBlocks := make([]*types.IndexedBlock, 0)
-			for i := 0; i < numBlocks; i++ {
-				b := &types.IndexedBlock{
-					Height: int32(initialHeight) + int32(i),
-				}
-				confirmedBlocks = append(confirmedBlocks, b)
-			}
-			chainUpdateInfoChan <- &btcscanner.ChainUpdateInfo{
-				ConfirmedBlocks: confirmedBlocks,
-			}
-		}()
-		wg.Wait()
-
-		// wait for db writes finished
-		time.Sleep(2 * time.Second)
+	}
 
-		// get start height from the indexer again, it should be equal to
-		// the last processed height (initialHeight + numBlocks - 1) + 1
-		startHeight := stakingIndexer.GetStartHeight()
-		require.Equal(t, initialHeight+uint64(numBlocks), startHeight)
-		err = stakingIndexer.ValidateStartHeight(startHeight)
+	for _, stakingEv := range testScenario.StakingEvents {
+		storedTx, err := stakingIndexer1.GetStakingTxByHash(stakingEv.StakingTx.Hash())
 		require.NoError(t, err)
+		require.NotNil(t, storedTx)
 
-		// 3. test the case where the start height is between [base height, last processed height + 1]
-		gap := int(startHeight - initialHeight)
-		validStartHeight := initialHeight + uint64(r.Intn(gap)) + 1
-		err = stakingIndexer.ValidateStartHeight(validStartHeight)
+		storedTx, err = stakingIndexer2.GetStakingTxByHash(stakingEv.StakingTx.Hash())
 		require.NoError(t, err)
+		require.Nil(t, storedTx)
+	}
 
-		// 4. test the case where the start height is less than the base height
-		smallHeight := uint64(r.Intn(int(initialHeight)))
-		err = stakingIndexer.ValidateStartHeight(smallHeight)
-		require.Error(t, err)
-
-		// 5. test the case where the start height is more than the last processed height + 1
-		bigHeight := uint64(r.Intn(1000)) + 1 + startHeight
-		err = stakingIndexer.ValidateStartHeight(bigHeight)
-		require.Error(t, err)
-	})
+	tvl, err := stakingIndexer2.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Zero(t, tvl)
 }
 
-// FuzzVerifyUnbondingTx tests IsValidUnbondingTx in three scenarios:
-// 1. it returns (true, nil) if the given tx is valid unbonding tx
-// 2. it returns (false, nil) if the given tx is not unbonding tx
-// 3. it returns (false, ErrInvalidUnbondingTx) if the given tx is not
-// a valid unbonding tx
-func FuzzVerifyUnbondingTx(f *testing.F) {
-	bbndatagen.AddRandomSeedsToFuzzer(f, 50)
-
-	f.Fuzz(func(t *testing.T, seed int64) {
-		r := rand.New(rand.NewSource(seed))
+// TestOutOfOrderBlockIsRejected tests that a confirmed block delivered at a
+// height that has been handled is rejected rather than re-indexed
+func TestOutOfOrderBlockIsRejected(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-		homePath := filepath.Join(t.TempDir(), "indexer")
-		cfg := config.DefaultConfigWithHome(homePath)
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
 
-		sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	testScenario := NewTestScenario(r, t, sysParamsVersions, 100, 10, true)
 
-		db, err := cfg.DatabaseConfig.GetDbBackend()
-		require.NoError(t, err)
-		chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
-		mockBtcScanner := NewMockedBtcScanner(t, chainUpdateInfoChan)
-		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
-		require.NoError(t, err)
-		defer func() {
-			err = db.Close()
-			require.NoError(t, err)
-		}()
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
+	mockBtcScanner := NewMockedBtcScanner(t, chainUpdateInfoChan)
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
 
-		// Select the first params versions to play with
-		params := sysParamsVersions.Versions[0]
-		// 1. generate and add a valid staking tx to the indexer
-		stakingData := datagen.GenerateTestStakingData(t, r, params)
-		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
-		// For a valid tx, its btc height is always larger than the activation height
-		mockedHeight := uint64(params.ActivationHeight) + 1
-		err = stakingIndexer.ProcessStakingTx(
-			stakingTx.MsgTx(),
-			getParsedStakingData(stakingData, stakingTx.MsgTx(), params),
-			mockedHeight, time.Now(), params)
+	err = stakingIndexer.Start(stakingIndexer.GetStartHeight())
+	require.NoError(t, err)
+	defer func() {
+		err := stakingIndexer.Stop()
 		require.NoError(t, err)
-		storedStakingTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+		err = db.Close()
 		require.NoError(t, err)
-		require.NotNil(t, storedStakingTx)
+	}()
 
-		// 2. test IsValidUnbondingTx with valid unbonding tx, expect (true, nil)
-		unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
-		isValid, err := stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
-		require.NoError(t, err)
-		require.True(t, isValid)
+	chainUpdateInfoChan <- &btcscanner.ChainUpdateInfo{
+		ConfirmedBlocks: testScenario.Blocks,
+	}
 
-		// 3. test IsValidUnbondingTx with no unbonding tx (different staking output index), expect (false, nil)
-		unbondingTx = datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 1)
-		isValid, err = stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
-		require.NoError(t, err)
-		require.False(t, isValid)
+	// deliver a block at the last handled height with a new staking tx
+	lastBlock := testScenario.Blocks[len(testScenario.Blocks)-1]
+	p := sysParamsVersions.GetVersionedGlobalParamsByHeight(uint64(lastBlock.Height))
+	require.NotNil(t, p)
+	stakingEvent := buildStakingEvent(r, t, lastBlock.Height, p)
+	outOfOrderBlock := &types.IndexedBlock{
+		Height: lastBlock.Height,
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingEvent.StakingTx},
+	}
+	chainUpdateInfoChan <- &btcscanner.ChainUpdateInfo{
+		ConfirmedBlocks: []*types.IndexedBlock{outOfOrderBlock},
+	}
 
-		// 4. test IsValidUnbondingTx with rbf enabled, expect (false, ErrInvalidUnbondingTx)
-		unbondingTx = datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
-		unbondingTx.MsgTx().TxIn[0].Sequence = 0
-		isValid, err = stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
-		require.ErrorIs(t, err, indexer.ErrInvalidUnbondingTx)
-		require.Contains(t, err.Error(), "unbonding tx should not enable rbf")
-		require.False(t, isValid)
+	// the following block should still be handled
+	nextBlock := &types.IndexedBlock{
+		Height: lastBlock.Height + 1,
+		Header: &wire.BlockHeader{PrevBlock: lastBlock.BlockHash(), Timestamp: time.Now()},
+	}
+	chainUpdateInfoChan <- &btcscanner.ChainUpdateInfo{
+		ConfirmedBlocks: []*types.IndexedBlock{nextBlock},
+	}
 
-		// 5. test IsValidUnbondingTx with time lock set, expect (false, ErrInvalidUnbondingTx)
-		unbondingTx = datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
-		unbondingTx.MsgTx().LockTime = 1
-		isValid, err = stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
-		require.ErrorIs(t, err, indexer.ErrInvalidUnbondingTx)
-		require.Contains(t, err.Error(), "unbonding tx should not set lock time")
-		require.False(t, isValid)
+	require.Eventually(t, func() bool {
+		return stakingIndexer.GetStartHeight() == uint64(nextBlock.Height)+1
+	}, 5*time.Second, 50*time.Millisecond)
 
-		// 6. test IsValidUnbondingTx with invalid unbonding tx (random unbonding fee in params), expect (false, ErrInvalidUnbondingTx)
-		newParams := *params
-		newParams.UnbondingFee = btcutil.Amount(bbndatagen.RandomIntOtherThan(r, int(params.UnbondingFee), 10000000))
-		unbondingTx = datagen.GenerateUnbondingTxFromStaking(t, &newParams, stakingData, stakingTx.Hash(), 0)
-		// pass the old params
-		isValid, err = stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
-		require.ErrorIs(t, err, indexer.ErrInvalidUnbondingTx)
-		require.Contains(t, err.Error(), fmt.Sprintf("the unbonding output value %d is not expected", unbondingTx.MsgTx().TxOut[0].Value))
-		require.False(t, isValid)
+	storedTx, err := stakingIndexer.GetStakingTxByHash(stakingEvent.StakingTx.Hash())
+	require.NoError(t, err)
+	require.Nil(t, storedTx)
 
-		// 7. test IsValidUnbondingTx with invalid unbonding tx (random unbonding time in params), expect (false, ErrInvalidUnbondingTx)
-		newParams2 := *params
-		newParams2.UnbondingTime = uint16(bbndatagen.RandomIntOtherThan(r, int(params.UnbondingTime), 1000))
-		unbondingTx = datagen.GenerateUnbondingTxFromStaking(t, &newParams2, stakingData, stakingTx.Hash(), 0)
-		// pass the old params
-		isValid, err = stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
-		require.ErrorIs(t, err, indexer.ErrInvalidUnbondingTx)
-		require.Contains(t, err.Error(), "the unbonding output is not expected")
-		require.False(t, isValid)
-	})
+	tvl, err := stakingIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Equal(t, uint64(testScenario.Tvl), tvl)
 }
 
-func FuzzValidateWithdrawTxFromStaking(f *testing.F) {
-	bbndatagen.AddRandomSeedsToFuzzer(f, 10)
+// TestPerStakerCap tests that a staking tx making the active stake of its
+// staker exceed the per-staker cap is overflow even though the total TVL
+// is under the global staking cap
+func TestPerStakerCap(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-	f.Fuzz(func(t *testing.T, seed int64) {
-		r := rand.New(rand.NewSource(seed))
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
 
-		homePath := filepath.Join(t.TempDir(), "indexer")
-		cfg := config.DefaultConfigWithHome(homePath)
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// make sure the global staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
 
-		sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the staker can have two staking txs active at most
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	cfg.PerStakerCap = uint64(2*stakingData.StakingAmount + stakingData.StakingAmount/2)
 
-		db, err := cfg.DatabaseConfig.GetDbBackend()
-		require.NoError(t, err)
-		chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
-		mockBtcScanner := NewMockedBtcScanner(t, chainUpdateInfoChan)
-		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
 		require.NoError(t, err)
-		defer func() {
-			err = db.Close()
-			require.NoError(t, err)
-		}()
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
 
-		// Select the first params versions to play with
-		params := sysParamsVersions.Versions[0]
-		// 1. generate and add a valid staking tx to the indexer
-		stakingData := datagen.GenerateTestStakingData(t, r, params)
+	height := params.ActivationHeight
+	stakingTxs := make([]*btcutil.Tx, 0)
+	for i := 0; i < 3; i++ {
 		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
-		// For a valid tx, its btc height is always larger than the activation height
-		mockedHeight := uint64(params.ActivationHeight) + 1
-		err = stakingIndexer.ProcessStakingTx(
+		err := stakingIndexer.ProcessStakingTx(
 			stakingTx.MsgTx(),
 			getParsedStakingData(stakingData, stakingTx.MsgTx(), params),
-			mockedHeight, time.Now(), params)
-		require.NoError(t, err)
-		storedStakingTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+			height, time.Now(), params)
 		require.NoError(t, err)
-		require.NotNil(t, storedStakingTx)
+		stakingTxs = append(stakingTxs, stakingTx)
+	}
 
-		// 2. test ValidateWithdrawalTxFromStaking with valid withdrawal tx
-		withdrawTxFromStaking := datagen.GenerateWithdrawalTxFromStaking(t, r, params, stakingData, stakingTx.Hash(), 0)
-		err = stakingIndexer.ValidateWithdrawalTxFromStaking(withdrawTxFromStaking.MsgTx(), storedStakingTx, 0, params)
+	// another staker is not affected
+	otherStakingData := datagen.GenerateTestStakingData(t, r, params)
+	otherStakingData.StakingAmount = stakingData.StakingAmount
+	_, otherStakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, otherStakingData)
+	err = stakingIndexer.ProcessStakingTx(
+		otherStakingTx.MsgTx(),
+		getParsedStakingData(otherStakingData, otherStakingTx.MsgTx(), params),
+		height, time.Now(), params)
+	require.NoError(t, err)
+
+	for i, stakingTx := range stakingTxs {
+		storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
 		require.NoError(t, err)
+		if i < 2 {
+			require.False(t, storedTx.IsOverflow)
+			require.Equal(t, indexerstore.InactiveReasonNone, storedTx.InactiveReason)
+		} else {
+			require.True(t, storedTx.IsOverflow)
+			require.Equal(t, indexerstore.InactiveReasonPerStakerCap, storedTx.InactiveReason)
+		}
+	}
+	storedTx, err := stakingIndexer.GetStakingTxByHash(otherStakingTx.Hash())
+	require.NoError(t, err)
+	require.False(t, storedTx.IsOverflow)
 
-		// 3. test ValidateWithdrawalTxFromStaking with invalid spending input index, expect panic
-		require.Panics(t, func() {
-			_ = stakingIndexer.ValidateWithdrawalTxFromStaking(withdrawTxFromStaking.MsgTx(), storedStakingTx, 1, params)
-		})
+	tvl, err := stakingIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2*stakingData.StakingAmount+otherStakingData.StakingAmount), tvl)
 
-		// 4. test ValidateWithdrawalTxFromStaking with a different staking time, expect ErrInvalidWithdrawTx
-		invalidStakingTx := *storedStakingTx
-		invalidStakingTx.StakingTime = uint32(bbndatagen.RandomIntOtherThan(r, int(storedStakingTx.StakingTime), 1000))
-		err = stakingIndexer.ValidateWithdrawalTxFromStaking(withdrawTxFromStaking.MsgTx(), &invalidStakingTx, 0, params)
-		require.ErrorIs(t, err, indexer.ErrInvalidWithdrawalTx)
-	})
+	// the default score is the staking value
+	totalScore, err := stakingIndexer.GetTotalScore()
+	require.NoError(t, err)
+	require.Equal(t, tvl, totalScore)
 }
 
-func FuzzValidateWithdrawTxFromUnbonding(f *testing.F) {
-	bbndatagen.AddRandomSeedsToFuzzer(f, 10)
+// TestPerFinalityProviderCap tests that a staking tx making the active stake
+// of its finality provider exceed the per-finality-provider cap is overflow
+// even though the total TVL is under the global staking cap
+func TestPerFinalityProviderCap(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-	f.Fuzz(func(t *testing.T, seed int64) {
-		r := rand.New(rand.NewSource(seed))
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
 
-		homePath := filepath.Join(t.TempDir(), "indexer")
-		cfg := config.DefaultConfigWithHome(homePath)
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// make sure the global staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
 
-		sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the finality provider can have two staking txs of different
+	// stakers active at most
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	cfg.PerFinalityProviderCap = uint64(2*stakingData.StakingAmount + stakingData.StakingAmount/2)
 
-		db, err := cfg.DatabaseConfig.GetDbBackend()
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
 		require.NoError(t, err)
-		chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
-		mockBtcScanner := NewMockedBtcScanner(t, chainUpdateInfoChan)
-		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
-		require.NoError(t, err)
-		defer func() {
-			err = db.Close()
-			require.NoError(t, err)
-		}()
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
 
-		// Select the first params versions to play with
-		params := sysParamsVersions.Versions[0]
-		// 1. generate and add a valid staking tx to the indexer
-		stakingData := datagen.GenerateTestStakingData(t, r, params)
-		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
-		// For a valid tx, its btc height is always larger than the activation height
-		mockedHeight := uint64(params.ActivationHeight) + 1
-		err = stakingIndexer.ProcessStakingTx(
+	height := params.ActivationHeight
+	stakingTxs := make([]*btcutil.Tx, 0)
+	for i := 0; i < 3; i++ {
+		stakerData := datagen.GenerateTestStakingData(t, r, params)
+		stakerData.FinalityProviderKey = stakingData.FinalityProviderKey
+		stakerData.StakingAmount = stakingData.StakingAmount
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakerData)
+		err := stakingIndexer.ProcessStakingTx(
 			stakingTx.MsgTx(),
-			getParsedStakingData(stakingData, stakingTx.MsgTx(), params),
-			mockedHeight, time.Now(), params)
-		require.NoError(t, err)
-		storedStakingTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+			getParsedStakingData(stakerData, stakingTx.MsgTx(), params),
+			height, time.Now(), params)
 		require.NoError(t, err)
-		require.NotNil(t, storedStakingTx)
+		stakingTxs = append(stakingTxs, stakingTx)
+	}
 
-		// 2. generate a valid unbonding tx
-		unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
-		isValid, err := stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
-		require.NoError(t, err)
-		require.True(t, isValid)
+	// another finality provider is not affected
+	otherStakingData := datagen.GenerateTestStakingData(t, r, params)
+	otherStakingData.StakingAmount = stakingData.StakingAmount
+	_, otherStakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, otherStakingData)
+	err = stakingIndexer.ProcessStakingTx(
+		otherStakingTx.MsgTx(),
+		getParsedStakingData(otherStakingData, otherStakingTx.MsgTx(), params),
+		height, time.Now(), params)
+	require.NoError(t, err)
 
-		// 3. test ValidateWithdrawalTxFromUnbonding with valid withdrawal tx
-		withdrawTxFromUnbonding := datagen.GenerateWithdrawalTxFromUnbonding(t, r, params, stakingData, unbondingTx.Hash())
-		err = stakingIndexer.ValidateWithdrawalTxFromUnbonding(withdrawTxFromUnbonding.MsgTx(), storedStakingTx, 0, params)
+	for i, stakingTx := range stakingTxs {
+		storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
 		require.NoError(t, err)
+		if i < 2 {
+			require.False(t, storedTx.IsOverflow)
+			require.Equal(t, indexerstore.InactiveReasonNone, storedTx.InactiveReason)
+		} else {
+			require.True(t, storedTx.IsOverflow)
+			require.Equal(t, indexerstore.InactiveReasonPerFinalityProviderCap, storedTx.InactiveReason)
+		}
+	}
+	storedTx, err := stakingIndexer.GetStakingTxByHash(otherStakingTx.Hash())
+	require.NoError(t, err)
+	require.False(t, storedTx.IsOverflow)
 
-		// 4. test ValidateWithdrawalTxFromUnbonding with invalid spending input index, expect panic
-		require.Panics(t, func() {
-			_ = stakingIndexer.ValidateWithdrawalTxFromUnbonding(withdrawTxFromUnbonding.MsgTx(), storedStakingTx, 1, params)
-		})
+	tvl, err := stakingIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2*stakingData.StakingAmount+otherStakingData.StakingAmount), tvl)
+	require.Less(t, tvl, uint64(params.StakingCap))
 
-		// 5. test ValidateWithdrawalTxFromUnbonding with a different param, expect ErrInvalidWithdrawTx
-		invalidParams := *params
-		invalidParams.UnbondingTime = uint16(bbndatagen.RandomIntOtherThan(r, int(params.UnbondingTime), 1000))
-		err = stakingIndexer.ValidateWithdrawalTxFromUnbonding(withdrawTxFromUnbonding.MsgTx(), storedStakingTx, 0, &invalidParams)
-		require.ErrorIs(t, err, indexer.ErrInvalidWithdrawalTx)
-	})
+	counts, err := stakingIndexer.GetEligibilityCounts()
+	require.NoError(t, err)
+	require.Equal(t, 3, counts.Active)
+	require.Equal(t, 1, counts.InactiveByReason[indexerstore.InactiveReasonPerFinalityProviderCap])
 }
 
-func getParsedStakingData(data *datagen.TestStakingData, tx *wire.MsgTx, params *parser.ParsedVersionedGlobalParams) *btcstaking.ParsedV0StakingTx {
-	return &btcstaking.ParsedV0StakingTx{
-		StakingOutput:     tx.TxOut[0],
-		StakingOutputIdx:  0,
-		OpReturnOutput:    tx.TxOut[1],
+// TestStakingCapPolicy tests that the staking tx exactly filling or crossing
+// the staking cap is classified according to the staking cap policy
+func TestStakingCapPolicy(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	testCases := []struct {
+		name   string
+		policy string
+		// whether the second staking tx crosses the cap rather
+		// than exactly fills it
+		crossing bool
+		active   bool
+	}{
+		{name: "default exactly filling", policy: "", crossing: false, active: true},
+		{name: "reach exactly filling", policy: config.StakingCapPolicyReach, crossing: false, active: true},
+		{name: "reach crossing", policy: config.StakingCapPolicyReach, crossing: true, active: true},
+		{name: "fill exactly filling", policy: config.StakingCapPolicyFill, crossing: false, active: true},
+		{name: "fill crossing", policy: config.StakingCapPolicyFill, crossing: true, active: false},
+		{name: "below exactly filling", policy: config.StakingCapPolicyBelow, crossing: false, active: false},
+		{name: "below crossing", policy: config.StakingCapPolicyBelow, crossing: true, active: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			homePath := filepath.Join(t.TempDir(), "indexer")
+			cfg := config.DefaultConfigWithHome(homePath)
+			cfg.StakingCapPolicy = tc.policy
+
+			sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+			params := sysParamsVersions.Versions[0]
+
+			// the remaining cap is exactly the value of the second
+			// staking tx, or one satoshi less if it crosses the cap
+			stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+			stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+			params.CapHeight = 0
+			params.StakingCap = stakingData1.StakingAmount + stakingData2.StakingAmount
+			if tc.crossing {
+				params.StakingCap--
+			}
+
+			db, err := cfg.DatabaseConfig.GetDbBackend()
+			require.NoError(t, err)
+			defer func() {
+				err := db.Close()
+				require.NoError(t, err)
+			}()
+			mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+			stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+			require.NoError(t, err)
+
+			stakingTxs := make([]*btcutil.Tx, 0, 2)
+			for _, stakingData := range []*datagen.TestStakingData{stakingData1, stakingData2} {
+				_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+				err := stakingIndexer.ProcessStakingTx(
+					stakingTx.MsgTx(),
+					getParsedStakingData(stakingData, stakingTx.MsgTx(), params),
+					params.ActivationHeight, time.Now(), params)
+				require.NoError(t, err)
+				stakingTxs = append(stakingTxs, stakingTx)
+			}
+
+			storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTxs[0].Hash())
+			require.NoError(t, err)
+			require.False(t, storedTx.IsOverflow)
+
+			storedTx, err = stakingIndexer.GetStakingTxByHash(stakingTxs[1].Hash())
+			require.NoError(t, err)
+			require.Equal(t, !tc.active, storedTx.IsOverflow)
+			expectedTvl := stakingData1.StakingAmount
+			if tc.active {
+				expectedTvl += stakingData2.StakingAmount
+			} else {
+				require.Equal(t, indexerstore.InactiveReasonStakingCap, storedTx.InactiveReason)
+			}
+
+			tvl, err := stakingIndexer.GetConfirmedTvl()
+			require.NoError(t, err)
+			require.Equal(t, uint64(expectedTvl), tvl)
+		})
+	}
+}
+
+// TestEligibilityCounts tests that the counts of the active and inactive
+// delegations reflect the split after the staking caps are exceeded
+func TestEligibilityCounts(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+
+	// all the delegations have the same staking value, the global staking
+	// cap allows two of them and the per-staker cap allows one per staker
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	params.CapHeight = 0
+	params.StakingCap = 2 * stakingData.StakingAmount
+	cfg.PerStakerCap = uint64(stakingData.StakingAmount + stakingData.StakingAmount/2)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	counts, err := stakingIndexer.GetEligibilityCounts()
+	require.NoError(t, err)
+	require.Zero(t, counts.Active)
+	require.Zero(t, counts.Inactive)
+	require.Empty(t, counts.InactiveByReason)
+
+	otherStakingData := datagen.GenerateTestStakingData(t, r, params)
+	otherStakingData.StakingAmount = stakingData.StakingAmount
+	lateStakingData := datagen.GenerateTestStakingData(t, r, params)
+	lateStakingData.StakingAmount = stakingData.StakingAmount
+
+	// the second delegation of the staker exceeds the per-staker cap and
+	// the last delegation exceeds the global staking cap
+	for i, data := range []*datagen.TestStakingData{stakingData, stakingData, otherStakingData, lateStakingData} {
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, data)
+		b := &types.IndexedBlock{
+			Height: int32(params.ActivationHeight) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    []*btcutil.Tx{stakingTx},
+		}
+		err := handleLinkedBlock(t, stakingIndexer, b)
+		require.NoError(t, err)
+	}
+
+	counts, err = stakingIndexer.GetEligibilityCounts()
+	require.NoError(t, err)
+	require.Equal(t, 2, counts.Active)
+	require.Equal(t, 2, counts.Inactive)
+	require.Equal(t, map[indexerstore.InactiveReason]int{
+		indexerstore.InactiveReasonStakingCap:   1,
+		indexerstore.InactiveReasonPerStakerCap: 1,
+	}, counts.InactiveByReason)
+}
+
+// TestGetStakerDelegationsByStatus tests that the delegations of a staker
+// with a mix of active, inactive, unbonding, and withdrawn delegations are
+// partitioned by status, including a withdrawn overflow delegation
+func TestGetStakerDelegationsByStatus(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	// make sure the global staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	// the staker can have two staking txs active at most
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	cfg.PerStakerCap = uint64(2*stakingData.StakingAmount + stakingData.StakingAmount/2)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	otherStakingData := datagen.GenerateTestStakingData(t, r, params)
+	otherStakingData.StakingAmount = stakingData.StakingAmount
+
+	expectedTxs := map[indexer.DelegationStatus]map[chainhash.Hash]struct{}{
+		indexer.DelegationStatusActive:    {},
+		indexer.DelegationStatusInactive:  {},
+		indexer.DelegationStatusUnbonding: {},
+		indexer.DelegationStatusWithdrawn: {},
+	}
+	var unbondedTx, withdrawnTx *btcutil.Tx
+	height := params.ActivationHeight
+	for _, data := range []*datagen.TestStakingData{stakingData, otherStakingData, stakingData, stakingData, stakingData} {
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, data)
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: int32(height),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    []*btcutil.Tx{stakingTx},
+		})
+		require.NoError(t, err)
+		height++
+
+		if data != stakingData {
+			continue
+		}
+		switch {
+		case unbondedTx == nil:
+			unbondedTx = stakingTx
+			expectedTxs[indexer.DelegationStatusUnbonding][*stakingTx.Hash()] = struct{}{}
+		case len(expectedTxs[indexer.DelegationStatusActive]) < 1:
+			expectedTxs[indexer.DelegationStatusActive][*stakingTx.Hash()] = struct{}{}
+		case len(expectedTxs[indexer.DelegationStatusInactive]) < 1:
+			expectedTxs[indexer.DelegationStatusInactive][*stakingTx.Hash()] = struct{}{}
+		default:
+			withdrawnTx = stakingTx
+			expectedTxs[indexer.DelegationStatusWithdrawn][*stakingTx.Hash()] = struct{}{}
+		}
+	}
+	storedTx, err := stakingIndexer.GetStakingTxByHash(withdrawnTx.Hash())
+	require.NoError(t, err)
+	require.True(t, storedTx.IsOverflow)
+
+	// the unbonded delegation and the withdrawn overflow
+	// delegation are neither active nor inactive
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, unbondedTx.Hash(), 0)
+	withdrawTx := datagen.GenerateWithdrawalTxFromStaking(t, r, params, stakingData, withdrawnTx.Hash(), 0)
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: int32(height),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{unbondingTx, withdrawTx},
+	})
+	require.NoError(t, err)
+
+	// every delegation of the staker has exactly one status
+	seen := make(map[chainhash.Hash]indexer.DelegationStatus)
+	for status, txs := range expectedTxs {
+		delegations, err := stakingIndexer.GetStakerDelegationsByStatus(stakingData.StakerKey, status)
+		require.NoError(t, err)
+		require.Len(t, delegations, len(txs), status)
+		for _, d := range delegations {
+			require.Contains(t, txs, d.Tx.TxHash(), status)
+			require.NotContains(t, seen, d.Tx.TxHash(), status)
+			seen[d.Tx.TxHash()] = status
+		}
+	}
+	delegationCount, err := stakingIndexer.GetStakerDelegationCount(stakingData.StakerKey)
+	require.NoError(t, err)
+	require.Len(t, seen, delegationCount)
+
+	// the other staker only has an active delegation
+	for status := range expectedTxs {
+		delegations, err := stakingIndexer.GetStakerDelegationsByStatus(otherStakingData.StakerKey, status)
+		require.NoError(t, err)
+		if status == indexer.DelegationStatusActive {
+			require.Len(t, delegations, 1)
+		} else {
+			require.Empty(t, delegations, status)
+		}
+	}
+
+	_, err = stakingIndexer.GetStakerDelegationsByStatus(stakingData.StakerKey, "unknown")
+	require.Error(t, err)
+}
+
+// TestPendingUnbonding tests that an unconfirmed unbonding tx is deducted
+// from the TVL only once it has the configured number of confirmations,
+// and that it does not affect the TVL if it is reorged out before that
+func TestPendingUnbonding(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.UnbondingConfirmations = 3
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// make sure the staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+
+	stakingHeight := int32(params.ActivationHeight)
+	err = stakingIndexer.HandleConfirmedBlock(&types.IndexedBlock{
+		Height: stakingHeight,
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingTx},
+	})
+	require.NoError(t, err)
+
+	// unconfirmedBlocks returns the unconfirmed blocks above the staking tx
+	// up to the given tip, the first of which includes the unbonding tx if
+	// withUnbonding is set
+	unconfirmedBlocks := func(tipHeight int32, withUnbonding bool) []*types.IndexedBlock {
+		blocks := make([]*types.IndexedBlock, 0)
+		for h := stakingHeight + 1; h <= tipHeight; h++ {
+			b := &types.IndexedBlock{Height: h}
+			if h == stakingHeight+1 && withUnbonding {
+				b.Txs = []*btcutil.Tx{unbondingTx}
+			}
+			blocks = append(blocks, b)
+		}
+		return blocks
+	}
+
+	for _, tc := range []struct {
+		name          string
+		blocks        []*types.IndexedBlock
+		expectedDelta btcutil.Amount
+	}{
+		{"unbonding tx is pending", unconfirmedBlocks(stakingHeight+2, true), 0},
+		{"unbonding tx is reorged out", unconfirmedBlocks(stakingHeight+3, false), 0},
+		{"unbonding tx reaches the confirmations", unconfirmedBlocks(stakingHeight+3, true), -stakingData.StakingAmount},
+	} {
+		tvlInUnconfirmedBlocks, err := stakingIndexer.CalculateTvlInUnconfirmedBlocks(tc.blocks)
+		require.NoError(t, err, tc.name)
+		require.Equal(t, tc.expectedDelta, tvlInUnconfirmedBlocks, tc.name)
+
+		// the confirmed TVL is not affected by the unconfirmed blocks
+		confirmedTvl, err := stakingIndexer.GetConfirmedTvl()
+		require.NoError(t, err)
+		require.Equal(t, uint64(stakingData.StakingAmount), confirmedTvl, tc.name)
+	}
+}
+
+// TestPendingConfirmedUnbonding tests that a confirmed unbonding tx is held
+// pending until it has the configured number of confirmations when that is
+// higher than the confirmation depth, so that its stake still counts for the
+// eligibility of later staking txs, and that a reorg before the threshold
+// leaves the stake in the TVL
+func TestPendingConfirmedUnbonding(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+
+	// the staking cap only allows one staking tx at a time
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	stakingData3 := datagen.GenerateTestStakingData(t, r, params)
+	params.CapHeight = 0
+	params.StakingCap = stakingData1.StakingAmount
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.UnbondingConfirmations = uint32(params.ConfirmationDepth) + 3
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	_, stakingTx3 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData3)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+
+	requireTvl := func(expected btcutil.Amount) {
+		tvl, err := stakingIndexer.GetConfirmedTvl()
+		require.NoError(t, err)
+		require.Equal(t, uint64(expected), tvl)
+		totalScore, err := stakingIndexer.GetTotalScore()
+		require.NoError(t, err)
+		require.Equal(t, uint64(expected), totalScore)
+	}
+	requirePending := func(pending bool) {
+		isPending, err := stakingIndexer.IsUnbondingPending(stakingTx1.Hash())
+		require.NoError(t, err)
+		require.Equal(t, pending, isPending)
+		storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTx1.Hash())
+		require.NoError(t, err)
+		if pending {
+			require.Equal(t, indexerstore.StakingStatusStaked, storedTx.Status)
+		} else {
+			require.Equal(t, indexerstore.StakingStatusUnbonding, storedTx.Status)
+		}
+	}
+
+	// the unbonding tx is held pending in the confirmed block
+	startHeight := int32(params.ActivationHeight)
+	unbondingHeight := startHeight + 1
+	for i, txs := range [][]*btcutil.Tx{{stakingTx1}, {unbondingTx}} {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: startHeight + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		})
+		require.NoError(t, err)
+	}
+	storedUnbondingTx, err := stakingIndexer.GetUnbondingTxByHash(unbondingTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedUnbondingTx)
+	requirePending(true)
+	requireTvl(stakingData1.StakingAmount)
+
+	// the pending unbonding tx is deducted from the unconfirmed TVL only
+	// once it has the required confirmations given the tip
+	applyHeight := unbondingHeight + int32(cfg.UnbondingConfirmations) - 1
+	for _, tc := range []struct {
+		tipHeight     int32
+		expectedDelta btcutil.Amount
+	}{
+		{applyHeight - 1, 0},
+		{applyHeight, -stakingData1.StakingAmount},
+	} {
+		tvlInUnconfirmedBlocks, err := stakingIndexer.CalculateTvlInUnconfirmedBlocks(
+			[]*types.IndexedBlock{{Height: tc.tipHeight}})
+		require.NoError(t, err)
+		require.Equal(t, tc.expectedDelta, tvlInUnconfirmedBlocks)
+	}
+
+	// the stake of the pending unbonding tx still counts for the eligibility
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: unbondingHeight + 1,
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingTx2},
+	})
+	require.NoError(t, err)
+	storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTx2.Hash())
+	require.NoError(t, err)
+	require.True(t, storedTx.IsOverflow)
+	requirePending(true)
+	requireTvl(stakingData1.StakingAmount)
+
+	// a reorg of the block including the unbonding tx halts the indexer
+	// before the threshold, and the stake is never deducted
+	err = stakingIndexer.HandleConfirmedBlock(&types.IndexedBlock{
+		Height: unbondingHeight,
+		Header: &wire.BlockHeader{Timestamp: time.Now(), Nonce: 1},
+	})
+	require.ErrorIs(t, err, indexer.ErrReorgDetected)
+	requirePending(true)
+	requireTvl(stakingData1.StakingAmount)
+
+	// the block confirmed at the tip the unbonding tx reaches the threshold
+	// applies it before its staking txs are processed
+	for h := unbondingHeight + 2; h < applyHeight-int32(params.ConfirmationDepth)+1; h++ {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: h,
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+		})
+		require.NoError(t, err)
+		requirePending(true)
+	}
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: applyHeight - int32(params.ConfirmationDepth) + 1,
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingTx3},
+	})
+	require.NoError(t, err)
+	requirePending(false)
+	storedTx, err = stakingIndexer.GetStakingTxByHash(stakingTx3.Hash())
+	require.NoError(t, err)
+	require.False(t, storedTx.IsOverflow)
+	tvl, err := stakingIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Equal(t, uint64(stakingData3.StakingAmount), tvl)
+}
+
+// TestOverrideEligibility tests that the eligibility of a staking tx can be
+// manually overridden, and that the override is kept and logged when the
+// staking tx is processed again
+func TestOverrideEligibility(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+
+	// the staking cap only allows the first staking tx
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	params.CapHeight = 0
+	params.StakingCap = stakingData1.StakingAmount
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	core, logs := observer.New(zap.InfoLevel)
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.New(core), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	blocks := []*types.IndexedBlock{
+		{
+			Height: int32(params.ActivationHeight),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    []*btcutil.Tx{stakingTx1},
+		},
+		{
+			Height: int32(params.ActivationHeight) + 1,
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    []*btcutil.Tx{stakingTx2},
+		},
+	}
+	for _, b := range blocks {
+		err := handleLinkedBlock(t, stakingIndexer, b)
+		require.NoError(t, err)
+	}
+
+	requireEligibility := func(txHash *chainhash.Hash, eligible bool, reason indexerstore.InactiveReason, overridden bool) {
+		storedTx, err := stakingIndexer.GetStakingTxByHash(txHash)
+		require.NoError(t, err)
+		require.Equal(t, !eligible, storedTx.IsOverflow)
+		require.Equal(t, reason, storedTx.InactiveReason)
+		require.Equal(t, overridden, storedTx.EligibilityOverridden)
+	}
+	requireTvl := func(expected btcutil.Amount) {
+		tvl, err := stakingIndexer.GetConfirmedTvl()
+		require.NoError(t, err)
+		require.Equal(t, uint64(expected), tvl)
+		totalScore, err := stakingIndexer.GetTotalScore()
+		require.NoError(t, err)
+		require.Equal(t, uint64(expected), totalScore)
+	}
+
+	requireEligibility(stakingTx1.Hash(), true, indexerstore.InactiveReasonNone, false)
+	requireEligibility(stakingTx2.Hash(), false, indexerstore.InactiveReasonStakingCap, false)
+	requireTvl(stakingData1.StakingAmount)
+
+	// the inactive reason should match the eligibility
+	err = stakingIndexer.OverrideEligibility(stakingTx1.Hash(), false, indexerstore.InactiveReasonNone)
+	require.ErrorIs(t, err, indexer.ErrInvalidEligibilityOverride)
+	err = stakingIndexer.OverrideEligibility(stakingTx2.Hash(), true, indexerstore.InactiveReasonManual)
+	require.ErrorIs(t, err, indexer.ErrInvalidEligibilityOverride)
+	err = stakingIndexer.OverrideEligibility(&chainhash.Hash{}, false, indexerstore.InactiveReasonManual)
+	require.ErrorIs(t, err, indexer.ErrStakingTxNotFound)
+
+	// swap the eligibility of the staking txs
+	err = stakingIndexer.OverrideEligibility(stakingTx1.Hash(), false, indexerstore.InactiveReasonManual)
+	require.NoError(t, err)
+	err = stakingIndexer.OverrideEligibility(stakingTx2.Hash(), true, indexerstore.InactiveReasonNone)
+	require.NoError(t, err)
+	requireEligibility(stakingTx1.Hash(), false, indexerstore.InactiveReasonManual, true)
+	requireEligibility(stakingTx2.Hash(), true, indexerstore.InactiveReasonNone, true)
+	requireTvl(stakingData2.StakingAmount)
+	require.Equal(t, 2, logs.FilterMessage("the eligibility of the staking tx is manually overridden").Len())
+
+	counts, err := stakingIndexer.GetEligibilityCounts()
+	require.NoError(t, err)
+	require.Equal(t, 1, counts.Active)
+	require.Equal(t, map[indexerstore.InactiveReason]int{indexerstore.InactiveReasonManual: 1}, counts.InactiveByReason)
+
+	// processing the blocks again, e.g., after restart, keeps the overrides
+	for _, b := range blocks {
+		err := handleLinkedBlock(t, stakingIndexer, b)
+		require.NoError(t, err)
+	}
+	requireEligibility(stakingTx1.Hash(), false, indexerstore.InactiveReasonManual, true)
+	requireEligibility(stakingTx2.Hash(), true, indexerstore.InactiveReasonNone, true)
+	requireTvl(stakingData2.StakingAmount)
+	require.Equal(t, 2, logs.FilterMessage("keeping the manually overridden eligibility of the staking tx").Len())
+
+	// the stake of an unbonded staking tx is not counted regardless of
+	// the overrides
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData2, stakingTx2.Hash(), 0)
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: int32(params.ActivationHeight) + 2,
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{unbondingTx},
+	})
+	require.NoError(t, err)
+	requireTvl(0)
+	err = stakingIndexer.OverrideEligibility(stakingTx2.Hash(), false, indexerstore.InactiveReasonManual)
+	require.NoError(t, err)
+	requireTvl(0)
+	err = stakingIndexer.OverrideEligibility(stakingTx2.Hash(), true, indexerstore.InactiveReasonNone)
+	require.NoError(t, err)
+	requireTvl(0)
+}
+
+// TestOverrideEligibilityPendingUnbonding tests that overriding the
+// eligibility of a staking tx of which the unbonding is pending in either
+// direction leaves the TVL, the total score, and the active stakes of the
+// staker and the finality provider right once the unbonding is applied
+func TestOverrideEligibilityPendingUnbonding(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for _, eligibleBefore := range []bool{true, false} {
+		t.Run(fmt.Sprintf("eligible before %v", eligibleBefore), func(t *testing.T) {
+			cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+
+			sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+			// the txs are processed in the blocks following the activation
+			// height, which should not activate another params version
+			sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+			params := sysParamsVersions.Versions[0]
+			// make sure the staking cap is never reached
+			params.CapHeight = 0
+			params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+			cfg.UnbondingConfirmations = uint32(params.ConfirmationDepth) + 3
+
+			db, err := cfg.DatabaseConfig.GetDbBackend()
+			require.NoError(t, err)
+			defer func() {
+				err := db.Close()
+				require.NoError(t, err)
+			}()
+			mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+			stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+			require.NoError(t, err)
+			// the active stakes are only read from the store
+			is, err := indexerstore.NewIndexerStore(db)
+			require.NoError(t, err)
+
+			// the kept staking tx stays active
+			keptData := datagen.GenerateTestStakingData(t, r, params)
+			_, keptTx := datagen.GenerateStakingTxFromTestData(t, r, params, keptData)
+			stakingData := datagen.GenerateTestStakingData(t, r, params)
+			_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+			unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+
+			height := int32(params.ActivationHeight)
+			handleBlock := func(txs ...*btcutil.Tx) {
+				err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+					Height: height,
+					Header: &wire.BlockHeader{Timestamp: time.Now()},
+					Txs:    txs,
+				})
+				require.NoError(t, err)
+				height++
+			}
+			requireCounters := func(stake btcutil.Amount) {
+				tvl, err := stakingIndexer.GetConfirmedTvl()
+				require.NoError(t, err)
+				require.Equal(t, uint64(keptData.StakingAmount+stake), tvl)
+				totalScore, err := stakingIndexer.GetTotalScore()
+				require.NoError(t, err)
+				require.Equal(t, uint64(keptData.StakingAmount+stake), totalScore)
+				stakerStake, err := is.GetStakerActiveStake(stakingData.StakerKey)
+				require.NoError(t, err)
+				require.Equal(t, uint64(stake), stakerStake)
+				fpStake, err := is.GetFinalityProviderActiveStake(stakingData.FinalityProviderKey)
+				require.NoError(t, err)
+				require.Equal(t, uint64(stake), fpStake)
+				keptStakerStake, err := is.GetStakerActiveStake(keptData.StakerKey)
+				require.NoError(t, err)
+				require.Equal(t, uint64(keptData.StakingAmount), keptStakerStake)
+			}
+			override := func(eligible bool) {
+				reason := indexerstore.InactiveReasonNone
+				if !eligible {
+					reason = indexerstore.InactiveReasonManual
+				}
+				err := stakingIndexer.OverrideEligibility(stakingTx.Hash(), eligible, reason)
+				require.NoError(t, err)
+			}
+
+			handleBlock(keptTx, stakingTx)
+			if !eligibleBefore {
+				override(false)
+			}
+
+			// the unbonding tx is held pending
+			handleBlock(unbondingTx)
+			pending, err := stakingIndexer.IsUnbondingPending(stakingTx.Hash())
+			require.NoError(t, err)
+			require.True(t, pending)
+
+			// the override adjusts the counters as for a staked tx
+			override(!eligibleBefore)
+			if eligibleBefore {
+				requireCounters(0)
+			} else {
+				requireCounters(stakingData.StakingAmount)
+			}
+
+			// the stake is not counted once the unbonding is applied
+			for pending {
+				handleBlock()
+				pending, err = stakingIndexer.IsUnbondingPending(stakingTx.Hash())
+				require.NoError(t, err)
+			}
+			requireCounters(0)
+		})
+	}
+}
+
+// TestGetBlockStats tests that the number of the staking, unbonding, and
+// withdrawal txs of a processed block is returned and all the numbers of an
+// empty block or an unprocessed height are 0
+func TestGetBlockStats(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// 1. stake twice in the first block
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	// 2. in the busy block, stake three more times, unbond the first
+	// staking tx, and withdraw the second one
+	busyStakingTxs := make([]*btcutil.Tx, 0, 3)
+	for i := 0; i < 3; i++ {
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		busyStakingTxs = append(busyStakingTxs, stakingTx)
+	}
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+	withdrawTx := datagen.GenerateWithdrawalTxFromStaking(t, r, params, stakingData2, stakingTx2.Hash(), 0)
+
+	height := uint64(params.ActivationHeight)
+	for i, txs := range [][]*btcutil.Tx{
+		{stakingTx1, stakingTx2},
+		append(busyStakingTxs, unbondingTx, withdrawTx),
+		{},
+	} {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: int32(height) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		})
+		require.NoError(t, err)
+	}
+
+	stakingCount, unbondingCount, withdrawalCount, err := stakingIndexer.GetBlockStats(height)
+	require.NoError(t, err)
+	require.Equal(t, 2, stakingCount)
+	require.Zero(t, unbondingCount)
+	require.Zero(t, withdrawalCount)
+
+	stakingCount, unbondingCount, withdrawalCount, err = stakingIndexer.GetBlockStats(height + 1)
+	require.NoError(t, err)
+	require.Equal(t, len(busyStakingTxs), stakingCount)
+	require.Equal(t, 1, unbondingCount)
+	require.Equal(t, 1, withdrawalCount)
+
+	// the empty block and the unprocessed height have no txs
+	for _, h := range []uint64{height + 2, height + 3} {
+		stakingCount, unbondingCount, withdrawalCount, err = stakingIndexer.GetBlockStats(h)
+		require.NoError(t, err)
+		require.Zero(t, stakingCount)
+		require.Zero(t, unbondingCount)
+		require.Zero(t, withdrawalCount)
+	}
+}
+
+// TestEventFieldFiltering tests that the raw txs are omitted from the
+// events or stripped of the witness data as configured, while the
+// identifiers are always kept
+func TestEventFieldFiltering(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+	// the unbonding tx spends the staking output through the witness, a
+	// witness is added to the staking tx as well, which does not change
+	// the tx hash
+	stakingTx.MsgTx().TxIn[0].Witness = wire.TxWitness{bbndatagen.GenRandomByteArray(r, 64)}
+	require.NotEmpty(t, unbondingTx.MsgTx().TxIn[0].Witness)
+
+	serialize := func(tx *btcutil.Tx, withWitness bool) string {
+		var buf bytes.Buffer
+		if withWitness {
+			require.NoError(t, tx.MsgTx().Serialize(&buf))
+		} else {
+			require.NoError(t, tx.MsgTx().SerializeNoWitness(&buf))
+		}
+		return hex.EncodeToString(buf.Bytes())
+	}
+
+	testCases := []struct {
+		name                   string
+		excludedFields         []string
+		expectedStakingTxHex   string
+		expectedUnbondingTxHex string
+	}{
+		{
+			name:                   "no excluded fields",
+			expectedStakingTxHex:   serialize(stakingTx, true),
+			expectedUnbondingTxHex: serialize(unbondingTx, true),
+		},
+		{
+			name:                   "witness excluded",
+			excludedFields:         []string{config.EventFieldWitness},
+			expectedStakingTxHex:   serialize(stakingTx, false),
+			expectedUnbondingTxHex: serialize(unbondingTx, false),
+		},
+		{
+			name:           "raw tx excluded",
+			excludedFields: []string{config.EventFieldTxHex, config.EventFieldWitness},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+			cfg.ExcludedEventFields = tc.excludedFields
+			require.NoError(t, cfg.Validate())
+
+			db, err := cfg.DatabaseConfig.GetDbBackend()
+			require.NoError(t, err)
+			defer func() {
+				err := db.Close()
+				require.NoError(t, err)
+			}()
+
+			var (
+				stakingEvent   *queuecli.ActiveStakingEvent
+				unbondingEvent *queuecli.UnbondingStakingEvent
+			)
+			mockedConsumer := mocks.NewMockEventConsumer(gomock.NewController(t))
+			mockedConsumer.EXPECT().PushStakingEvent(gomock.Any()).DoAndReturn(
+				func(ev *queuecli.ActiveStakingEvent) error {
+					stakingEvent = ev
+					return nil
+				}).Times(1)
+			mockedConsumer.EXPECT().PushUnbondingEvent(gomock.Any()).DoAndReturn(
+				func(ev *queuecli.UnbondingStakingEvent) error {
+					unbondingEvent = ev
+					return nil
+				}).Times(1)
+
+			mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+			stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), mockedConsumer, db, sysParamsVersions, mockBtcScanner)
+			require.NoError(t, err)
+
+			err = stakingIndexer.HandleConfirmedBlock(&types.IndexedBlock{
+				Height: int32(params.ActivationHeight),
+				Header: &wire.BlockHeader{Timestamp: time.Now()},
+				Txs:    []*btcutil.Tx{stakingTx, unbondingTx},
+			})
+			require.NoError(t, err)
+
+			require.NotNil(t, stakingEvent)
+			require.Equal(t, tc.expectedStakingTxHex, stakingEvent.StakingTxHex)
+			require.Equal(t, stakingTx.Hash().String(), stakingEvent.StakingTxHashHex)
+			require.Equal(t, hex.EncodeToString(schnorr.SerializePubKey(stakingData.StakerKey)), stakingEvent.StakerPkHex)
+
+			require.NotNil(t, unbondingEvent)
+			require.Equal(t, tc.expectedUnbondingTxHex, unbondingEvent.UnbondingTxHex)
+			require.Equal(t, unbondingTx.Hash().String(), unbondingEvent.UnbondingTxHashHex)
+			require.Equal(t, stakingTx.Hash().String(), unbondingEvent.StakingTxHashHex)
+
+			// the stored txs keep the witness data
+			storedStakingTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+			require.NoError(t, err)
+			require.Equal(t, stakingTx.MsgTx().TxIn[0].Witness, storedStakingTx.Tx.TxIn[0].Witness)
+		})
+	}
+}
+
+// TestSelfTestStakingTx tests that the self-test reports the result of each
+// check and stops at the first failed check
+func TestSelfTestStakingTx(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+	height := params.ActivationHeight
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	invalidStakingData := datagen.GenerateTestStakingData(t, r, params)
+	invalidStakingData.StakingTime = params.MaxStakingTime + 1
+	_, invalidStakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, invalidStakingData)
+
+	newIndexer := func(perStakerCap uint64) *indexer.StakingIndexer {
+		cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+		cfg.PerStakerCap = perStakerCap
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			err := db.Close()
+			require.NoError(t, err)
+		})
+		// the self-test does not migrate the db
+		_, err = indexer.NewSelfTestStakingIndexer(cfg, zap.NewNop(), db, sysParamsVersions)
+		require.ErrorIs(t, err, indexerstore.ErrOutdatedDbVersion)
+		_, err = indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, nil)
+		require.NoError(t, err)
+		stakingIndexer, err := indexer.NewSelfTestStakingIndexer(cfg, zap.NewNop(), db, sysParamsVersions)
+		require.NoError(t, err)
+		return stakingIndexer
+	}
+	stakingIndexer := newIndexer(0)
+
+	testCases := []struct {
+		name   string
+		si     *indexer.StakingIndexer
+		tx     *wire.MsgTx
+		height uint64
+		// the name of the failed check, which is empty if all the checks pass
+		failedCheck string
+	}{
+		{
+			name:   "valid staking tx",
+			si:     stakingIndexer,
+			tx:     stakingTx.MsgTx(),
+			height: height,
+		},
+		{
+			name:        "no params for the height",
+			si:          stakingIndexer,
+			tx:          stakingTx.MsgTx(),
+			height:      height - 1,
+			failedCheck: indexer.SelfTestCheckParams,
+		},
+		{
+			name:        "not a staking tx",
+			si:          stakingIndexer,
+			tx:          bbndatagen.GenRandomTx(r),
+			height:      height,
+			failedCheck: indexer.SelfTestCheckParse,
+		},
+		{
+			name:        "staking time too high",
+			si:          stakingIndexer,
+			tx:          invalidStakingTx.MsgTx(),
+			height:      height,
+			failedCheck: indexer.SelfTestCheckValidate,
+		},
+		{
+			name:        "exceeding the per-staker cap",
+			si:          newIndexer(1),
+			tx:          stakingTx.MsgTx(),
+			height:      height,
+			failedCheck: indexer.SelfTestCheckEligibility,
+		},
+	}
+
+	allChecks := []string{
+		indexer.SelfTestCheckParams,
+		indexer.SelfTestCheckParse,
+		indexer.SelfTestCheckValidate,
+		indexer.SelfTestCheckEligibility,
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			checks := tc.si.SelfTestStakingTx(tc.tx, tc.height)
+
+			expectedChecks := allChecks
+			if tc.failedCheck != "" {
+				for i, name := range allChecks {
+					if name == tc.failedCheck {
+						expectedChecks = allChecks[:i+1]
+						break
+					}
+				}
+			}
+			require.Len(t, checks, len(expectedChecks))
+			for i, check := range checks {
+				require.Equal(t, expectedChecks[i], check.Name)
+				if check.Name == tc.failedCheck {
+					require.False(t, check.Passed)
+					require.NotEmpty(t, check.Detail)
+				} else {
+					require.True(t, check.Passed)
+				}
+			}
+		})
+	}
+
+	// the self-test does not change the store
+	storedStakingTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+	require.NoError(t, err)
+	require.Nil(t, storedStakingTx)
+	confirmedTvl, err := stakingIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Zero(t, confirmedTvl)
+}
+
+// TestStateHash tests that two indexers processing the same blocks have the
+// same state hash at each height, which is kept when a block is processed
+// again, while a different block leads to a different state hash
+func TestStateHash(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+	withdrawTx := datagen.GenerateWithdrawalTxFromStaking(t, r, params, stakingData2, stakingTx2.Hash(), 0)
+
+	height := int32(params.ActivationHeight)
+	blocks := []*types.IndexedBlock{
+		{Height: height, Header: &wire.BlockHeader{Timestamp: time.Now()}, Txs: []*btcutil.Tx{stakingTx1, stakingTx2}},
+		{Height: height + 1, Header: &wire.BlockHeader{Timestamp: time.Now()}},
+		{Height: height + 2, Header: &wire.BlockHeader{Timestamp: time.Now()}, Txs: []*btcutil.Tx{unbondingTx, withdrawTx}},
+	}
+
+	newIndexer := func() *indexer.StakingIndexer {
+		cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			err := db.Close()
+			require.NoError(t, err)
+		})
+		mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+		require.NoError(t, err)
+		return stakingIndexer
+	}
+
+	indexerA, indexerB := newIndexer(), newIndexer()
+	stateHashes := make(map[chainhash.Hash]struct{})
+	for _, b := range blocks {
+		require.NoError(t, handleLinkedBlock(t, indexerA, b))
+		require.NoError(t, handleLinkedBlock(t, indexerB, b))
+
+		stateHashA, err := indexerA.GetStateHash(uint64(b.Height))
+		require.NoError(t, err)
+		require.NotNil(t, stateHashA)
+		stateHashB, err := indexerB.GetStateHash(uint64(b.Height))
+		require.NoError(t, err)
+		require.Equal(t, stateHashA, stateHashB)
+
+		// the state hash commits to the previous ones, so even the
+		// empty block has a distinct state hash
+		require.NotContains(t, stateHashes, *stateHashA)
+		stateHashes[*stateHashA] = struct{}{}
+	}
+
+	// processing a block again keeps its state hash
+	lastHeight := uint64(blocks[len(blocks)-1].Height)
+	stateHash, err := indexerA.GetStateHash(lastHeight)
+	require.NoError(t, err)
+	require.NoError(t, handleLinkedBlock(t, indexerA, blocks[len(blocks)-1]))
+	replayedStateHash, err := indexerA.GetStateHash(lastHeight)
+	require.NoError(t, err)
+	require.Equal(t, stateHash, replayedStateHash)
+
+	// the height not processed yet has no state hash
+	stateHash, err = indexerA.GetStateHash(lastHeight + 1)
+	require.NoError(t, err)
+	require.Nil(t, stateHash)
+
+	// an indexer missing a tx of the first block diverges from the
+	// first height on
+	indexerC := newIndexer()
+	require.NoError(t, handleLinkedBlock(t, indexerC, &types.IndexedBlock{
+		Height: height,
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingTx1},
+	}))
+	require.NoError(t, handleLinkedBlock(t, indexerC, blocks[1]))
+	for _, h := range []uint64{uint64(height), uint64(height) + 1} {
+		stateHashA, err := indexerA.GetStateHash(h)
+		require.NoError(t, err)
+		stateHashC, err := indexerC.GetStateHash(h)
+		require.NoError(t, err)
+		require.NotEqual(t, stateHashA, stateHashC)
+	}
+}
+
+// TestInclusionProofs tests that the merkle inclusion proofs of the staking
+// and unbonding txs are stored if enabled and validate against the merkle
+// root of the stored block header
+func TestInclusionProofs(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+
+	// the blocks have other txs around the staking and unbonding txs
+	newBlock := func(height int32, txs ...*btcutil.Tx) *types.IndexedBlock {
+		blockTxs := []*btcutil.Tx{btcutil.NewTx(bbndatagen.GenRandomTx(r))}
+		for _, tx := range txs {
+			blockTxs = append(blockTxs, tx, btcutil.NewTx(bbndatagen.GenRandomTx(r)))
+		}
+		merkleTree := blockchain.BuildMerkleTreeStore(blockTxs, false)
+		return &types.IndexedBlock{
+			Height: height,
+			Header: &wire.BlockHeader{
+				MerkleRoot: *merkleTree[len(merkleTree)-1],
+				Timestamp:  time.Now(),
+			},
+			Txs: blockTxs,
+		}
+	}
+	height := int32(params.ActivationHeight)
+	blocks := []*types.IndexedBlock{
+		newBlock(height, stakingTx1, stakingTx2),
+		newBlock(height+1, unbondingTx),
+	}
+
+	newIndexer := func(inclusionProofsEnabled bool) *indexer.StakingIndexer {
+		cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+		cfg.InclusionProofsEnabled = inclusionProofsEnabled
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			err := db.Close()
+			require.NoError(t, err)
+		})
+		mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+		require.NoError(t, err)
+		for _, b := range blocks {
+			require.NoError(t, handleLinkedBlock(t, stakingIndexer, b))
+		}
+		return stakingIndexer
+	}
+
+	stakingIndexer := newIndexer(true)
+	for _, tc := range []struct {
+		tx    *btcutil.Tx
+		block *types.IndexedBlock
+	}{
+		{tx: stakingTx1, block: blocks[0]},
+		{tx: stakingTx2, block: blocks[0]},
+		{tx: unbondingTx, block: blocks[1]},
+	} {
+		proof, err := stakingIndexer.GetInclusionProof(tc.tx.Hash())
+		require.NoError(t, err)
+		require.NotNil(t, proof)
+		require.Equal(t, uint64(tc.block.Height), proof.Height)
+		require.Equal(t, tc.block.BlockHash(), proof.BlockHeader.BlockHash())
+		require.Equal(t, tc.tx.Hash(), tc.block.Txs[proof.TxIndex].Hash())
+		require.True(t, proof.Verify(tc.tx.Hash()))
+
+		// the proof does not validate for another tx
+		require.False(t, proof.Verify(tc.block.Txs[0].Hash()))
+	}
+
+	// the other txs in the blocks have no proofs
+	proof, err := stakingIndexer.GetInclusionProof(blocks[0].Txs[0].Hash())
+	require.NoError(t, err)
+	require.Nil(t, proof)
+
+	// no proof is stored if not enabled
+	proof, err = newIndexer(false).GetInclusionProof(stakingTx1.Hash())
+	require.NoError(t, err)
+	require.Nil(t, proof)
+}
+
+// TestMetricsPushOnStop tests that the metrics are pushed to the configured
+// pushgateway once the indexer stops, and a failed push does not fail the
+// stop
+func TestMetricsPushOnStop(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+
+	for _, pushStatus := range []int{http.StatusOK, http.StatusInternalServerError} {
+		// the stub pushgateway records the pushes
+		var (
+			mu     sync.Mutex
+			pushes []string
+		)
+		pushGateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			require.NotEmpty(t, body)
+
+			mu.Lock()
+			pushes = append(pushes, req.Method+" "+req.URL.Path)
+			mu.Unlock()
+			w.WriteHeader(pushStatus)
+		}))
+		getPushes := func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), pushes...)
+		}
+
+		cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+		cfg.MetricsConfig.PushGatewayURL = pushGateway.URL
+		cfg.MetricsConfig.PushJob = "sid-test"
+		require.NoError(t, cfg.Validate())
+
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+		require.NoError(t, err)
+
+		err = stakingIndexer.Start(stakingIndexer.GetStartHeight())
+		require.NoError(t, err)
+		require.Empty(t, getPushes())
+
+		// the final push is made once on stop
+		err = stakingIndexer.Stop()
+		require.NoError(t, err)
+		err = stakingIndexer.Stop()
+		require.NoError(t, err)
+		require.Equal(t, []string{http.MethodPut + " /metrics/job/sid-test"}, getPushes())
+
+		pushGateway.Close()
+		require.NoError(t, db.Close())
+	}
+}
+
+// TestGetRemainingCap tests that the remaining staking cap is computed per
+// staking cap policy from the TVL at the time of the last processed block,
+// and an error is returned if the staking is capped by height
+func TestGetRemainingCap(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	stakingAmount := stakingData.StakingAmount
+
+	// setCaps sets the caps of all the params versions so that the
+	// params of the next block have the same caps
+	setCaps := func(stakingCap btcutil.Amount, capHeight uint64) {
+		for _, p := range sysParamsVersions.Versions {
+			p.StakingCap = stakingCap
+			p.CapHeight = capHeight
+		}
+	}
+
+	unbounded := indexer.UnboundedRemainingCap
+	testCases := []struct {
+		name       string
+		policy     string
+		capWindow  time.Duration
+		blockAge   time.Duration
+		stakingCap btcutil.Amount
+		// the age of the empty block processed after the
+		// staking tx, no block is processed if 0
+		nextBlockAge time.Duration
+		initial      btcutil.Amount
+		expected     btcutil.Amount
+	}{
+		// any staking tx is active while the TVL is below the cap
+		{"reach under the cap", config.StakingCapPolicyReach, 0, 0, stakingAmount + 1000, 0, unbounded, unbounded},
+		{"reach exactly at the cap", config.StakingCapPolicyReach, 0, 0, stakingAmount, 0, unbounded, 0},
+		// the staking tx is active as the TVL is below
+		// the cap before it, and the TVL exceeds the cap
+		{"reach over the cap", config.StakingCapPolicyReach, 0, 0, stakingAmount - 1, 0, unbounded, 0},
+		// the TVL can reach the cap
+		{"fill under the cap", config.StakingCapPolicyFill, 0, 0, stakingAmount + 1000, 0, stakingAmount + 1000, 1000},
+		{"fill exactly at the cap", config.StakingCapPolicyFill, 0, 0, stakingAmount, 0, stakingAmount, 0},
+		// the TVL has to stay below the cap
+		{"below under the cap", config.StakingCapPolicyBelow, 0, 0, stakingAmount + 1000, 0, stakingAmount + 999, 999},
+		{"below one under the cap", config.StakingCapPolicyBelow, 0, 0, stakingAmount + 1, 0, stakingAmount, 0},
+		// the cap window is anchored at the last processed
+		// block, so the old staking tx still counts
+		{"within the cap window", config.StakingCapPolicyFill, time.Hour, 2 * time.Hour, stakingAmount + 1000, 0, stakingAmount + 1000, 1000},
+		// the staking tx out of the window of the last
+		// processed block does not count
+		{"out of the cap window", config.StakingCapPolicyFill, time.Hour, 3 * time.Hour, stakingAmount + 1000, time.Minute, stakingAmount + 1000, stakingAmount + 1000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setCaps(tc.stakingCap, 0)
+
+			cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+			cfg.StakingCapPolicy = tc.policy
+			cfg.CapWindow = tc.capWindow
+			db, err := cfg.DatabaseConfig.GetDbBackend()
+			require.NoError(t, err)
+			defer func() {
+				err := db.Close()
+				require.NoError(t, err)
+			}()
+			mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+			stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+			require.NoError(t, err)
+
+			// the whole cap remains before any block is processed
+			remainingCap, err := stakingIndexer.GetRemainingCap()
+			require.NoError(t, err)
+			require.Equal(t, tc.initial, remainingCap)
+
+			err = stakingIndexer.HandleConfirmedBlock(&types.IndexedBlock{
+				Height: int32(params.ActivationHeight),
+				Header: &wire.BlockHeader{Timestamp: time.Now().Add(-tc.blockAge)},
+				Txs:    []*btcutil.Tx{stakingTx},
+			})
+			require.NoError(t, err)
+			storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+			require.NoError(t, err)
+			require.False(t, storedTx.IsOverflow)
+
+			if tc.nextBlockAge != 0 {
+				err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+					Height: int32(params.ActivationHeight) + 1,
+					Header: &wire.BlockHeader{Timestamp: time.Now().Add(-tc.nextBlockAge)},
+				})
+				require.NoError(t, err)
+			}
+
+			remainingCap, err = stakingIndexer.GetRemainingCap()
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, remainingCap)
+
+			// the staking capped by height has no remaining amount
+			setCaps(0, params.ActivationHeight+1000)
+			_, err = stakingIndexer.GetRemainingCap()
+			require.ErrorIs(t, err, indexer.ErrTimeBasedCap)
+		})
+	}
+}
+
+// TestMaxStakingTxSize tests that a staking tx larger than the configured
+// max size is rejected as invalid while a smaller one is accepted
+func TestMaxStakingTxSize(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.ProcessingErrorLogSize = 10
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, underTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	_, overTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+
+	// pad the signature script of the txs to get the exact sizes
+	maxSize := underTx.MsgTx().SerializeSize()
+	if overTx.MsgTx().SerializeSize() > maxSize {
+		maxSize = overTx.MsgTx().SerializeSize()
+	}
+	maxSize += 10
+	cfg.MaxStakingTxSize = uint64(maxSize)
+	padTx := func(tx *btcutil.Tx, size int) *btcutil.Tx {
+		msgTx := tx.MsgTx()
+		for msgTx.SerializeSize() < size {
+			msgTx.TxIn[0].SignatureScript = append(msgTx.TxIn[0].SignatureScript, 0)
+		}
+		require.Equal(t, size, msgTx.SerializeSize())
+		return btcutil.NewTx(msgTx)
+	}
+	underTx = padTx(underTx, maxSize-1)
+	overTx = padTx(overTx, maxSize+1)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	height := params.ActivationHeight
+	err = stakingIndexer.HandleConfirmedBlock(&types.IndexedBlock{
+		Height: int32(height),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{underTx, overTx},
+	})
+	require.NoError(t, err)
+
+	storedTx, err := stakingIndexer.GetStakingTxByHash(underTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedTx)
+
+	storedTx, err = stakingIndexer.GetStakingTxByHash(overTx.Hash())
+	require.NoError(t, err)
+	require.Nil(t, storedTx)
+
+	processingErrors, err := stakingIndexer.GetRecentProcessingErrors(10)
+	require.NoError(t, err)
+	require.Len(t, processingErrors, 1)
+	require.Equal(t, overTx.Hash(), processingErrors[0].TxHash)
+	require.Contains(t, processingErrors[0].Error, indexer.ErrInvalidStakingTx.Error())
+
+	tvl, err := stakingIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Equal(t, uint64(stakingData.StakingAmount), tvl)
+}
+
+// TestActivationHeightInclusive tests that a params version applies to the
+// staking txs from exactly its activation height up to the height before
+// the activation height of the next version
+func TestActivationHeightInclusive(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:2]
+	for _, p := range sysParamsVersions.Versions {
+		p.CapHeight = 0
+		p.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+	}
+	params0, params1 := sysParamsVersions.Versions[0], sysParamsVersions.Versions[1]
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		height uint64
+		params *parser.ParsedVersionedGlobalParams
+		valid  bool
+	}{
+		{"below the activation height", params0.ActivationHeight - 1, params0, false},
+		{"exactly the activation height", params0.ActivationHeight, params0, true},
+		{"the last height of the version", params1.ActivationHeight - 1, params0, true},
+		{"the activation height of the next version", params1.ActivationHeight, params0, false},
+		{"exactly the activation height of the next version", params1.ActivationHeight, params1, true},
+		{"one above the activation height of the next version", params1.ActivationHeight + 1, params1, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stakingData := datagen.GenerateTestStakingData(t, r, tc.params)
+			_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, tc.params, stakingData)
+			err := stakingIndexer.ProcessStakingTx(
+				stakingTx.MsgTx(),
+				getParsedStakingData(stakingData, stakingTx.MsgTx(), tc.params),
+				tc.height, time.Now(), tc.params)
+			storedTx, getErr := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+			require.NoError(t, getErr)
+			if tc.valid {
+				require.NoError(t, err)
+				require.NotNil(t, storedTx)
+				require.Equal(t, tc.height, storedTx.InclusionHeight)
+			} else {
+				require.ErrorIs(t, err, indexer.ErrParamsHeightMismatch)
+				require.Nil(t, storedTx)
+			}
+		})
+	}
+}
+
+// TestActivationHeightExclusive tests that a params version applies to the
+// staking txs from the height after its activation height up to exactly the
+// activation height of the next version if the activation height is
+// configured as exclusive
+func TestActivationHeightExclusive(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	cfg.ExclusiveActivationHeight = true
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:2]
+	for _, p := range sysParamsVersions.Versions {
+		p.CapHeight = 0
+		p.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+	}
+	params0, params1 := sysParamsVersions.Versions[0], sysParamsVersions.Versions[1]
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// the given params are not modified while the reported
+	// activation heights are the first heights they apply to
+	versions := stakingIndexer.GetAllParamsVersions()
+	require.Equal(t, params0.ActivationHeight+1, versions[0].ActivationHeight)
+	require.Equal(t, params1.ActivationHeight, versions[0].EndHeight)
+	require.Equal(t, params1.ActivationHeight+1, versions[1].ActivationHeight)
+	require.Equal(t, params0.ActivationHeight, sysParamsVersions.Versions[0].ActivationHeight)
+
+	for _, tc := range []struct {
+		name   string
+		height uint64
+		params *parser.ParsedVersionedGlobalParams
+		valid  bool
+	}{
+		{"exactly the activation height", params0.ActivationHeight, params0, false},
+		{"one above the activation height", params0.ActivationHeight + 1, params0, true},
+		{"exactly the activation height of the next version", params1.ActivationHeight, params0, true},
+		{"the next version at its activation height", params1.ActivationHeight, params1, false},
+		{"one above the activation height of the next version", params1.ActivationHeight + 1, params1, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stakingData := datagen.GenerateTestStakingData(t, r, tc.params)
+			_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, tc.params, stakingData)
+			err := stakingIndexer.ProcessStakingTx(
+				stakingTx.MsgTx(),
+				getParsedStakingData(stakingData, stakingTx.MsgTx(), tc.params),
+				tc.height, time.Now(), tc.params)
+			storedTx, getErr := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+			require.NoError(t, getErr)
+			if tc.valid {
+				require.NoError(t, err)
+				require.NotNil(t, storedTx)
+				require.Equal(t, tc.height, storedTx.InclusionHeight)
+			} else {
+				require.ErrorIs(t, err, indexer.ErrParamsHeightMismatch)
+				require.Nil(t, storedTx)
+			}
+		})
+	}
+}
+
+// TestGetExpiringDelegations tests that only the staked delegations of
+// which the timelock expires within the window after the tip are returned
+func TestGetExpiringDelegations(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+	params.MaxStakingTime = params.MinStakingTime + 100
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	// the unbonding txs are held pending for a few blocks after confirmed
+	cfg.UnbondingConfirmations = uint32(params.ConfirmationDepth) + 3
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	genStakingTx := func(stakingTime uint16) (*datagen.TestStakingData, *btcutil.Tx) {
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		stakingData.StakingTime = stakingTime
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		return stakingData, stakingTx
+	}
+	minTime := params.MinStakingTime
+	_, firstTx := genStakingTx(minTime)
+	_, secondTx := genStakingTx(minTime + 1)
+	_, lateTx := genStakingTx(params.MaxStakingTime)
+	unbondedData, unbondedTx := genStakingTx(minTime + 1)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, unbondedData, unbondedTx.Hash(), 0)
+	pendingData, pendingTx := genStakingTx(minTime + 1)
+	pendingUnbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, pendingData, pendingTx.Hash(), 0)
+
+	height := params.ActivationHeight
+	for i, txs := range [][]*btcutil.Tx{
+		{secondTx, firstTx, lateTx, unbondedTx, pendingTx},
+		{unbondingTx},
+		{pendingUnbondingTx},
+	} {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: int32(height) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		})
+		require.NoError(t, err)
+	}
+	// the unbonding included later is still pending once the
+	// first one is applied
+	for tipHeight := int32(height) + 3; ; tipHeight++ {
+		pending, err := stakingIndexer.IsUnbondingPending(unbondedTx.Hash())
+		require.NoError(t, err)
+		if !pending {
+			break
+		}
+		err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: tipHeight,
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+		})
+		require.NoError(t, err)
+	}
+	pending, err := stakingIndexer.IsUnbondingPending(pendingTx.Hash())
+	require.NoError(t, err)
+	require.True(t, pending)
+
+	requireExpiring := func(tipHeight, withinBlocks uint64, expected ...*btcutil.Tx) {
+		delegations, err := stakingIndexer.GetExpiringDelegations(tipHeight, withinBlocks)
+		require.NoError(t, err)
+		require.Len(t, delegations, len(expected))
+		for i, d := range delegations {
+			require.Equal(t, *expected[i].Hash(), d.Tx.TxHash())
+		}
+	}
+
+	firstExpiry := height + uint64(minTime)
+	// the unbonded delegations, including the one of which the unbonding
+	// is pending, are excluded and the result is sorted by the expiry height
+	requireExpiring(firstExpiry-1, 2, firstTx, secondTx)
+	// the window is inclusive of its end
+	requireExpiring(firstExpiry-2, 2, firstTx)
+	requireExpiring(firstExpiry-3, 2)
+	// the expired delegations are excluded
+	requireExpiring(firstExpiry, 2, secondTx)
+	requireExpiring(firstExpiry-1, 0)
+	requireExpiring(firstExpiry-1, math.MaxUint64, firstTx, secondTx, lateTx)
+}
+
+// stakerBlocklistValidator rejects the staking txs and flags the unbonding
+// txs of the given staker
+type stakerBlocklistValidator struct {
+	blockedStakerPk *btcec.PublicKey
+}
+
+func (v *stakerBlocklistValidator) ValidateStakingTx(_ *wire.MsgTx, stakingData *btcstaking.ParsedV0StakingTx, _ uint64) error {
+	if bytes.Equal(schnorr.SerializePubKey(stakingData.OpReturnData.StakerPublicKey.PubKey), schnorr.SerializePubKey(v.blockedStakerPk)) {
+		return fmt.Errorf("the staker is blocked")
+	}
+	return nil
+}
+
+func (v *stakerBlocklistValidator) AuditUnbondingTx(_ *wire.MsgTx, stakingTx *indexerstore.StoredStakingTransaction, _ uint64) error {
+	if bytes.Equal(schnorr.SerializePubKey(stakingTx.StakerPk), schnorr.SerializePubKey(v.blockedStakerPk)) {
+		return fmt.Errorf("the staker is blocked")
+	}
+	return nil
+}
+
+// TestCustomValidator tests that the staking txs rejected by a registered
+// validator are not stored, while the flagged unbonding txs are recorded
+// as processing errors but still applied as they spend the staking txs
+func TestCustomValidator(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	cfg.ProcessingErrorLogSize = 10
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	allowedData := datagen.GenerateTestStakingData(t, r, params)
+	_, allowedTx := datagen.GenerateStakingTxFromTestData(t, r, params, allowedData)
+	blockedData := datagen.GenerateTestStakingData(t, r, params)
+	_, blockedTx := datagen.GenerateStakingTxFromTestData(t, r, params, blockedData)
+
+	// the staking tx of the staker is stored before the staker is blocked
+	height := params.ActivationHeight
+	_, earlierTx := datagen.GenerateStakingTxFromTestData(t, r, params, blockedData)
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: int32(height),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{earlierTx},
+	})
+	require.NoError(t, err)
+
+	err = stakingIndexer.AddValidator(&stakerBlocklistValidator{blockedStakerPk: blockedData.StakerKey})
+	require.NoError(t, err)
+
+	allowedUnbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, allowedData, allowedTx.Hash(), 0)
+	blockedUnbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, blockedData, earlierTx.Hash(), 0)
+	for i, txs := range [][]*btcutil.Tx{
+		{allowedTx, blockedTx},
+		{allowedUnbondingTx, blockedUnbondingTx},
+	} {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: int32(height) + 1 + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		})
+		require.NoError(t, err)
+	}
+
+	storedTx, err := stakingIndexer.GetStakingTxByHash(allowedTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedTx)
+	storedTx, err = stakingIndexer.GetStakingTxByHash(blockedTx.Hash())
+	require.NoError(t, err)
+	require.Nil(t, storedTx)
+
+	storedUnbondingTx, err := stakingIndexer.GetUnbondingTxByHash(allowedUnbondingTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedUnbondingTx)
+	storedUnbondingTx, err = stakingIndexer.GetUnbondingTxByHash(blockedUnbondingTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedUnbondingTx)
+
+	// the stake of the earlier staking tx is unbonded regardless
+	// of the rejection
+	storedTx, err = stakingIndexer.GetStakingTxByHash(earlierTx.Hash())
+	require.NoError(t, err)
+	require.Equal(t, indexerstore.StakingStatusUnbonding, storedTx.Status)
+	tvl, err := stakingIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Zero(t, tvl)
+
+	processingErrors, err := stakingIndexer.GetRecentProcessingErrors(10)
+	require.NoError(t, err)
+	require.Len(t, processingErrors, 2)
+	require.Equal(t, blockedUnbondingTx.Hash(), processingErrors[0].TxHash)
+	require.Contains(t, processingErrors[0].Error, indexer.ErrUnbondingTxFlagged.Error())
+	require.Contains(t, processingErrors[0].Error, "the staker is blocked")
+	require.Equal(t, blockedTx.Hash(), processingErrors[1].TxHash)
+	require.Contains(t, processingErrors[1].Error, indexer.ErrInvalidStakingTx.Error())
+	require.Contains(t, processingErrors[1].Error, "the staker is blocked")
+}
+
+// TestExportCSV tests that the exported CSV has a row per delegation
+// reflecting its eligibility, unbonding, and withdrawal
+func TestExportCSV(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+
+	// the first delegation is unbonded and withdrawn, the second one stays
+	// active, and the last one exceeds the staking cap
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	stakingData3 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx3 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData3)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+	withdrawTx := datagen.GenerateWithdrawalTxFromUnbonding(t, r, params, stakingData1, unbondingTx.Hash())
+	params.CapHeight = 0
+	params.StakingCap = stakingData1.StakingAmount + stakingData2.StakingAmount
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// nothing but the header is exported before any delegation
+	var buf bytes.Buffer
+	err = stakingIndexer.ExportCSV(&buf)
+	require.NoError(t, err)
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	height := params.ActivationHeight
+	for i, txs := range [][]*btcutil.Tx{
+		{stakingTx1, stakingTx2, stakingTx3},
+		{unbondingTx},
+		{withdrawTx},
+	} {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: int32(height) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		})
+		require.NoError(t, err)
+	}
+
+	buf.Reset()
+	err = stakingIndexer.ExportCSV(&buf)
+	require.NoError(t, err)
+	records, err = csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	require.Equal(t, []string{
+		"staking_tx_hash", "staker_pk", "finality_provider_pk", "staking_value",
+		"staking_time", "inclusion_height", "status", "unbonded", "withdrawn",
+	}, records[0])
+
+	rows := make(map[string][]string)
+	for _, record := range records[1:] {
+		rows[record[0]] = record
+	}
+	for _, tc := range []struct {
+		stakingTx   *btcutil.Tx
+		stakingData *datagen.TestStakingData
+		status      string
+		unbonded    string
+		withdrawn   string
+	}{
+		{stakingTx1, stakingData1, "active", "true", "true"},
+		{stakingTx2, stakingData2, "active", "false", "false"},
+		{stakingTx3, stakingData3, "inactive", "false", "false"},
+	} {
+		require.Contains(t, rows, tc.stakingTx.Hash().String())
+		require.Equal(t, []string{
+			tc.stakingTx.Hash().String(),
+			hex.EncodeToString(schnorr.SerializePubKey(tc.stakingData.StakerKey)),
+			hex.EncodeToString(schnorr.SerializePubKey(tc.stakingData.FinalityProviderKey)),
+			strconv.FormatInt(int64(tc.stakingData.StakingAmount), 10),
+			strconv.FormatUint(uint64(tc.stakingData.StakingTime), 10),
+			strconv.FormatUint(height, 10),
+			tc.status,
+			tc.unbonded,
+			tc.withdrawn,
+		}, rows[tc.stakingTx.Hash().String()])
+	}
+}
+
+// TestResolveStakingFromUnbonding tests that the staking tx is resolved
+// from the input of an unbonding tx only if the input spends its staking
+// output
+func TestResolveStakingFromUnbonding(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	err = stakingIndexer.HandleConfirmedBlock(&types.IndexedBlock{
+		Height: int32(params.ActivationHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingTx},
+	})
+	require.NoError(t, err)
+
+	// the unbonding tx is resolved without being processed
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+	resolvedTx, err := stakingIndexer.ResolveStakingFromUnbonding(unbondingTx.MsgTx())
+	require.NoError(t, err)
+	require.NotNil(t, resolvedTx)
+	require.Equal(t, *stakingTx.Hash(), resolvedTx.Tx.TxHash())
+
+	// the input spends another output of the staking tx
+	otherOutputTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 1)
+	resolvedTx, err = stakingIndexer.ResolveStakingFromUnbonding(otherOutputTx.MsgTx())
+	require.NoError(t, err)
+	require.Nil(t, resolvedTx)
+
+	// the input spends an unknown tx
+	unknownHash := bbndatagen.GenRandomBtcdHash(r)
+	unknownTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, &unknownHash, 0)
+	resolvedTx, err = stakingIndexer.ResolveStakingFromUnbonding(unknownTx.MsgTx())
+	require.NoError(t, err)
+	require.Nil(t, resolvedTx)
+
+	// an unbonding tx has exactly one input
+	multiInputTx := unbondingTx.MsgTx().Copy()
+	multiInputTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&unknownHash, 0), nil, nil))
+	_, err = stakingIndexer.ResolveStakingFromUnbonding(multiInputTx)
+	require.ErrorIs(t, err, indexer.ErrInvalidUnbondingTx)
+}
+
+// TestStakingEventsInBlockOrder tests that the events of the staking txs in
+// the same block are emitted in the order of the txs in the block
+func TestStakingEventsInBlockOrder(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	n := 10
+	stakingTxs := make([]*btcutil.Tx, 0, n)
+	for i := 0; i < n; i++ {
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		stakingTxs = append(stakingTxs, stakingTx)
+	}
+	// the txs are placed in the reverse order of their hashes so that the
+	// block order differs from the order of the stored keys
+	sort.Slice(stakingTxs, func(i, j int) bool {
+		return stakingTxs[i].Hash().String() > stakingTxs[j].Hash().String()
+	})
+
+	var emittedTxHashes []string
+	mockedConsumer := mocks.NewMockEventConsumer(gomock.NewController(t))
+	mockedConsumer.EXPECT().PushStakingEvent(gomock.Any()).DoAndReturn(
+		func(ev *queuecli.ActiveStakingEvent) error {
+			emittedTxHashes = append(emittedTxHashes, ev.StakingTxHashHex)
+			return nil
+		}).Times(n)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), mockedConsumer, db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	err = stakingIndexer.HandleConfirmedBlock(&types.IndexedBlock{
+		Height: int32(params.ActivationHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    stakingTxs,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, emittedTxHashes, n)
+	for i, tx := range stakingTxs {
+		require.Equal(t, tx.Hash().String(), emittedTxHashes[i])
+	}
+}
+
+// TestCapWarning tests that the cap warning is logged once when the
+// confirmed TVL crosses the threshold upward and the TVL dropping below the
+// threshold is logged once as well
+func TestCapWarning(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.CapWarningThreshold = 50
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+
+	// the TVL reaches exactly 50% of the cap with both staking txs
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	params.CapHeight = 0
+	params.StakingCap = 2 * (stakingData1.StakingAmount + stakingData2.StakingAmount)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	core, logs := observer.New(zap.InfoLevel)
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.New(core), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	requireLogCounts := func(reached, dropped int) {
+		require.Equal(t, reached, logs.FilterMessage(
+			"the TVL has reached the warning threshold of the staking cap").Len())
+		require.Equal(t, dropped, logs.FilterMessage(
+			"the TVL has dropped below the warning threshold of the staking cap").Len())
+	}
+
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+	height := int32(params.ActivationHeight)
+	handleBlock := func(txs ...*btcutil.Tx) {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: height,
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		})
+		require.NoError(t, err)
+		height++
+	}
+
+	// below the threshold
+	handleBlock(stakingTx1)
+	requireLogCounts(0, 0)
+
+	// crossing the threshold upward
+	handleBlock(stakingTx2)
+	requireLogCounts(1, 0)
+
+	// staying above the threshold does not log again
+	handleBlock()
+	requireLogCounts(1, 0)
+
+	// crossing the threshold downward
+	handleBlock(unbondingTx)
+	requireLogCounts(1, 1)
+
+	// staying below the threshold does not log again
+	handleBlock()
+	requireLogCounts(1, 1)
+}
+
+// TestGetStakingTransactionWitness tests that the witness stack of the
+// staking tx input parsed from the stored tx matches the original tx
+func TestGetStakingTransactionWitness(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// the witness does not change the tx hash
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	_, segwitStakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	segwitStakingTx.MsgTx().TxIn[0].Witness = wire.TxWitness{
+		bbndatagen.GenRandomByteArray(r, 64),
+		bbndatagen.GenRandomByteArray(r, 33),
+		{},
+	}
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	_, legacyStakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+
+	err = stakingIndexer.HandleConfirmedBlock(&types.IndexedBlock{
+		Height: int32(params.ActivationHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{segwitStakingTx, legacyStakingTx},
+	})
+	require.NoError(t, err)
+
+	witness, err := stakingIndexer.GetStakingTransactionWitness(segwitStakingTx.Hash())
+	require.NoError(t, err)
+	expectedWitness := segwitStakingTx.MsgTx().TxIn[0].Witness
+	require.Len(t, witness, len(expectedWitness))
+	for i := range expectedWitness {
+		require.True(t, bytes.Equal(expectedWitness[i], witness[i]))
+	}
+
+	witness, err = stakingIndexer.GetStakingTransactionWitness(legacyStakingTx.Hash())
+	require.NoError(t, err)
+	require.Empty(t, witness)
+
+	_, err = stakingIndexer.GetStakingTransactionWitness(&chainhash.Hash{})
+	require.ErrorIs(t, err, indexer.ErrStakingTxNotFound)
+}
+
+// TestConsumerPushTimeout tests that a push to a hanging consumer fails
+// once all the attempts reach the push timeout and the block is not saved
+// as processed so that its events are pushed again
+func TestConsumerPushTimeout(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.PushTimeout = 100 * time.Millisecond
+	cfg.PushMaxRetries = 2
+	cfg.PushRetryBackoff = 10 * time.Millisecond
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+
+	// the consumer hangs until the test ends
+	release := make(chan struct{})
+	defer close(release)
+	mockedConsumer := mocks.NewMockEventConsumer(gomock.NewController(t))
+	mockedConsumer.EXPECT().PushStakingEvent(gomock.Any()).DoAndReturn(
+		func(ev *queuecli.ActiveStakingEvent) error {
+			<-release
+			return nil
+		}).Times(3)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), mockedConsumer, db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = stakingIndexer.HandleConfirmedBlock(&types.IndexedBlock{
+		Height: int32(params.ActivationHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingTx},
+	})
+	require.ErrorIs(t, err, indexer.ErrPushTimeout)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// the block is handled again from the start
+	require.Equal(t, params.ActivationHeight, stakingIndexer.GetStartHeight())
+}
+
+// TestConsumerPushRetry tests that a timed out push to a slow consumer is
+// retried and the block is processed once an attempt returns
+func TestConsumerPushRetry(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	cfg.PushTimeout = 100 * time.Millisecond
+	cfg.PushMaxRetries = 2
+	cfg.PushRetryBackoff = 10 * time.Millisecond
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+
+	// the first attempt hangs until the test ends while the retry returns
+	release := make(chan struct{})
+	defer close(release)
+	attempts := atomic.NewInt32(0)
+	mockedConsumer := mocks.NewMockEventConsumer(gomock.NewController(t))
+	mockedConsumer.EXPECT().PushStakingEvent(gomock.Any()).DoAndReturn(
+		func(ev *queuecli.ActiveStakingEvent) error {
+			if attempts.Add(1) == 1 {
+				<-release
+			}
+			return nil
+		}).Times(2)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), mockedConsumer, db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+	require.NoError(t, err)
+
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: int32(params.ActivationHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingTx},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), attempts.Load())
+	require.Equal(t, params.ActivationHeight+1, stakingIndexer.GetStartHeight())
+}
+
+// TestConsumerPushTimeoutUnblocksLoop tests that the blocks loop moves on to
+// the following updates after a push to the consumer times out
+func TestConsumerPushTimeoutUnblocksLoop(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.PushTimeout = 100 * time.Millisecond
+	cfg.PushMaxRetries = 0
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+
+	// the push of the first update hangs until the test ends while the
+	// following ones return immediately
+	release := make(chan struct{})
+	defer close(release)
+	pushed := make(chan uint64, 10)
+	mockedConsumer := NewMockedConsumer(t)
+	mockedConsumer.EXPECT().PushBtcInfoEvent(gomock.Any()).DoAndReturn(
+		func(ev *queuecli.BtcInfoEvent) error {
+			if ev.Height == params.ActivationHeight {
+				<-release
+				return nil
+			}
+			pushed <- ev.Height
+			return nil
+		}).Times(2)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
+	mockBtcScanner := NewMockedBtcScanner(t, chainUpdateInfoChan)
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), mockedConsumer, db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	err = stakingIndexer.Start(stakingIndexer.GetStartHeight())
+	require.NoError(t, err)
+	defer func() {
+		err := stakingIndexer.Stop()
+		require.NoError(t, err)
+		err = db.Close()
+		require.NoError(t, err)
+	}()
+
+	for i := 0; i < 2; i++ {
+		update := &btcscanner.ChainUpdateInfo{
+			UnconfirmedBlocks: []*types.IndexedBlock{{
+				Height: int32(params.ActivationHeight) + int32(i),
+				Header: &wire.BlockHeader{Timestamp: time.Now()},
+			}},
+		}
+		select {
+		case chainUpdateInfoChan <- update:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the update %d is not received by the blocks loop", i)
+		}
+	}
+
+	select {
+	case height := <-pushed:
+		require.Equal(t, params.ActivationHeight+1, height)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the btc info event of the second update is not pushed")
+	}
+}
+
+// TestReorgDetection tests that the headers of the processed blocks are
+// stored and a confirmed block not extending them is rejected as a reorg
+// without changing the state
+func TestReorgDetection(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	height := int32(params.ActivationHeight)
+	block := &types.IndexedBlock{
+		Height: height,
+		Header: &wire.BlockHeader{
+			PrevBlock: chainhash.HashH(bbndatagen.GenRandomByteArray(r, 32)),
+			Timestamp: time.Unix(time.Now().Unix(), 0),
+		},
+	}
+	err = stakingIndexer.HandleConfirmedBlock(block)
+	require.NoError(t, err)
+
+	header, err := stakingIndexer.GetProcessedHeader(uint64(height))
+	require.NoError(t, err)
+	require.NotNil(t, header)
+	require.Equal(t, block.BlockHash(), header.Hash)
+	require.Equal(t, block.Header.PrevBlock, header.PrevHash)
+	require.Equal(t, uint64(height), header.Height)
+	require.True(t, block.Header.Timestamp.Equal(header.Timestamp))
+
+	header, err = stakingIndexer.GetProcessedHeader(uint64(height) + 1)
+	require.NoError(t, err)
+	require.Nil(t, header)
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	assertRejected := func(b *types.IndexedBlock) {
+		err := stakingIndexer.HandleConfirmedBlock(b)
+		require.ErrorIs(t, err, indexer.ErrReorgDetected)
+
+		storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+		require.NoError(t, err)
+		require.Nil(t, storedTx)
+		require.Equal(t, uint64(height)+1, stakingIndexer.GetStartHeight())
+	}
+
+	// the next block does not point to the processed block
+	assertRejected(&types.IndexedBlock{
+		Height: height + 1,
+		Header: &wire.BlockHeader{
+			PrevBlock: chainhash.HashH(bbndatagen.GenRandomByteArray(r, 32)),
+			Timestamp: time.Now(),
+		},
+		Txs: []*btcutil.Tx{stakingTx},
+	})
+
+	// a different block replaces the processed block
+	assertRejected(&types.IndexedBlock{
+		Height: height,
+		Header: &wire.BlockHeader{
+			PrevBlock: block.Header.PrevBlock,
+			Timestamp: block.Header.Timestamp.Add(time.Second),
+		},
+		Txs: []*btcutil.Tx{stakingTx},
+	})
+
+	// the block extending the processed block is handled
+	err = stakingIndexer.HandleConfirmedBlock(&types.IndexedBlock{
+		Height: height + 1,
+		Header: &wire.BlockHeader{PrevBlock: block.BlockHash(), Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingTx},
+	})
+	require.NoError(t, err)
+	storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedTx)
+}
+
+// TestValidateStakingTxAgainstParams tests that a staking tx is validated
+// against the given params without an indexer
+func TestValidateStakingTxAgainstParams(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	net := &chaincfg.SigNetParams
+
+	// genStakingTx generates a staking tx of which the staking data
+	// is updated by the given function
+	genStakingTx := func(update func(data *datagen.TestStakingData)) *wire.MsgTx {
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		update(stakingData)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		return stakingTx.MsgTx()
+	}
+
+	// a staking tx of which the staking output does not match the op return data
+	malformedTx := genStakingTx(func(*datagen.TestStakingData) {})
+	malformedTx.TxOut[0].PkScript = bbndatagen.GenRandomByteArray(r, 34)
+	// a staking tx of which the staking output commits to another
+	// covenant committee
+	_, wrongCovenantTx := datagen.GenerateStakingTxFromTestData(t, r, withOtherCovenants(t, params),
+		datagen.GenerateTestStakingData(t, r, params))
+
+	testCases := []struct {
+		name string
+		tx   *wire.MsgTx
+		// the expected error, which is nil if the tx is valid
+		expectedErr error
+	}{
+		{
+			name: "valid staking tx",
+			tx:   genStakingTx(func(*datagen.TestStakingData) {}),
+		},
+		{
+			name:        "not a staking tx",
+			tx:          bbndatagen.GenRandomTx(r),
+			expectedErr: indexer.ErrNotStakingTx,
+		},
+		{
+			name:        "unparseable staking tx",
+			tx:          malformedTx,
+			expectedErr: indexer.ErrUnparseableStakingTx,
+		},
+		{
+			name:        "staking to another covenant committee",
+			tx:          wrongCovenantTx.MsgTx(),
+			expectedErr: indexer.ErrNoMatchingStakingOutput,
+		},
+		{
+			name: "staking amount too low",
+			tx: genStakingTx(func(data *datagen.TestStakingData) {
+				data.StakingAmount = params.MinStakingAmount - 1
+			}),
+			expectedErr: indexer.ErrInvalidStakingTx,
+		},
+		{
+			name: "staking amount too high",
+			tx: genStakingTx(func(data *datagen.TestStakingData) {
+				data.StakingAmount = params.MaxStakingAmount + 1
+			}),
+			expectedErr: indexer.ErrInvalidStakingTx,
+		},
+		{
+			name: "staking time too low",
+			tx: genStakingTx(func(data *datagen.TestStakingData) {
+				data.StakingTime = params.MinStakingTime - 1
+			}),
+			expectedErr: indexer.ErrInvalidStakingTx,
+		},
+		{
+			name: "staking time too high",
+			tx: genStakingTx(func(data *datagen.TestStakingData) {
+				data.StakingTime = params.MaxStakingTime + 1
+			}),
+			expectedErr: indexer.ErrInvalidStakingTx,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := indexer.ValidateStakingTxAgainstParams(tc.tx, params, net)
+			if tc.expectedErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+// TestCapWindow tests that the TVL is measured against the staking cap over
+// the active staking txs included within the cap window, so that the older
+// staking txs no longer count towards the cap
+func TestCapWindow(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.CapWindow = time.Hour
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	// a single staking tx reaches the staking cap
+	params.CapHeight = 0
+	params.StakingCap = params.MinStakingAmount
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	start := time.Now()
+	for i, tc := range []struct {
+		// the inclusion time of the staking tx since the first one
+		sinceStart time.Duration
+		isOverflow bool
+	}{
+		// the first staking tx is active as the window is empty
+		{0, false},
+		// the first staking tx is within the window and reaches the cap
+		{30 * time.Minute, true},
+		// the first staking tx is out of the window, while the second
+		// one within it is overflow and does not count
+		{90 * time.Minute, false},
+		// the third staking tx is within the window
+		{100 * time.Minute, true},
+	} {
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		err := stakingIndexer.ProcessStakingTx(
+			stakingTx.MsgTx(),
+			getParsedStakingData(stakingData, stakingTx.MsgTx(), params),
+			params.ActivationHeight+uint64(i), start.Add(tc.sinceStart), params)
+		require.NoError(t, err)
+
+		storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+		require.NoError(t, err)
+		require.Equal(t, tc.isOverflow, storedTx.IsOverflow, "staking tx %d", i)
+	}
+
+	// the confirmed TVL still counts all the active staking txs
+	confirmedTvl, err := stakingIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Greater(t, confirmedTvl, uint64(params.StakingCap))
+}
+
+// TestStartupSummary tests that a structured summary of the indexer state
+// is logged on start
+func TestStartupSummary(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+
+	scannerTip := params.ActivationHeight + 10
+	ctl := gomock.NewController(t)
+	mockBtcScanner := mocks.NewMockBtcScanner(ctl)
+	mockBtcScanner.EXPECT().Start(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockBtcScanner.EXPECT().ChainUpdateInfoChan().Return(make(chan *btcscanner.ChainUpdateInfo)).AnyTimes()
+	mockBtcScanner.EXPECT().LastConfirmedHeight().Return(scannerTip).AnyTimes()
+	mockBtcScanner.EXPECT().Stop().Return(nil).AnyTimes()
+
+	core, logs := observer.New(zap.InfoLevel)
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.New(core), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: int32(params.ActivationHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingTx},
+	})
+	require.NoError(t, err)
+
+	startHeight := stakingIndexer.GetStartHeight()
+	err = stakingIndexer.Start(startHeight)
+	require.NoError(t, err)
+	defer func() {
+		err := stakingIndexer.Stop()
+		require.NoError(t, err)
+	}()
+
+	summaries := logs.FilterMessage("startup summary").All()
+	require.Len(t, summaries, 1)
+	fields := summaries[0].ContextMap()
+	require.Equal(t, filepath.Join(cfg.DatabaseConfig.DBDir(), cfg.DatabaseConfig.DBFileName), fields["db_path"])
+	require.NotZero(t, fields["db_version"])
+	require.Equal(t, int64(1), fields["staking_tx_count"])
+	require.Equal(t, int64(0), fields["unbonding_tx_count"])
+	require.Equal(t, int64(0), fields["withdrawal_count"])
+	require.Equal(t, params.ActivationHeight, fields["last_processed_height"])
+	require.Equal(t, startHeight, fields["start_height"])
+	require.Equal(t, scannerTip, fields["scanner_tip"])
+	require.Equal(t, params.Version, fields["params_version"])
+	require.Equal(t, uint64(stakingData.StakingAmount), fields["confirmed_tvl"])
+}
+
+// TestUnbondingBeforeStakingIsIgnored tests that a tx spending a staking tx
+// which is not indexed yet is not treated as an unbonding tx, so that the
+// block is processed and the staking tx is indexed as staked once it
+// appears in a later block
+func TestUnbondingBeforeStakingIsIgnored(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+	require.NoError(t, err)
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: int32(params.ActivationHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{unbondingTx},
+	})
+	require.NoError(t, err)
+	storedUnbondingTx, err := stakingIndexer.GetUnbondingTxByHash(unbondingTx.Hash())
+	require.NoError(t, err)
+	require.Nil(t, storedUnbondingTx)
+
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: int32(params.ActivationHeight) + 1,
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingTx},
+	})
+	require.NoError(t, err)
+	storedStakingTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedStakingTx)
+	require.Equal(t, indexerstore.StakingStatusStaked, storedStakingTx.Status)
+}
+
+// TestBlockData tests that the full data of the processed blocks is stored
+// only if it is enabled
+func TestBlockData(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for _, enabled := range []bool{false, true} {
+		homePath := filepath.Join(t.TempDir(), "indexer")
+		cfg := config.DefaultConfigWithHome(homePath)
+		cfg.BlockDataEnabled = enabled
+
+		sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+		params := sysParamsVersions.Versions[0]
+		params.CapHeight = 0
+		params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+		require.NoError(t, err)
+
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		block := &types.IndexedBlock{
+			Height: int32(params.ActivationHeight),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    []*btcutil.Tx{btcutil.NewTx(datagen.GenRandomTx(r)), stakingTx},
+		}
+		err = handleLinkedBlock(t, stakingIndexer, block)
+		require.NoError(t, err)
+
+		storedBlock, err := stakingIndexer.GetIndexedBlock(uint64(block.Height))
+		require.NoError(t, err)
+		if !enabled {
+			require.Nil(t, storedBlock)
+		} else {
+			require.NotNil(t, storedBlock)
+			require.Equal(t, block.Height, storedBlock.Height)
+			require.Equal(t, block.BlockHash(), storedBlock.BlockHash())
+			require.Len(t, storedBlock.Txs, len(block.Txs))
+			for i := range block.Txs {
+				require.Equal(t, block.Txs[i].Hash(), storedBlock.Txs[i].Hash())
+				require.Equal(t, block.Txs[i].WitnessHash(), storedBlock.Txs[i].WitnessHash())
+			}
+		}
+
+		err = db.Close()
+		require.NoError(t, err)
+	}
+}
+
+// TestMixedValidityBlock tests that the invalid txs of a block are recorded
+// as processing errors without aborting the block, so that the valid txs
+// of the block are stored and the block is checkpointed
+func TestMixedValidityBlock(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.ProcessingErrorLogSize = 10
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+	require.NoError(t, err)
+
+	// the invalid staking tx stakes less than the minimum staking amount
+	invalidStakingData := datagen.GenerateTestStakingData(t, r, params)
+	invalidStakingData.StakingAmount = params.MinStakingAmount - 1
+	_, invalidStakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, invalidStakingData)
+	_, validStakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, datagen.GenerateTestStakingData(t, r, params))
+
+	height := params.ActivationHeight
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: int32(height),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{invalidStakingTx, validStakingTx},
+	})
+	require.NoError(t, err)
+
+	storedTx, err := stakingIndexer.GetStakingTxByHash(validStakingTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedTx)
+	storedTx, err = stakingIndexer.GetStakingTxByHash(invalidStakingTx.Hash())
+	require.NoError(t, err)
+	require.Nil(t, storedTx)
+
+	processingErrors, err := stakingIndexer.GetRecentProcessingErrors(10)
+	require.NoError(t, err)
+	require.Len(t, processingErrors, 1)
+	require.Equal(t, invalidStakingTx.Hash(), processingErrors[0].TxHash)
+	require.Equal(t, height, processingErrors[0].Height)
+
+	// the block is checkpointed
+	require.Equal(t, height+1, stakingIndexer.GetStartHeight())
+}
+
+// TestMaxTxsPerBlock tests that a confirmed block with txs up to the
+// configured maximum is processed while a block exceeding it is rejected
+// without storing any of its txs or checkpointing it
+func TestMaxTxsPerBlock(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.MaxTxsPerBlock = 3
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+	require.NoError(t, err)
+
+	// a block at the limit is processed
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	atLimitBlock := &types.IndexedBlock{
+		Height: int32(params.ActivationHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs: []*btcutil.Tx{
+			btcutil.NewTx(datagen.GenRandomTx(r)),
+			btcutil.NewTx(datagen.GenRandomTx(r)),
+			stakingTx,
+		},
+	}
+	err = handleLinkedBlock(t, stakingIndexer, atLimitBlock)
+	require.NoError(t, err)
+	storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedTx)
+	require.Equal(t, uint64(atLimitBlock.Height)+1, stakingIndexer.GetStartHeight())
+
+	// a block above the limit is rejected as a whole
+	stakingData = datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx = datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	aboveLimitBlock := &types.IndexedBlock{
+		Height: atLimitBlock.Height + 1,
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs: []*btcutil.Tx{
+			btcutil.NewTx(datagen.GenRandomTx(r)),
+			btcutil.NewTx(datagen.GenRandomTx(r)),
+			btcutil.NewTx(datagen.GenRandomTx(r)),
+			stakingTx,
+		},
+	}
+	err = handleLinkedBlock(t, stakingIndexer, aboveLimitBlock)
+	require.ErrorIs(t, err, indexer.ErrTooManyTxs)
+	storedTx, err = stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+	require.NoError(t, err)
+	require.Nil(t, storedTx)
+	require.Equal(t, uint64(atLimitBlock.Height)+1, stakingIndexer.GetStartHeight())
+}
+
+// TestGetRemainingLockTime tests the remaining lock time of the active,
+// exactly maturing, and matured delegations
+func TestGetRemainingLockTime(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+	require.NoError(t, err)
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	height := params.ActivationHeight
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: int32(height),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{stakingTx},
+	})
+	require.NoError(t, err)
+
+	stakingTime := uint32(stakingData.StakingTime)
+	expiryHeight := height + uint64(stakingTime)
+	for _, tc := range []struct {
+		name      string
+		tipHeight uint64
+		expected  uint32
+	}{
+		{"included", height, stakingTime},
+		{"active", height + 1, stakingTime - 1},
+		{"one block to mature", expiryHeight - 1, 1},
+		{"exactly maturing", expiryHeight, 0},
+		{"matured", expiryHeight + 100, 0},
+		{"tip below inclusion", height - 1, stakingTime},
+	} {
+		remaining, err := stakingIndexer.GetRemainingLockTime(stakingTx.Hash(), tc.tipHeight)
+		require.NoError(t, err, tc.name)
+		require.Equal(t, tc.expected, remaining, tc.name)
+	}
+
+	_, err = stakingIndexer.GetRemainingLockTime(&chainhash.Hash{}, height)
+	require.ErrorIs(t, err, indexer.ErrStakingTxNotFound)
+}
+
+// TestGetStaleMaturedDelegations tests that the matured delegations are
+// stale only if they are neither unbonded nor withdrawn
+func TestGetStaleMaturedDelegations(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+	params.MaxStakingTime = params.MinStakingTime + 100
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	// the unbonding txs are held pending for a few blocks after confirmed
+	cfg.UnbondingConfirmations = uint32(params.ConfirmationDepth) + 3
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+	require.NoError(t, err)
+
+	genStakingTx := func(stakingTime uint16) (*datagen.TestStakingData, *btcutil.Tx) {
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		stakingData.StakingTime = stakingTime
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		return stakingData, stakingTx
+	}
+	minTime := params.MinStakingTime
+	withdrawnData, withdrawnTx := genStakingTx(minTime)
+	unbondedData, unbondedTx := genStakingTx(minTime)
+	_, staleTx := genStakingTx(minTime)
+	_, lateTx := genStakingTx(params.MaxStakingTime)
+	pendingData, pendingTx := genStakingTx(minTime)
+	withdrawTx := datagen.GenerateWithdrawalTxFromStaking(t, r, params, withdrawnData, withdrawnTx.Hash(), 0)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, unbondedData, unbondedTx.Hash(), 0)
+	pendingUnbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, pendingData, pendingTx.Hash(), 0)
+
+	height := params.ActivationHeight
+	for i, txs := range [][]*btcutil.Tx{
+		{lateTx, withdrawnTx, unbondedTx, staleTx, pendingTx},
+		{withdrawTx, unbondingTx},
+		{pendingUnbondingTx},
+	} {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: int32(height) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		})
+		require.NoError(t, err)
+	}
+	// the unbonding included later is still pending once the
+	// first one is applied
+	for tipHeight := int32(height) + 3; ; tipHeight++ {
+		pending, err := stakingIndexer.IsUnbondingPending(unbondedTx.Hash())
+		require.NoError(t, err)
+		if !pending {
+			break
+		}
+		err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: tipHeight,
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+		})
+		require.NoError(t, err)
+	}
+	pending, err := stakingIndexer.IsUnbondingPending(pendingTx.Hash())
+	require.NoError(t, err)
+	require.True(t, pending)
+
+	requireStale := func(tipHeight uint64, expected ...*btcutil.Tx) {
+		delegations, err := stakingIndexer.GetStaleMaturedDelegations(tipHeight)
+		require.NoError(t, err)
+		require.Len(t, delegations, len(expected))
+		for i, d := range delegations {
+			require.Equal(t, *expected[i].Hash(), d.Tx.TxHash())
+		}
+	}
+
+	// the withdrawn and the unbonded delegations, including the one of
+	// which the unbonding is pending, are never stale while the others are
+	// stale once they mature, sorted by the expiry height
+	firstExpiry := height + uint64(minTime)
+	requireStale(height)
+	requireStale(firstExpiry - 1)
+	requireStale(firstExpiry, staleTx)
+	requireStale(height+uint64(params.MaxStakingTime)-1, staleTx)
+	requireStale(height+uint64(params.MaxStakingTime), staleTx, lateTx)
+}
+
+// TestEventDeliveryOrdering tests that the events of a block are pushed to
+// a slow consumer one at a time in order under the strict ordering, while
+// they are pushed concurrently under the throughput ordering, and all of
+// them are pushed before the block is saved as processed either way
+func TestEventDeliveryOrdering(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for _, ordering := range []string{config.EventDeliveryOrderingStrict, config.EventDeliveryOrderingThroughput} {
+		homePath := filepath.Join(t.TempDir(), "indexer")
+		cfg := config.DefaultConfigWithHome(homePath)
+		cfg.EventDeliveryOrdering = ordering
+
+		sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+		params := sysParamsVersions.Versions[0]
+		params.CapHeight = 0
+		params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+		var stakingTxs []*btcutil.Tx
+		for i := 0; i < 4; i++ {
+			stakingData := datagen.GenerateTestStakingData(t, r, params)
+			_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+			stakingTxs = append(stakingTxs, stakingTx)
+		}
+
+		// the consumer is slow so that the concurrent pushes overlap
+		var (
+			mu                  sync.Mutex
+			inFlight, maxFlight int
+			pushedTxHashes      []string
+		)
+		mockedConsumer := mocks.NewMockEventConsumer(gomock.NewController(t))
+		mockedConsumer.EXPECT().PushStakingEvent(gomock.Any()).DoAndReturn(
+			func(ev *queuecli.ActiveStakingEvent) error {
+				mu.Lock()
+				inFlight++
+				maxFlight = max(maxFlight, inFlight)
+				mu.Unlock()
+
+				time.Sleep(100 * time.Millisecond)
+
+				mu.Lock()
+				inFlight--
+				pushedTxHashes = append(pushedTxHashes, ev.StakingTxHashHex)
+				mu.Unlock()
+
+				return nil
+			}).Times(len(stakingTxs))
+
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), mockedConsumer, db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+		require.NoError(t, err)
+
+		err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: int32(params.ActivationHeight),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    stakingTxs,
+		})
+		require.NoError(t, err)
+		require.Equal(t, params.ActivationHeight+1, stakingIndexer.GetStartHeight())
+
+		mu.Lock()
+		require.Len(t, pushedTxHashes, len(stakingTxs))
+		if ordering == config.EventDeliveryOrderingStrict {
+			require.Equal(t, 1, maxFlight)
+			for i, stakingTx := range stakingTxs {
+				require.Equal(t, stakingTx.Hash().String(), pushedTxHashes[i])
+			}
+		} else {
+			require.Greater(t, maxFlight, 1)
+			for _, stakingTx := range stakingTxs {
+				require.Contains(t, pushedTxHashes, stakingTx.Hash().String())
+			}
+		}
+		mu.Unlock()
+
+		err = db.Close()
+		require.NoError(t, err)
+	}
+}
+
+// TestGetSpendingTx tests that the spenders of the staking and unbonding
+// outputs are recorded for the unbonding and the withdrawal txs, while the
+// unspent staking output has no spender
+func TestGetSpendingTx(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+	require.NoError(t, err)
+
+	unbondedData := datagen.GenerateTestStakingData(t, r, params)
+	_, unbondedTx := datagen.GenerateStakingTxFromTestData(t, r, params, unbondedData)
+	withdrawnData := datagen.GenerateTestStakingData(t, r, params)
+	_, withdrawnTx := datagen.GenerateStakingTxFromTestData(t, r, params, withdrawnData)
+	unspentData := datagen.GenerateTestStakingData(t, r, params)
+	_, unspentTx := datagen.GenerateStakingTxFromTestData(t, r, params, unspentData)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, unbondedData, unbondedTx.Hash(), 0)
+	withdrawFromStakingTx := datagen.GenerateWithdrawalTxFromStaking(t, r, params, withdrawnData, withdrawnTx.Hash(), 0)
+	withdrawFromUnbondingTx := datagen.GenerateWithdrawalTxFromUnbonding(t, r, params, unbondedData, unbondingTx.Hash())
+
+	height := params.ActivationHeight
+	for i, txs := range [][]*btcutil.Tx{
+		{unbondedTx, withdrawnTx, unspentTx},
+		{unbondingTx, withdrawFromStakingTx},
+		{withdrawFromUnbondingTx},
+	} {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: int32(height) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		})
+		require.NoError(t, err)
+	}
+
+	for _, tc := range []struct {
+		outpoint *wire.OutPoint
+		spender  *btcutil.Tx
+	}{
+		{wire.NewOutPoint(unbondedTx.Hash(), 0), unbondingTx},
+		{wire.NewOutPoint(unbondingTx.Hash(), 0), withdrawFromUnbondingTx},
+		{wire.NewOutPoint(withdrawnTx.Hash(), 0), withdrawFromStakingTx},
+		{wire.NewOutPoint(unspentTx.Hash(), 0), nil},
+	} {
+		spendingTxHash, err := stakingIndexer.GetSpendingTx(tc.outpoint)
+		require.NoError(t, err)
+		if tc.spender == nil {
+			require.Nil(t, spendingTxHash)
+			continue
+		}
+		require.NotNil(t, spendingTxHash)
+		require.Equal(t, *tc.spender.Hash(), *spendingTxHash)
+	}
+}
+
+// getGaugeValue returns the value of the gauge of the given name from the
+// default registry of the metrics
+func getGaugeValue(t *testing.T, name string) float64 {
+	metricFamilies, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, mf := range metricFamilies {
+		if mf.GetName() == name {
+			require.Len(t, mf.GetMetric(), 1)
+			return mf.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	require.Failf(t, "metric not found", "the gauge %s is not registered", name)
+
+	return 0
+}
+
+// TestCapUtilization tests that the staking cap utilization is rounded to
+// the configured precision and reported identically by the metric and
+// the API
+func TestCapUtilization(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the next params version is activated by the block following the
+	// processed one, and its cap should not be used
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:2]
+	params := sysParamsVersions.Versions[0]
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	// a third of the cap is used by the staking tx
+	params.CapHeight = 0
+	params.StakingCap = 3 * stakingData.StakingAmount
+	nextParams := sysParamsVersions.Versions[1]
+	nextParams.ActivationHeight = params.ActivationHeight + 1
+	nextParams.CapHeight = 0
+	nextParams.StakingCap = 2 * params.StakingCap
+
+	testCases := []struct {
+		precision uint32
+		expected  float64
+	}{
+		{0, 33},
+		{2, 33.33},
+		{5, 33.33333},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("precision %d", tc.precision), func(t *testing.T) {
+			cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+			cfg.FloatPrecision = tc.precision
+			db, err := cfg.DatabaseConfig.GetDbBackend()
+			require.NoError(t, err)
+			defer func() {
+				err := db.Close()
+				require.NoError(t, err)
+			}()
+			mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+			stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+			require.NoError(t, err)
+
+			// nothing of the cap is used before any block is processed
+			utilization, err := stakingIndexer.GetCapUtilization()
+			require.NoError(t, err)
+			require.Zero(t, utilization)
+
+			err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+				Height: int32(params.ActivationHeight),
+				Header: &wire.BlockHeader{Timestamp: time.Now()},
+				Txs:    []*btcutil.Tx{stakingTx},
+			})
+			require.NoError(t, err)
+
+			utilization, err = stakingIndexer.GetCapUtilization()
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, utilization)
+			require.Equal(t, utilization, getGaugeValue(t, "si_staking_cap_utilization"))
+		})
+	}
+}
+
+// TestReplayEventsTo tests that replaying a height range to a fresh
+// consumer pushes only the events of the blocks within the range as they
+// are originally pushed, without pushing to the configured consumer
+func TestReplayEventsTo(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+	withdrawTxFromStaking := datagen.GenerateWithdrawalTxFromStaking(t, r, params, stakingData2, stakingTx2.Hash(), 0)
+	withdrawTxFromUnbonding := datagen.GenerateWithdrawalTxFromUnbonding(t, r, params, stakingData1, unbondingTx.Hash())
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	cfg.BatchBlockEventsEnabled = true
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	// the per-event methods are not expected to be called
+	bc := &batchedConsumer{MockEventConsumer: mocks.NewMockEventConsumer(gomock.NewController(t))}
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), bc, db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+	require.NoError(t, err)
+
+	height := params.ActivationHeight
+	for i, txs := range [][]*btcutil.Tx{
+		{stakingTx1, stakingTx2},
+		{unbondingTx, withdrawTxFromStaking},
+		// no events
+		{},
+		{withdrawTxFromUnbonding},
+	} {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: int32(height) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		})
+		require.NoError(t, err)
+	}
+	require.Len(t, bc.batches, 3)
+
+	// the sub-range skips the staking events of the first block
+	replayed := &batchedConsumer{MockEventConsumer: mocks.NewMockEventConsumer(gomock.NewController(t))}
+	err = stakingIndexer.ReplayEventsTo(replayed, height+1, height+3)
+	require.NoError(t, err)
+	require.Equal(t, bc.batches[1:], replayed.batches)
+
+	// the staking events within a block are sorted by the tx hash
+	replayed = &batchedConsumer{MockEventConsumer: mocks.NewMockEventConsumer(gomock.NewController(t))}
+	err = stakingIndexer.ReplayEventsTo(replayed, height, height)
+	require.NoError(t, err)
+	require.Len(t, replayed.batches, 1)
+	require.Equal(t, height, replayed.batches[0].Height)
+	require.ElementsMatch(t, bc.batches[0].Events, replayed.batches[0].Events)
+
+	// the events are pushed one by one to the consumers without batches,
+	// and any event out of the range fails the unexpected push
+	mockedConsumer := mocks.NewMockEventConsumer(gomock.NewController(t))
+	mockedConsumer.EXPECT().PushWithdrawEvent(bc.batches[2].Events[0].WithdrawEvent).Return(nil).Times(1)
+	err = stakingIndexer.ReplayEventsTo(mockedConsumer, height+2, height+3)
+	require.NoError(t, err)
+
+	// nothing is replayed to the configured consumer
+	require.Len(t, bc.batches, 3)
+
+	// the range should be processed and not inverted
+	err = stakingIndexer.ReplayEventsTo(replayed, height+1, height+4)
+	require.Error(t, err)
+	err = stakingIndexer.ReplayEventsTo(replayed, height+1, height)
+	require.Error(t, err)
+}
+
+// TestReplayEventsToWithBlockData tests that the replayed events within a
+// block are in the order of the processed events if the block data is stored
+func TestReplayEventsToWithBlockData(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+	withdrawTxFromStaking := datagen.GenerateWithdrawalTxFromStaking(t, r, params, stakingData2, stakingTx2.Hash(), 0)
+	withdrawTxFromUnbonding := datagen.GenerateWithdrawalTxFromUnbonding(t, r, params, stakingData1, unbondingTx.Hash())
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	cfg.BatchBlockEventsEnabled = true
+	cfg.BlockDataEnabled = true
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	bc := &batchedConsumer{MockEventConsumer: mocks.NewMockEventConsumer(gomock.NewController(t))}
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), bc, db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+	require.NoError(t, err)
+
+	// the withdrawal tx comes before the unbonding tx in the block, unlike
+	// the order of the events rebuilt without the block data
+	height := params.ActivationHeight
+	for i, txs := range [][]*btcutil.Tx{
+		{stakingTx2, stakingTx1},
+		{withdrawTxFromStaking, unbondingTx},
+		{withdrawTxFromUnbonding},
+	} {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: int32(height) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		})
+		require.NoError(t, err)
+	}
+	require.Len(t, bc.batches, 3)
+	require.NotNil(t, bc.batches[1].Events[0].WithdrawEvent)
+
+	replayed := &batchedConsumer{MockEventConsumer: mocks.NewMockEventConsumer(gomock.NewController(t))}
+	err = stakingIndexer.ReplayEventsTo(replayed, height, height+2)
+	require.NoError(t, err)
+	require.Equal(t, bc.batches, replayed.batches)
+}
+
+// withOtherCovenants returns a copy of the given params of which the
+// covenant committee is replaced by the same number of random keys
+func withOtherCovenants(t *testing.T, params *parser.ParsedVersionedGlobalParams) *parser.ParsedVersionedGlobalParams {
+	otherParams := *params
+	otherParams.CovenantPks = make([]*btcec.PublicKey, len(params.CovenantPks))
+	for i := range otherParams.CovenantPks {
+		privKey, err := btcec.NewPrivateKey()
+		require.NoError(t, err)
+		otherParams.CovenantPks[i] = privKey.PubKey()
+	}
+
+	return &otherParams
+}
+
+// TestWrongCovenantStakingTx tests that a staking tx with a well-formed op
+// return but staking to a covenant committee other than the one of the
+// params is stored as a dead letter as no staking output matches the params
+func TestWrongCovenantStakingTx(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	cfg.DeadLetterEnabled = true
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo)))
+	require.NoError(t, err)
+
+	// the rotated committee of the next params version is
+	// not recognized at the height of the params either
+	wrongCovenantParams := *params
+	wrongCovenantParams.CovenantPks = sysParamsVersions.Versions[1].CovenantPks
+	wrongCovenantParams.CovenantQuorum = sysParamsVersions.Versions[1].CovenantQuorum
+	_, wrongCovenantTx := datagen.GenerateStakingTxFromTestData(t, r, &wrongCovenantParams,
+		datagen.GenerateTestStakingData(t, r, params))
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: int32(params.ActivationHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{wrongCovenantTx, stakingTx},
+	})
+	require.NoError(t, err)
+
+	// only the staking tx to the covenant committee of the params is stored
+	storedTx, err := stakingIndexer.GetStakingTxByHash(wrongCovenantTx.Hash())
+	require.NoError(t, err)
+	require.Nil(t, storedTx)
+	storedTx, err = stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedTx)
+	confirmedTvl, err := stakingIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Equal(t, uint64(stakingData.StakingAmount), confirmedTvl)
+
+	// the tx is recorded as unparseable with the reason
+	processingErrors, err := stakingIndexer.GetRecentProcessingErrors(10)
+	require.NoError(t, err)
+	require.Len(t, processingErrors, 1)
+	require.Equal(t, wrongCovenantTx.Hash(), processingErrors[0].TxHash)
+	require.Contains(t, processingErrors[0].Error, indexer.ErrUnparseableStakingTx.Error())
+	require.Contains(t, processingErrors[0].Error, indexer.ErrNoMatchingStakingOutput.Error())
+	deadLetters, err := stakingIndexer.GetDeadLetters()
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	require.Equal(t, wrongCovenantTx.MsgTx().TxHash(), deadLetters[0].Tx.TxHash())
+	require.Contains(t, deadLetters[0].Error, indexer.ErrNoMatchingStakingOutput.Error())
+}
+
+// TestIntraBlockEventOrdering tests that the staking event is emitted before
+// the unbonding event when the unbonding tx is placed before its staking tx
+// in the same block
+func TestIntraBlockEventOrdering(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+
+	ctl := gomock.NewController(t)
+	mockedConsumer := mocks.NewMockEventConsumer(ctl)
+	gomock.InOrder(
+		mockedConsumer.EXPECT().PushStakingEvent(gomock.Any()).Return(nil).Times(1),
+		mockedConsumer.EXPECT().PushUnbondingEvent(gomock.Any()).Return(nil).Times(1),
+	)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), mockedConsumer, db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	b := &types.IndexedBlock{
+		Height: int32(params.ActivationHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{unbondingTx, stakingTx},
+	}
+	err = stakingIndexer.HandleConfirmedBlock(b)
+	require.NoError(t, err)
+
+	storedUnbondingTx, err := stakingIndexer.GetUnbondingTxByHash(unbondingTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedUnbondingTx)
+	require.Equal(t, stakingTx.Hash(), storedUnbondingTx.StakingTxHash)
+}
+
+// TestTotalWithdrawnValue tests that the value of withdrawal txs from both
+// the staking and the unbonding path is accumulated as the staking value
+func TestTotalWithdrawnValue(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// 1. stake twice
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	// 2. unbond the first staking tx
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+	// 3. withdraw from the unbonding tx and from the second staking tx
+	withdrawTxFromUnbonding := datagen.GenerateWithdrawalTxFromUnbonding(t, r, params, stakingData1, unbondingTx.Hash())
+	withdrawTxFromStaking := datagen.GenerateWithdrawalTxFromStaking(t, r, params, stakingData2, stakingTx2.Hash(), 0)
+
+	height := int32(params.ActivationHeight)
+	for i, txs := range [][]*btcutil.Tx{
+		{stakingTx1, stakingTx2},
+		{unbondingTx},
+		{withdrawTxFromUnbonding, withdrawTxFromStaking},
+	} {
+		b := &types.IndexedBlock{
+			Height: height + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		}
+		err := handleLinkedBlock(t, stakingIndexer, b)
+		require.NoError(t, err)
+	}
+
+	// the unbonding fee is not deducted from the value withdrawn
+	// from the unbonding path
+	expectedTotal := stakingData1.StakingAmount + stakingData2.StakingAmount
+	totalWithdrawnValue, err := stakingIndexer.GetTotalWithdrawnValue()
+	require.NoError(t, err)
+	require.Equal(t, expectedTotal, totalWithdrawnValue)
+
+	// replaying the withdrawals does not change the total
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: height + 2,
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{withdrawTxFromUnbonding, withdrawTxFromStaking},
+	})
+	require.NoError(t, err)
+	totalWithdrawnValue, err = stakingIndexer.GetTotalWithdrawnValue()
+	require.NoError(t, err)
+	require.Equal(t, expectedTotal, totalWithdrawnValue)
+}
+
+// sliceBlockPuller is a pull-based block source serving the given blocks
+type sliceBlockPuller struct {
+	blocks []*types.IndexedBlock
+}
+
+func (p *sliceBlockPuller) NextBlock(ctx context.Context) (*types.IndexedBlock, error) {
+	if len(p.blocks) == 0 {
+		// no more blocks, wait until the scanner is stopped
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	b := p.blocks[0]
+	p.blocks = p.blocks[1:]
+
+	return b, nil
+}
+
+// TestPushAndPullScanners tests that the indexer produces the same state
+// with a push-based scanner and a pull-based scanner
+func TestPushAndPullScanners(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	testScenario := NewTestScenario(r, t, sysParamsVersions, 80, 20, true)
+	lastHeight := uint64(testScenario.Blocks[len(testScenario.Blocks)-1].Height)
+
+	startIndexer := func(btcScanner btcscanner.BtcScanner) *indexer.StakingIndexer {
+		homePath := filepath.Join(t.TempDir(), "indexer")
+		cfg := config.DefaultConfigWithHome(homePath)
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, btcScanner)
+		require.NoError(t, err)
+		err = stakingIndexer.Start(stakingIndexer.GetStartHeight())
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			err := stakingIndexer.Stop()
+			require.NoError(t, err)
+			err = db.Close()
+			require.NoError(t, err)
+		})
+
+		return stakingIndexer
+	}
+
+	// push mode
+	chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
+	pushIndexer := startIndexer(NewMockedBtcScanner(t, chainUpdateInfoChan))
+	chainUpdateInfoChan <- &btcscanner.ChainUpdateInfo{
+		ConfirmedBlocks: testScenario.Blocks,
+	}
+
+	// pull mode
+	pullScanner := btcscanner.NewPullScanner(&sliceBlockPuller{blocks: testScenario.Blocks}, zap.NewNop())
+	pullIndexer := startIndexer(pullScanner)
+
+	for _, si := range []*indexer.StakingIndexer{pushIndexer, pullIndexer} {
+		require.Eventually(t, func() bool {
+			return si.GetStartHeight() == lastHeight+1
+		}, 10*time.Second, 50*time.Millisecond)
+	}
+	require.Equal(t, lastHeight, pullScanner.LastConfirmedHeight())
+
+	pushTvl, err := pushIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	pullTvl, err := pullIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Equal(t, uint64(testScenario.Tvl), pushTvl)
+	require.Equal(t, pushTvl, pullTvl)
+
+	for _, stakingEv := range testScenario.StakingEvents {
+		pushTx, err := pushIndexer.GetStakingTxByHash(stakingEv.StakingTx.Hash())
+		require.NoError(t, err)
+		pullTx, err := pullIndexer.GetStakingTxByHash(stakingEv.StakingTx.Hash())
+		require.NoError(t, err)
+		require.Equal(t, pushTx, pullTx)
+	}
+
+	for _, unbondingEv := range testScenario.UnbondingEvents {
+		pushTx, err := pushIndexer.GetUnbondingTxByHash(unbondingEv.UnbondingTx.Hash())
+		require.NoError(t, err)
+		pullTx, err := pullIndexer.GetUnbondingTxByHash(unbondingEv.UnbondingTx.Hash())
+		require.NoError(t, err)
+		require.Equal(t, pushTx, pullTx)
+	}
+}
+
+// TestReplayScanner tests that replaying the dumped blocks produces the same
+// indexed state as processing the blocks live
+func TestReplayScanner(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	testScenario := NewTestScenario(r, t, sysParamsVersions, 80, 20, true)
+	lastHeight := uint64(testScenario.Blocks[len(testScenario.Blocks)-1].Height)
+
+	startIndexer := func(btcScanner btcscanner.BtcScanner) *indexer.StakingIndexer {
+		homePath := filepath.Join(t.TempDir(), "indexer")
+		cfg := config.DefaultConfigWithHome(homePath)
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, btcScanner)
+		require.NoError(t, err)
+		err = stakingIndexer.Start(stakingIndexer.GetStartHeight())
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			err := stakingIndexer.Stop()
+			require.NoError(t, err)
+			err = db.Close()
+			require.NoError(t, err)
+		})
+
+		return stakingIndexer
+	}
+
+	// live processing
+	chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
+	liveIndexer := startIndexer(NewMockedBtcScanner(t, chainUpdateInfoChan))
+	chainUpdateInfoChan <- &btcscanner.ChainUpdateInfo{
+		ConfirmedBlocks: testScenario.Blocks,
+	}
+
+	// dump the blocks into two files and replay them
+	dumpDir := t.TempDir()
+	half := len(testScenario.Blocks) / 2
+	for i, blocks := range [][]*types.IndexedBlock{testScenario.Blocks[:half], testScenario.Blocks[half:]} {
+		var buf bytes.Buffer
+		err := btcscanner.DumpBlocks(&buf, blocks)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dumpDir, fmt.Sprintf("%d.blk", i)), buf.Bytes(), 0600)
+		require.NoError(t, err)
+	}
+	replayScanner, err := btcscanner.NewReplayScanner(dumpDir, zap.NewNop())
+	require.NoError(t, err)
+	replayIndexer := startIndexer(replayScanner)
+
+	for _, si := range []*indexer.StakingIndexer{liveIndexer, replayIndexer} {
+		require.Eventually(t, func() bool {
+			return si.GetStartHeight() == lastHeight+1
+		}, 10*time.Second, 50*time.Millisecond)
+	}
+
+	// the state hash commits to the state of all the processed heights
+	liveStateHash, err := liveIndexer.GetStateHash(lastHeight)
+	require.NoError(t, err)
+	require.NotNil(t, liveStateHash)
+	replayStateHash, err := replayIndexer.GetStateHash(lastHeight)
+	require.NoError(t, err)
+	require.Equal(t, liveStateHash, replayStateHash)
+
+	liveTvl, err := liveIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	replayTvl, err := replayIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Equal(t, uint64(testScenario.Tvl), liveTvl)
+	require.Equal(t, liveTvl, replayTvl)
+
+	for _, stakingEv := range testScenario.StakingEvents {
+		liveTx, err := liveIndexer.GetStakingTxByHash(stakingEv.StakingTx.Hash())
+		require.NoError(t, err)
+		replayTx, err := replayIndexer.GetStakingTxByHash(stakingEv.StakingTx.Hash())
+		require.NoError(t, err)
+		require.Equal(t, liveTx, replayTx)
+	}
+
+	for _, unbondingEv := range testScenario.UnbondingEvents {
+		liveTx, err := liveIndexer.GetUnbondingTxByHash(unbondingEv.UnbondingTx.Hash())
+		require.NoError(t, err)
+		replayTx, err := replayIndexer.GetUnbondingTxByHash(unbondingEv.UnbondingTx.Hash())
+		require.NoError(t, err)
+		require.Equal(t, liveTx, replayTx)
+	}
+}
+
+func TestGetAllParamsVersions(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	infos := stakingIndexer.GetAllParamsVersions()
+	require.Len(t, infos, len(sysParamsVersions.Versions))
+	for i, info := range infos {
+		p := sysParamsVersions.Versions[i]
+		require.Equal(t, p.Version, info.Version)
+		require.Equal(t, p.ActivationHeight, info.ActivationHeight)
+		require.Equal(t, p.StakingCap, info.StakingCap)
+		require.Equal(t, p.CapHeight, info.CapHeight)
+		require.Equal(t, p.MinStakingAmount, info.MinStakingAmount)
+		require.Equal(t, p.MaxStakingAmount, info.MaxStakingAmount)
+		require.Equal(t, p.MinStakingTime, info.MinStakingTime)
+		require.Equal(t, p.MaxStakingTime, info.MaxStakingTime)
+		require.Equal(t, p.Tag, info.Tag)
+		if i+1 < len(infos) {
+			require.Equal(t, sysParamsVersions.Versions[i+1].ActivationHeight-1, info.EndHeight)
+		} else {
+			require.Zero(t, info.EndHeight)
+		}
+	}
+
+	// mutating the returned data does not affect the loaded params
+	originalTag := make([]byte, len(sysParamsVersions.Versions[0].Tag))
+	copy(originalTag, sysParamsVersions.Versions[0].Tag)
+	infos[0].Tag[0]++
+	infos[0].StakingCap++
+	require.Equal(t, originalTag, sysParamsVersions.Versions[0].Tag)
+	require.Equal(t, originalTag, stakingIndexer.GetAllParamsVersions()[0].Tag)
+}
+
+// TestGetParamsVersionForTx tests that the params version of a staking tx
+// is derived from its inclusion height across a params boundary
+func TestGetParamsVersionForTx(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	require.GreaterOrEqual(t, len(sysParamsVersions.Versions), 2)
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// stake right before and at the activation height of a version
+	versionIdx := r.Intn(len(sysParamsVersions.Versions)-1) + 1
+	boundary := sysParamsVersions.Versions[versionIdx].ActivationHeight
+	for _, height := range []uint64{boundary - 1, boundary} {
+		params := sysParamsVersions.GetVersionedGlobalParamsByHeight(height)
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		err := stakingIndexer.ProcessStakingTx(
+			stakingTx.MsgTx(),
+			getParsedStakingData(stakingData, stakingTx.MsgTx(), params),
+			height, time.Now(), params)
+		require.NoError(t, err)
+
+		expectedIdx := versionIdx
+		if height < boundary {
+			expectedIdx = versionIdx - 1
+		}
+		idx, err := stakingIndexer.GetParamsVersionForTx(stakingTx.Hash())
+		require.NoError(t, err)
+		require.Equal(t, expectedIdx, idx)
+	}
+
+	unknownHash := bbndatagen.GenRandomBtcdHash(r)
+	_, err = stakingIndexer.GetParamsVersionForTx(&unknownHash)
+	require.ErrorIs(t, err, indexer.ErrStakingTxNotFound)
+}
+
+// TestStartCancellation tests that the start of the indexer is aborted
+// when the context is cancelled during the startup
+func TestStartCancellation(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+
+	// the scanner start blocks until the scanner is stopped
+	scannerStopped := make(chan struct{})
+	scannerStartReturned := atomic.NewBool(false)
+	ctl := gomock.NewController(t)
+	mockBtcScanner := mocks.NewMockBtcScanner(ctl)
+	mockBtcScanner.EXPECT().Start(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_, _ uint64) error {
+			<-scannerStopped
+			time.Sleep(50 * time.Millisecond)
+			scannerStartReturned.Store(true)
+			return fmt.Errorf("the BTC scanner is stopped")
+		}).Times(1)
+	mockBtcScanner.EXPECT().ChainUpdateInfoChan().Return(make(chan *btcscanner.ChainUpdateInfo)).AnyTimes()
+	mockBtcScanner.EXPECT().Stop().DoAndReturn(func() error {
+		select {
+		case <-scannerStopped:
+		default:
+			close(scannerStopped)
+		}
+		return nil
+	}).AnyTimes()
+
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// a cancelled context aborts the start immediately
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = stakingIndexer.StartWithContext(cancelledCtx, stakingIndexer.GetStartHeight())
+	require.ErrorIs(t, err, context.Canceled)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	err = stakingIndexer.StartWithContext(ctx, stakingIndexer.GetStartHeight())
+	require.ErrorIs(t, err, context.Canceled)
+	// the scanner is not left starting after the cancellation
+	require.True(t, scannerStartReturned.Load())
+
+	// the indexer is left stopped after the cancellation
+	err = stakingIndexer.AddValidator(&stakerBlocklistValidator{})
+	require.NoError(t, err)
+
+	err = stakingIndexer.Stop()
+	require.NoError(t, err)
+}
+
+// TestStartFailure tests that the indexer is left stopped when its start
+// fails, so that it can be started again
+func TestStartFailure(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+
+	// the first start of the scanner fails
+	ctl := gomock.NewController(t)
+	mockBtcScanner := mocks.NewMockBtcScanner(ctl)
+	gomock.InOrder(
+		mockBtcScanner.EXPECT().Start(gomock.Any(), gomock.Any()).Return(fmt.Errorf("the BTC scanner failed to bootstrap")).Times(1),
+		mockBtcScanner.EXPECT().Start(gomock.Any(), gomock.Any()).Return(nil).Times(1),
+	)
+	mockBtcScanner.EXPECT().ChainUpdateInfoChan().Return(make(chan *btcscanner.ChainUpdateInfo)).AnyTimes()
+	mockBtcScanner.EXPECT().LastConfirmedHeight().Return(uint64(0)).AnyTimes()
+	mockBtcScanner.EXPECT().Stop().Return(nil).AnyTimes()
+
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// an invalid start height is rejected before anything is started
+	baseHeight := sysParamsVersions.Versions[0].ActivationHeight
+	err = stakingIndexer.Start(baseHeight + 1)
+	require.Error(t, err)
+	err = stakingIndexer.AddValidator(&stakerBlocklistValidator{})
+	require.NoError(t, err)
+
+	// a failed scanner start leaves the indexer stopped
+	err = stakingIndexer.Start(baseHeight)
+	require.ErrorContains(t, err, "failed to bootstrap")
+	err = stakingIndexer.AddValidator(&stakerBlocklistValidator{})
+	require.NoError(t, err)
+
+	// the indexer can be started again
+	err = stakingIndexer.Start(baseHeight)
+	require.NoError(t, err)
+	err = stakingIndexer.AddValidator(&stakerBlocklistValidator{})
+	require.Error(t, err)
+
+	err = stakingIndexer.Stop()
+	require.NoError(t, err)
+}
+
+// TestDeadLetters tests that the txs carrying the staking tag but failing
+// parsing are stored as dead letters
+func TestDeadLetters(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.DeadLetterEnabled = true
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// a staking tx of which the staking output does not match the op return data
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, malformedTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	malformedTx.MsgTx().TxOut[0].PkScript = bbndatagen.GenRandomByteArray(r, 34)
+	malformedTx = btcutil.NewTx(malformedTx.MsgTx())
+	// a valid staking tx
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, datagen.GenerateTestStakingData(t, r, params))
+
+	b := &types.IndexedBlock{
+		Height: int32(params.ActivationHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{malformedTx, stakingTx},
+	}
+	err = stakingIndexer.HandleConfirmedBlock(b)
+	require.NoError(t, err)
+
+	deadLetters, err := stakingIndexer.GetDeadLetters()
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	require.Equal(t, malformedTx.Hash().String(), deadLetters[0].Tx.TxHash().String())
+	require.Equal(t, params.ActivationHeight, deadLetters[0].Height)
+	require.NotEmpty(t, deadLetters[0].Error)
+
+	storedTx, err := stakingIndexer.GetStakingTxByHash(malformedTx.Hash())
+	require.NoError(t, err)
+	require.Nil(t, storedTx)
+	storedTx, err = stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedTx)
+}
+
+func FuzzGetStartHeight(f *testing.F) {
+	// use small seed because db open/close is slow
+	bbndatagen.AddRandomSeedsToFuzzer(f, 6)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+
+		homePath := filepath.Join(t.TempDir(), "indexer")
+		cfg := config.DefaultConfigWithHome(homePath)
+
+		sysParams := datagen.GenerateGlobalParamsVersions(r, t)
+
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
+		mockBtcScanner := NewMockedBtcScanner(t, chainUpdateInfoChan)
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParams, mockBtcScanner)
+		require.NoError(t, err)
+
+		// 1. no blocks have been processed, the start height should be equal to the base height
+		initialHeight := stakingIndexer.GetStartHeight()
+		require.Equal(t, sysParams.Versions[0].ActivationHeight, initialHeight)
+		err = stakingIndexer.ValidateStartHeight(initialHeight)
+		require.NoError(t, err)
+
+		err = stakingIndexer.ValidateStartHeight(bbndatagen.RandomIntOtherThan(r, int(initialHeight), 100))
+		require.Error(t, err)
+
+		err = stakingIndexer.Start(initialHeight)
+		require.NoError(t, err)
+		defer func() {
+			err := stakingIndexer.Stop()
+			require.NoError(t, err)
+			err = db.Close()
+			require.NoError(t, err)
+		}()
+
+		// 2. generate some blocks and let the last processed height grow
+		numBlocks := r.Intn(10) + 1
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			confirmedBlocks := make([]*types.IndexedBlock, 0)
+			var prevHash chainhash.Hash
+			for i := 0; i < numBlocks; i++ {
+				b := &types.IndexedBlock{
+					Height: int32(initialHeight) + int32(i),
+					Header: &wire.BlockHeader{PrevBlock: prevHash},
+				}
+				confirmedBlocks = append(confirmedBlocks, b)
+				prevHash = b.BlockHash()
+			}
+			chainUpdateInfoChan <- &btcscanner.ChainUpdateInfo{
+				ConfirmedBlocks: confirmedBlocks,
+			}
+		}()
+		wg.Wait()
+
+		// wait for db writes finished
+		time.Sleep(2 * time.Second)
+
+		// get start height from the indexer again, it should be equal to
+		// the last processed height (initialHeight + numBlocks - 1) + 1
+		startHeight := stakingIndexer.GetStartHeight()
+		require.Equal(t, initialHeight+uint64(numBlocks), startHeight)
+		err = stakingIndexer.ValidateStartHeight(startHeight)
+		require.NoError(t, err)
+
+		// 3. test the case where the start height is between [base height, last processed height + 1]
+		gap := int(startHeight - initialHeight)
+		validStartHeight := initialHeight + uint64(r.Intn(gap)) + 1
+		err = stakingIndexer.ValidateStartHeight(validStartHeight)
+		require.NoError(t, err)
+
+		// 4. test the case where the start height is less than the base height
+		smallHeight := uint64(r.Intn(int(initialHeight)))
+		err = stakingIndexer.ValidateStartHeight(smallHeight)
+		require.Error(t, err)
+
+		// 5. test the case where the start height is more than the last processed height + 1
+		bigHeight := uint64(r.Intn(1000)) + 1 + startHeight
+		err = stakingIndexer.ValidateStartHeight(bigHeight)
+		require.Error(t, err)
+	})
+}
+
+// FuzzVerifyUnbondingTx tests IsValidUnbondingTx in three scenarios:
+// 1. it returns (true, nil) if the given tx is valid unbonding tx
+// 2. it returns (false, nil) if the given tx is not unbonding tx
+// 3. it returns (false, ErrInvalidUnbondingTx) if the given tx is not
+// a valid unbonding tx
+func FuzzVerifyUnbondingTx(f *testing.F) {
+	bbndatagen.AddRandomSeedsToFuzzer(f, 50)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+
+		homePath := filepath.Join(t.TempDir(), "indexer")
+		cfg := config.DefaultConfigWithHome(homePath)
+
+		sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
+		mockBtcScanner := NewMockedBtcScanner(t, chainUpdateInfoChan)
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+		require.NoError(t, err)
+		defer func() {
+			err = db.Close()
+			require.NoError(t, err)
+		}()
+
+		// Select the first params versions to play with
+		params := sysParamsVersions.Versions[0]
+		// 1. generate and add a valid staking tx to the indexer
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		// For a valid tx, its btc height is always larger than the activation height
+		mockedHeight := uint64(params.ActivationHeight) + 1
+		err = stakingIndexer.ProcessStakingTx(
+			stakingTx.MsgTx(),
+			getParsedStakingData(stakingData, stakingTx.MsgTx(), params),
+			mockedHeight, time.Now(), params)
+		require.NoError(t, err)
+		storedStakingTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+		require.NoError(t, err)
+		require.NotNil(t, storedStakingTx)
+
+		// 2. test IsValidUnbondingTx with valid unbonding tx, expect (true, nil)
+		unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+		isValid, err := stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
+		require.NoError(t, err)
+		require.True(t, isValid)
+
+		// 3. test IsValidUnbondingTx with no unbonding tx (different staking output index), expect (false, nil)
+		unbondingTx = datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 1)
+		isValid, err = stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
+		require.NoError(t, err)
+		require.False(t, isValid)
+
+		// 4. test IsValidUnbondingTx with rbf enabled, expect (false, ErrInvalidUnbondingTx)
+		unbondingTx = datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+		unbondingTx.MsgTx().TxIn[0].Sequence = 0
+		isValid, err = stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
+		require.ErrorIs(t, err, indexer.ErrInvalidUnbondingTx)
+		require.Contains(t, err.Error(), "unbonding tx should not enable rbf")
+		require.False(t, isValid)
+
+		// 5. test IsValidUnbondingTx with time lock set, expect (false, ErrInvalidUnbondingTx)
+		unbondingTx = datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+		unbondingTx.MsgTx().LockTime = 1
+		isValid, err = stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
+		require.ErrorIs(t, err, indexer.ErrInvalidUnbondingTx)
+		require.Contains(t, err.Error(), "unbonding tx should not set lock time")
+		require.False(t, isValid)
+
+		// 6. test IsValidUnbondingTx with invalid unbonding tx (random unbonding fee in params), expect (false, ErrInvalidUnbondingTx)
+		newParams := *params
+		newParams.UnbondingFee = btcutil.Amount(bbndatagen.RandomIntOtherThan(r, int(params.UnbondingFee), 10000000))
+		unbondingTx = datagen.GenerateUnbondingTxFromStaking(t, &newParams, stakingData, stakingTx.Hash(), 0)
+		// pass the old params
+		isValid, err = stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
+		require.ErrorIs(t, err, indexer.ErrInvalidUnbondingTx)
+		require.Contains(t, err.Error(), fmt.Sprintf("the unbonding output value %d is not expected", unbondingTx.MsgTx().TxOut[0].Value))
+		require.False(t, isValid)
+
+		// 7. test IsValidUnbondingTx with invalid unbonding tx (random unbonding time in params), expect (false, ErrInvalidUnbondingTx)
+		newParams2 := *params
+		newParams2.UnbondingTime = uint16(bbndatagen.RandomIntOtherThan(r, int(params.UnbondingTime), 1000))
+		unbondingTx = datagen.GenerateUnbondingTxFromStaking(t, &newParams2, stakingData, stakingTx.Hash(), 0)
+		// pass the old params
+		isValid, err = stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
+		require.ErrorIs(t, err, indexer.ErrInvalidUnbondingTx)
+		require.Contains(t, err.Error(), "the unbonding output is not expected")
+		require.False(t, isValid)
+	})
+}
+
+func FuzzValidateWithdrawTxFromStaking(f *testing.F) {
+	bbndatagen.AddRandomSeedsToFuzzer(f, 10)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+
+		homePath := filepath.Join(t.TempDir(), "indexer")
+		cfg := config.DefaultConfigWithHome(homePath)
+
+		sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
+		mockBtcScanner := NewMockedBtcScanner(t, chainUpdateInfoChan)
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+		require.NoError(t, err)
+		defer func() {
+			err = db.Close()
+			require.NoError(t, err)
+		}()
+
+		// Select the first params versions to play with
+		params := sysParamsVersions.Versions[0]
+		// 1. generate and add a valid staking tx to the indexer
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		// For a valid tx, its btc height is always larger than the activation height
+		mockedHeight := uint64(params.ActivationHeight) + 1
+		err = stakingIndexer.ProcessStakingTx(
+			stakingTx.MsgTx(),
+			getParsedStakingData(stakingData, stakingTx.MsgTx(), params),
+			mockedHeight, time.Now(), params)
+		require.NoError(t, err)
+		storedStakingTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+		require.NoError(t, err)
+		require.NotNil(t, storedStakingTx)
+
+		// 2. test ValidateWithdrawalTxFromStaking with valid withdrawal tx
+		withdrawTxFromStaking := datagen.GenerateWithdrawalTxFromStaking(t, r, params, stakingData, stakingTx.Hash(), 0)
+		err = stakingIndexer.ValidateWithdrawalTxFromStaking(withdrawTxFromStaking.MsgTx(), storedStakingTx, 0, params)
+		require.NoError(t, err)
+
+		// 3. test ValidateWithdrawalTxFromStaking with invalid spending input index, expect panic
+		require.Panics(t, func() {
+			_ = stakingIndexer.ValidateWithdrawalTxFromStaking(withdrawTxFromStaking.MsgTx(), storedStakingTx, 1, params)
+		})
+
+		// 4. test ValidateWithdrawalTxFromStaking with a different staking time, expect ErrInvalidWithdrawTx
+		invalidStakingTx := *storedStakingTx
+		invalidStakingTx.StakingTime = uint32(bbndatagen.RandomIntOtherThan(r, int(storedStakingTx.StakingTime), 1000))
+		err = stakingIndexer.ValidateWithdrawalTxFromStaking(withdrawTxFromStaking.MsgTx(), &invalidStakingTx, 0, params)
+		require.ErrorIs(t, err, indexer.ErrInvalidWithdrawalTx)
+	})
+}
+
+func FuzzValidateWithdrawTxFromUnbonding(f *testing.F) {
+	bbndatagen.AddRandomSeedsToFuzzer(f, 10)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+
+		homePath := filepath.Join(t.TempDir(), "indexer")
+		cfg := config.DefaultConfigWithHome(homePath)
+
+		sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
+		mockBtcScanner := NewMockedBtcScanner(t, chainUpdateInfoChan)
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+		require.NoError(t, err)
+		defer func() {
+			err = db.Close()
+			require.NoError(t, err)
+		}()
+
+		// Select the first params versions to play with
+		params := sysParamsVersions.Versions[0]
+		// 1. generate and add a valid staking tx to the indexer
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		// For a valid tx, its btc height is always larger than the activation height
+		mockedHeight := uint64(params.ActivationHeight) + 1
+		err = stakingIndexer.ProcessStakingTx(
+			stakingTx.MsgTx(),
+			getParsedStakingData(stakingData, stakingTx.MsgTx(), params),
+			mockedHeight, time.Now(), params)
+		require.NoError(t, err)
+		storedStakingTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+		require.NoError(t, err)
+		require.NotNil(t, storedStakingTx)
+
+		// 2. generate a valid unbonding tx
+		unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+		isValid, err := stakingIndexer.IsValidUnbondingTx(unbondingTx.MsgTx(), storedStakingTx, params)
+		require.NoError(t, err)
+		require.True(t, isValid)
+
+		// 3. test ValidateWithdrawalTxFromUnbonding with valid withdrawal tx
+		withdrawTxFromUnbonding := datagen.GenerateWithdrawalTxFromUnbonding(t, r, params, stakingData, unbondingTx.Hash())
+		err = stakingIndexer.ValidateWithdrawalTxFromUnbonding(withdrawTxFromUnbonding.MsgTx(), storedStakingTx, 0, params)
+		require.NoError(t, err)
+
+		// 4. test ValidateWithdrawalTxFromUnbonding with invalid spending input index, expect panic
+		require.Panics(t, func() {
+			_ = stakingIndexer.ValidateWithdrawalTxFromUnbonding(withdrawTxFromUnbonding.MsgTx(), storedStakingTx, 1, params)
+		})
+
+		// 5. test ValidateWithdrawalTxFromUnbonding with a different param, expect ErrInvalidWithdrawTx
+		invalidParams := *params
+		invalidParams.UnbondingTime = uint16(bbndatagen.RandomIntOtherThan(r, int(params.UnbondingTime), 1000))
+		err = stakingIndexer.ValidateWithdrawalTxFromUnbonding(withdrawTxFromUnbonding.MsgTx(), storedStakingTx, 0, &invalidParams)
+		require.ErrorIs(t, err, indexer.ErrInvalidWithdrawalTx)
+	})
+}
+
+func getParsedStakingData(data *datagen.TestStakingData, tx *wire.MsgTx, params *parser.ParsedVersionedGlobalParams) *btcstaking.ParsedV0StakingTx {
+	return &btcstaking.ParsedV0StakingTx{
+		StakingOutput:     tx.TxOut[0],
+		StakingOutputIdx:  0,
+		OpReturnOutput:    tx.TxOut[1],
 		OpReturnOutputIdx: 1,
 		OpReturnData: &btcstaking.V0OpReturnData{
 			Tag:                       params.Tag,
@@ -583,6 +4867,1156 @@ func getParsedStakingData(data *datagen.TestStakingData, tx *wire.MsgTx, params
 	}
 }
 
+// TestGetStakingTransactionsByAddress tests that the staking txs are indexed
+// by the address of their staking output
+func TestGetStakingTransactionsByAddress(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// make sure the staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// the staking txs with the same staking data share the staking output
+	// and therefore the address
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	otherStakingData := datagen.GenerateTestStakingData(t, r, params)
+	expectedTxs := make(map[string]map[chainhash.Hash]struct{})
+	for i := 0; i < 3; i++ {
+		data := stakingData
+		if i == 2 {
+			data = otherStakingData
+		}
+		stakingInfo, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, data)
+		parsedStakingData := getParsedStakingData(data, stakingTx.MsgTx(), params)
+		err := stakingIndexer.ProcessStakingTx(
+			stakingTx.MsgTx(), parsedStakingData,
+			params.ActivationHeight, time.Now(), params)
+		require.NoError(t, err)
+
+		// the taproot address computed from the output key of the staking output
+		expectedAddr, err := btcutil.NewAddressTaproot(stakingInfo.StakingOutput.PkScript[2:], &cfg.BTCNetParams)
+		require.NoError(t, err)
+		addr, err := utils.GetOutputAddress(stakingTx.MsgTx(), uint32(parsedStakingData.StakingOutputIdx), &cfg.BTCNetParams)
+		require.NoError(t, err)
+		require.Equal(t, expectedAddr.EncodeAddress(), addr.EncodeAddress())
+
+		if _, ok := expectedTxs[addr.EncodeAddress()]; !ok {
+			expectedTxs[addr.EncodeAddress()] = make(map[chainhash.Hash]struct{})
+		}
+		expectedTxs[addr.EncodeAddress()][*stakingTx.Hash()] = struct{}{}
+	}
+	require.Len(t, expectedTxs, 2)
+
+	for addr, txHashes := range expectedTxs {
+		storedTxs, err := stakingIndexer.GetStakingTransactionsByAddress(addr)
+		require.NoError(t, err)
+		require.Len(t, storedTxs, len(txHashes))
+		for _, storedTx := range storedTxs {
+			_, ok := txHashes[storedTx.Tx.TxHash()]
+			require.True(t, ok)
+		}
+	}
+
+	// an address without staking txs
+	unknownStakingData := datagen.GenerateTestStakingData(t, r, params)
+	unknownStakingInfo, _ := datagen.GenerateStakingTxFromTestData(t, r, params, unknownStakingData)
+	unknownAddr, err := btcutil.NewAddressTaproot(unknownStakingInfo.StakingOutput.PkScript[2:], &cfg.BTCNetParams)
+	require.NoError(t, err)
+	storedTxs, err := stakingIndexer.GetStakingTransactionsByAddress(unknownAddr.EncodeAddress())
+	require.NoError(t, err)
+	require.Empty(t, storedTxs)
+
+	// invalid addresses
+	_, err = stakingIndexer.GetStakingTransactionsByAddress("invalid")
+	require.ErrorIs(t, err, indexer.ErrInvalidStakingAddress)
+	mainnetAddr, err := btcutil.NewAddressTaproot(unknownStakingInfo.StakingOutput.PkScript[2:], &chaincfg.MainNetParams)
+	require.NoError(t, err)
+	_, err = stakingIndexer.GetStakingTransactionsByAddress(mainnetAddr.EncodeAddress())
+	require.ErrorIs(t, err, indexer.ErrInvalidStakingAddress)
+}
+
+// TestEventConfirmations tests that the staking and withdraw events are
+// emitted at their respective configured confirmation depths, and the held
+// back withdraw event survives a restart with the confirmations raised
+func TestEventConfirmations(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// the staking events are emitted at the confirmation depth
+	// while the withdraw events require extra confirmations
+	extraConfirmations := uint32(3)
+	cfg.WithdrawEventConfirmations = uint32(params.ConfirmationDepth) + extraConfirmations
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	withdrawTx := datagen.GenerateWithdrawalTxFromStaking(t, r, params, stakingData, stakingTx.Hash(), 0)
+
+	var pushedStakingEvents, pushedWithdrawEvents sync.Map
+	ctl := gomock.NewController(t)
+	mockedConsumer := mocks.NewMockEventConsumer(ctl)
+	mockedConsumer.EXPECT().PushStakingEvent(gomock.Any()).DoAndReturn(
+		func(ev *queuecli.ActiveStakingEvent) error {
+			pushedStakingEvents.Store(ev.StakingTxHashHex, struct{}{})
+			return nil
+		}).AnyTimes()
+	mockedConsumer.EXPECT().PushWithdrawEvent(gomock.Any()).DoAndReturn(
+		func(ev *queuecli.WithdrawStakingEvent) error {
+			pushedWithdrawEvents.Store(ev.StakingTxHashHex, struct{}{})
+			return nil
+		}).AnyTimes()
+	isPushed := func(events *sync.Map) bool {
+		_, ok := events.Load(stakingTx.Hash().String())
+		return ok
+	}
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	chainUpdateInfoChan := make(chan *btcscanner.ChainUpdateInfo)
+	mockBtcScanner := NewMockedBtcScanner(t, chainUpdateInfoChan)
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), mockedConsumer, db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+	err = stakingIndexer.Start(stakingIndexer.GetStartHeight())
+	require.NoError(t, err)
+	defer func() {
+		err := stakingIndexer.Stop()
+		require.NoError(t, err)
+		err = db.Close()
+		require.NoError(t, err)
+	}()
+
+	// the blocks are delivered one by one without unconfirmed blocks,
+	// so that the tip is the confirmed block
+	height := params.ActivationHeight
+	var prevHash chainhash.Hash
+	sendBlock := func(txs ...*btcutil.Tx) {
+		b := &types.IndexedBlock{
+			Height: int32(height),
+			Header: &wire.BlockHeader{PrevBlock: prevHash, Timestamp: time.Now()},
+			Txs:    txs,
+		}
+		chainUpdateInfoChan <- &btcscanner.ChainUpdateInfo{
+			ConfirmedBlocks: []*types.IndexedBlock{b},
+		}
+		prevHash = b.BlockHash()
+		height++
+	}
+
+	// the staking event is emitted once the staking tx is confirmed
+	sendBlock(stakingTx)
+	require.Eventually(t, func() bool {
+		return isPushed(&pushedStakingEvents)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the withdraw tx is stored once confirmed, but the event is held back
+	withdrawHeight := height
+	sendBlock(withdrawTx)
+	require.Eventually(t, func() bool {
+		totalWithdrawnValue, err := stakingIndexer.GetTotalWithdrawnValue()
+		require.NoError(t, err)
+		return totalWithdrawnValue == btcutil.Amount(stakingData.StakingAmount)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	emitHeight := withdrawHeight + uint64(cfg.WithdrawEventConfirmations) - 1
+	for uint64(height) < emitHeight {
+		sendBlock()
+		require.Never(t, func() bool {
+			return isPushed(&pushedWithdrawEvents)
+		}, 50*time.Millisecond, 10*time.Millisecond)
+	}
+
+	// the held back event is saved, so the indexer restarts right after
+	// the last processed block. The emit height is fixed once the event is
+	// saved, so raising the confirmations does not hold the event longer
+	require.Eventually(t, func() bool {
+		return stakingIndexer.GetStartHeight() == height
+	}, 5*time.Second, 10*time.Millisecond)
+	err = stakingIndexer.Stop()
+	require.NoError(t, err)
+	restartedCfg := *cfg
+	restartedCfg.WithdrawEventConfirmations += extraConfirmations
+	stakingIndexer, err = indexer.NewStakingIndexer(&restartedCfg, zap.NewNop(), mockedConsumer, db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+	require.Equal(t, height, stakingIndexer.GetStartHeight())
+	err = stakingIndexer.Start(stakingIndexer.GetStartHeight())
+	require.NoError(t, err)
+	require.False(t, isPushed(&pushedWithdrawEvents))
+
+	// the withdraw event is emitted once the tip reaches the required depth
+	sendBlock()
+	require.Eventually(t, func() bool {
+		return isPushed(&pushedWithdrawEvents)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, emitHeight+1, uint64(height))
+}
+
+// TestDurationWeightedScore tests that a custom score function weighting
+// the staking value by the staking time is applied to the new staking txs
+// and the score of unbonded txs is subtracted from the total score
+func TestDurationWeightedScore(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// make sure the staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	durationWeightedScore := func(stakingValue uint64, stakingTime uint32) uint64 {
+		return stakingValue * uint64(stakingTime) / uint64(params.MaxStakingTime)
+	}
+	stakingIndexer.SetScoreFunc(durationWeightedScore)
+
+	numTxs := r.Intn(5) + 2
+	stakingTxs := make([]*btcutil.Tx, 0, numTxs)
+	stakingDatas := make([]*datagen.TestStakingData, 0, numTxs)
+	expectedTotalScore := uint64(0)
+	for i := 0; i < numTxs; i++ {
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		err := stakingIndexer.ProcessStakingTx(
+			stakingTx.MsgTx(),
+			getParsedStakingData(stakingData, stakingTx.MsgTx(), params),
+			params.ActivationHeight, time.Now(), params)
+		require.NoError(t, err)
+		stakingTxs = append(stakingTxs, stakingTx)
+		stakingDatas = append(stakingDatas, stakingData)
+
+		expectedScore := durationWeightedScore(uint64(stakingData.StakingAmount), uint32(stakingData.StakingTime))
+		storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+		require.NoError(t, err)
+		require.Equal(t, expectedScore, storedTx.Score)
+		expectedTotalScore += expectedScore
+	}
+
+	totalScore, err := stakingIndexer.GetTotalScore()
+	require.NoError(t, err)
+	require.Equal(t, expectedTotalScore, totalScore)
+
+	// the score of the unbonded tx no longer counts
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingDatas[0], stakingTxs[0].Hash(), 0)
+	err = stakingIndexer.ProcessUnbondingTx(unbondingTx.MsgTx(), stakingTxs[0].Hash(), params.ActivationHeight+1, time.Now(), params)
+	require.NoError(t, err)
+	expectedTotalScore -= durationWeightedScore(uint64(stakingDatas[0].StakingAmount), uint32(stakingDatas[0].StakingTime))
+	totalScore, err = stakingIndexer.GetTotalScore()
+	require.NoError(t, err)
+	require.Equal(t, expectedTotalScore, totalScore)
+
+	// the confirmed TVL is not weighted
+	tvl, err := stakingIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	expectedTvl := uint64(0)
+	for _, stakingData := range stakingDatas[1:] {
+		expectedTvl += uint64(stakingData.StakingAmount)
+	}
+	require.Equal(t, expectedTvl, tvl)
+}
+
+// TestStartStopGuard tests that starting the indexer twice returns an
+// error, and stopping it before it starts or twice is a no-op
+func TestStartStopGuard(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// stop before start
+	err = stakingIndexer.Stop()
+	require.NoError(t, err)
+
+	// the indexer can still be started
+	err = stakingIndexer.Start(stakingIndexer.GetStartHeight())
+	require.NoError(t, err)
+
+	// double start
+	err = stakingIndexer.Start(stakingIndexer.GetStartHeight())
+	require.Error(t, err)
+
+	// stop twice
+	err = stakingIndexer.Stop()
+	require.NoError(t, err)
+	err = stakingIndexer.Stop()
+	require.NoError(t, err)
+
+	// the stopped indexer cannot be started again
+	err = stakingIndexer.Start(stakingIndexer.GetStartHeight())
+	require.Error(t, err)
+}
+
+// TestTagTransitionWindow tests that the staking txs carrying the tag of
+// the adjacent params version are accepted within the window around the
+// activation height of the new version
+func TestTagTransitionWindow(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.TagTransitionWindow = 1
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	oldParams, newParams := sysParamsVersions.Versions[0], sysParamsVersions.Versions[1]
+	newParams.Tag = []byte{0x05, 0x06, 0x07, 0x08}
+	boundary := newParams.ActivationHeight
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// genStakingTx generates a staking tx following the params of the
+	// given height but carrying the given tag
+	genStakingTx := func(params *parser.ParsedVersionedGlobalParams, tag []byte) *btcutil.Tx {
+		taggedParams := *params
+		taggedParams.Tag = tag
+		stakingData := datagen.GenerateTestStakingData(t, r, &taggedParams)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, &taggedParams, stakingData)
+		return stakingTx
+	}
+	handleBlock := func(height uint64, txs ...*btcutil.Tx) {
+		err := handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+			Height: int32(height),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    txs,
+		})
+		require.NoError(t, err)
+	}
+	isStored := func(tx *btcutil.Tx) bool {
+		storedTx, err := stakingIndexer.GetStakingTxByHash(tx.Hash())
+		require.NoError(t, err)
+		return storedTx != nil
+	}
+
+	// both tags are accepted at the last height of the old version
+	// and the first height of the new version, each height is handled
+	// once as handling another block at a processed height is a reorg
+	newTagTxBeforeBoundary := genStakingTx(oldParams, newParams.Tag)
+	oldTagTxBeforeBoundary := genStakingTx(oldParams, oldParams.Tag)
+	handleBlock(boundary-1, newTagTxBeforeBoundary, oldTagTxBeforeBoundary)
+	require.True(t, isStored(newTagTxBeforeBoundary))
+	require.True(t, isStored(oldTagTxBeforeBoundary))
+
+	oldTagTxAtBoundary := genStakingTx(newParams, oldParams.Tag)
+	newTagTxAtBoundary := genStakingTx(newParams, newParams.Tag)
+	handleBlock(boundary, oldTagTxAtBoundary, newTagTxAtBoundary)
+	require.True(t, isStored(oldTagTxAtBoundary))
+	require.True(t, isStored(newTagTxAtBoundary))
+
+	// the old tag is no longer accepted out of the window
+	oldTagTxAfterWindow := genStakingTx(newParams, oldParams.Tag)
+	handleBlock(boundary+1, oldTagTxAfterWindow)
+	require.False(t, isStored(oldTagTxAfterWindow))
+}
+
+// TestDelegationTimeline tests the timeline of a delegation going through
+// the full lifecycle and of a delegation that is still active, before and
+// after their eligibility is overridden
+func TestDelegationTimeline(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// make sure the staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// the first delegation is staked, unbonded and withdrawn while
+	// the second one stays active
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+	withdrawTx := datagen.GenerateWithdrawalTxFromUnbonding(t, r, params, stakingData1, unbondingTx.Hash())
+
+	startHeight := params.ActivationHeight
+	startTime := time.Now().Unix()
+	for i, txs := range [][]*btcutil.Tx{
+		{stakingTx1, stakingTx2},
+		{unbondingTx},
+		{withdrawTx},
+	} {
+		b := &types.IndexedBlock{
+			Height: int32(startHeight) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Unix(startTime+int64(i)*600, 0)},
+			Txs:    txs,
+		}
+		err := handleLinkedBlock(t, stakingIndexer, b)
+		require.NoError(t, err)
+	}
+
+	timeline, err := stakingIndexer.GetDelegationTimeline(stakingTx1.Hash())
+	require.NoError(t, err)
+	require.Equal(t, []indexer.TimelineEvent{
+		{Type: indexer.TimelineEventStaked, Height: startHeight, Timestamp: startTime, Eligible: true},
+		{Type: indexer.TimelineEventUnbonded, Height: startHeight + 1, Timestamp: startTime + 600},
+		{Type: indexer.TimelineEventWithdrawn, Height: startHeight + 2, Timestamp: startTime + 1200},
+	}, timeline)
+
+	timeline, err = stakingIndexer.GetDelegationTimeline(stakingTx2.Hash())
+	require.NoError(t, err)
+	require.Equal(t, []indexer.TimelineEvent{
+		{Type: indexer.TimelineEventStaked, Height: startHeight, Timestamp: startTime, Eligible: true},
+	}, timeline)
+
+	// the staked event keeps the eligibility at staking while the override
+	// is an event placed by its time, i.e., before the blocks timestamped
+	// in the future here
+	for _, stakingTx := range []*btcutil.Tx{stakingTx1, stakingTx2} {
+		err = stakingIndexer.OverrideEligibility(stakingTx.Hash(), false, indexerstore.InactiveReasonManual)
+		require.NoError(t, err)
+	}
+	overrideTime := time.Now().Unix()
+
+	timeline, err = stakingIndexer.GetDelegationTimeline(stakingTx1.Hash())
+	require.NoError(t, err)
+	require.Len(t, timeline, 4)
+	require.InDelta(t, overrideTime, timeline[1].Timestamp, 1)
+	require.Equal(t, []indexer.TimelineEvent{
+		{Type: indexer.TimelineEventStaked, Height: startHeight, Timestamp: startTime, Eligible: true},
+		{Type: indexer.TimelineEventEligibilityChanged, Timestamp: timeline[1].Timestamp, InactiveReason: indexerstore.InactiveReasonManual},
+		{Type: indexer.TimelineEventUnbonded, Height: startHeight + 1, Timestamp: startTime + 600},
+		{Type: indexer.TimelineEventWithdrawn, Height: startHeight + 2, Timestamp: startTime + 1200},
+	}, timeline)
+
+	timeline, err = stakingIndexer.GetDelegationTimeline(stakingTx2.Hash())
+	require.NoError(t, err)
+	require.Len(t, timeline, 2)
+	require.Equal(t, []indexer.TimelineEvent{
+		{Type: indexer.TimelineEventStaked, Height: startHeight, Timestamp: startTime, Eligible: true},
+		{Type: indexer.TimelineEventEligibilityChanged, Timestamp: timeline[1].Timestamp, InactiveReason: indexerstore.InactiveReasonManual},
+	}, timeline)
+
+	// unknown delegations have no timeline
+	unknownHash := bbndatagen.GenRandomBtcdHash(r)
+	timeline, err = stakingIndexer.GetDelegationTimeline(&unknownHash)
+	require.NoError(t, err)
+	require.Nil(t, timeline)
+}
+
+// TestStakingStatusLifecycle tests that the status of the stored staking txs
+// follows the unbonding and withdrawal txs spending them
+func TestStakingStatusLifecycle(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// make sure the staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// the first delegation is unbonded before it is withdrawn while the
+	// second one is withdrawn from the staking output
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+	withdrawTxFromUnbonding := datagen.GenerateWithdrawalTxFromUnbonding(t, r, params, stakingData1, unbondingTx.Hash())
+	withdrawTxFromStaking := datagen.GenerateWithdrawalTxFromStaking(t, r, params, stakingData2, stakingTx2.Hash(), 0)
+
+	requireStatuses := func(status1, status2 indexerstore.StakingStatus) {
+		storedTx, err := stakingIndexer.GetStakingTxByHash(stakingTx1.Hash())
+		require.NoError(t, err)
+		require.Equal(t, status1, storedTx.Status)
+		storedTx, err = stakingIndexer.GetStakingTxByHash(stakingTx2.Hash())
+		require.NoError(t, err)
+		require.Equal(t, status2, storedTx.Status)
+	}
+
+	for i, step := range []struct {
+		txs              []*btcutil.Tx
+		status1, status2 indexerstore.StakingStatus
+	}{
+		{[]*btcutil.Tx{stakingTx1, stakingTx2}, indexerstore.StakingStatusStaked, indexerstore.StakingStatusStaked},
+		{[]*btcutil.Tx{unbondingTx}, indexerstore.StakingStatusUnbonding, indexerstore.StakingStatusStaked},
+		{[]*btcutil.Tx{withdrawTxFromUnbonding}, indexerstore.StakingStatusWithdrawn, indexerstore.StakingStatusStaked},
+		{[]*btcutil.Tx{withdrawTxFromStaking}, indexerstore.StakingStatusWithdrawn, indexerstore.StakingStatusWithdrawn},
+	} {
+		b := &types.IndexedBlock{
+			Height: int32(params.ActivationHeight) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    step.txs,
+		}
+		err := handleLinkedBlock(t, stakingIndexer, b)
+		require.NoError(t, err)
+
+		requireStatuses(step.status1, step.status2)
+	}
+}
+
+// TestProcessingErrorLog tests that the errors of processing invalid txs
+// are recorded and only the most recent ones are kept
+func TestProcessingErrorLog(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.ProcessingErrorLogSize = 2
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	// an unbonding tx setting the lock time
+	lockTimeUnbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+	lockTimeUnbondingTx.MsgTx().LockTime = 1
+	lockTimeUnbondingTx = btcutil.NewTx(lockTimeUnbondingTx.MsgTx())
+	// a staking tx of which the staking output does not match the op return data
+	_, malformedTx := datagen.GenerateStakingTxFromTestData(t, r, params, datagen.GenerateTestStakingData(t, r, params))
+	malformedTx.MsgTx().TxOut[0].PkScript = bbndatagen.GenRandomByteArray(r, 34)
+	malformedTx = btcutil.NewTx(malformedTx.MsgTx())
+	// an unbonding tx enabling rbf
+	rbfUnbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+	rbfUnbondingTx.MsgTx().TxIn[0].Sequence = 0
+	rbfUnbondingTx = btcutil.NewTx(rbfUnbondingTx.MsgTx())
+
+	startHeight := params.ActivationHeight
+	for i, tx := range []*btcutil.Tx{stakingTx, lockTimeUnbondingTx, malformedTx, rbfUnbondingTx} {
+		b := &types.IndexedBlock{
+			Height: int32(startHeight) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    []*btcutil.Tx{tx},
+		}
+		err := handleLinkedBlock(t, stakingIndexer, b)
+		require.NoError(t, err)
+	}
+
+	// the error of the oldest invalid tx is removed
+	processingErrors, err := stakingIndexer.GetRecentProcessingErrors(10)
+	require.NoError(t, err)
+	require.Len(t, processingErrors, 2)
+	require.Equal(t, rbfUnbondingTx.Hash(), processingErrors[0].TxHash)
+	require.Equal(t, startHeight+3, processingErrors[0].Height)
+	require.Contains(t, processingErrors[0].Error, indexer.ErrInvalidUnbondingTx.Error())
+	require.Equal(t, malformedTx.Hash(), processingErrors[1].TxHash)
+	require.Equal(t, startHeight+2, processingErrors[1].Height)
+	require.Contains(t, processingErrors[1].Error, indexer.ErrUnparseableStakingTx.Error())
+
+	processingErrors, err = stakingIndexer.GetRecentProcessingErrors(1)
+	require.NoError(t, err)
+	require.Len(t, processingErrors, 1)
+	require.Equal(t, rbfUnbondingTx.Hash(), processingErrors[0].TxHash)
+}
+
+// TestDevCovenantQuorumOverride tests that the covenant quorum override
+// only applies to parsing and validating txs when the dev mode is enabled
+func TestDevCovenantQuorumOverride(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// make sure the quorum of the params can be reduced
+	covenantKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	params.CovenantPks = append(params.CovenantPks, covenantKey.PubKey())
+	params.CovenantQuorum = uint32(len(params.CovenantPks))
+	// the txs are built with a reduced quorum as on a testnet
+	devParams := *params
+	devParams.CovenantQuorum = 1
+
+	stakingData := datagen.GenerateTestStakingData(t, r, &devParams)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, &devParams, stakingData)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, &devParams, stakingData, stakingTx.Hash(), 0)
+
+	for _, devModeEnabled := range []bool{false, true} {
+		homePath := filepath.Join(t.TempDir(), "indexer")
+		cfg := config.DefaultConfigWithHome(homePath)
+		cfg.DevCovenantQuorum = devParams.CovenantQuorum
+		cfg.DevModeEnabled = devModeEnabled
+
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+		require.NoError(t, err)
+
+		for i, tx := range []*btcutil.Tx{stakingTx, unbondingTx} {
+			b := &types.IndexedBlock{
+				Height: int32(params.ActivationHeight) + int32(i),
+				Header: &wire.BlockHeader{Timestamp: time.Now()},
+				Txs:    []*btcutil.Tx{tx},
+			}
+			err := handleLinkedBlock(t, stakingIndexer, b)
+			require.NoError(t, err)
+		}
+
+		storedStakingTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+		require.NoError(t, err)
+		storedUnbondingTx, err := stakingIndexer.GetUnbondingTxByHash(unbondingTx.Hash())
+		require.NoError(t, err)
+		if devModeEnabled {
+			require.NotNil(t, storedStakingTx)
+			require.NotNil(t, storedUnbondingTx)
+		} else {
+			// the quorum of the params is used
+			require.Nil(t, storedStakingTx)
+			require.Nil(t, storedUnbondingTx)
+		}
+
+		err = db.Close()
+		require.NoError(t, err)
+	}
+
+	// the override requires the dev mode which is refused on mainnet
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	cfg.DevCovenantQuorum = 1
+	require.Error(t, cfg.Validate())
+	cfg.DevModeEnabled = true
+	require.NoError(t, cfg.Validate())
+	cfg.BitcoinNetwork = "mainnet"
+	require.Error(t, cfg.Validate())
+
+	// the override cannot exceed the number of covenants
+	cfg = config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	cfg.DevModeEnabled = true
+	cfg.DevCovenantQuorum = uint32(len(params.CovenantPks) + 1)
+	_, err = indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), nil, sysParamsVersions, nil)
+	require.Error(t, err)
+}
+
+// batchedConsumer is a consumer receiving the events of a block in batch
+type batchedConsumer struct {
+	*mocks.MockEventConsumer
+	batches []*consumer.BlockEvents
+}
+
+func (c *batchedConsumer) PushBlockEvents(evs *consumer.BlockEvents) error {
+	c.batches = append(c.batches, evs)
+	return nil
+}
+
+// TestBatchedBlockEvents tests that the events of a block are pushed in a
+// single batch containing all the events, and pushed one by one in order if
+// the consumer does not support batches
+func TestBatchedBlockEvents(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// make sure the staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	stakingData1 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx1 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData1)
+	stakingData2 := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx2 := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData2)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData1, stakingTx1.Hash(), 0)
+	withdrawTxFromStaking := datagen.GenerateWithdrawalTxFromStaking(t, r, params, stakingData2, stakingTx2.Hash(), 0)
+	withdrawTxFromUnbonding := datagen.GenerateWithdrawalTxFromUnbonding(t, r, params, stakingData1, unbondingTx.Hash())
+	blockTxs := [][]*btcutil.Tx{
+		{stakingTx1, stakingTx2},
+		{unbondingTx, withdrawTxFromStaking},
+		// no events
+		{},
+		{withdrawTxFromUnbonding},
+	}
+
+	handleBlocks := func(c consumer.EventConsumer) {
+		cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+		cfg.BatchBlockEventsEnabled = true
+
+		db, err := cfg.DatabaseConfig.GetDbBackend()
+		require.NoError(t, err)
+		defer func() {
+			err := db.Close()
+			require.NoError(t, err)
+		}()
+		mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+		stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), c, db, sysParamsVersions, mockBtcScanner)
+		require.NoError(t, err)
+
+		for i, txs := range blockTxs {
+			b := &types.IndexedBlock{
+				Height: int32(params.ActivationHeight) + int32(i),
+				Header: &wire.BlockHeader{Timestamp: time.Now()},
+				Txs:    txs,
+			}
+			err := handleLinkedBlock(t, stakingIndexer, b)
+			require.NoError(t, err)
+		}
+	}
+
+	// the per-event methods are not expected to be called
+	bc := &batchedConsumer{MockEventConsumer: mocks.NewMockEventConsumer(gomock.NewController(t))}
+	handleBlocks(bc)
+	require.Len(t, bc.batches, 3)
+
+	require.Equal(t, params.ActivationHeight, bc.batches[0].Height)
+	require.Len(t, bc.batches[0].Events, 2)
+	require.Equal(t, stakingTx1.Hash().String(), bc.batches[0].Events[0].StakingEvent.StakingTxHashHex)
+	require.Equal(t, stakingTx2.Hash().String(), bc.batches[0].Events[1].StakingEvent.StakingTxHashHex)
+
+	require.Equal(t, params.ActivationHeight+1, bc.batches[1].Height)
+	require.Len(t, bc.batches[1].Events, 2)
+	require.Equal(t, unbondingTx.Hash().String(), bc.batches[1].Events[0].UnbondingEvent.UnbondingTxHashHex)
+	require.Equal(t, stakingTx2.Hash().String(), bc.batches[1].Events[1].WithdrawEvent.StakingTxHashHex)
+
+	require.Equal(t, params.ActivationHeight+3, bc.batches[2].Height)
+	require.Len(t, bc.batches[2].Events, 1)
+	require.Equal(t, stakingTx1.Hash().String(), bc.batches[2].Events[0].WithdrawEvent.StakingTxHashHex)
+
+	// the events are pushed one by one in the same order otherwise
+	mockedConsumer := mocks.NewMockEventConsumer(gomock.NewController(t))
+	gomock.InOrder(
+		mockedConsumer.EXPECT().PushStakingEvent(gomock.Any()).Return(nil).Times(2),
+		mockedConsumer.EXPECT().PushUnbondingEvent(gomock.Any()).Return(nil).Times(1),
+		mockedConsumer.EXPECT().PushWithdrawEvent(gomock.Any()).Return(nil).Times(2),
+	)
+	handleBlocks(mockedConsumer)
+}
+
+// TestConflictingUnbondingTxs tests that an unbonding tx spending an already
+// unbonded staking output is rejected and recorded as a processing error
+// without halting the indexer on the block, while the same unbonding tx can
+// be processed again
+func TestConflictingUnbondingTxs(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// make sure the staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), 0)
+	// another valid unbonding tx spending the same staking output
+	conflictingMsgTx := unbondingTx.MsgTx().Copy()
+	conflictingMsgTx.Version++
+	conflictingTx := btcutil.NewTx(conflictingMsgTx)
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	cfg.ProcessingErrorLogSize = 10
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+
+	// the unbonding event is emitted again for the re-broadcast
+	// but never for the conflicting unbonding tx
+	mockedConsumer := mocks.NewMockEventConsumer(gomock.NewController(t))
+	mockedConsumer.EXPECT().PushStakingEvent(gomock.Any()).Return(nil).Times(1)
+	mockedConsumer.EXPECT().PushUnbondingEvent(gomock.Any()).Return(nil).Times(2)
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), mockedConsumer, db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	for i, tx := range []*btcutil.Tx{stakingTx, unbondingTx} {
+		b := &types.IndexedBlock{
+			Height: int32(params.ActivationHeight) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+			Txs:    []*btcutil.Tx{tx},
+		}
+		err := handleLinkedBlock(t, stakingIndexer, b)
+		require.NoError(t, err)
+	}
+
+	err = stakingIndexer.ProcessUnbondingTx(unbondingTx.MsgTx(), stakingTx.Hash(), params.ActivationHeight+1, time.Now(), params)
+	require.NoError(t, err)
+
+	// the block including the conflicting unbonding tx is still processed
+	conflictingHeight := params.ActivationHeight + 2
+	err = handleLinkedBlock(t, stakingIndexer, &types.IndexedBlock{
+		Height: int32(conflictingHeight),
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{conflictingTx},
+	})
+	require.NoError(t, err)
+	require.Equal(t, conflictingHeight+1, stakingIndexer.GetStartHeight())
+
+	storedUnbondingTx, err := stakingIndexer.GetUnbondingTxByHash(unbondingTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedUnbondingTx)
+	storedUnbondingTx, err = stakingIndexer.GetUnbondingTxByHash(conflictingTx.Hash())
+	require.NoError(t, err)
+	require.Nil(t, storedUnbondingTx)
+
+	processingErrors, err := stakingIndexer.GetRecentProcessingErrors(10)
+	require.NoError(t, err)
+	require.Len(t, processingErrors, 1)
+	require.Equal(t, conflictingTx.Hash(), processingErrors[0].TxHash)
+	require.Equal(t, conflictingHeight, processingErrors[0].Height)
+	require.Contains(t, processingErrors[0].Error, indexerstore.ErrStakingOutputAlreadySpent.Error())
+}
+
+// TestStakingTxWithExtraOutputs tests that staking txs carrying outputs
+// other than the staking and OP_RETURN outputs, e.g., a change output, are
+// indexed regardless of the positions of the outputs, and that they can be
+// spent from the located staking output
+func TestStakingTxWithExtraOutputs(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	// the txs are processed in the blocks following the activation height,
+	// which should not activate another params version
+	sysParamsVersions.Versions = sysParamsVersions.Versions[:1]
+	params := sysParamsVersions.Versions[0]
+	// make sure the staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// a P2WSH change output, which is never mistaken for an OP_RETURN output
+	changeScript := append([]byte{txscript.OP_0, txscript.OP_DATA_32}, bbndatagen.GenRandomByteArray(r, 32)...)
+	changeOutput := wire.NewTxOut(int64(r.Int63n(1e8)+1), changeScript)
+
+	for i, tc := range []struct {
+		name string
+		// reorder returns the outputs of the staking tx given its staking,
+		// OP_RETURN and change outputs
+		reorder          func(staking, opReturn, change *wire.TxOut) []*wire.TxOut
+		stakingOutputIdx uint32
+	}{
+		{
+			"change output appended",
+			func(staking, opReturn, change *wire.TxOut) []*wire.TxOut {
+				return []*wire.TxOut{staking, opReturn, change}
+			},
+			0,
+		},
+		{
+			"change output first",
+			func(staking, opReturn, change *wire.TxOut) []*wire.TxOut {
+				return []*wire.TxOut{change, staking, opReturn}
+			},
+			1,
+		},
+		{
+			"OP_RETURN output first and staking output last",
+			func(staking, opReturn, change *wire.TxOut) []*wire.TxOut {
+				return []*wire.TxOut{opReturn, change, staking}
+			},
+			2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stakingData := datagen.GenerateTestStakingData(t, r, params)
+			stakingInfo, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+			msgTx := stakingTx.MsgTx().Copy()
+			msgTx.TxOut = tc.reorder(stakingInfo.StakingOutput, stakingInfo.OpReturnOutput, changeOutput)
+			stakingTx = btcutil.NewTx(msgTx)
+			unbondingTx := datagen.GenerateUnbondingTxFromStaking(t, params, stakingData, stakingTx.Hash(), tc.stakingOutputIdx)
+
+			height := params.ActivationHeight + uint64(2*i)
+			for j, tx := range []*btcutil.Tx{stakingTx, unbondingTx} {
+				b := &types.IndexedBlock{
+					Height: int32(height) + int32(j),
+					Header: &wire.BlockHeader{Timestamp: time.Now()},
+					Txs:    []*btcutil.Tx{tx},
+				}
+				err := handleLinkedBlock(t, stakingIndexer, b)
+				require.NoError(t, err)
+			}
+
+			storedStakingTx, err := stakingIndexer.GetStakingTxByHash(stakingTx.Hash())
+			require.NoError(t, err)
+			require.NotNil(t, storedStakingTx)
+			require.Equal(t, tc.stakingOutputIdx, storedStakingTx.StakingOutputIdx)
+			require.Equal(t, stakingData.StakingAmount, btcutil.Amount(stakingTx.MsgTx().TxOut[storedStakingTx.StakingOutputIdx].Value))
+
+			storedUnbondingTx, err := stakingIndexer.GetUnbondingTxByHash(unbondingTx.Hash())
+			require.NoError(t, err)
+			require.NotNil(t, storedUnbondingTx)
+			require.Equal(t, stakingTx.Hash().String(), storedUnbondingTx.StakingTxHash.String())
+		})
+	}
+}
+
+// TestStakingTxReplacement tests that only the mined version of a staking tx
+// replaced before confirmation is stored. The original tx only contributes
+// to the unconfirmed TVL while it is in the unconfirmed blocks, and it is
+// never stored once a replacement spending the same inputs is confirmed
+func TestStakingTxReplacement(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// the replacement spends the same inputs with a change output
+	stakingData := datagen.GenerateTestStakingData(t, r, params)
+	_, originalTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+	replacementMsgTx := originalTx.MsgTx().Copy()
+	changeScript := append([]byte{txscript.OP_0, txscript.OP_DATA_32}, bbndatagen.GenRandomByteArray(r, 32)...)
+	replacementMsgTx.AddTxOut(wire.NewTxOut(int64(r.Int63n(1e8)+1), changeScript))
+	replacementTx := btcutil.NewTx(replacementMsgTx)
+	require.NotEqual(t, originalTx.Hash(), replacementTx.Hash())
+
+	// the original tx is counted in the unconfirmed TVL while it is
+	// in the unconfirmed blocks
+	height := int32(params.ActivationHeight)
+	unconfirmedTvl, err := stakingIndexer.CalculateTvlInUnconfirmedBlocks([]*types.IndexedBlock{
+		{Height: height, Header: &wire.BlockHeader{Timestamp: time.Now()}, Txs: []*btcutil.Tx{originalTx}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, stakingData.StakingAmount, unconfirmedTvl)
+
+	// the original tx is reorged out and the replacement is confirmed
+	err = stakingIndexer.HandleConfirmedBlock(&types.IndexedBlock{
+		Height: height,
+		Header: &wire.BlockHeader{Timestamp: time.Now()},
+		Txs:    []*btcutil.Tx{replacementTx},
+	})
+	require.NoError(t, err)
+
+	storedTx, err := stakingIndexer.GetStakingTxByHash(originalTx.Hash())
+	require.NoError(t, err)
+	require.Nil(t, storedTx)
+	storedTx, err = stakingIndexer.GetStakingTxByHash(replacementTx.Hash())
+	require.NoError(t, err)
+	require.NotNil(t, storedTx)
+
+	confirmedTvl, err := stakingIndexer.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Equal(t, uint64(stakingData.StakingAmount), confirmedTvl)
+	stakingCount, _, _, err := stakingIndexer.GetBlockStats(uint64(height))
+	require.NoError(t, err)
+	require.Equal(t, 1, stakingCount)
+}
+
+// processedConsumer is a consumer tracking the processed blocks
+type processedConsumer struct {
+	*mocks.MockEventConsumer
+	heights []uint64
+	hashes  []chainhash.Hash
+}
+
+func (c *processedConsumer) PushBlockProcessedEvent(height uint64, hash *chainhash.Hash) error {
+	c.heights = append(c.heights, height)
+	c.hashes = append(c.hashes, *hash)
+	return nil
+}
+
+// TestBlockProcessedEvent tests that the block processed event is pushed
+// after the events of each block, whether the block has staking activity
+func TestBlockProcessedEvent(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	// make sure the staking cap is never reached
+	params.CapHeight = 0
+	params.StakingCap = btcutil.Amount(btcutil.MaxSatoshi)
+
+	_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, datagen.GenerateTestStakingData(t, r, params))
+
+	cfg := config.DefaultConfigWithHome(filepath.Join(t.TempDir(), "indexer"))
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+
+	mockedConsumer := mocks.NewMockEventConsumer(gomock.NewController(t))
+	pc := &processedConsumer{MockEventConsumer: mockedConsumer}
+	mockedConsumer.EXPECT().PushStakingEvent(gomock.Any()).DoAndReturn(
+		func(_ *queuecli.ActiveStakingEvent) error {
+			// the staking event is pushed before the block is processed
+			require.Empty(t, pc.heights)
+			return nil
+		}).Times(1)
+
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), pc, db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	var expectedHashes []chainhash.Hash
+	for i, txs := range [][]*btcutil.Tx{{stakingTx}, {}} {
+		b := &types.IndexedBlock{
+			Height: int32(params.ActivationHeight) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now(), Nonce: r.Uint32()},
+			Txs:    txs,
+		}
+		err := handleLinkedBlock(t, stakingIndexer, b)
+		require.NoError(t, err)
+		expectedHashes = append(expectedHashes, b.BlockHash())
+	}
+
+	require.Equal(t, []uint64{params.ActivationHeight, params.ActivationHeight + 1}, pc.heights)
+	require.Equal(t, expectedHashes, pc.hashes)
+}
+
+// TestPruningDiagnosticLogs tests that the dead letters and processing errors
+// beyond the configured retention are pruned
+func TestPruningDiagnosticLogs(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	homePath := filepath.Join(t.TempDir(), "indexer")
+	cfg := config.DefaultConfigWithHome(homePath)
+	cfg.DeadLetterEnabled = true
+	cfg.DeadLetterMaxEntries = 1
+	cfg.DiagnosticLogRetention = 3
+
+	sysParamsVersions := datagen.GenerateGlobalParamsVersions(r, t)
+	params := sysParamsVersions.Versions[0]
+	db, err := cfg.DatabaseConfig.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+	mockBtcScanner := NewMockedBtcScanner(t, make(chan *btcscanner.ChainUpdateInfo))
+	stakingIndexer, err := indexer.NewStakingIndexer(cfg, zap.NewNop(), NewMockedConsumer(t), db, sysParamsVersions, mockBtcScanner)
+	require.NoError(t, err)
+
+	// a staking tx of which the staking output does not match the op return
+	// data in each of the first 3 blocks, followed by 2 empty blocks
+	startHeight := params.ActivationHeight
+	var malformedTxs []*btcutil.Tx
+	for i := 0; i < 5; i++ {
+		b := &types.IndexedBlock{
+			Height: int32(startHeight) + int32(i),
+			Header: &wire.BlockHeader{Timestamp: time.Now()},
+		}
+		if i < 3 {
+			_, malformedTx := datagen.GenerateStakingTxFromTestData(t, r, params, datagen.GenerateTestStakingData(t, r, params))
+			malformedTx.MsgTx().TxOut[0].PkScript = bbndatagen.GenRandomByteArray(r, 34)
+			malformedTx = btcutil.NewTx(malformedTx.MsgTx())
+			malformedTxs = append(malformedTxs, malformedTx)
+			b.Txs = []*btcutil.Tx{malformedTx}
+		}
+		err := handleLinkedBlock(t, stakingIndexer, b)
+		require.NoError(t, err)
+	}
+
+	sizes, err := stakingIndexer.GetDiagnosticLogSizes()
+	require.NoError(t, err)
+	require.Equal(t, 3, sizes.DeadLetters)
+	require.Equal(t, 3, sizes.ProcessingErrors)
+
+	// the entries of the first block are beyond the retention, and only
+	// the dead letter of the highest height is kept by the limit
+	err = stakingIndexer.PruneDiagnosticLogs()
+	require.NoError(t, err)
+
+	sizes, err = stakingIndexer.GetDiagnosticLogSizes()
+	require.NoError(t, err)
+	require.Equal(t, 1, sizes.DeadLetters)
+	require.Equal(t, 2, sizes.ProcessingErrors)
+
+	deadLetters, err := stakingIndexer.GetDeadLetters()
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	require.Equal(t, malformedTxs[2].Hash().String(), deadLetters[0].Tx.TxHash().String())
+
+	processingErrors, err := stakingIndexer.GetRecentProcessingErrors(10)
+	require.NoError(t, err)
+	require.Len(t, processingErrors, 2)
+	require.Equal(t, malformedTxs[2].Hash(), processingErrors[0].TxHash)
+	require.Equal(t, malformedTxs[1].Hash(), processingErrors[1].TxHash)
+}
+
 func NewMockedConsumer(t *testing.T) *mocks.MockEventConsumer {
 	ctl := gomock.NewController(t)
 	mockedConsumer := mocks.NewMockEventConsumer(ctl)
@@ -595,11 +6029,26 @@ func NewMockedConsumer(t *testing.T) *mocks.MockEventConsumer {
 	return mockedConsumer
 }
 
+// handleLinkedBlock handles the given hand-built block as the confirmed block
+// extending the block processed at the previous height, if any
+func handleLinkedBlock(t *testing.T, si *indexer.StakingIndexer, b *types.IndexedBlock) error {
+	if b.Height > 0 {
+		parent, err := si.GetProcessedHeader(uint64(b.Height) - 1)
+		require.NoError(t, err)
+		if parent != nil {
+			b.Header.PrevBlock = parent.Hash
+		}
+	}
+
+	return si.HandleConfirmedBlock(b)
+}
+
 func NewMockedBtcScanner(t *testing.T, chainUpdateInfoChan chan *btcscanner.ChainUpdateInfo) *mocks.MockBtcScanner {
 	ctl := gomock.NewController(t)
 	mockBtcScanner := mocks.NewMockBtcScanner(ctl)
 	mockBtcScanner.EXPECT().Start(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 	mockBtcScanner.EXPECT().ChainUpdateInfoChan().Return(chainUpdateInfoChan).AnyTimes()
+	mockBtcScanner.EXPECT().LastConfirmedHeight().Return(uint64(0)).AnyTimes()
 	mockBtcScanner.EXPECT().Stop().Return(nil).AnyTimes()
 
 	return mockBtcScanner
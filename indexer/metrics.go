@@ -1,10 +1,20 @@
 package indexer
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"go.uber.org/zap"
+
+	"github.com/babylonlabs-io/staking-indexer/utils"
 )
 
+// metricsPushTimeout is the timeout of pushing the metrics to the pushgateway
+const metricsPushTimeout = 10 * time.Second
+
 var (
 	/* statistics */
 
@@ -25,6 +35,27 @@ var (
 		},
 	)
 
+	lastCalculatedTvlBtc = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "si_last_calculated_active_tvl_btc",
+			Help: "The value of the last calculated TVL in BTC",
+		},
+	)
+
+	stakingCapWarning = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "si_staking_cap_warning",
+			Help: "Whether the TVL measured against the staking cap has reached the configured percentage of it (1) or not (0)",
+		},
+	)
+
+	stakingCapUtilization = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "si_staking_cap_utilization",
+			Help: "The percentage of the staking cap used by the TVL measured against it",
+		},
+	)
+
 	lastFoundStakingTxHeight = promauto.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "si_last_found_staking_tx_height",
@@ -84,6 +115,47 @@ var (
 		},
 	)
 
+	pendingEventsGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "si_pending_events",
+			Help: "The number of events held back until their txs reach the configured number of confirmations",
+		},
+	)
+
+	deadLettersGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "si_dead_letters",
+			Help: "The number of dead letters in the store",
+		},
+	)
+
+	processingErrorsGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "si_processing_errors",
+			Help: "The number of processing errors in the store",
+		},
+	)
+
+	delegationsByEligibility = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "si_delegations_by_eligibility",
+			Help: "The number of delegations that are active or inactive due to the staking caps",
+		},
+		[]string{
+			"eligibility",
+		},
+	)
+
+	inactiveDelegationsByReason = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "si_inactive_delegations_by_reason",
+			Help: "The number of inactive delegations per inactive reason",
+		},
+		[]string{
+			"inactive_reason",
+		},
+	)
+
 	/* alerts */
 
 	failedProcessingStakingTxsCounter = promauto.NewCounter(
@@ -100,6 +172,34 @@ var (
 		},
 	)
 
+	outOfOrderBlocksCounter = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "si_out_of_order_blocks_counter",
+			Help: "Total number of rejected confirmed blocks delivered out of order",
+		},
+	)
+
+	detectedReorgsCounter = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "si_detected_reorgs_counter",
+			Help: "Total number of reorgs of the confirmed blocks detected against the processed headers",
+		},
+	)
+
+	oversizedBlocksCounter = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "si_oversized_blocks_counter",
+			Help: "Total number of rejected confirmed blocks having more txs than the configured maximum",
+		},
+	)
+
+	consumerPushTimeoutsCounter = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "si_consumer_push_timeouts_counter",
+			Help: "Total number of pushes to the consumer that timed out",
+		},
+	)
+
 	invalidTransactionsCounter = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "si_invalid_txs_counter",
@@ -110,6 +210,13 @@ var (
 		},
 	)
 
+	flaggedUnbondingTxsCounter = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "si_flagged_unbonding_txs_counter",
+			Help: "Total number of unbonding transactions flagged by a validator",
+		},
+	)
+
 	failedVerifyingUnbondingTxsCounter = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "si_failed_checking_unbonding_txs_counter",
@@ -138,3 +245,36 @@ var (
 		},
 	)
 )
+
+// roundFloat rounds the given float value to the configured precision, all
+// the float values reported by the metrics and the APIs are rounded by it so
+// that the dashboards do not mismatch the API responses
+func (si *StakingIndexer) roundFloat(v float64) float64 {
+	return utils.RoundFloat(v, si.cfg.FloatPrecision)
+}
+
+// pushMetrics pushes all the metrics to the configured pushgateway, which
+// replaces the metrics pushed before under the same job. It does nothing if
+// the pushgateway is not configured. A failed push is only logged as the
+// metrics are still served by the Prometheus server
+func (si *StakingIndexer) pushMetrics() {
+	metricsCfg := si.cfg.MetricsConfig
+	if metricsCfg.PushGatewayURL == "" {
+		return
+	}
+
+	err := push.New(metricsCfg.PushGatewayURL, metricsCfg.PushJob).
+		Client(&http.Client{Timeout: metricsPushTimeout}).
+		Gatherer(prometheus.DefaultGatherer).
+		Push()
+	if err != nil {
+		si.logger.Error("failed to push the metrics to the pushgateway",
+			zap.String("url", metricsCfg.PushGatewayURL),
+			zap.Error(err))
+		return
+	}
+
+	si.logger.Info("pushed the metrics to the pushgateway",
+		zap.String("url", metricsCfg.PushGatewayURL),
+		zap.String("job", metricsCfg.PushJob))
+}
@@ -0,0 +1,127 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/babylonlabs-io/networks/parameters/parser"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"github.com/babylonlabs-io/staking-indexer/config"
+)
+
+// ParamsVersionInfo describes a version of the global params and the
+// range of BTC heights it applies to
+type ParamsVersionInfo struct {
+	Version uint64
+	// ActivationHeight is the first height the params apply to, which is
+	// one after the configured one if the activation height is exclusive
+	ActivationHeight uint64
+	// EndHeight is the last height the params apply to, it is 0
+	// for the latest version which applies to all the later heights
+	EndHeight        uint64
+	StakingCap       btcutil.Amount
+	CapHeight        uint64
+	MinStakingAmount btcutil.Amount
+	MaxStakingAmount btcutil.Amount
+	MinStakingTime   uint16
+	MaxStakingTime   uint16
+	Tag              []byte
+}
+
+// GetAllParamsVersions returns the info of all the versions of the global
+// params. The returned data is a copy and can be freely modified
+func (si *StakingIndexer) GetAllParamsVersions() []ParamsVersionInfo {
+	versions := si.paramsVersions.Versions
+	infos := make([]ParamsVersionInfo, 0, len(versions))
+	for i, p := range versions {
+		var endHeight uint64
+		if i+1 < len(versions) {
+			endHeight = versions[i+1].ActivationHeight - 1
+		}
+
+		tag := make([]byte, len(p.Tag))
+		copy(tag, p.Tag)
+
+		infos = append(infos, ParamsVersionInfo{
+			Version:          p.Version,
+			ActivationHeight: p.ActivationHeight,
+			EndHeight:        endHeight,
+			StakingCap:       p.StakingCap,
+			CapHeight:        p.CapHeight,
+			MinStakingAmount: p.MinStakingAmount,
+			MaxStakingAmount: p.MaxStakingAmount,
+			MinStakingTime:   p.MinStakingTime,
+			MaxStakingTime:   p.MaxStakingTime,
+			Tag:              tag,
+		})
+	}
+
+	return infos
+}
+
+// GetParamsVersionForTx returns the index of the params version governing
+// the stored staking tx of the given hash, derived from its inclusion height.
+// It returns ErrStakingTxNotFound if the staking tx is not stored
+func (si *StakingIndexer) GetParamsVersionForTx(txHash *chainhash.Hash) (int, error) {
+	stakingTx, err := si.is.GetStakingTransaction(txHash)
+	if err != nil {
+		return -1, err
+	}
+	if stakingTx == nil {
+		return -1, fmt.Errorf("%w: %s", ErrStakingTxNotFound, txHash)
+	}
+
+	// the versions are sorted by the activation height
+	versions := si.paramsVersions.Versions
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].ActivationHeight <= stakingTx.InclusionHeight {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("the params for height %d does not exist", stakingTx.InclusionHeight)
+}
+
+// covenantQuorum returns the covenant quorum of the given params used to
+// parse and validate the txs, unless it is overridden for development
+func (si *StakingIndexer) covenantQuorum(params *parser.ParsedVersionedGlobalParams) uint32 {
+	if si.cfg.DevModeEnabled && si.cfg.DevCovenantQuorum != 0 {
+		return si.cfg.DevCovenantQuorum
+	}
+
+	return params.CovenantQuorum
+}
+
+// shiftActivationHeights returns a copy of the given params versions of
+// which the activation heights are one block later, so that every version
+// applies from the height after its configured activation height
+func shiftActivationHeights(paramsVersions *parser.ParsedGlobalParams) *parser.ParsedGlobalParams {
+	shifted := &parser.ParsedGlobalParams{
+		Versions: make([]*parser.ParsedVersionedGlobalParams, 0, len(paramsVersions.Versions)),
+	}
+	for _, p := range paramsVersions.Versions {
+		shiftedParams := *p
+		shiftedParams.ActivationHeight++
+		shifted.Versions = append(shifted.Versions, &shiftedParams)
+	}
+
+	return shifted
+}
+
+// validateCovenantQuorumOverride checks the covenant quorum override
+// can be satisfied by the covenants of all the params versions
+func validateCovenantQuorumOverride(cfg *config.Config, paramsVersions *parser.ParsedGlobalParams) error {
+	if !cfg.DevModeEnabled || cfg.DevCovenantQuorum == 0 {
+		return nil
+	}
+
+	for _, p := range paramsVersions.Versions {
+		if int(cfg.DevCovenantQuorum) > len(p.CovenantPks) {
+			return fmt.Errorf("the covenant quorum override %d is larger than the number of covenants %d of params version %d",
+				cfg.DevCovenantQuorum, len(p.CovenantPks), p.Version)
+		}
+	}
+
+	return nil
+}
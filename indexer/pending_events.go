@@ -0,0 +1,119 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/babylonlabs-io/staking-indexer/consumer"
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+)
+
+// emitEvent pushes the event of the tx included at the given height if the
+// required confirmations are not higher than the confirmation depth of the
+// global parameters. Otherwise, the event is saved in the store until the
+// tip reaches the required depth, so that it survives restarts. The emit
+// height is fixed once the event is saved, so changing the configured
+// confirmations only affects the events of the txs processed afterwards
+func (si *StakingIndexer) emitEvent(height uint64, confirmations uint32, ev *consumer.BlockEvent) error {
+	params, err := si.getVersionedParams(height)
+	if err != nil {
+		return err
+	}
+
+	if confirmations <= uint32(params.ConfirmationDepth) {
+		return si.pushEvent(ev)
+	}
+
+	marshalled, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the pending event: %w", err)
+	}
+
+	if err := si.is.AddPendingEvent(&indexerstore.StoredPendingEvent{
+		Height:     height,
+		Seq:        si.pendingEventSeq,
+		EmitHeight: height + uint64(confirmations) - 1,
+		Event:      marshalled,
+	}); err != nil {
+		return fmt.Errorf("failed to save the pending event: %w", err)
+	}
+	si.pendingEventSeq++
+
+	// record metrics
+	pendingEventsGauge.Inc()
+
+	return nil
+}
+
+// emitPendingEvents pushes the saved events that have reached the required
+// confirmations given the tip height, and deletes them once pushed. The
+// events are pushed in the order they are saved
+func (si *StakingIndexer) emitPendingEvents(tipHeight uint64) error {
+	pendingEvents, err := si.is.GetPendingEvents()
+	if err != nil {
+		return fmt.Errorf("failed to get the pending events: %w", err)
+	}
+
+	emitted := 0
+	for _, e := range pendingEvents {
+		if e.EmitHeight > tipHeight {
+			continue
+		}
+
+		var ev consumer.BlockEvent
+		if err := json.Unmarshal(e.Event, &ev); err != nil {
+			return fmt.Errorf("failed to unmarshal the pending event at height %d: %w", e.Height, err)
+		}
+
+		if err := si.pushWithTimeout("pending event", func() error {
+			return consumer.PushEvent(si.consumer, &ev)
+		}); err != nil {
+			// the events that are not pushed yet are kept
+			pendingEventsGauge.Set(float64(len(pendingEvents) - emitted))
+			return fmt.Errorf("failed to push the pending event: %w", err)
+		}
+
+		if err := si.is.DeletePendingEvent(e.Height, e.Seq); err != nil {
+			return fmt.Errorf("failed to delete the pending event: %w", err)
+		}
+		emitted++
+	}
+
+	if emitted != 0 {
+		si.logger.Info("emitted pending events",
+			zap.Uint64("tip_height", tipHeight),
+			zap.Int("emitted", emitted),
+			zap.Int("remaining", len(pendingEvents)-emitted))
+	}
+
+	// record metrics
+	pendingEventsGauge.Set(float64(len(pendingEvents) - emitted))
+
+	return nil
+}
+
+// pushEvent adds the event to the events of the confirmed block being
+// handled if they are pushed in batch, starts pushing the event if the
+// events are pushed concurrently, which is waited for before the block is
+// saved as processed, otherwise the event is pushed
+func (si *StakingIndexer) pushEvent(ev *consumer.BlockEvent) error {
+	if si.blockEvents != nil {
+		si.blockEvents.Events = append(si.blockEvents.Events, ev)
+		return nil
+	}
+
+	push := func() error {
+		return si.pushWithTimeout("event", func() error {
+			return consumer.PushEvent(si.consumer, ev)
+		})
+	}
+
+	if si.inFlightPushes != nil {
+		si.inFlightPushes.Go(push)
+		return nil
+	}
+
+	return push()
+}
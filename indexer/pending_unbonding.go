@@ -0,0 +1,55 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/babylonlabs-io/networks/parameters/parser"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"go.uber.org/zap"
+)
+
+// unbondingApplyHeight returns the lowest tip height at which an unbonding
+// tx included at the given height has the configured number of unbonding
+// confirmations. It returns 0 if the configured number is not higher than
+// the confirmation depth of the global parameters, in which case the
+// unbonding tx is applied once its block is confirmed
+func (si *StakingIndexer) unbondingApplyHeight(height uint64) (uint64, error) {
+	params, err := si.getVersionedParams(height)
+	if err != nil {
+		return 0, err
+	}
+
+	if si.cfg.UnbondingConfirmations <= uint32(params.ConfirmationDepth) {
+		return 0, nil
+	}
+
+	return height + uint64(si.cfg.UnbondingConfirmations) - 1, nil
+}
+
+// applyPendingUnbondings applies the pending unbonding txs that have the
+// configured number of confirmations once the block at the given height is
+// confirmed. The tip is derived from the height of the confirmed block rather
+// than taken from the BTC scanner, so that the TVL and the eligibility of the
+// staking txs in the block do not depend on when the block is processed
+func (si *StakingIndexer) applyPendingUnbondings(height uint64, params *parser.ParsedVersionedGlobalParams) error {
+	tipHeight := height + uint64(params.ConfirmationDepth) - 1
+	stakingTxHashes, err := si.is.ApplyPendingUnbondingTransactions(tipHeight)
+	if err != nil {
+		return fmt.Errorf("failed to apply the pending unbonding txs: %w", err)
+	}
+
+	for _, stakingTxHash := range stakingTxHashes {
+		si.logger.Info("applied the pending unbonding of the staking tx",
+			zap.String("staking_tx_hash", stakingTxHash.String()),
+			zap.Uint64("tip_height", tipHeight))
+	}
+
+	return nil
+}
+
+// IsUnbondingPending returns whether the staking tx of the given hash is
+// unbonded by a confirmed unbonding tx that is held pending as it does not
+// have the configured number of unbonding confirmations yet
+func (si *StakingIndexer) IsUnbondingPending(stakingTxHash *chainhash.Hash) (bool, error) {
+	return si.is.IsUnbondingPending(stakingTxHash)
+}
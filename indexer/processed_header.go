@@ -0,0 +1,83 @@
+package indexer
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+	"github.com/babylonlabs-io/staking-indexer/types"
+)
+
+// checkBlockLinkage returns an error if the given confirmed block does not
+// extend the processed blocks, i.e., a different block at the same height
+// has been processed, or its previous block hash does not match the header
+// processed at the previous height, which indicates a reorg of the blocks
+// that are considered confirmed. The check is skipped if the headers have
+// not been stored, e.g., for the blocks processed before the headers were
+// stored
+func (si *StakingIndexer) checkBlockLinkage(b *types.IndexedBlock) error {
+	height := uint64(b.Height)
+	blockHash := b.BlockHash()
+
+	processed, err := si.is.GetProcessedHeader(height)
+	if err != nil {
+		return fmt.Errorf("failed to get the processed header at height %d: %w", height, err)
+	}
+	if processed != nil && !processed.Hash.IsEqual(&blockHash) {
+		return si.reorgDetected(b, fmt.Errorf("%w: the block %s at height %d replaces the processed block %s",
+			ErrReorgDetected, blockHash.String(), height, processed.Hash.String()))
+	}
+
+	if height == 0 {
+		return nil
+	}
+
+	parent, err := si.is.GetProcessedHeader(height - 1)
+	if err != nil {
+		return fmt.Errorf("failed to get the processed header at height %d: %w", height-1, err)
+	}
+	if parent != nil && !parent.Hash.IsEqual(&b.Header.PrevBlock) {
+		return si.reorgDetected(b, fmt.Errorf("%w: the previous block %s of the block at height %d does not match the processed block %s",
+			ErrReorgDetected, b.Header.PrevBlock.String(), height, parent.Hash.String()))
+	}
+
+	return nil
+}
+
+func (si *StakingIndexer) reorgDetected(b *types.IndexedBlock, err error) error {
+	si.logger.Error("detected a reorg of the confirmed blocks",
+		zap.Int32("height", b.Height),
+		zap.Error(err))
+
+	// record metrics
+	detectedReorgsCounter.Inc()
+
+	return err
+}
+
+// saveProcessedHeader saves the header of the given processed block, which
+// the following blocks are checked against
+func (si *StakingIndexer) saveProcessedHeader(b *types.IndexedBlock) error {
+	return si.is.AddProcessedHeader(&indexerstore.StoredProcessedHeader{
+		Hash:      b.BlockHash(),
+		PrevHash:  b.Header.PrevBlock,
+		Height:    uint64(b.Height),
+		Timestamp: b.Header.Timestamp,
+	})
+}
+
+// GetProcessedHeader returns the header of the confirmed block processed at
+// the given height, it returns nil if the height is not processed or it is
+// processed before the headers are stored
+func (si *StakingIndexer) GetProcessedHeader(height uint64) (*indexerstore.StoredProcessedHeader, error) {
+	return si.is.GetProcessedHeader(height)
+}
+
+// GetIndexedBlock returns the full data of the confirmed block processed at
+// the given height, e.g., for replay and audit. It returns nil if the block
+// is not stored, which is always the case if storing the block data is not
+// enabled
+func (si *StakingIndexer) GetIndexedBlock(height uint64) (*types.IndexedBlock, error) {
+	return si.is.GetIndexedBlock(height)
+}
@@ -0,0 +1,32 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+)
+
+// recordProcessingError records the error of processing the given invalid
+// tx included at the given height, if the processing error log is enabled
+func (si *StakingIndexer) recordProcessingError(tx *wire.MsgTx, height uint64, processErr error) error {
+	if si.cfg.ProcessingErrorLogSize == 0 {
+		return nil
+	}
+
+	txHash := tx.TxHash()
+	if err := si.is.AddProcessingError(
+		&txHash, height, processErr.Error(), si.cfg.ProcessingErrorLogSize,
+	); err != nil {
+		return fmt.Errorf("failed to add the processing error to store: %w", err)
+	}
+
+	return nil
+}
+
+// GetRecentProcessingErrors returns at most n of the most recent errors of
+// processing invalid txs, ordered from the most recent one
+func (si *StakingIndexer) GetRecentProcessingErrors(n int) ([]*indexerstore.StoredProcessingError, error) {
+	return si.is.GetRecentProcessingErrors(n)
+}
@@ -0,0 +1,132 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+)
+
+// DiagnosticLogSizes is the number of the entries in the diagnostic logs
+type DiagnosticLogSizes struct {
+	DeadLetters      int
+	ProcessingErrors int
+}
+
+// pruningEnabled returns whether any retention of the diagnostic logs
+// is configured
+func (si *StakingIndexer) pruningEnabled() bool {
+	return si.cfg.DeadLetterMaxEntries != 0 || si.cfg.DiagnosticLogRetention != 0
+}
+
+// PruneDiagnosticLogs removes the dead letters and processing errors that
+// are beyond the configured retention
+func (si *StakingIndexer) PruneDiagnosticLogs() error {
+	minHeight, err := si.minRetainedHeight()
+	if err != nil {
+		return err
+	}
+
+	prunedDeadLetters, err := si.is.PruneDeadLetters(minHeight, si.cfg.DeadLetterMaxEntries)
+	if err != nil {
+		return fmt.Errorf("failed to prune dead letters: %w", err)
+	}
+
+	prunedProcessingErrors, err := si.is.PruneProcessingErrors(minHeight)
+	if err != nil {
+		return fmt.Errorf("failed to prune processing errors: %w", err)
+	}
+
+	sizes, err := si.GetDiagnosticLogSizes()
+	if err != nil {
+		return err
+	}
+
+	if prunedDeadLetters != 0 || prunedProcessingErrors != 0 {
+		si.logger.Info("pruned the diagnostic logs",
+			zap.Uint64("min_height", minHeight),
+			zap.Int("pruned_dead_letters", prunedDeadLetters),
+			zap.Int("pruned_processing_errors", prunedProcessingErrors),
+			zap.Int("dead_letters", sizes.DeadLetters),
+			zap.Int("processing_errors", sizes.ProcessingErrors))
+	}
+
+	return nil
+}
+
+// minRetainedHeight returns the lowest height of which the diagnostic logs
+// are kept by the configured retention, which is 0 if there is no retention
+// or no block has been processed
+func (si *StakingIndexer) minRetainedHeight() (uint64, error) {
+	if si.cfg.DiagnosticLogRetention == 0 {
+		return 0, nil
+	}
+
+	lastProcessedHeight, err := si.is.GetLastProcessedHeight()
+	if err != nil {
+		if errors.Is(err, indexerstore.ErrLastProcessedHeightNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get the last processed height: %w", err)
+	}
+
+	if lastProcessedHeight < si.cfg.DiagnosticLogRetention {
+		return 0, nil
+	}
+
+	return lastProcessedHeight - si.cfg.DiagnosticLogRetention, nil
+}
+
+// GetDiagnosticLogSizes returns the current number of the dead letters and
+// processing errors in the store
+func (si *StakingIndexer) GetDiagnosticLogSizes() (*DiagnosticLogSizes, error) {
+	deadLetters, err := si.is.GetDeadLetterCount()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count dead letters: %w", err)
+	}
+
+	processingErrors, err := si.is.GetProcessingErrorCount()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count processing errors: %w", err)
+	}
+
+	// record metrics
+	deadLettersGauge.Set(float64(deadLetters))
+	processingErrorsGauge.Set(float64(processingErrors))
+
+	return &DiagnosticLogSizes{
+		DeadLetters:      deadLetters,
+		ProcessingErrors: processingErrors,
+	}, nil
+}
+
+// pruneLoop prunes the diagnostic logs periodically until the context is
+// cancelled or the indexer is stopped
+func (si *StakingIndexer) pruneLoop(ctx context.Context) {
+	defer si.wg.Done()
+
+	ticker := time.NewTicker(si.cfg.PruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := si.PruneDiagnosticLogs(); err != nil {
+				si.logger.Error("failed to prune the diagnostic logs",
+					zap.Error(err))
+			}
+
+		case <-ctx.Done():
+			si.logger.Info("closing the pruning loop as the context is cancelled")
+			return
+
+		case <-si.quit:
+			si.logger.Info("closing the pruning loop")
+			return
+		}
+	}
+}
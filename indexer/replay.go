@@ -0,0 +1,199 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/babylonlabs-io/staking-indexer/consumer"
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+	"github.com/babylonlabs-io/staking-indexer/types"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+// ReplayEventsTo pushes the staking, unbonding, and withdraw events of the
+// processed blocks at the heights within the given inclusive range to the
+// given consumer only, e.g., to re-sync a single downstream without
+// disturbing the configured consumer. The blocks are not fed through
+// btcscanner.ReplayScanner as the indexer only processes the blocks above
+// the last processed height, and processing them changes the store and
+// pushes to the configured consumer. Instead, the events are rebuilt from
+// the store without changing it and pushed block by block, in a single push
+// per block if the consumer implements consumer.BlockEventsConsumer. Within
+// a block, the events are ordered by the txs of the block as when it is
+// processed if the block data is stored, see BlockDataEnabled. Otherwise
+// the staking events are pushed first, then the unbonding events and the
+// withdraw events, each sorted by the tx hash, which differs from the order
+// of the processed events. Note that the staking events carry the current
+// eligibility of the staking txs, which differs from the one originally
+// pushed if it has been overridden since
+func (si *StakingIndexer) ReplayEventsTo(c consumer.EventConsumer, fromHeight, toHeight uint64) error {
+	if fromHeight > toHeight {
+		return fmt.Errorf("the replay start height %d is higher than the end height %d", fromHeight, toHeight)
+	}
+
+	lastProcessedHeight, err := si.is.GetLastProcessedHeight()
+	if err != nil && !errors.Is(err, indexerstore.ErrLastProcessedHeightNotFound) {
+		return fmt.Errorf("failed to get the last processed height: %w", err)
+	}
+	if err != nil || toHeight > lastProcessedHeight {
+		return fmt.Errorf("the replay end height %d is not processed yet", toHeight)
+	}
+
+	blocks, err := si.is.GetBlockTxHashesBetween(fromHeight, toHeight)
+	if err != nil {
+		return fmt.Errorf("failed to get the txs of the blocks between %d and %d: %w", fromHeight, toHeight, err)
+	}
+
+	for _, b := range blocks {
+		blockEvents, err := si.rebuildBlockEvents(b)
+		if err != nil {
+			return fmt.Errorf("failed to rebuild the events of the block at height %d: %w", b.Height, err)
+		}
+
+		if err := consumer.PushBlockEvents(c, blockEvents); err != nil {
+			return fmt.Errorf("failed to replay the events of the block at height %d: %w", b.Height, err)
+		}
+	}
+
+	return nil
+}
+
+// replayedEvent is an event rebuilt from the store along with the hash of
+// the tx emitting it, which is nil if the tx is not known
+type replayedEvent struct {
+	txHash *chainhash.Hash
+	event  *consumer.BlockEvent
+}
+
+// rebuildBlockEvents rebuilds the events of the txs stored from the block
+// of the given tx hashes as they are emitted when the block is processed,
+// which are ordered by the txs of the block if its data is stored
+func (si *StakingIndexer) rebuildBlockEvents(b *indexerstore.BlockTxHashes) (*consumer.BlockEvents, error) {
+	block, err := si.is.GetIndexedBlock(b.Height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the block data: %w", err)
+	}
+
+	var events []*replayedEvent
+	for _, txHash := range b.StakingTxHashes {
+		storedTx, err := si.is.GetStakingTransaction(txHash)
+		if err != nil {
+			return nil, err
+		}
+		if storedTx == nil {
+			return nil, fmt.Errorf("%w: %s", ErrStakingTxNotFound, txHash)
+		}
+
+		stakingEvent, err := si.newStakingEvent(
+			storedTx.Tx, storedTx.InclusionHeight, storedTx.InclusionTimestamp,
+			storedTx.StakerPk, storedTx.FinalityProviderPk, storedTx.StakingValue,
+			storedTx.StakingTime, storedTx.StakingOutputIdx, storedTx.IsOverflow,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &replayedEvent{txHash: txHash, event: stakingEvent})
+	}
+
+	if len(b.UnbondingTxHashes) > 0 {
+		params, err := si.getVersionedParams(b.Height)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, txHash := range b.UnbondingTxHashes {
+			storedTx, err := si.is.GetUnbondingTransaction(txHash)
+			if err != nil {
+				return nil, err
+			}
+			if storedTx == nil {
+				return nil, fmt.Errorf("the unbonding tx %s is not found", txHash)
+			}
+
+			unbondingEvent, err := si.newUnbondingEvent(
+				storedTx.Tx, storedTx.StakingTxHash, storedTx.InclusionHeight,
+				storedTx.InclusionTimestamp, params.UnbondingTime,
+			)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, &replayedEvent{txHash: txHash, event: unbondingEvent})
+		}
+	}
+
+	for _, stakingTxHash := range b.WithdrawnStakingTxHashes {
+		// the withdrawal tx is only needed to order the events by the block
+		var withdrawalTxHash *chainhash.Hash
+		if block != nil {
+			withdrawalTxHash, err = si.getWithdrawalTxHash(stakingTxHash)
+			if err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, &replayedEvent{txHash: withdrawalTxHash, event: newWithdrawEvent(stakingTxHash)})
+	}
+
+	if block != nil {
+		sortEventsByBlock(events, block)
+	}
+
+	blockEvents := &consumer.BlockEvents{Height: b.Height}
+	for _, e := range events {
+		blockEvents.Events = append(blockEvents.Events, e.event)
+	}
+
+	return blockEvents, nil
+}
+
+// sortEventsByBlock sorts the given events in the order the txs of the given
+// block are processed, the events of the same tx and the ones of the txs not
+// known keep their order, where the latter are placed last
+func sortEventsByBlock(events []*replayedEvent, block *types.IndexedBlock) {
+	txs := utils.SortTxsByDependency(block.Txs)
+	txIndexes := make(map[chainhash.Hash]int, len(txs))
+	for i, tx := range txs {
+		txIndexes[*tx.Hash()] = i
+	}
+
+	txIndex := func(e *replayedEvent) int {
+		if e.txHash == nil {
+			return len(txs)
+		}
+		if i, ok := txIndexes[*e.txHash]; ok {
+			return i
+		}
+		return len(txs)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return txIndex(events[i]) < txIndex(events[j])
+	})
+}
+
+// getWithdrawalTxHash returns the hash of the withdrawal tx of the staking tx
+// of the given hash, which spends the unbonding tx if the staking tx is
+// unbonded. It returns nil if the withdrawal tx is not recorded
+func (si *StakingIndexer) getWithdrawalTxHash(stakingTxHash *chainhash.Hash) (*chainhash.Hash, error) {
+	unbondingTx, err := si.is.GetUnbondingTransactionByStakingTxHash(stakingTxHash)
+	if err != nil {
+		return nil, err
+	}
+	if unbondingTx != nil {
+		unbondingTxHash := unbondingTx.Tx.TxHash()
+		return si.is.GetSpendingTx(wire.NewOutPoint(&unbondingTxHash, 0))
+	}
+
+	stakingTx, err := si.is.GetStakingTransaction(stakingTxHash)
+	if err != nil {
+		return nil, err
+	}
+	if stakingTx == nil {
+		return nil, nil
+	}
+
+	return si.is.GetSpendingTx(wire.NewOutPoint(stakingTxHash, stakingTx.StakingOutputIdx))
+}
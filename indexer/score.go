@@ -0,0 +1,23 @@
+package indexer
+
+// ScoreFunc computes the score of a staking tx from its staking value and
+// staking time, e.g., to weight the stake by its duration for rewards
+type ScoreFunc func(stakingValue uint64, stakingTime uint32) uint64
+
+// DefaultScoreFunc scores a staking tx by its staking value, so that the
+// total score equals the confirmed TVL
+func DefaultScoreFunc(stakingValue uint64, _ uint32) uint64 {
+	return stakingValue
+}
+
+// SetScoreFunc sets the function computing the score of the new staking
+// txs. The score of a staking tx is persisted when it is stored, so it
+// should be called before the indexer is started
+func (si *StakingIndexer) SetScoreFunc(scoreFunc ScoreFunc) {
+	si.scoreFunc = scoreFunc
+}
+
+// GetTotalScore returns the total score of the active staking txs
+func (si *StakingIndexer) GetTotalScore() (uint64, error) {
+	return si.is.GetTotalScore()
+}
@@ -0,0 +1,135 @@
+package indexer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/babylonlabs-io/networks/parameters/parser"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/kvdb"
+	"go.uber.org/zap"
+
+	"github.com/babylonlabs-io/staking-indexer/config"
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+)
+
+// the names of the checks of the self-test in the order they run
+const (
+	SelfTestCheckParams      = "params"
+	SelfTestCheckParse       = "parse"
+	SelfTestCheckValidate    = "validate"
+	SelfTestCheckEligibility = "eligibility"
+)
+
+// SelfTestCheck is the result of a check of the self-test
+type SelfTestCheck struct {
+	Name   string
+	Passed bool
+	// Detail is the reason why the check failed or the
+	// information found by the check if it passed
+	Detail string
+}
+
+// NewSelfTestStakingIndexer returns a staking indexer backed by db for
+// running the self-test only, which cannot be started. Unlike
+// NewStakingIndexer, the store is opened without migrating it or changing
+// its index key hash, so it fails with indexerstore.ErrOutdatedDbVersion
+// unless the db is migrated by the staking indexer of the same version
+func NewSelfTestStakingIndexer(
+	cfg *config.Config,
+	logger *zap.Logger,
+	db kvdb.Backend,
+	paramsVersions *parser.ParsedGlobalParams,
+) (*StakingIndexer, error) {
+	if err := validateCovenantQuorumOverride(cfg, paramsVersions); err != nil {
+		return nil, err
+	}
+
+	is, err := indexerstore.OpenIndexerStore(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open staking indexer store: %w", err)
+	}
+	is.SetDbTxRetry(cfg.DatabaseConfig.TxMaxRetries, cfg.DatabaseConfig.TxRetryBackoff)
+
+	return newStakingIndexer(cfg, logger, nil, is, paramsVersions, nil), nil
+}
+
+// SelfTestStakingTx runs the checks the given tx would go through as a
+// staking tx confirmed at the given height, i.e., whether there are params
+// for the height and whether the tx parses, validates against the params,
+// and would be eligible, e.g., for integrators to debug their tx
+// construction. The checks stop at the first failure, and the eligibility
+// is evaluated against the current state of the store without changing it
+func (si *StakingIndexer) SelfTestStakingTx(tx *wire.MsgTx, height uint64) []SelfTestCheck {
+	var checks []SelfTestCheck
+
+	params, err := si.getVersionedParams(height)
+	if err != nil {
+		return append(checks, SelfTestCheck{Name: SelfTestCheckParams, Detail: err.Error()})
+	}
+	checks = append(checks, SelfTestCheck{
+		Name:   SelfTestCheckParams,
+		Passed: true,
+		Detail: fmt.Sprintf("params version %d", params.Version),
+	})
+
+	stakingData, err := si.tryParseStakingTx(tx, height, params)
+	if err != nil {
+		return append(checks, SelfTestCheck{Name: SelfTestCheckParse, Detail: err.Error()})
+	}
+	checks = append(checks, SelfTestCheck{
+		Name:   SelfTestCheckParse,
+		Passed: true,
+		Detail: fmt.Sprintf("staking output index %d, value %d, staking time %d",
+			stakingData.StakingOutputIdx, stakingData.StakingOutput.Value,
+			stakingData.OpReturnData.StakingTime),
+	})
+
+	if err := si.validateStakingTx(tx, height, params, stakingData); err != nil {
+		return append(checks, SelfTestCheck{Name: SelfTestCheckValidate, Detail: err.Error()})
+	}
+	checks = append(checks, SelfTestCheck{Name: SelfTestCheckValidate, Passed: true})
+
+	// the tx is assumed to be included now if the cap is measured
+	// over a rolling window
+	isOverflow, err := si.isOverflow(height, time.Now(), uint64(stakingData.StakingOutput.Value), params)
+	if err != nil {
+		return append(checks, SelfTestCheck{Name: SelfTestCheckEligibility, Detail: err.Error()})
+	}
+	if isOverflow {
+		return append(checks, SelfTestCheck{
+			Name:   SelfTestCheckEligibility,
+			Detail: fmt.Sprintf("overflow: %s", indexerstore.InactiveReasonStakingCap),
+		})
+	}
+
+	isStakerOverflow, err := si.isStakerOverflow(
+		stakingData.OpReturnData.StakerPublicKey.PubKey,
+		uint64(stakingData.StakingOutput.Value),
+	)
+	if err != nil {
+		return append(checks, SelfTestCheck{Name: SelfTestCheckEligibility, Detail: err.Error()})
+	}
+	if isStakerOverflow {
+		return append(checks, SelfTestCheck{
+			Name:   SelfTestCheckEligibility,
+			Detail: fmt.Sprintf("overflow: %s", indexerstore.InactiveReasonPerStakerCap),
+		})
+	}
+
+	isFpOverflow, err := si.isFinalityProviderOverflow(
+		stakingData.OpReturnData.FinalityProviderPublicKey.PubKey,
+		uint64(stakingData.StakingOutput.Value),
+	)
+	if err != nil {
+		return append(checks, SelfTestCheck{Name: SelfTestCheckEligibility, Detail: err.Error()})
+	}
+	if isFpOverflow {
+		return append(checks, SelfTestCheck{
+			Name:   SelfTestCheckEligibility,
+			Detail: fmt.Sprintf("overflow: %s", indexerstore.InactiveReasonPerFinalityProviderCap),
+		})
+	}
+
+	return append(checks, SelfTestCheck{Name: SelfTestCheckEligibility, Passed: true})
+}
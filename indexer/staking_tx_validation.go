@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/babylonlabs-io/babylon/btcstaking"
+	"github.com/babylonlabs-io/networks/parameters/parser"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ValidateStakingTxAgainstParams checks whether the given tx is a valid
+// staking tx under the given params of the given BTC network, i.e., it
+// carries the tag of the params, parses against the covenant committee of
+// the params, and its staking amount and staking time are within the
+// bounds of the params, e.g., for wallets to check a tx before broadcasting
+// it without running an indexer. The checks depending on the indexer,
+// i.e., the configured max tx size, the registered validators, the tag
+// transition window, and the staking caps, are not run. It returns
+// ErrNotStakingTx, ErrUnparseableStakingTx, or ErrInvalidStakingTx if the
+// tx fails the respective check, where the unparseable error wraps
+// ErrNoMatchingStakingOutput if the tx carries a well-formed op return but
+// none of its outputs is the staking output built from the params
+func ValidateStakingTxAgainstParams(tx *wire.MsgTx, params *parser.ParsedVersionedGlobalParams, net *chaincfg.Params) error {
+	if !btcstaking.IsPossibleV0StakingTx(tx, params.Tag) {
+		return ErrNotStakingTx
+	}
+
+	stakingData, err := btcstaking.ParseV0StakingTx(
+		tx,
+		params.Tag,
+		params.CovenantPks,
+		params.CovenantQuorum,
+		net)
+	if err != nil {
+		if matchErr := checkStakingOutputMatch(tx, params.Tag, params, params.CovenantQuorum, net); matchErr != nil {
+			return fmt.Errorf("%w: %w", ErrUnparseableStakingTx, matchErr)
+		}
+
+		return fmt.Errorf("%w: %v", ErrUnparseableStakingTx, err)
+	}
+
+	return validateStakingDataAgainstParams(stakingData, params)
+}
+
+// checkStakingOutputMatch returns ErrNoMatchingStakingOutput if the given
+// tx failing parsing under the given params carries a well-formed op return
+// of the given tag and a taproot output, while none of its outputs is the
+// staking output built from the op return data and the params. The taproot
+// output may commit to another covenant committee, but also to other keys
+// or another staking time, so the mismatch is reported as the parsing
+// failure rather than attributed to the covenant committee
+func checkStakingOutputMatch(
+	tx *wire.MsgTx,
+	tag []byte,
+	params *parser.ParsedVersionedGlobalParams,
+	covenantQuorum uint32,
+	net *chaincfg.Params,
+) error {
+	var opReturnData *btcstaking.V0OpReturnData
+	for _, out := range tx.TxOut {
+		data, err := btcstaking.NewV0OpReturnDataFromTxOutput(out)
+		if err != nil {
+			continue
+		}
+		// more than one op return is malformed
+		if opReturnData != nil {
+			return nil
+		}
+		opReturnData = data
+	}
+	if opReturnData == nil || !bytes.Equal(opReturnData.Tag, tag) || opReturnData.Version != 0 {
+		return nil
+	}
+
+	stakingInfo, err := btcstaking.BuildStakingInfo(
+		opReturnData.StakerPublicKey.PubKey,
+		[]*btcec.PublicKey{opReturnData.FinalityProviderPublicKey.PubKey},
+		params.CovenantPks,
+		covenantQuorum,
+		opReturnData.StakingTime,
+		// the staking amount is not used by the pk script
+		0,
+		net,
+	)
+	if err != nil {
+		return nil
+	}
+
+	hasTaprootOutput := false
+	for _, out := range tx.TxOut {
+		// the staking output exists, so the tx fails parsing otherwise
+		if bytes.Equal(out.PkScript, stakingInfo.StakingOutput.PkScript) {
+			return nil
+		}
+		if txscript.IsPayToTaproot(out.PkScript) {
+			hasTaprootOutput = true
+		}
+	}
+	if !hasTaprootOutput {
+		return nil
+	}
+
+	return fmt.Errorf("%w of version %d", ErrNoMatchingStakingOutput, params.Version)
+}
@@ -0,0 +1,72 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+)
+
+// logStartupSummary logs a structured summary of the indexer state on
+// start, i.e., the db path and version, the numbers of the stored records,
+// the last processed height, the confirmed tip of the BTC scanner, the
+// version of the params applying to the start height, and the confirmed
+// tvl. A failure of collecting the summary is logged without failing the
+// start
+func (si *StakingIndexer) logStartupSummary(startHeight uint64) {
+	fields, err := si.startupSummaryFields(startHeight)
+	if err != nil {
+		si.logger.Warn("failed to collect the startup summary", zap.Error(err))
+		return
+	}
+
+	si.logger.Info("startup summary", fields...)
+}
+
+func (si *StakingIndexer) startupSummaryFields(startHeight uint64) ([]zap.Field, error) {
+	dbVersion, err := si.is.GetDbVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the db version: %w", err)
+	}
+
+	stakingCount, unbondingCount, withdrawalCount, err := si.is.GetRecordCounts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count the stored records: %w", err)
+	}
+
+	// the last processed height is absent for an empty db
+	var lastProcessedHeight *uint64
+	height, err := si.is.GetLastProcessedHeight()
+	if err != nil && !errors.Is(err, indexerstore.ErrLastProcessedHeightNotFound) {
+		return nil, fmt.Errorf("failed to get the last processed height: %w", err)
+	}
+	if err == nil {
+		lastProcessedHeight = &height
+	}
+
+	params, err := si.getVersionedParams(startHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmedTvl, err := si.is.GetConfirmedTvl()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the confirmed tvl: %w", err)
+	}
+
+	return []zap.Field{
+		zap.String("db_path", filepath.Join(si.cfg.DatabaseConfig.DBDir(), si.cfg.DatabaseConfig.DBFileName)),
+		zap.Uint64("db_version", dbVersion),
+		zap.Int("staking_tx_count", stakingCount),
+		zap.Int("unbonding_tx_count", unbondingCount),
+		zap.Int("withdrawal_count", withdrawalCount),
+		zap.Uint64p("last_processed_height", lastProcessedHeight),
+		zap.Uint64("start_height", startHeight),
+		zap.Uint64("scanner_tip", si.btcScanner.LastConfirmedHeight()),
+		zap.Uint64("params_version", params.Version),
+		zap.Uint64("confirmed_tvl", confirmedTvl),
+	}, nil
+}
@@ -0,0 +1,119 @@
+package indexer
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+)
+
+// TimelineEventType is the type of an event in the lifecycle of a delegation
+type TimelineEventType string
+
+const (
+	// TimelineEventStaked the staking tx is included
+	TimelineEventStaked TimelineEventType = "staked"
+	// TimelineEventUnbonded the unbonding tx spending the staking tx is included
+	TimelineEventUnbonded TimelineEventType = "unbonded"
+	// TimelineEventWithdrawn the withdrawal tx spending the staking or
+	// unbonding tx is included
+	TimelineEventWithdrawn TimelineEventType = "withdrawn"
+	// TimelineEventEligibilityChanged the eligibility of the staking tx is
+	// manually overridden
+	TimelineEventEligibilityChanged TimelineEventType = "eligibility_changed"
+)
+
+// TimelineEvent is an event in the lifecycle of a delegation. The height
+// and timestamp are those of the block including the tx of the event, they
+// are 0 if the event is recorded before they are stored. The eligibility
+// change event has no height and its timestamp is the time of the override
+type TimelineEvent struct {
+	Type      TimelineEventType
+	Height    uint64
+	Timestamp int64
+	// Eligible is whether the delegation counts towards the TVL after the
+	// event, InactiveReason is the reason if the staking tx is overflow,
+	// which is only set on the staked and the eligibility change events
+	Eligible       bool
+	InactiveReason indexerstore.InactiveReason
+}
+
+// GetDelegationTimeline returns the events of the delegation of the given
+// staking tx in the order they happen, which always starts with the staked
+// event, carrying the eligibility of the staking tx when it is included. The
+// last manual override of the eligibility, if any, is placed by its
+// timestamp. It returns nil if the staking tx is not found
+func (si *StakingIndexer) GetDelegationTimeline(stakingTxHash *chainhash.Hash) ([]TimelineEvent, error) {
+	stakingTx, err := si.is.GetStakingTransaction(stakingTxHash)
+	if err != nil {
+		return nil, err
+	}
+	if stakingTx == nil {
+		return nil, nil
+	}
+
+	isOverflow, inactiveReason := stakingTx.IsOverflow, stakingTx.InactiveReason
+	if stakingTx.EligibilityOverridden {
+		isOverflow, inactiveReason = stakingTx.OriginalIsOverflow, stakingTx.OriginalInactiveReason
+	}
+	timeline := []TimelineEvent{{
+		Type:           TimelineEventStaked,
+		Height:         stakingTx.InclusionHeight,
+		Timestamp:      stakingTx.InclusionTimestamp,
+		Eligible:       !isOverflow,
+		InactiveReason: inactiveReason,
+	}}
+
+	unbondingTx, err := si.is.GetUnbondingTransactionByStakingTxHash(stakingTxHash)
+	if err != nil {
+		return nil, err
+	}
+	if unbondingTx != nil {
+		timeline = append(timeline, TimelineEvent{
+			Type:      TimelineEventUnbonded,
+			Height:    unbondingTx.InclusionHeight,
+			Timestamp: unbondingTx.InclusionTimestamp,
+		})
+	}
+
+	// a delegation is withdrawn after it is unbonded, if ever
+	withdrawn, err := si.is.GetWithdrawnStakingTransaction(stakingTxHash)
+	if err != nil {
+		return nil, err
+	}
+	if withdrawn != nil {
+		timeline = append(timeline, TimelineEvent{
+			Type:      TimelineEventWithdrawn,
+			Height:    withdrawn.Height,
+			Timestamp: withdrawn.Timestamp,
+		})
+	}
+
+	if stakingTx.EligibilityOverridden {
+		timeline = insertEligibilityChange(timeline, stakingTx)
+	}
+
+	return timeline, nil
+}
+
+// insertEligibilityChange inserts the event of the overridden eligibility of
+// the given staking tx after the events happening before the override. The
+// overridden eligibility does not count towards the TVL once it is unbonded
+func insertEligibilityChange(timeline []TimelineEvent, stakingTx *indexerstore.StoredStakingTransaction) []TimelineEvent {
+	i := 1
+	for i < len(timeline) && timeline[i].Timestamp <= stakingTx.EligibilityOverriddenTimestamp {
+		i++
+	}
+
+	event := TimelineEvent{
+		Type:           TimelineEventEligibilityChanged,
+		Timestamp:      stakingTx.EligibilityOverriddenTimestamp,
+		Eligible:       !stakingTx.IsOverflow && i == 1,
+		InactiveReason: stakingTx.InactiveReason,
+	}
+
+	timeline = append(timeline, TimelineEvent{})
+	copy(timeline[i+1:], timeline[i:])
+	timeline[i] = event
+
+	return timeline
+}
@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/babylonlabs-io/babylon/btcstaking"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+)
+
+// Validator is an additional validation of the staking txs, e.g.,
+// compliance screening of the staker keys, which can audit the unbonding
+// txs as well. A staking tx is rejected if any registered validator returns
+// an error for it
+type Validator interface {
+	// ValidateStakingTx validates a new staking tx at the given height,
+	// which has passed the built-in checks against the global params. It
+	// might be run more than once for the same tx, e.g., while the tx is
+	// in the unconfirmed blocks, so it should be deterministic
+	ValidateStakingTx(tx *wire.MsgTx, stakingData *btcstaking.ParsedV0StakingTx, height uint64) error
+
+	// AuditUnbondingTx audits a new unbonding tx of the given staking tx
+	// at the given height, which has passed the built-in checks. It cannot
+	// reject the tx, as a confirmed unbonding tx spends the staking tx on
+	// BTC anyway, so an error only flags the tx as a processing error
+	AuditUnbondingTx(tx *wire.MsgTx, stakingTx *indexerstore.StoredStakingTransaction, height uint64) error
+}
+
+// AddValidator appends the given validator to the chain of validators run
+// after the built-in checks, in the order they are added. The rejected
+// staking txs are not stored, while the flagged unbonding txs are applied
+// and recorded as processing errors. The validators are not synchronized with
+// the processing of the blocks, so an error is returned once the indexer
+// is started
+func (si *StakingIndexer) AddValidator(v Validator) error {
+	if si.isStarted.Load() {
+		return fmt.Errorf("cannot add a validator after the staking indexer is started")
+	}
+
+	si.validators = append(si.validators, v)
+
+	return nil
+}
+
+// runStakingTxValidators runs the chain of validators on the given staking
+// tx, the error of the first validator rejecting it is returned
+func (si *StakingIndexer) runStakingTxValidators(
+	tx *wire.MsgTx,
+	stakingData *btcstaking.ParsedV0StakingTx,
+	height uint64,
+) error {
+	for _, v := range si.validators {
+		if err := v.ValidateStakingTx(tx, stakingData, height); err != nil {
+			return fmt.Errorf("%w: rejected by a validator: %w", ErrInvalidStakingTx, err)
+		}
+	}
+
+	return nil
+}
+
+// runUnbondingTxAudits runs the chain of validators on the given unbonding
+// tx, the error of the first validator flagging it is returned
+func (si *StakingIndexer) runUnbondingTxAudits(
+	tx *wire.MsgTx,
+	stakingTx *indexerstore.StoredStakingTransaction,
+	height uint64,
+) error {
+	for _, v := range si.validators {
+		if err := v.AuditUnbondingTx(tx, stakingTx, height); err != nil {
+			return fmt.Errorf("%w: %w", ErrUnbondingTxFlagged, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package indexerstore
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/kvdb"
+
+	"github.com/babylonlabs-io/staking-indexer/types"
+)
+
+var (
+	// mapping height -> the processed block at the height serialized in
+	// the BTC wire format including the witness data
+	blockDataBucketName = []byte("blockdata")
+)
+
+// AddIndexedBlock saves the full data of the given processed block, i.e.,
+// the header and the txs, the block saved before at the same height is
+// replaced
+func (is *IndexerStore) AddIndexedBlock(b *types.IndexedBlock) error {
+	var buf bytes.Buffer
+	if err := b.MsgBlock().Serialize(&buf); err != nil {
+		return fmt.Errorf("failed to serialize the block at height %d: %w", b.Height, err)
+	}
+
+	return is.batch(func(tx kvdb.RwTx) error {
+		blockBucket := tx.ReadWriteBucket(blockDataBucketName)
+		if blockBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		return blockBucket.Put(uint64ToBytes(uint64(b.Height)), buf.Bytes())
+	})
+}
+
+// GetIndexedBlock returns the full data of the processed block at the given
+// height, it returns nil if the block is not saved
+func (is *IndexerStore) GetIndexedBlock(height uint64) (*types.IndexedBlock, error) {
+	var block *types.IndexedBlock
+	err := is.view(func(tx kvdb.RTx) error {
+		blockBucket := tx.ReadBucket(blockDataBucketName)
+		if blockBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		v := blockBucket.Get(uint64ToBytes(height))
+		if v == nil {
+			return nil
+		}
+
+		var msgBlock wire.MsgBlock
+		if err := msgBlock.Deserialize(bytes.NewReader(v)); err != nil {
+			return ErrCorruptedStateDb
+		}
+
+		block = types.NewIndexedBlockFromMsgBlock(int32(height), &msgBlock)
+
+		return nil
+	}, func() {
+		block = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
@@ -0,0 +1,80 @@
+package indexerstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lightningnetwork/lnd/kvdb"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// compactTxMaxSize is the maximum size of the data copied in a single
+	// db transaction of the compaction
+	compactTxMaxSize = 64 * 1024 * 1024
+
+	compactedDbFileSuffix = ".compacted"
+)
+
+// Compact rewrites the bolt db file in the given directory into a fresh
+// file holding only the live records, and replaces the original file with
+// it to reclaim the space of the deleted records, as bolt db files never
+// shrink. It returns the sizes of the db file before and after the
+// compaction. The db must not be opened by others, e.g., a running indexer,
+// during the compaction
+func Compact(dbDir, dbFileName string) (int64, int64, error) {
+	dbPath := filepath.Join(dbDir, dbFileName)
+	compactedPath := dbPath + compactedDbFileSuffix
+
+	srcInfo, err := os.Stat(dbPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat the db file %s: %w", dbPath, err)
+	}
+
+	// the left over of a previous failed compaction is discarded
+	if err := os.Remove(compactedPath); err != nil && !os.IsNotExist(err) {
+		return 0, 0, fmt.Errorf("failed to remove the compacted db file %s: %w", compactedPath, err)
+	}
+
+	// the file lock of the db fails the compaction if the db is in use
+	src, err := bbolt.Open(dbPath, 0600, &bbolt.Options{
+		ReadOnly: true,
+		Timeout:  kvdb.DefaultDBTimeout,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open the db file %s: %w", dbPath, err)
+	}
+	defer src.Close()
+
+	dst, err := bbolt.Open(compactedPath, srcInfo.Mode(), &bbolt.Options{
+		Timeout: kvdb.DefaultDBTimeout,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create the compacted db file %s: %w", compactedPath, err)
+	}
+
+	if err := bbolt.Compact(dst, src, compactTxMaxSize); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(compactedPath)
+		return 0, 0, fmt.Errorf("failed to compact the db file %s: %w", dbPath, err)
+	}
+
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(compactedPath)
+		return 0, 0, fmt.Errorf("failed to close the compacted db file %s: %w", compactedPath, err)
+	}
+
+	dstInfo, err := os.Stat(compactedPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat the compacted db file %s: %w", compactedPath, err)
+	}
+
+	// the original file is only replaced once the compacted
+	// file is complete so that it is never left corrupted
+	if err := os.Rename(compactedPath, dbPath); err != nil {
+		return 0, 0, fmt.Errorf("failed to replace the db file %s: %w", dbPath, err)
+	}
+
+	return srcInfo.Size(), dstInfo.Size(), nil
+}
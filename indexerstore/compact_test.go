@@ -0,0 +1,87 @@
+package indexerstore_test
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bbndatagen "github.com/babylonlabs-io/babylon/testutil/datagen"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonlabs-io/staking-indexer/config"
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+	"github.com/babylonlabs-io/staking-indexer/testutils/datagen"
+)
+
+func TestCompact(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	cfg := config.DefaultDBConfig()
+	cfg.DBPath = t.TempDir()
+
+	db, err := cfg.GetDbBackend()
+	require.NoError(t, err)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// fill the db with many dead letters of which most are deleted later
+	numDeadLetters := 200
+	numKept := 10
+	expected := make(map[string]*indexerstore.StoredDeadLetter)
+	for i := 0; i < numDeadLetters; i++ {
+		deadLetter := &indexerstore.StoredDeadLetter{
+			Tx:     datagen.GenRandomTx(r),
+			Height: uint64(i + 1),
+			Error:  bbndatagen.GenRandomHexStr(r, 2000),
+		}
+		err := s.AddDeadLetter(deadLetter.Tx, deadLetter.Height, deadLetter.Error)
+		require.NoError(t, err)
+		if i >= numDeadLetters-numKept {
+			expected[deadLetter.Tx.TxHash().String()] = deadLetter
+		}
+	}
+	err = s.SaveLastProcessedHeight(uint64(numDeadLetters))
+	require.NoError(t, err)
+
+	pruned, err := s.PruneDeadLetters(uint64(numDeadLetters-numKept+1), 0)
+	require.NoError(t, err)
+	require.Equal(t, numDeadLetters-numKept, pruned)
+	require.NoError(t, db.Close())
+
+	dbFile := filepath.Join(cfg.DBDir(), cfg.DBFileName)
+	infoBefore, err := os.Stat(dbFile)
+	require.NoError(t, err)
+
+	sizeBefore, sizeAfter, err := indexerstore.Compact(cfg.DBDir(), cfg.DBFileName)
+	require.NoError(t, err)
+	require.Equal(t, infoBefore.Size(), sizeBefore)
+	require.Less(t, sizeAfter, sizeBefore)
+
+	infoAfter, err := os.Stat(dbFile)
+	require.NoError(t, err)
+	require.Equal(t, sizeAfter, infoAfter.Size())
+
+	// the records are intact after the compaction
+	db, err = cfg.GetDbBackend()
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+	s, err = indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	deadLetters, err := s.GetDeadLetters()
+	require.NoError(t, err)
+	require.Len(t, deadLetters, numKept)
+	for _, deadLetter := range deadLetters {
+		expectedDeadLetter, ok := expected[deadLetter.Tx.TxHash().String()]
+		require.True(t, ok)
+		require.Equal(t, expectedDeadLetter, deadLetter)
+	}
+
+	lastProcessedHeight, err := s.GetLastProcessedHeight()
+	require.NoError(t, err)
+	require.Equal(t, uint64(numDeadLetters), lastProcessedHeight)
+}
@@ -0,0 +1,167 @@
+package indexerstore
+
+import (
+	"fmt"
+
+	"github.com/lightningnetwork/lnd/kvdb"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+// RecomputeCounters re-derives the persisted counters, i.e., the confirmed
+// tvl, the total score, the active stakes of the stakers and the finality
+// providers, and the total withdrawn value, from the stored staking txs and
+// withdrawals, and replaces the stored values with them in a single db
+// transaction. It is a maintenance operation to repair the counters that
+// drifted, e.g., due to a bug, and it should not be run while the indexer
+// is processing blocks
+func (is *IndexerStore) RecomputeCounters() error {
+	return is.batch(func(tx kvdb.RwTx) error {
+		stakingTxBucket := tx.ReadBucket(stakingTxBucketName)
+		if stakingTxBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		unbondingIndexBucket := tx.ReadBucket(stakingUnbondingIndexBucketName)
+		if unbondingIndexBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		withdrawnBucket := tx.ReadBucket(withdrawnStakingTxBucketName)
+		if withdrawnBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		// the unbonding txs held pending are not applied yet
+		pendingStakingTxs := make(map[string]struct{})
+		pendingBucket := tx.ReadBucket(pendingUnbondingBucketName)
+		if pendingBucket == nil {
+			return ErrCorruptedStateDb
+		}
+		if err := pendingBucket.ForEach(func(_, v []byte) error {
+			pendingStakingTxs[string(v)] = struct{}{}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		// a staking tx is active if it is not an overflow and it has not
+		// been unbonded, the withdrawal after the timelock expires does
+		// not change the active stakes
+		var confirmedTvl, totalScore uint64
+		stakerStakes := make(map[string]uint64)
+		fpStakes := make(map[string]uint64)
+		err := stakingTxBucket.ForEach(func(k, v []byte) error {
+			var stakingTxProto proto.StakingTransaction
+			if err := pm.Unmarshal(v, &stakingTxProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			if stakingTxProto.IsOverflow {
+				return nil
+			}
+			if _, pending := pendingStakingTxs[string(k)]; !pending && unbondingIndexBucket.Get(k) != nil {
+				return nil
+			}
+
+			var err error
+			confirmedTvl, err = utils.AddUint64(confirmedTvl, stakingTxProto.StakingValue)
+			if err != nil {
+				return fmt.Errorf("failed to recompute the confirmed tvl: %w", err)
+			}
+
+			totalScore, err = utils.AddUint64(totalScore, stakingTxProto.Score)
+			if err != nil {
+				return fmt.Errorf("failed to recompute the total score: %w", err)
+			}
+
+			stakerPk := string(stakingTxProto.StakerPk)
+			stakerStakes[stakerPk], err = utils.AddUint64(stakerStakes[stakerPk], stakingTxProto.StakingValue)
+			if err != nil {
+				return fmt.Errorf("failed to recompute the active stake of the staker: %w", err)
+			}
+
+			fpPk := string(stakingTxProto.FinalityProviderPk)
+			fpStakes[fpPk], err = utils.AddUint64(fpStakes[fpPk], stakingTxProto.StakingValue)
+			if err != nil {
+				return fmt.Errorf("failed to recompute the active stake of the finality provider: %w", err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		var totalWithdrawnValue uint64
+		err = withdrawnBucket.ForEach(func(_, v []byte) error {
+			var withdrawnProto proto.WithdrawnStakingTransaction
+			if err := pm.Unmarshal(v, &withdrawnProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			var err error
+			totalWithdrawnValue, err = utils.AddUint64(totalWithdrawnValue, withdrawnProto.WithdrawnValue)
+			if err != nil {
+				return fmt.Errorf("failed to recompute the total withdrawn value: %w", err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := replaceActiveStakes(tx, stakerActiveStakeBucketName, stakerStakes); err != nil {
+			return err
+		}
+
+		if err := replaceActiveStakes(tx, fpActiveStakeBucketName, fpStakes); err != nil {
+			return err
+		}
+
+		tvlBucket := tx.ReadWriteBucket(confirmedTvlBucketName)
+		if tvlBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		if err := tvlBucket.Put(getConfirmedTvlKey(), uint64ToBytes(confirmedTvl)); err != nil {
+			return err
+		}
+
+		if err := tvlBucket.Put(getTotalScoreKey(), uint64ToBytes(totalScore)); err != nil {
+			return err
+		}
+
+		stateBucket := tx.ReadWriteBucket(indexerStateBucketName)
+		if stateBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		return stateBucket.Put(getTotalWithdrawnValueKey(), uint64ToBytes(totalWithdrawnValue))
+	})
+}
+
+// replaceActiveStakes replaces all the active stakes in the given bucket
+// with the given ones, so that the stale pks not in the given stakes are
+// dropped
+func replaceActiveStakes(tx kvdb.RwTx, bucketName []byte, stakes map[string]uint64) error {
+	if err := tx.DeleteTopLevelBucket(bucketName); err != nil {
+		return err
+	}
+
+	stakeBucket, err := tx.CreateTopLevelBucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	for pk, stake := range stakes {
+		if err := stakeBucket.Put([]byte(pk), uint64ToBytes(stake)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
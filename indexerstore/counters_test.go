@@ -0,0 +1,137 @@
+package indexerstore
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	bbndatagen "github.com/babylonlabs-io/babylon/testutil/datagen"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/kvdb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+	"github.com/babylonlabs-io/staking-indexer/testutils"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+// TestRecomputeCounters tests that the drifted counters are replaced with
+// the ones re-derived from the stored txs and withdrawals
+func TestRecomputeCounters(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// the staker has an active tx, an overflow tx, an unbonded tx, a tx
+	// withdrawn after the timelock expires which is still counted as active,
+	// and a tx of which the unbonding is pending which is active as well
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	var fpPks [][]byte
+	for i := 0; i < 5; i++ {
+		txHash, stakingTx := genLegacyStakingTx(t, r, stakerPk)
+		stakingTx.Score = stakingTx.StakingValue
+		stakingTx.IsOverflow = i == 1
+		err := s.addStakingTransaction(txHash[:], stakingTx)
+		require.NoError(t, err)
+		fpPks = append(fpPks, stakingTx.FinalityProviderPk)
+
+		switch i {
+		case 2:
+			unbondingTx := bbndatagen.GenRandomTx(r)
+			unbondingTxBytes, err := utils.SerializeBtcTransaction(unbondingTx)
+			require.NoError(t, err)
+			unbondingTxHash := unbondingTx.TxHash()
+			err = s.addUnbondingTransaction(unbondingTxHash[:], txHash[:], &proto.UnbondingTransaction{
+				TransactionBytes: unbondingTxBytes,
+				StakingTxHash:    txHash[:],
+			}, 0)
+			require.NoError(t, err)
+		case 3:
+			withdrawalTxHash := bbndatagen.GenRandomBtcdHash(r)
+			spentOutpoint := wire.NewOutPoint(&txHash, stakingTx.StakingOutputIdx)
+			err := s.AddWithdrawalTransaction(&txHash, &withdrawalTxHash, spentOutpoint, stakingTx.StakingValue, stakingTx.InclusionHeight+1, 0)
+			require.NoError(t, err)
+		case 4:
+			unbondingTx := bbndatagen.GenRandomTx(r)
+			unbondingTxBytes, err := utils.SerializeBtcTransaction(unbondingTx)
+			require.NoError(t, err)
+			unbondingTxHash := unbondingTx.TxHash()
+			err = s.addUnbondingTransaction(unbondingTxHash[:], txHash[:], &proto.UnbondingTransaction{
+				TransactionBytes: unbondingTxBytes,
+				StakingTxHash:    txHash[:],
+			}, stakingTx.InclusionHeight+10)
+			require.NoError(t, err)
+		}
+	}
+
+	// the counters maintained while the txs are added
+	confirmedTvl, err := s.GetConfirmedTvl()
+	require.NoError(t, err)
+	totalScore, err := s.GetTotalScore()
+	require.NoError(t, err)
+	stakerStake, err := s.GetStakerActiveStake(stakerPk)
+	require.NoError(t, err)
+	totalWithdrawnValue, err := s.GetTotalWithdrawnValue()
+	require.NoError(t, err)
+	fpStakes := make([]uint64, len(fpPks))
+	for i, fpPkBytes := range fpPks {
+		fpPk, err := schnorr.ParsePubKey(fpPkBytes)
+		require.NoError(t, err)
+		fpStakes[i], err = s.GetFinalityProviderActiveStake(fpPk)
+		require.NoError(t, err)
+	}
+	require.NotZero(t, confirmedTvl)
+
+	// corrupt the counters, including a stale active stake of an unknown
+	// finality provider
+	_, staleFpPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	err = kvdb.Batch(db, func(tx kvdb.RwTx) error {
+		tvlBucket := tx.ReadWriteBucket(confirmedTvlBucketName)
+		if err := tvlBucket.Put(getConfirmedTvlKey(), uint64ToBytes(confirmedTvl+12345)); err != nil {
+			return err
+		}
+		if err := tvlBucket.Put(getTotalScoreKey(), uint64ToBytes(0)); err != nil {
+			return err
+		}
+		stakerBucket := tx.ReadWriteBucket(stakerActiveStakeBucketName)
+		if err := stakerBucket.Put(schnorr.SerializePubKey(stakerPk), uint64ToBytes(1)); err != nil {
+			return err
+		}
+		fpBucket := tx.ReadWriteBucket(fpActiveStakeBucketName)
+		return fpBucket.Put(schnorr.SerializePubKey(staleFpPk), uint64ToBytes(1))
+	})
+	require.NoError(t, err)
+	corruptedTvl, err := s.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Equal(t, confirmedTvl+12345, corruptedTvl)
+
+	err = s.RecomputeCounters()
+	require.NoError(t, err)
+
+	recomputedTvl, err := s.GetConfirmedTvl()
+	require.NoError(t, err)
+	require.Equal(t, confirmedTvl, recomputedTvl)
+	recomputedScore, err := s.GetTotalScore()
+	require.NoError(t, err)
+	require.Equal(t, totalScore, recomputedScore)
+	recomputedStakerStake, err := s.GetStakerActiveStake(stakerPk)
+	require.NoError(t, err)
+	require.Equal(t, stakerStake, recomputedStakerStake)
+	recomputedWithdrawnValue, err := s.GetTotalWithdrawnValue()
+	require.NoError(t, err)
+	require.Equal(t, totalWithdrawnValue, recomputedWithdrawnValue)
+	for i, fpPkBytes := range fpPks {
+		fpPk, err := schnorr.ParsePubKey(fpPkBytes)
+		require.NoError(t, err)
+		recomputedFpStake, err := s.GetFinalityProviderActiveStake(fpPk)
+		require.NoError(t, err)
+		require.Equal(t, fpStakes[i], recomputedFpStake)
+	}
+	staleFpStake, err := s.GetFinalityProviderActiveStake(staleFpPk)
+	require.NoError(t, err)
+	require.Zero(t, staleFpStake)
+}
@@ -0,0 +1,86 @@
+package indexerstore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lightningnetwork/lnd/kvdb"
+)
+
+// batch runs the given function in a read-write db transaction and
+// records the duration and the failure of the transaction. A transaction
+// failing transiently, i.e., failing to begin or commit while the given
+// function succeeds, is retried up to the configured number of times with
+// a backoff doubling after each retry, so the given function should be
+// safe to run again as it is for the batched transactions. The errors
+// returned by the given function are not retried
+func (is *IndexerStore) batch(f func(tx kvdb.RwTx) error) error {
+	backoff := is.txRetryBackoff
+	for attempt := uint32(0); ; attempt++ {
+		var fErr error
+		start := time.Now()
+		err := kvdb.Batch(is.db, func(tx kvdb.RwTx) error {
+			fErr = f(tx)
+			return fErr
+		})
+		recordDbTx(dbTxTypeWrite, start, err)
+
+		if err == nil || fErr != nil {
+			return err
+		}
+
+		if attempt == is.txMaxRetries {
+			if attempt == 0 {
+				return err
+			}
+
+			return fmt.Errorf("db transaction failed after %d attempts: %w", attempt+1, err)
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// SetDbTxRetry sets the maximum number of retries of a read-write db
+// transaction failing transiently and the backoff before the first retry,
+// which doubles after each retry
+func (is *IndexerStore) SetDbTxRetry(maxRetries uint32, backoff time.Duration) {
+	is.txMaxRetries = maxRetries
+	is.txRetryBackoff = backoff
+}
+
+// view runs the given function in a read-only db transaction and
+// records the duration and the failure of the transaction
+func (is *IndexerStore) view(f func(tx kvdb.RTx) error, reset func()) error {
+	start := time.Now()
+	err := is.db.View(f, reset)
+	recordDbTx(dbTxTypeRead, start, err)
+
+	return err
+}
+
+// logicalDbTxErrs are the errors of the store rejecting the lookup or the
+// update by its own rules, e.g., a not found lookup or a duplicate insert,
+// which are expected results rather than failures of the db transaction
+var logicalDbTxErrs = []error{
+	ErrTransactionNotFound,
+	ErrLastProcessedHeightNotFound,
+	ErrDuplicateTransaction,
+	ErrStakingOutputAlreadySpent,
+}
+
+func recordDbTx(txType string, start time.Time, err error) {
+	dbTxDurationHistogram.WithLabelValues(txType).Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+	for _, logicalErr := range logicalDbTxErrs {
+		if errors.Is(err, logicalErr) {
+			return
+		}
+	}
+
+	failedDbTxsCounter.WithLabelValues(txType).Inc()
+}
@@ -0,0 +1,137 @@
+package indexerstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/kvdb"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonlabs-io/staking-indexer/testutils"
+)
+
+func getDbTxSampleCount(t *testing.T, txType string) uint64 {
+	var m dto.Metric
+	err := dbTxDurationHistogram.WithLabelValues(txType).(prometheus.Histogram).Write(&m)
+	require.NoError(t, err)
+
+	return m.GetHistogram().GetSampleCount()
+}
+
+func getFailedDbTxsCount(t *testing.T, txType string) float64 {
+	var m dto.Metric
+	err := failedDbTxsCounter.WithLabelValues(txType).Write(&m)
+	require.NoError(t, err)
+
+	return m.GetCounter().GetValue()
+}
+
+func TestDbTxMetrics(t *testing.T) {
+	db := testutils.MakeTestBackend(t)
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	readsBefore := getDbTxSampleCount(t, dbTxTypeRead)
+	writesBefore := getDbTxSampleCount(t, dbTxTypeWrite)
+	failedReadsBefore := getFailedDbTxsCount(t, dbTxTypeRead)
+	failedWritesBefore := getFailedDbTxsCount(t, dbTxTypeWrite)
+
+	err = s.SaveLastProcessedHeight(100)
+	require.NoError(t, err)
+	_, err = s.GetLastProcessedHeight()
+	require.NoError(t, err)
+	_, err = s.GetConfirmedTvl()
+	require.NoError(t, err)
+
+	require.Equal(t, writesBefore+1, getDbTxSampleCount(t, dbTxTypeWrite))
+	require.Equal(t, readsBefore+2, getDbTxSampleCount(t, dbTxTypeRead))
+
+	// not found lookups are not counted as failures
+	_, err = s.GetStakingTransaction(&chainhash.Hash{})
+	require.NoError(t, err)
+
+	// subtracting from an empty tvl fails the write transaction
+	err = s.batch(func(tx kvdb.RwTx) error {
+		return s.subtractConfirmedTvl(tx, 1)
+	})
+	require.ErrorIs(t, err, ErrCorruptedStateDb)
+	require.Equal(t, failedWritesBefore+1, getFailedDbTxsCount(t, dbTxTypeWrite))
+	require.Equal(t, failedReadsBefore, getFailedDbTxsCount(t, dbTxTypeRead))
+
+	// a duplicate insert is rejected by the store rather than
+	// failing the write transaction
+	stakingTxHash, withdrawalTxHash := chainhash.Hash{1}, chainhash.Hash{2}
+	addWithdrawal := func() error {
+		return s.AddWithdrawalTransaction(
+			&stakingTxHash, &withdrawalTxHash, wire.NewOutPoint(&stakingTxHash, 0), 1000, 100, 0)
+	}
+	err = addWithdrawal()
+	require.NoError(t, err)
+	err = addWithdrawal()
+	require.ErrorIs(t, err, ErrDuplicateTransaction)
+	require.Equal(t, failedWritesBefore+1, getFailedDbTxsCount(t, dbTxTypeWrite))
+}
+
+var errTransientDbTx = errors.New("transient db tx failure")
+
+// flakyBackend fails the given number of the next read-write transactions
+// after their functions succeed, i.e., as if they fail to commit
+type flakyBackend struct {
+	kvdb.Backend
+	failures int
+	attempts int
+}
+
+func (b *flakyBackend) Update(f func(tx kvdb.RwTx) error, reset func()) error {
+	return b.Backend.Update(func(tx kvdb.RwTx) error {
+		b.attempts++
+		if err := f(tx); err != nil {
+			return err
+		}
+
+		if b.failures > 0 {
+			b.failures--
+			return errTransientDbTx
+		}
+
+		return nil
+	}, reset)
+}
+
+func TestDbTxRetry(t *testing.T) {
+	db := &flakyBackend{Backend: testutils.MakeTestBackend(t)}
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	s.SetDbTxRetry(2, time.Millisecond)
+
+	// the transient failures are retried until the transaction succeeds
+	db.failures, db.attempts = 2, 0
+	err = s.SaveLastProcessedHeight(100)
+	require.NoError(t, err)
+	require.Equal(t, 3, db.attempts)
+	height, err := s.GetLastProcessedHeight()
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), height)
+
+	// the error is returned once the retries are exhausted
+	db.failures, db.attempts = 3, 0
+	err = s.SaveLastProcessedHeight(200)
+	require.ErrorIs(t, err, errTransientDbTx)
+	require.Equal(t, 3, db.attempts)
+	height, err = s.GetLastProcessedHeight()
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), height)
+
+	// the errors of the transaction itself are not retried
+	db.failures, db.attempts = 0, 0
+	err = s.batch(func(tx kvdb.RwTx) error {
+		return s.subtractConfirmedTvl(tx, 1)
+	})
+	require.ErrorIs(t, err, ErrCorruptedStateDb)
+	require.Equal(t, 1, db.attempts)
+}
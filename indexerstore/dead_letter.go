@@ -0,0 +1,199 @@
+package indexerstore
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/kvdb"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+var (
+	// mapping tx hash -> dead letter
+	deadLetterBucketName = []byte("deadletters")
+)
+
+// StoredDeadLetter is a tx that carries the staking tag
+// but cannot be parsed
+type StoredDeadLetter struct {
+	Tx     *wire.MsgTx
+	Height uint64
+	Error  string
+}
+
+// AddDeadLetter stores the given unparseable tx along with the
+// parsing error
+func (is *IndexerStore) AddDeadLetter(tx *wire.MsgTx, height uint64, parseErr string) error {
+	txHash := tx.TxHash()
+	serializedTx, err := utils.SerializeBtcTransaction(tx)
+	if err != nil {
+		return err
+	}
+
+	msg := proto.DeadLetter{
+		TransactionBytes: serializedTx,
+		Height:           height,
+		Error:            parseErr,
+	}
+
+	return is.batch(func(tx kvdb.RwTx) error {
+		deadLetterBucket := tx.ReadWriteBucket(deadLetterBucketName)
+		if deadLetterBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		if deadLetterBucket.Get(txHash[:]) != nil {
+			return ErrDuplicateTransaction
+		}
+
+		marshalled, err := pm.Marshal(&msg)
+		if err != nil {
+			return err
+		}
+
+		return deadLetterBucket.Put(txHash[:], marshalled)
+	})
+}
+
+// GetDeadLetters returns all the stored dead letters
+func (is *IndexerStore) GetDeadLetters() ([]*StoredDeadLetter, error) {
+	var deadLetters []*StoredDeadLetter
+
+	err := is.view(func(tx kvdb.RTx) error {
+		deadLetterBucket := tx.ReadBucket(deadLetterBucketName)
+		if deadLetterBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		return deadLetterBucket.ForEach(func(_, v []byte) error {
+			var deadLetterProto proto.DeadLetter
+			if err := pm.Unmarshal(v, &deadLetterProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			deadLetter, err := protoDeadLetterToStoredDeadLetter(&deadLetterProto)
+			if err != nil {
+				return err
+			}
+
+			deadLetters = append(deadLetters, deadLetter)
+
+			return nil
+		})
+	}, func() {
+		deadLetters = nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deadLetters, nil
+}
+
+// PruneDeadLetters removes the dead letters included below minHeight, and
+// then removes the ones of the lowest heights until at most maxEntries dead
+// letters are kept if maxEntries is not 0. It returns the number of the
+// removed dead letters
+func (is *IndexerStore) PruneDeadLetters(minHeight uint64, maxEntries uint64) (int, error) {
+	var pruned int
+
+	err := is.batch(func(tx kvdb.RwTx) error {
+		deadLetterBucket := tx.ReadWriteBucket(deadLetterBucketName)
+		if deadLetterBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		type deadLetterKey struct {
+			key    []byte
+			height uint64
+		}
+
+		var kept, expired []deadLetterKey
+		err := deadLetterBucket.ForEach(func(k, v []byte) error {
+			var deadLetterProto proto.DeadLetter
+			if err := pm.Unmarshal(v, &deadLetterProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			// the keys are only valid during the db transaction
+			dk := deadLetterKey{key: append([]byte(nil), k...), height: deadLetterProto.Height}
+			if dk.height < minHeight {
+				expired = append(expired, dk)
+			} else {
+				kept = append(kept, dk)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if maxEntries != 0 && uint64(len(kept)) > maxEntries {
+			sort.SliceStable(kept, func(i, j int) bool {
+				return kept[i].height < kept[j].height
+			})
+			expired = append(expired, kept[:uint64(len(kept))-maxEntries]...)
+		}
+
+		// the bucket should not be modified while iterating it
+		for _, dk := range expired {
+			if err := deadLetterBucket.Delete(dk.key); err != nil {
+				return err
+			}
+		}
+
+		pruned = len(expired)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return pruned, nil
+}
+
+// GetDeadLetterCount returns the number of the stored dead letters
+func (is *IndexerStore) GetDeadLetterCount() (int, error) {
+	var count int
+
+	err := is.view(func(tx kvdb.RTx) error {
+		deadLetterBucket := tx.ReadBucket(deadLetterBucketName)
+		if deadLetterBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		return deadLetterBucket.ForEach(func(_, _ []byte) error {
+			count++
+			return nil
+		})
+	}, func() {
+		count = 0
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func protoDeadLetterToStoredDeadLetter(protoDeadLetter *proto.DeadLetter) (*StoredDeadLetter, error) {
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(protoDeadLetter.TransactionBytes)); err != nil {
+		return nil, fmt.Errorf("invalid dead letter tx: %w", err)
+	}
+
+	return &StoredDeadLetter{
+		Tx:     &tx,
+		Height: protoDeadLetter.Height,
+		Error:  protoDeadLetter.Error,
+	}, nil
+}
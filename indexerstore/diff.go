@@ -0,0 +1,170 @@
+package indexerstore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/kvdb"
+)
+
+// diffedBucket is a bucket compared by DiffStores with the function
+// formatting its keys for display
+type diffedBucket struct {
+	name      []byte
+	formatKey func(k []byte) string
+}
+
+// diffedBuckets are the buckets compared by DiffStores in the order they
+// are reported. The staking output index, the staking unbonding index, the
+// staker index, the finality provider index, the index key pks, the tag
+// index, and the height index are not compared as they are derived from the
+// staking and unbonding txs, the spent outputs are not compared as the
+// withdrawals processed before they are recorded are missing, the state
+// hashes are not compared as they depend on the height the store started
+// computing them, so are the processed headers, the inclusion proofs and the
+// block data are not compared as they are optionally stored, the
+// processing errors are not compared as the txs are processed again after
+// restarts, and the pending events are not compared as they depend on the
+// configured event confirmations and the tip when the store is compared
+var diffedBuckets = []diffedBucket{
+	{name: stakingTxBucketName, formatKey: formatTxHashKey},
+	{name: unbondingTxBucketName, formatKey: formatTxHashKey},
+	{name: indexerStateBucketName, formatKey: formatStringKey},
+	{name: confirmedTvlBucketName, formatKey: formatStringKey},
+	{name: stakerActiveStakeBucketName, formatKey: hex.EncodeToString},
+	{name: fpActiveStakeBucketName, formatKey: hex.EncodeToString},
+	{name: withdrawnStakingTxBucketName, formatKey: formatTxHashKey},
+	{name: deadLetterBucketName, formatKey: formatTxHashKey},
+	{name: pendingUnbondingBucketName, formatKey: hex.EncodeToString},
+}
+
+func formatTxHashKey(k []byte) string {
+	txHash, err := chainhash.NewHash(k)
+	if err != nil {
+		return hex.EncodeToString(k)
+	}
+
+	return txHash.String()
+}
+
+func formatStringKey(k []byte) string {
+	return string(k)
+}
+
+// BucketDiff is the difference of the records of a bucket between two
+// stores. The keys are sorted
+type BucketDiff struct {
+	Bucket string `json:"bucket"`
+	// OnlyInA are the keys of the records only found in the first store
+	OnlyInA []string `json:"only_in_a,omitempty"`
+	// OnlyInB are the keys of the records only found in the second store
+	OnlyInB []string `json:"only_in_b,omitempty"`
+	// Different are the keys of the records found in both stores
+	// with different values
+	Different []string `json:"different,omitempty"`
+}
+
+// StoreDiff is the difference between two stores, which only contains
+// the buckets having different records
+type StoreDiff struct {
+	Buckets []*BucketDiff `json:"buckets"`
+}
+
+// IsEmpty returns true if the two stores have the same records
+func (d *StoreDiff) IsEmpty() bool {
+	return len(d.Buckets) == 0
+}
+
+// DiffStores compares the records of the two given stores, e.g., a store
+// rebuilt by reindexing against the original one
+func DiffStores(a, b *IndexerStore) (*StoreDiff, error) {
+	recordsA, err := a.getDiffedRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	recordsB, err := b.getDiffedRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &StoreDiff{Buckets: make([]*BucketDiff, 0)}
+	for i, bucket := range diffedBuckets {
+		bucketDiff := diffBucket(bucket, recordsA[i], recordsB[i])
+		if bucketDiff != nil {
+			diff.Buckets = append(diff.Buckets, bucketDiff)
+		}
+	}
+
+	return diff, nil
+}
+
+// getDiffedRecords returns the records of the diffed buckets in the same
+// order as diffedBuckets
+func (is *IndexerStore) getDiffedRecords() ([]map[string][]byte, error) {
+	var records []map[string][]byte
+
+	err := is.view(func(tx kvdb.RTx) error {
+		for _, bucket := range diffedBuckets {
+			b := tx.ReadBucket(bucket.name)
+			if b == nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			bucketRecords := make(map[string][]byte)
+			err := b.ForEach(func(k, v []byte) error {
+				// the values are only valid during the db transaction
+				bucketRecords[string(k)] = append([]byte(nil), v...)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			records = append(records, bucketRecords)
+		}
+
+		return nil
+	}, func() {
+		records = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func diffBucket(bucket diffedBucket, recordsA, recordsB map[string][]byte) *BucketDiff {
+	bucketDiff := &BucketDiff{Bucket: string(bucket.name)}
+	for k, va := range recordsA {
+		vb, ok := recordsB[k]
+		if !ok {
+			bucketDiff.OnlyInA = append(bucketDiff.OnlyInA, bucket.formatKey([]byte(k)))
+			continue
+		}
+
+		if !bytes.Equal(va, vb) {
+			bucketDiff.Different = append(bucketDiff.Different, bucket.formatKey([]byte(k)))
+		}
+	}
+
+	for k := range recordsB {
+		if _, ok := recordsA[k]; !ok {
+			bucketDiff.OnlyInB = append(bucketDiff.OnlyInB, bucket.formatKey([]byte(k)))
+		}
+	}
+
+	if len(bucketDiff.OnlyInA) == 0 && len(bucketDiff.OnlyInB) == 0 && len(bucketDiff.Different) == 0 {
+		return nil
+	}
+
+	// the maps are iterated in random order
+	sort.Strings(bucketDiff.OnlyInA)
+	sort.Strings(bucketDiff.OnlyInB)
+	sort.Strings(bucketDiff.Different)
+
+	return bucketDiff
+}
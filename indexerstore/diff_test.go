@@ -0,0 +1,110 @@
+package indexerstore_test
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+	"github.com/babylonlabs-io/staking-indexer/testutils"
+	"github.com/babylonlabs-io/staking-indexer/testutils/datagen"
+)
+
+func addStakingTx(t testing.TB, s *indexerstore.IndexerStore, storedTx *indexerstore.StoredStakingTransaction) {
+	err := s.AddStakingTransaction(
+		storedTx.Tx,
+		storedTx.StakingOutputIdx,
+		storedTx.InclusionHeight,
+		storedTx.InclusionTimestamp,
+		storedTx.StakerPk,
+		storedTx.StakingTime,
+		storedTx.FinalityProviderPk,
+		storedTx.StakingValue,
+		storedTx.IsOverflow,
+		storedTx.InactiveReason,
+		storedTx.OpReturnVersion,
+		storedTx.Score,
+	)
+	require.NoError(t, err)
+}
+
+func TestDiffStores(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	storeA, err := indexerstore.NewIndexerStore(testutils.MakeTestBackend(t))
+	require.NoError(t, err)
+	storeB, err := indexerstore.NewIndexerStore(testutils.MakeTestBackend(t))
+	require.NoError(t, err)
+
+	// the stores with the same records have no difference
+	stakingTxs := datagen.GenNStoredStakingTxs(t, r, r.Intn(10)+4, 200)
+	common, onlyInA, onlyInB, different := stakingTxs[3:], stakingTxs[0], stakingTxs[1], stakingTxs[2]
+	for _, storedTx := range common {
+		addStakingTx(t, storeA, storedTx)
+		addStakingTx(t, storeB, storedTx)
+	}
+	diff, err := indexerstore.DiffStores(storeA, storeB)
+	require.NoError(t, err)
+	require.True(t, diff.IsEmpty())
+
+	// diverge the stores
+	addStakingTx(t, storeA, onlyInA)
+	addStakingTx(t, storeB, onlyInB)
+	addStakingTx(t, storeA, different)
+	differentInB := *different
+	differentInB.StakingValue++
+	addStakingTx(t, storeB, &differentInB)
+
+	diff, err = indexerstore.DiffStores(storeA, storeB)
+	require.NoError(t, err)
+	require.False(t, diff.IsEmpty())
+
+	stakerPkHex := func(storedTx *indexerstore.StoredStakingTransaction) string {
+		return hex.EncodeToString(schnorr.SerializePubKey(storedTx.StakerPk))
+	}
+	fpPkHex := func(storedTx *indexerstore.StoredStakingTransaction) string {
+		return hex.EncodeToString(schnorr.SerializePubKey(storedTx.FinalityProviderPk))
+	}
+	expected := &indexerstore.StoreDiff{
+		Buckets: []*indexerstore.BucketDiff{
+			{
+				Bucket:    "stakingtxs",
+				OnlyInA:   []string{onlyInA.Tx.TxHash().String()},
+				OnlyInB:   []string{onlyInB.Tx.TxHash().String()},
+				Different: []string{different.Tx.TxHash().String()},
+			},
+			{
+				Bucket:    "confirmedtvl",
+				Different: []string{"confirmedtvl", "totalscore"},
+			},
+			{
+				Bucket:    "stakeractivestake",
+				OnlyInA:   []string{stakerPkHex(onlyInA)},
+				OnlyInB:   []string{stakerPkHex(onlyInB)},
+				Different: []string{stakerPkHex(different)},
+			},
+			{
+				Bucket:    "fpactivestake",
+				OnlyInA:   []string{fpPkHex(onlyInA)},
+				OnlyInB:   []string{fpPkHex(onlyInB)},
+				Different: []string{fpPkHex(different)},
+			},
+		},
+	}
+	require.Equal(t, expected, diff)
+
+	// the diff is deterministic and symmetric
+	diffAgain, err := indexerstore.DiffStores(storeA, storeB)
+	require.NoError(t, err)
+	require.Equal(t, diff, diffAgain)
+	reversed, err := indexerstore.DiffStores(storeB, storeA)
+	require.NoError(t, err)
+	for i, bucketDiff := range reversed.Buckets {
+		require.Equal(t, diff.Buckets[i].OnlyInA, bucketDiff.OnlyInB)
+		require.Equal(t, diff.Buckets[i].OnlyInB, bucketDiff.OnlyInA)
+		require.Equal(t, diff.Buckets[i].Different, bucketDiff.Different)
+	}
+}
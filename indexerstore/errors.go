@@ -12,6 +12,9 @@ var (
 	// ErrDuplicateTransaction The transaction we try to add already exists in db
 	ErrDuplicateTransaction = errors.New("transaction already exists")
 
+	// ErrStakingOutputAlreadySpent the staking output is already spent by another unbonding transaction
+	ErrStakingOutputAlreadySpent = errors.New("staking output already spent")
+
 	// ErrCorruptedStateDb For some reason, db on disk representation have changed
 	ErrCorruptedStateDb = errors.New("state db is corrupted")
 
@@ -20,4 +23,16 @@ var (
 
 	// ErrNegativeTvl the tvl is negative
 	ErrNegativeTvl = errors.New("negative tvl")
+
+	// ErrNegativeScore the total score is negative
+	ErrNegativeScore = errors.New("negative score")
+
+	// ErrIncompatibleDbVersion the db is written by a newer version of the indexer
+	ErrIncompatibleDbVersion = errors.New("incompatible db version")
+
+	// ErrOutdatedDbVersion the db is not migrated to the latest version of the indexer
+	ErrOutdatedDbVersion = errors.New("outdated db version")
+
+	// ErrIncompleteTransaction the transaction to store misses a required field
+	ErrIncompleteTransaction = errors.New("incomplete transaction")
 )
@@ -0,0 +1,316 @@
+package indexerstore
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/kvdb"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+var (
+	// mapping tx type -> inclusion height and tx hash of the txs of the type
+	heightIndexBucketName = []byte("heightindex")
+
+	// the nested buckets of the height index per tx type
+	heightIndexStakingBucketName    = []byte("staking")
+	heightIndexUnbondingBucketName  = []byte("unbonding")
+	heightIndexWithdrawalBucketName = []byte("withdrawal")
+)
+
+// maxBlockTimeSkew is how far in seconds the timestamp of a block might be
+// ahead of the blocks following it, as the nodes accept the blocks up to two
+// hours ahead of their time
+const maxBlockTimeSkew = 2 * 60 * 60
+
+// initHeightIndex creates the nested buckets of the height index
+func initHeightIndex(tx kvdb.RwTx) error {
+	indexBucket, err := tx.CreateTopLevelBucket(heightIndexBucketName)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range [][]byte{
+		heightIndexStakingBucketName,
+		heightIndexUnbondingBucketName,
+		heightIndexWithdrawalBucketName,
+	} {
+		if _, err := indexBucket.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexHeight indexes the tx of the given hash and type by the height
+// including it. The withdrawals are indexed by the hash of the staking tx
+// they withdraw
+func indexHeight(tx kvdb.RwTx, typeBucketName []byte, height uint64, txHashBytes []byte) error {
+	indexBucket := tx.ReadWriteBucket(heightIndexBucketName)
+	if indexBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	typeBucket := indexBucket.NestedReadWriteBucket(typeBucketName)
+	if typeBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	txHash, err := chainhash.NewHash(txHashBytes)
+	if err != nil {
+		return err
+	}
+
+	return typeBucket.Put(uint64TxKey(height, txHash), []byte{})
+}
+
+// countAtHeight returns the number of the txs indexed at the given height
+// in the given nested bucket of the height index
+func countAtHeight(indexBucket kvdb.RBucket, typeBucketName []byte, height uint64) (int, error) {
+	typeBucket := indexBucket.NestedReadBucket(typeBucketName)
+	if typeBucket == nil {
+		return 0, ErrCorruptedStateDb
+	}
+
+	prefix := uint64ToBytes(height)
+	count := 0
+	c := typeBucket.ReadCursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		count++
+	}
+
+	return count, nil
+}
+
+// GetBlockStats returns the number of the staking, unbonding, and
+// withdrawal txs stored from the block at the given height. The counts are
+// all 0 if the height is not processed or the block has none of the txs
+func (is *IndexerStore) GetBlockStats(height uint64) (stakingCount, unbondingCount, withdrawalCount int, err error) {
+	err = is.view(func(tx kvdb.RTx) error {
+		indexBucket := tx.ReadBucket(heightIndexBucketName)
+		if indexBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		var err error
+		stakingCount, err = countAtHeight(indexBucket, heightIndexStakingBucketName, height)
+		if err != nil {
+			return err
+		}
+
+		unbondingCount, err = countAtHeight(indexBucket, heightIndexUnbondingBucketName, height)
+		if err != nil {
+			return err
+		}
+
+		withdrawalCount, err = countAtHeight(indexBucket, heightIndexWithdrawalBucketName, height)
+
+		return err
+	}, func() {
+		stakingCount, unbondingCount, withdrawalCount = 0, 0, 0
+	})
+
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	return stakingCount, unbondingCount, withdrawalCount, nil
+}
+
+// hashesAtHeight returns the hashes of the txs indexed at the given height
+// in the given nested bucket of the height index
+func hashesAtHeight(indexBucket kvdb.RBucket, typeBucketName []byte, height uint64) ([]*chainhash.Hash, error) {
+	typeBucket := indexBucket.NestedReadBucket(typeBucketName)
+	if typeBucket == nil {
+		return nil, ErrCorruptedStateDb
+	}
+
+	prefix := uint64ToBytes(height)
+	var hashes []*chainhash.Hash
+	c := typeBucket.ReadCursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		_, txHash, err := uint64TxFromKey(k)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, txHash)
+	}
+
+	return hashes, nil
+}
+
+// GetBlockTxHashes returns the hashes of the staking and unbonding txs
+// stored from the block at the given height
+func (is *IndexerStore) GetBlockTxHashes(height uint64) (stakingTxHashes, unbondingTxHashes []*chainhash.Hash, err error) {
+	err = is.view(func(tx kvdb.RTx) error {
+		indexBucket := tx.ReadBucket(heightIndexBucketName)
+		if indexBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		var err error
+		stakingTxHashes, err = hashesAtHeight(indexBucket, heightIndexStakingBucketName, height)
+		if err != nil {
+			return err
+		}
+
+		unbondingTxHashes, err = hashesAtHeight(indexBucket, heightIndexUnbondingBucketName, height)
+
+		return err
+	}, func() {
+		stakingTxHashes, unbondingTxHashes = nil, nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return stakingTxHashes, unbondingTxHashes, nil
+}
+
+// BlockTxHashes are the hashes of the txs stored from a block, the
+// withdrawals are identified by the hashes of the staking txs they withdraw
+type BlockTxHashes struct {
+	Height                   uint64
+	StakingTxHashes          []*chainhash.Hash
+	UnbondingTxHashes        []*chainhash.Hash
+	WithdrawnStakingTxHashes []*chainhash.Hash
+}
+
+// GetBlockTxHashesBetween returns the hashes of the staking, unbonding, and
+// withdrawn staking txs stored from the blocks at the heights within the
+// given inclusive range, sorted by the height. The blocks without any of
+// the txs are omitted
+func (is *IndexerStore) GetBlockTxHashesBetween(fromHeight, toHeight uint64) ([]*BlockTxHashes, error) {
+	var blocks []*BlockTxHashes
+	err := is.view(func(tx kvdb.RTx) error {
+		indexBucket := tx.ReadBucket(heightIndexBucketName)
+		if indexBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		blocksByHeight := make(map[uint64]*BlockTxHashes)
+		for _, typeBucketName := range [][]byte{
+			heightIndexStakingBucketName,
+			heightIndexUnbondingBucketName,
+			heightIndexWithdrawalBucketName,
+		} {
+			typeBucket := indexBucket.NestedReadBucket(typeBucketName)
+			if typeBucket == nil {
+				return ErrCorruptedStateDb
+			}
+
+			c := typeBucket.ReadCursor()
+			for k, _ := c.Seek(uint64ToBytes(fromHeight)); k != nil; k, _ = c.Next() {
+				height, txHash, err := uint64TxFromKey(k)
+				if err != nil {
+					return err
+				}
+				if height > toHeight {
+					break
+				}
+
+				block, ok := blocksByHeight[height]
+				if !ok {
+					block = &BlockTxHashes{Height: height}
+					blocksByHeight[height] = block
+					blocks = append(blocks, block)
+				}
+
+				switch {
+				case bytes.Equal(typeBucketName, heightIndexStakingBucketName):
+					block.StakingTxHashes = append(block.StakingTxHashes, txHash)
+				case bytes.Equal(typeBucketName, heightIndexUnbondingBucketName):
+					block.UnbondingTxHashes = append(block.UnbondingTxHashes, txHash)
+				default:
+					block.WithdrawnStakingTxHashes = append(block.WithdrawnStakingTxHashes, txHash)
+				}
+			}
+		}
+
+		sort.Slice(blocks, func(i, j int) bool {
+			return blocks[i].Height < blocks[j].Height
+		})
+
+		return nil
+	}, func() {
+		blocks = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// GetActiveStakeSince returns the sum of the values of the active staking
+// txs, i.e., neither overflow nor unbonded or withdrawn, of which the
+// inclusion timestamps are not earlier than the given unix timestamp. The
+// staking txs are walked from the highest height down and the walk stops
+// once the timestamps are earlier than the given one by more than the
+// block timestamps can be out of order
+func (is *IndexerStore) GetActiveStakeSince(since int64) (uint64, error) {
+	var stake uint64
+	err := is.view(func(tx kvdb.RTx) error {
+		indexBucket := tx.ReadBucket(heightIndexBucketName)
+		if indexBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		typeBucket := indexBucket.NestedReadBucket(heightIndexStakingBucketName)
+		if typeBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		txBucket := tx.ReadBucket(stakingTxBucketName)
+		if txBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		c := typeBucket.ReadCursor()
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			_, txHash, err := uint64TxFromKey(k)
+			if err != nil {
+				return err
+			}
+
+			v := txBucket.Get(txHash[:])
+			if v == nil {
+				return ErrCorruptedTransactionsDb
+			}
+			var storedTxProto proto.StakingTransaction
+			if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			if storedTxProto.InclusionTimestamp < since-maxBlockTimeSkew {
+				return nil
+			}
+
+			if storedTxProto.InclusionTimestamp < since ||
+				storedTxProto.IsOverflow ||
+				storedTxProto.Status != proto.StakingStatus_STAKING_STATUS_STAKED {
+				continue
+			}
+
+			stake, err = utils.AddUint64(stake, storedTxProto.StakingValue)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func() {
+		stake = 0
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return stake, nil
+}
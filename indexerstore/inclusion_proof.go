@@ -0,0 +1,119 @@
+package indexerstore
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/kvdb"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+var (
+	// mapping tx hash -> merkle inclusion proof of the tx
+	inclusionProofBucketName = []byte("inclusionproofs")
+)
+
+// StoredInclusionProof is the merkle inclusion proof of a tx within the
+// block including it
+type StoredInclusionProof struct {
+	BlockHeader *wire.BlockHeader
+	Height      uint64
+	TxIndex     uint32
+	// MerkleNodes are the hashes of the siblings along the path from
+	// the tx to the merkle root, from the bottom to the top
+	MerkleNodes []chainhash.Hash
+}
+
+// Verify checks whether the proof proves the inclusion of the tx of the
+// given hash under the merkle root of the block header
+func (p *StoredInclusionProof) Verify(txHash *chainhash.Hash) bool {
+	return utils.VerifyMerkleBranch(txHash, p.TxIndex, p.MerkleNodes, &p.BlockHeader.MerkleRoot)
+}
+
+// AddInclusionProof saves the inclusion proof of the tx of the given hash,
+// the proof saved before is replaced
+func (is *IndexerStore) AddInclusionProof(txHash *chainhash.Hash, proof *StoredInclusionProof) error {
+	var headerBuf bytes.Buffer
+	if err := proof.BlockHeader.Serialize(&headerBuf); err != nil {
+		return err
+	}
+
+	merkleNodes := make([]byte, 0, len(proof.MerkleNodes)*chainhash.HashSize)
+	for _, h := range proof.MerkleNodes {
+		merkleNodes = append(merkleNodes, h[:]...)
+	}
+
+	marshalled, err := pm.Marshal(&proto.InclusionProof{
+		BlockHeader: headerBuf.Bytes(),
+		Height:      proof.Height,
+		TxIndex:     proof.TxIndex,
+		MerkleNodes: merkleNodes,
+	})
+	if err != nil {
+		return err
+	}
+
+	return is.batch(func(tx kvdb.RwTx) error {
+		proofBucket := tx.ReadWriteBucket(inclusionProofBucketName)
+		if proofBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		return proofBucket.Put(txHash[:], marshalled)
+	})
+}
+
+// GetInclusionProof returns the inclusion proof of the tx of the given hash,
+// it returns nil if the proof is not found
+func (is *IndexerStore) GetInclusionProof(txHash *chainhash.Hash) (*StoredInclusionProof, error) {
+	var proof *StoredInclusionProof
+	err := is.view(func(tx kvdb.RTx) error {
+		proofBucket := tx.ReadBucket(inclusionProofBucketName)
+		if proofBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		v := proofBucket.Get(txHash[:])
+		if v == nil {
+			return nil
+		}
+
+		var proofProto proto.InclusionProof
+		if err := pm.Unmarshal(v, &proofProto); err != nil {
+			return ErrCorruptedStateDb
+		}
+
+		var header wire.BlockHeader
+		if err := header.Deserialize(bytes.NewReader(proofProto.BlockHeader)); err != nil {
+			return ErrCorruptedStateDb
+		}
+
+		if len(proofProto.MerkleNodes)%chainhash.HashSize != 0 {
+			return ErrCorruptedStateDb
+		}
+		merkleNodes := make([]chainhash.Hash, len(proofProto.MerkleNodes)/chainhash.HashSize)
+		for i := range merkleNodes {
+			copy(merkleNodes[i][:], proofProto.MerkleNodes[i*chainhash.HashSize:])
+		}
+
+		proof = &StoredInclusionProof{
+			BlockHeader: &header,
+			Height:      proofProto.Height,
+			TxIndex:     proofProto.TxIndex,
+			MerkleNodes: merkleNodes,
+		}
+
+		return nil
+	}, func() {
+		proof = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return proof, nil
+}
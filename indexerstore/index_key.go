@@ -0,0 +1,224 @@
+package indexerstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/lightningnetwork/lnd/kvdb"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+)
+
+// IndexKeyHash is the hash applied to the pks before they are used as the
+// keys of the staker index and the finality provider index
+type IndexKeyHash string
+
+const (
+	// IndexKeyHashNone the pks are used as the index keys as they are
+	IndexKeyHashNone IndexKeyHash = "none"
+	// IndexKeyHashSha256 the index keys are the first 16 bytes of the
+	// SHA256 hashes of the pks
+	IndexKeyHashSha256 IndexKeyHash = "sha256"
+)
+
+// hashedIndexKeySize is the size of the hashed index keys
+const hashedIndexKeySize = 16
+
+// indexKeyHashers are the hash functions of the index keys by name, the pks
+// are used as they are if the hash has no hash function
+var indexKeyHashers = map[IndexKeyHash]func(pk []byte) []byte{
+	IndexKeyHashSha256: func(pk []byte) []byte {
+		h := sha256.Sum256(pk)
+		return h[:hashedIndexKeySize]
+	},
+}
+
+var (
+	// mapping hashed index key -> pk hashed into the key
+	indexKeyPkBucketName = []byte("indexkeypks")
+)
+
+func getIndexKeyHashKey() []byte {
+	return []byte("indexkeyhash")
+}
+
+// getIndexKeyHash returns the hash of the index keys recorded in the db, a
+// db without the record uses the pks as the index keys
+func getIndexKeyHash(tx kvdb.RTx) (IndexKeyHash, error) {
+	stateBucket := tx.ReadBucket(indexerStateBucketName)
+	if stateBucket == nil {
+		return "", ErrCorruptedStateDb
+	}
+
+	v := stateBucket.Get(getIndexKeyHashKey())
+	if v == nil {
+		return IndexKeyHashNone, nil
+	}
+
+	return IndexKeyHash(v), nil
+}
+
+// lookupIndexKey returns the key under which the given pk is indexed by the
+// hash of the index keys recorded in the db
+func lookupIndexKey(tx kvdb.RTx, pk []byte) ([]byte, error) {
+	hash, err := getIndexKeyHash(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher, ok := indexKeyHashers[hash]
+	if !ok {
+		return pk, nil
+	}
+
+	return hasher(pk), nil
+}
+
+// putIndexKey returns the key under which the given pk is indexed and
+// records the pk of the key if the key is hashed. Two pks hashed into the
+// same key are reported as a corruption as the lookups cannot tell them
+// apart
+func putIndexKey(tx kvdb.RwTx, pk []byte) ([]byte, error) {
+	key, err := lookupIndexKey(tx, pk)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(key, pk) {
+		return key, nil
+	}
+
+	keyPkBucket := tx.ReadWriteBucket(indexKeyPkBucketName)
+	if keyPkBucket == nil {
+		return nil, ErrCorruptedTransactionsDb
+	}
+
+	if existingPk := keyPkBucket.Get(key); existingPk != nil {
+		if !bytes.Equal(existingPk, pk) {
+			return nil, fmt.Errorf("%w: the index key %x is the hash of both %x and %x",
+				ErrCorruptedTransactionsDb, key, existingPk, pk)
+		}
+
+		return key, nil
+	}
+
+	if err := keyPkBucket.Put(key, pk); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// indexedPk returns the pk of the given index key
+func indexedPk(tx kvdb.RTx, key []byte) ([]byte, error) {
+	hash, err := getIndexKeyHash(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := indexKeyHashers[hash]; !ok {
+		return key, nil
+	}
+
+	keyPkBucket := tx.ReadBucket(indexKeyPkBucketName)
+	if keyPkBucket == nil {
+		return nil, ErrCorruptedTransactionsDb
+	}
+
+	pk := keyPkBucket.Get(key)
+	if pk == nil {
+		return nil, ErrCorruptedTransactionsDb
+	}
+
+	return pk, nil
+}
+
+// SetIndexKeyHash sets the hash applied to the pks before they are used as
+// the keys of the staker index and the finality provider index, which bounds
+// the size of the index keys at the cost of an indirection when listing the
+// finality providers. If the hash differs from the one recorded in the db,
+// both indexes are rebuilt from the stored staking txs under the new keys
+// in a single db transaction
+func (is *IndexerStore) SetIndexKeyHash(hash IndexKeyHash) error {
+	if hash != IndexKeyHashNone {
+		if _, ok := indexKeyHashers[hash]; !ok {
+			return fmt.Errorf("unknown index key hash: %s", hash)
+		}
+	}
+
+	return is.batch(func(tx kvdb.RwTx) error {
+		currentHash, err := getIndexKeyHash(tx)
+		if err != nil {
+			return err
+		}
+		if currentHash == hash {
+			return nil
+		}
+
+		stateBucket := tx.ReadWriteBucket(indexerStateBucketName)
+		if stateBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		if hash == IndexKeyHashNone {
+			err = stateBucket.Delete(getIndexKeyHashKey())
+		} else {
+			err = stateBucket.Put(getIndexKeyHashKey(), []byte(hash))
+		}
+		if err != nil {
+			return err
+		}
+
+		return rebuildPkIndexes(tx)
+	})
+}
+
+// rebuildPkIndexes rebuilds the staker index and the finality provider
+// index from the stored staking txs under the keys of the hash recorded in
+// the db
+func rebuildPkIndexes(tx kvdb.RwTx) error {
+	for _, bucketName := range [][]byte{
+		stakerIndexBucketName, fpIndexBucketName, indexKeyPkBucketName,
+	} {
+		if err := tx.DeleteTopLevelBucket(bucketName); err != nil {
+			return err
+		}
+
+		if _, err := tx.CreateTopLevelBucket(bucketName); err != nil {
+			return err
+		}
+	}
+
+	txBucket := tx.ReadBucket(stakingTxBucketName)
+	if txBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	stakingTxs := make(map[string]*proto.StakingTransaction)
+	err := txBucket.ForEach(func(k, v []byte) error {
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+		stakingTxs[string(k)] = &storedTxProto
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, st := range stakingTxs {
+		if err := indexStaker(tx, []byte(k), st); err != nil {
+			return err
+		}
+
+		if err := indexFinalityProvider(tx, []byte(k), st); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
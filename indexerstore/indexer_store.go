@@ -2,12 +2,15 @@ package indexerstore
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
+	"sort"
+	"time"
 
+	"github.com/babylonlabs-io/babylon/btcstaking"
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/lightningnetwork/lnd/kvdb"
@@ -29,102 +32,390 @@ var (
 
 	// stores the confirmed tvl
 	confirmedTvlBucketName = []byte("confirmedtvl")
+
+	// mapping staker pk -> active stake of the staker
+	stakerActiveStakeBucketName = []byte("stakeractivestake")
+
+	// mapping finality provider pk -> active stake delegated to the
+	// finality provider
+	fpActiveStakeBucketName = []byte("fpactivestake")
+
+	// mapping withdrawn staking tx hash -> withdrawal of the staking tx
+	withdrawnStakingTxBucketName = []byte("withdrawnstakingtxs")
+
+	// mapping staking output pk script -> staking tx hashes
+	stakingOutputIndexBucketName = []byte("stakingoutputindex")
+
+	// mapping staking tx hash -> hash of the unbonding tx spending it
+	stakingUnbondingIndexBucketName = []byte("stakingunbondingindex")
+
+	// mapping staker pk, or its hash if the index keys are hashed -> staking
+	// tx hashes
+	stakerIndexBucketName = []byte("stakerindex")
+
+	// mapping finality provider pk, or its hash if the index keys are hashed
+	// -> staking tx hashes
+	fpIndexBucketName = []byte("fpindex")
+
+	// mapping staking tag of the OP_RETURN data -> staking tx hashes
+	tagIndexBucketName = []byte("tagindex")
+)
+
+// InactiveReason is the reason why a staking tx is overflow
+type InactiveReason uint32
+
+const (
+	// InactiveReasonNone the staking tx is active
+	InactiveReasonNone InactiveReason = iota
+	// InactiveReasonStakingCap the staking tx exceeds the global staking cap
+	InactiveReasonStakingCap
+	// InactiveReasonPerStakerCap the staking tx exceeds the per-staker cap
+	InactiveReasonPerStakerCap
+	// InactiveReasonManual the staking tx is manually marked as inactive
+	InactiveReasonManual
+	// InactiveReasonPerFinalityProviderCap the staking tx exceeds the
+	// per-finality-provider cap
+	InactiveReasonPerFinalityProviderCap
+)
+
+// String returns the name of the inactive reason used in metrics and logs
+func (r InactiveReason) String() string {
+	switch r {
+	case InactiveReasonNone:
+		return "none"
+	case InactiveReasonStakingCap:
+		return "staking_cap"
+	case InactiveReasonPerStakerCap:
+		return "per_staker_cap"
+	case InactiveReasonManual:
+		return "manual"
+	case InactiveReasonPerFinalityProviderCap:
+		return "per_finality_provider_cap"
+	default:
+		return fmt.Sprintf("unknown_%d", uint32(r))
+	}
+}
+
+// StakingStatus is the lifecycle status of a staking tx
+type StakingStatus uint32
+
+const (
+	// StakingStatusStaked the staking tx is included and its staking
+	// output is not spent
+	StakingStatusStaked StakingStatus = iota
+	// StakingStatusUnbonding the unbonding tx spending the staking tx
+	// is included
+	StakingStatusUnbonding
+	// StakingStatusWithdrawn the withdrawal tx spending the staking or
+	// unbonding tx is included
+	StakingStatusWithdrawn
 )
 
 type IndexerStore struct {
 	db kvdb.Backend
+	// txMaxRetries is the maximum number of retries of a read-write db
+	// transaction failing transiently
+	txMaxRetries uint32
+	// txRetryBackoff is the backoff before the first retry
+	txRetryBackoff time.Duration
 }
 
 type StoredStakingTransaction struct {
 	Tx                 *wire.MsgTx
 	StakingOutputIdx   uint32
 	InclusionHeight    uint64
+	InclusionTimestamp int64
 	StakerPk           *btcec.PublicKey
 	StakingTime        uint32
 	FinalityProviderPk *btcec.PublicKey
 	IsOverflow         bool
 	StakingValue       uint64
+	OpReturnVersion    uint32
+	InactiveReason     InactiveReason
+	Score              uint64
+	Status             StakingStatus
+	// EligibilityOverridden is whether IsOverflow and InactiveReason are
+	// manually overridden
+	EligibilityOverridden bool
+	// OriginalIsOverflow and OriginalInactiveReason are the eligibility of
+	// the staking tx when it is included, they are only set if the
+	// eligibility is overridden, at EligibilityOverriddenTimestamp
+	OriginalIsOverflow             bool
+	OriginalInactiveReason         InactiveReason
+	EligibilityOverriddenTimestamp int64
 }
 
 type StoredUnbondingTransaction struct {
-	Tx            *wire.MsgTx
-	StakingTxHash *chainhash.Hash
+	Tx                 *wire.MsgTx
+	StakingTxHash      *chainhash.Hash
+	InclusionHeight    uint64
+	InclusionTimestamp int64
+}
+
+type StoredWithdrawnStakingTransaction struct {
+	WithdrawnValue uint64
+	Height         uint64
+	Timestamp      int64
 }
 
 // NewIndexerStore returns a new store backed by db
 func NewIndexerStore(db kvdb.Backend) (*IndexerStore,
 	error) {
 
-	store := &IndexerStore{db}
-	if err := store.initBuckets(); err != nil {
-		return nil, err
+	store := &IndexerStore{db: db}
+	if err := store.initDb(); err != nil {
+		return nil, fmt.Errorf("failed to initialize the store: %w", err)
 	}
 
 	return store, nil
 }
 
-func (c *IndexerStore) initBuckets() error {
-	return kvdb.Batch(c.db, func(tx kvdb.RwTx) error {
-		_, err := tx.CreateTopLevelBucket(stakingTxBucketName)
-		if err != nil {
-			return err
-		}
+// OpenIndexerStore returns a store backed by db without creating the
+// buckets or migrating the db, e.g., for inspecting a db without changing
+// it. It returns ErrOutdatedDbVersion if the db is not migrated to the
+// latest version, including a db that has never been initialized
+func OpenIndexerStore(db kvdb.Backend) (*IndexerStore, error) {
+	store := &IndexerStore{db: db}
+	if err := store.checkDbVersion(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
 
-		_, err = tx.CreateTopLevelBucket(unbondingTxBucketName)
+// initDb checks the db version, then creates the missing buckets and
+// applies the migrations in a single db transaction, so that a db written
+// by a newer binary is left unmodified
+func (is *IndexerStore) initDb() error {
+	return is.batch(func(tx kvdb.RwTx) error {
+		dbVersion, err := readDbVersion(tx)
 		if err != nil {
 			return err
 		}
 
-		_, err = tx.CreateTopLevelBucket(indexerStateBucketName)
-		if err != nil {
-			return err
+		latestVersion := uint64(len(migrations))
+		if dbVersion > latestVersion {
+			// the db is written by a newer binary, the records
+			// might not be parsed correctly
+			return fmt.Errorf("%w: db version %d, latest supported version %d",
+				ErrIncompatibleDbVersion, dbVersion, latestVersion)
 		}
 
-		_, err = tx.CreateTopLevelBucket(confirmedTvlBucketName)
-		if err != nil {
+		if err := createBuckets(tx); err != nil {
 			return err
 		}
 
-		return nil
+		return runMigrations(tx, dbVersion)
 	})
 }
 
+func createBuckets(tx kvdb.RwTx) error {
+	_, err := tx.CreateTopLevelBucket(stakingTxBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(unbondingTxBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(indexerStateBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(confirmedTvlBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(stakerActiveStakeBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(fpActiveStakeBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(withdrawnStakingTxBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(deadLetterBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(stakingOutputIndexBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(stakingUnbondingIndexBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(processingErrorBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(stakerIndexBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(fpIndexBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(tagIndexBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(indexKeyPkBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(spentOutputBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(stateHashBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(inclusionProofBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(processedHeaderBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(blockDataBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(pendingUnbondingBucketName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateTopLevelBucket(pendingEventBucketName)
+	if err != nil {
+		return err
+	}
+
+	return initHeightIndex(tx)
+}
+
 func (is *IndexerStore) AddStakingTransaction(
 	tx *wire.MsgTx,
 	stakingOutputIdx uint32,
 	inclusionHeight uint64,
+	inclusionTimestamp int64,
 	stakerPk *btcec.PublicKey,
 	stakingTime uint32,
 	fpPk *btcec.PublicKey,
 	stakingValue uint64,
 	isOverflow bool,
+	inactiveReason InactiveReason,
+	opReturnVersion uint32,
+	score uint64,
 ) error {
 	txHash := tx.TxHash()
-	serializedTx, err := utils.SerializeBtcTransaction(tx)
-
-	if err != nil {
-		return err
-	}
-
-	msg := proto.StakingTransaction{
-		TransactionBytes:   serializedTx,
+	st := &StoredStakingTransaction{
+		Tx:                 tx,
 		StakingOutputIdx:   stakingOutputIdx,
 		InclusionHeight:    inclusionHeight,
+		InclusionTimestamp: inclusionTimestamp,
+		StakerPk:           stakerPk,
 		StakingTime:        stakingTime,
-		StakerPk:           schnorr.SerializePubKey(stakerPk),
-		FinalityProviderPk: schnorr.SerializePubKey(fpPk),
+		FinalityProviderPk: fpPk,
 		IsOverflow:         isOverflow,
 		StakingValue:       stakingValue,
+		OpReturnVersion:    opReturnVersion,
+		InactiveReason:     inactiveReason,
+		Score:              score,
+	}
+
+	msg, err := st.ToProto()
+	if err != nil {
+		return err
+	}
+
+	return is.addStakingTransaction(txHash[:], msg)
+}
+
+// ToProto converts the staking tx to the proto message as it is stored, it
+// returns ErrIncompleteTransaction if the tx or a public key is missing
+func (st *StoredStakingTransaction) ToProto() (*proto.StakingTransaction, error) {
+	switch {
+	case st.Tx == nil:
+		return nil, fmt.Errorf("%w: missing staking tx", ErrIncompleteTransaction)
+	case st.StakerPk == nil:
+		return nil, fmt.Errorf("%w: missing staker public key", ErrIncompleteTransaction)
+	case st.FinalityProviderPk == nil:
+		return nil, fmt.Errorf("%w: missing finality provider public key", ErrIncompleteTransaction)
+	}
+
+	serializedTx, err := utils.SerializeBtcTransaction(st.Tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.StakingTransaction{
+		TransactionBytes:               serializedTx,
+		StakingOutputIdx:               st.StakingOutputIdx,
+		InclusionHeight:                st.InclusionHeight,
+		InclusionTimestamp:             st.InclusionTimestamp,
+		StakingTime:                    st.StakingTime,
+		StakerPk:                       schnorr.SerializePubKey(st.StakerPk),
+		FinalityProviderPk:             schnorr.SerializePubKey(st.FinalityProviderPk),
+		IsOverflow:                     st.IsOverflow,
+		StakingValue:                   st.StakingValue,
+		OpReturnVersion:                st.OpReturnVersion,
+		InactiveReason:                 proto.InactiveReason(st.InactiveReason),
+		Score:                          st.Score,
+		Status:                         proto.StakingStatus(st.Status),
+		EligibilityOverridden:          st.EligibilityOverridden,
+		OriginalIsOverflow:             st.OriginalIsOverflow,
+		OriginalInactiveReason:         proto.InactiveReason(st.OriginalInactiveReason),
+		EligibilityOverriddenTimestamp: st.EligibilityOverriddenTimestamp,
+	}, nil
+}
+
+// FromProto sets the staking tx from the stored proto message
+func (st *StoredStakingTransaction) FromProto(protoTx *proto.StakingTransaction) error {
+	storedTx, err := protoStakingTxToStoredStakingTx(protoTx)
+	if err != nil {
+		return err
 	}
 
-	return is.addStakingTransaction(txHash[:], &msg)
+	*st = *storedTx
+
+	return nil
 }
 
 func (is *IndexerStore) addStakingTransaction(
 	txHashBytes []byte,
 	st *proto.StakingTransaction,
 ) error {
-	return kvdb.Batch(is.db, func(tx kvdb.RwTx) error {
+	return is.batch(func(tx kvdb.RwTx) error {
 
 		txBucket := tx.ReadWriteBucket(stakingTxBucketName)
 		if txBucket == nil {
@@ -145,10 +436,45 @@ func (is *IndexerStore) addStakingTransaction(
 			return err
 		}
 
-		// if the staking tx is an overflow, we don't increment the confirmed tvl
+		if err := indexStakingOutput(tx, txHashBytes, st); err != nil {
+			return err
+		}
+
+		if err := indexStaker(tx, txHashBytes, st); err != nil {
+			return err
+		}
+
+		if err := indexFinalityProvider(tx, txHashBytes, st); err != nil {
+			return err
+		}
+
+		if err := indexTag(tx, txHashBytes, st); err != nil {
+			return err
+		}
+
+		if err := indexHeight(
+			tx, heightIndexStakingBucketName, st.InclusionHeight, txHashBytes,
+		); err != nil {
+			return err
+		}
+
+		// if the staking tx is an overflow, we don't increment the confirmed tvl,
+		// the total score, and the active stakes of the staker and the
+		// finality provider
 		if st.IsOverflow {
 			return nil
 		}
+
+		if err := is.incrementActiveStakes(
+			tx, st.StakerPk, st.FinalityProviderPk, st.StakingValue,
+		); err != nil {
+			return err
+		}
+
+		if err := is.incrementTotalScore(tx, st.Score); err != nil {
+			return err
+		}
+
 		return is.incrementConfirmedTvl(tx, st.StakingValue)
 	})
 }
@@ -159,7 +485,7 @@ func (is *IndexerStore) GetStakingTransaction(txHash *chainhash.Hash) (*StoredSt
 	var storedTx *StoredStakingTransaction
 	txHashBytes := txHash.CloneBytes()
 
-	err := is.db.View(func(tx kvdb.RTx) error {
+	err := is.view(func(tx kvdb.RTx) error {
 		txBucket := tx.ReadBucket(stakingTxBucketName)
 		if txBucket == nil {
 			return ErrCorruptedTransactionsDb
@@ -191,296 +517,1744 @@ func (is *IndexerStore) GetStakingTransaction(txHash *chainhash.Hash) (*StoredSt
 	return storedTx, nil
 }
 
-func protoStakingTxToStoredStakingTx(protoTx *proto.StakingTransaction) (*StoredStakingTransaction, error) {
+// GetStakingTransactionBytes retrieves the serialized staking transaction as
+// it is stored by the given hash without deserializing it
+// it returns (nil, nil) if the transaction is not found
+func (is *IndexerStore) GetStakingTransactionBytes(txHash *chainhash.Hash) ([]byte, error) {
+	var txBytes []byte
+	txHashBytes := txHash.CloneBytes()
+
+	err := is.view(func(tx kvdb.RTx) error {
+		txBucket := tx.ReadBucket(stakingTxBucketName)
+		if txBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		maybeTx := txBucket.Get(txHashBytes)
+		if maybeTx == nil {
+			return ErrTransactionNotFound
+		}
+
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(maybeTx, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		txBytes = storedTxProto.TransactionBytes
+		return nil
+	}, func() {})
+
+	if err != nil && !errors.Is(err, ErrTransactionNotFound) {
+		return nil, err
+	}
+
+	return txBytes, nil
+}
+
+// GetStakingTransactions retrieves the stored staking transactions by the given
+// hashes in a single read transaction. Hashes that are not found are absent from
+// the returned map
+func (is *IndexerStore) GetStakingTransactions(txHashes []*chainhash.Hash) (map[chainhash.Hash]*StoredStakingTransaction, error) {
+	storedTxs := make(map[chainhash.Hash]*StoredStakingTransaction)
+
+	err := is.view(func(tx kvdb.RTx) error {
+		txBucket := tx.ReadBucket(stakingTxBucketName)
+		if txBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		for _, txHash := range txHashes {
+			maybeTx := txBucket.Get(txHash[:])
+			if maybeTx == nil {
+				continue
+			}
+
+			var storedTxProto proto.StakingTransaction
+			if err := pm.Unmarshal(maybeTx, &storedTxProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			txFromDb, err := protoStakingTxToStoredStakingTx(&storedTxProto)
+			if err != nil {
+				return err
+			}
+
+			storedTxs[*txHash] = txFromDb
+		}
+
+		return nil
+	}, func() {
+		storedTxs = make(map[chainhash.Hash]*StoredStakingTransaction)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return storedTxs, nil
+}
+
+// indexStakingOutput indexes the given staking tx by the pk script of its
+// staking output. The staking tx is not indexed if the staking output
+// cannot be found
+func indexStakingOutput(tx kvdb.RwTx, txHashBytes []byte, st *proto.StakingTransaction) error {
+	indexBucket := tx.ReadWriteBucket(stakingOutputIndexBucketName)
+	if indexBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
 	var stakingTx wire.MsgTx
-	err := stakingTx.Deserialize(bytes.NewReader(protoTx.TransactionBytes))
+	if err := stakingTx.Deserialize(bytes.NewReader(st.TransactionBytes)); err != nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	if int(st.StakingOutputIdx) >= len(stakingTx.TxOut) {
+		return nil
+	}
+
+	pkScript := stakingTx.TxOut[st.StakingOutputIdx].PkScript
+	if len(pkScript) == 0 {
+		return nil
+	}
+
+	pkScriptBucket, err := indexBucket.CreateBucketIfNotExists(pkScript)
 	if err != nil {
-		return nil, fmt.Errorf("invalid staking tx: %w", err)
+		return err
 	}
 
-	stakerPk, err := schnorr.ParsePubKey(protoTx.StakerPk)
+	return pkScriptBucket.Put(txHashBytes, []byte{})
+}
+
+// GetStakingTransactionsByPkScript returns the stored staking txs of which
+// the staking output has the given pk script
+func (is *IndexerStore) GetStakingTransactionsByPkScript(pkScript []byte) ([]*StoredStakingTransaction, error) {
+	return is.getIndexedStakingTransactions(stakingOutputIndexBucketName, pkScript)
+}
+
+// indexStaker indexes the staking tx by the pk of its staker
+func indexStaker(tx kvdb.RwTx, txHashBytes []byte, st *proto.StakingTransaction) error {
+	indexBucket := tx.ReadWriteBucket(stakerIndexBucketName)
+	if indexBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	key, err := putIndexKey(tx, st.StakerPk)
 	if err != nil {
-		return nil, fmt.Errorf("invalid staker pk: %w", err)
+		return err
 	}
 
-	fpPk, err := schnorr.ParsePubKey(protoTx.FinalityProviderPk)
+	stakerBucket, err := indexBucket.CreateBucketIfNotExists(key)
 	if err != nil {
-		return nil, fmt.Errorf("invalid finality provider pk: %w", err)
+		return err
+	}
+
+	return stakerBucket.Put(txHashBytes, []byte{})
+}
+
+// GetStakingTransactionsByStaker returns the stored staking txs of the
+// given staker
+func (is *IndexerStore) GetStakingTransactionsByStaker(stakerPk *btcec.PublicKey) ([]*StoredStakingTransaction, error) {
+	return is.getPkIndexedStakingTransactions(stakerIndexBucketName, schnorr.SerializePubKey(stakerPk))
+}
+
+// GetStakerDelegationCount returns the number of the stored staking txs of
+// the given staker, which is counted from the staker index without reading
+// the staking txs, it returns 0 for an unknown staker
+func (is *IndexerStore) GetStakerDelegationCount(stakerPk *btcec.PublicKey) (int, error) {
+	var count int
+
+	err := is.view(func(tx kvdb.RTx) error {
+		indexBucket := tx.ReadBucket(stakerIndexBucketName)
+		if indexBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		key, err := lookupIndexKey(tx, schnorr.SerializePubKey(stakerPk))
+		if err != nil {
+			return err
+		}
+
+		stakerBucket := indexBucket.NestedReadBucket(key)
+		if stakerBucket == nil {
+			return nil
+		}
+
+		c := stakerBucket.ReadCursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			count++
+		}
+
+		return nil
+	}, func() {
+		count = 0
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// indexFinalityProvider indexes the staking tx by the pk of its finality
+// provider
+func indexFinalityProvider(tx kvdb.RwTx, txHashBytes []byte, st *proto.StakingTransaction) error {
+	indexBucket := tx.ReadWriteBucket(fpIndexBucketName)
+	if indexBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	key, err := putIndexKey(tx, st.FinalityProviderPk)
+	if err != nil {
+		return err
+	}
+
+	fpBucket, err := indexBucket.CreateBucketIfNotExists(key)
+	if err != nil {
+		return err
+	}
+
+	return fpBucket.Put(txHashBytes, []byte{})
+}
+
+// GetStakingTransactionsByFinalityProvider returns the stored staking txs
+// delegating to the given finality provider
+func (is *IndexerStore) GetStakingTransactionsByFinalityProvider(fpPk *btcec.PublicKey) ([]*StoredStakingTransaction, error) {
+	return is.getPkIndexedStakingTransactions(fpIndexBucketName, schnorr.SerializePubKey(fpPk))
+}
+
+// ListFinalityProviders returns the pks of the distinct finality providers
+// that have received at least one staking tx, regardless of whether the
+// staking tx is active, in the order of the serialized pks
+func (is *IndexerStore) ListFinalityProviders() ([]*btcec.PublicKey, error) {
+	var fpPks []*btcec.PublicKey
+
+	err := is.view(func(tx kvdb.RTx) error {
+		indexBucket := tx.ReadBucket(fpIndexBucketName)
+		if indexBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		// each finality provider has a nested bucket keyed by its pk or
+		// its hash
+		return indexBucket.ForEach(func(k, _ []byte) error {
+			pk, err := indexedPk(tx, k)
+			if err != nil {
+				return err
+			}
+
+			fpPk, err := schnorr.ParsePubKey(pk)
+			if err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+			fpPks = append(fpPks, fpPk)
+
+			return nil
+		})
+	}, func() {
+		fpPks = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the hashed keys are not in the order of the pks
+	sort.Slice(fpPks, func(i, j int) bool {
+		return bytes.Compare(schnorr.SerializePubKey(fpPks[i]), schnorr.SerializePubKey(fpPks[j])) < 0
+	})
+
+	return fpPks, nil
+}
+
+// indexTag indexes the staking tx by the staking tag of its OP_RETURN data,
+// the tx is not indexed if it has no V0 OP_RETURN output
+func indexTag(tx kvdb.RwTx, txHashBytes []byte, st *proto.StakingTransaction) error {
+	tag, err := getStakingTag(st.TransactionBytes)
+	if err != nil {
+		return err
+	}
+	if tag == nil {
+		return nil
+	}
+
+	indexBucket := tx.ReadWriteBucket(tagIndexBucketName)
+	if indexBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	tagBucket, err := indexBucket.CreateBucketIfNotExists(tag)
+	if err != nil {
+		return err
+	}
+
+	return tagBucket.Put(txHashBytes, []byte{})
+}
+
+// getStakingTag returns the staking tag of the first V0 OP_RETURN output of
+// the given serialized tx, it returns nil if there is no such output
+func getStakingTag(txBytes []byte) ([]byte, error) {
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(txBytes)); err != nil {
+		return nil, fmt.Errorf("invalid staking tx: %w", err)
+	}
+
+	for _, out := range msgTx.TxOut {
+		opReturnData, err := btcstaking.NewV0OpReturnDataFromTxOutput(out)
+		if err != nil {
+			continue
+		}
+
+		return opReturnData.Tag, nil
+	}
+
+	return nil, nil
+}
+
+// GetStakingTransactionsByTag returns the stored staking txs of which the
+// OP_RETURN data carries the given staking tag, which is useful when the
+// params versions use different tags
+func (is *IndexerStore) GetStakingTransactionsByTag(tag []byte) ([]*StoredStakingTransaction, error) {
+	if len(tag) == 0 {
+		return nil, nil
+	}
+
+	return is.getIndexedStakingTransactions(tagIndexBucketName, tag)
+}
+
+// getIndexedStakingTransactions returns the stored staking txs of which the
+// hashes are in the nested bucket of the given key in the given index bucket
+func (is *IndexerStore) getIndexedStakingTransactions(indexBucketName, key []byte) ([]*StoredStakingTransaction, error) {
+	var storedTxs []*StoredStakingTransaction
+
+	err := is.view(func(tx kvdb.RTx) error {
+		var err error
+		storedTxs, err = readIndexedStakingTransactions(tx, indexBucketName, key)
+
+		return err
+	}, func() {
+		storedTxs = nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return storedTxs, nil
+}
+
+// getPkIndexedStakingTransactions returns the stored staking txs indexed by
+// the given pk in the given index bucket, of which the keys might be hashed
+func (is *IndexerStore) getPkIndexedStakingTransactions(indexBucketName, pk []byte) ([]*StoredStakingTransaction, error) {
+	var storedTxs []*StoredStakingTransaction
+
+	err := is.view(func(tx kvdb.RTx) error {
+		key, err := lookupIndexKey(tx, pk)
+		if err != nil {
+			return err
+		}
+
+		storedTxs, err = readIndexedStakingTransactions(tx, indexBucketName, key)
+
+		return err
+	}, func() {
+		storedTxs = nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return storedTxs, nil
+}
+
+func readIndexedStakingTransactions(tx kvdb.RTx, indexBucketName, key []byte) ([]*StoredStakingTransaction, error) {
+	indexBucket := tx.ReadBucket(indexBucketName)
+	if indexBucket == nil {
+		return nil, ErrCorruptedTransactionsDb
+	}
+
+	txBucket := tx.ReadBucket(stakingTxBucketName)
+	if txBucket == nil {
+		return nil, ErrCorruptedTransactionsDb
+	}
+
+	keyBucket := indexBucket.NestedReadBucket(key)
+	if keyBucket == nil {
+		return nil, nil
+	}
+
+	var storedTxs []*StoredStakingTransaction
+	err := keyBucket.ForEach(func(txHashBytes, _ []byte) error {
+		maybeTx := txBucket.Get(txHashBytes)
+		if maybeTx == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(maybeTx, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		txFromDb, err := protoStakingTxToStoredStakingTx(&storedTxProto)
+		if err != nil {
+			return err
+		}
+
+		storedTxs = append(storedTxs, txFromDb)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return storedTxs, nil
+}
+
+func protoStakingTxToStoredStakingTx(protoTx *proto.StakingTransaction) (*StoredStakingTransaction, error) {
+	var stakingTx wire.MsgTx
+	err := stakingTx.Deserialize(bytes.NewReader(protoTx.TransactionBytes))
+	if err != nil {
+		return nil, fmt.Errorf("invalid staking tx: %w", err)
+	}
+
+	stakerPk, err := schnorr.ParsePubKey(protoTx.StakerPk)
+	if err != nil {
+		return nil, fmt.Errorf("invalid staker pk: %w", err)
+	}
+
+	fpPk, err := schnorr.ParsePubKey(protoTx.FinalityProviderPk)
+	if err != nil {
+		return nil, fmt.Errorf("invalid finality provider pk: %w", err)
+	}
+
+	return &StoredStakingTransaction{
+		Tx:                             &stakingTx,
+		StakingOutputIdx:               protoTx.StakingOutputIdx,
+		InclusionHeight:                protoTx.InclusionHeight,
+		InclusionTimestamp:             protoTx.InclusionTimestamp,
+		StakerPk:                       stakerPk,
+		StakingTime:                    protoTx.StakingTime,
+		FinalityProviderPk:             fpPk,
+		IsOverflow:                     protoTx.IsOverflow,
+		StakingValue:                   protoTx.StakingValue,
+		OpReturnVersion:                protoTx.OpReturnVersion,
+		InactiveReason:                 InactiveReason(protoTx.InactiveReason),
+		Score:                          protoTx.Score,
+		Status:                         StakingStatus(protoTx.Status),
+		EligibilityOverridden:          protoTx.EligibilityOverridden,
+		OriginalIsOverflow:             protoTx.OriginalIsOverflow,
+		OriginalInactiveReason:         InactiveReason(protoTx.OriginalInactiveReason),
+		EligibilityOverriddenTimestamp: protoTx.EligibilityOverriddenTimestamp,
+	}, nil
+}
+
+func (is *IndexerStore) AddUnbondingTransaction(
+	tx *wire.MsgTx,
+	stakingTxHash *chainhash.Hash,
+	inclusionHeight uint64,
+	inclusionTimestamp int64,
+) error {
+	txHash := tx.TxHash()
+	ut := &StoredUnbondingTransaction{
+		Tx:                 tx,
+		StakingTxHash:      stakingTxHash,
+		InclusionHeight:    inclusionHeight,
+		InclusionTimestamp: inclusionTimestamp,
+	}
+
+	msg, err := ut.ToProto()
+	if err != nil {
+		return err
+	}
+
+	return is.addUnbondingTransaction(txHash[:], stakingTxHash.CloneBytes(), msg, 0)
+}
+
+// ToProto converts the unbonding tx to the proto message as it is stored, it
+// returns ErrIncompleteTransaction if the tx or the staking tx hash is missing
+func (ut *StoredUnbondingTransaction) ToProto() (*proto.UnbondingTransaction, error) {
+	switch {
+	case ut.Tx == nil:
+		return nil, fmt.Errorf("%w: missing unbonding tx", ErrIncompleteTransaction)
+	case ut.StakingTxHash == nil:
+		return nil, fmt.Errorf("%w: missing staking tx hash", ErrIncompleteTransaction)
+	}
+
+	serializedTx, err := utils.SerializeBtcTransaction(ut.Tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.UnbondingTransaction{
+		TransactionBytes:   serializedTx,
+		StakingTxHash:      ut.StakingTxHash.CloneBytes(),
+		InclusionHeight:    ut.InclusionHeight,
+		InclusionTimestamp: ut.InclusionTimestamp,
+	}, nil
+}
+
+// FromProto sets the unbonding tx from the stored proto message
+func (ut *StoredUnbondingTransaction) FromProto(protoTx *proto.UnbondingTransaction) error {
+	storedTx, err := protoUnbondingTxToStoredUnbondingTx(protoTx)
+	if err != nil {
+		return err
+	}
+
+	*ut = *storedTx
+
+	return nil
+}
+
+// addUnbondingTransaction stores the unbonding tx and applies it to the
+// staking tx it spends. If applyHeight is not 0, applying it is held
+// pending until ApplyPendingUnbondingTransactions reaches applyHeight
+func (is *IndexerStore) addUnbondingTransaction(
+	txHashBytes []byte,
+	stakingHashBytes []byte,
+	ut *proto.UnbondingTransaction,
+	applyHeight uint64,
+) error {
+	return is.batch(func(tx kvdb.RwTx) error {
+		stakingTxBucket := tx.ReadWriteBucket(stakingTxBucketName)
+		if stakingTxBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		// we need to ensure the staking tx already exists
+		maybeStakingTx := stakingTxBucket.Get(stakingHashBytes)
+		if maybeStakingTx == nil {
+			return ErrTransactionNotFound
+		}
+		// parse it, make sure it's valid
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(maybeStakingTx, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		unbondingTxBucket := tx.ReadWriteBucket(unbondingTxBucketName)
+		if unbondingTxBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		// check duplicate
+		maybeTx := unbondingTxBucket.Get(txHashBytes)
+		if maybeTx != nil {
+			return ErrDuplicateTransaction
+		}
+
+		// a staking output can only be spent once, another unbonding
+		// or withdrawal tx spending it conflicts with the stored one
+		stakingHash, err := chainhash.NewHash(stakingHashBytes)
+		if err != nil {
+			return err
+		}
+		stakingOutpoint := wire.NewOutPoint(stakingHash, storedTxProto.StakingOutputIdx)
+		spendingTxHash, err := getSpendingTx(tx, stakingOutpoint)
+		if err != nil {
+			return err
+		}
+		if spendingTxHash != nil {
+			return ErrStakingOutputAlreadySpent
+		}
+
+		marshalled, err := pm.Marshal(ut)
+		if err != nil {
+			return err
+		}
+
+		err = unbondingTxBucket.Put(txHashBytes, marshalled)
+		if err != nil {
+			return err
+		}
+
+		// the staking unbonding index records the unbonding tx as the
+		// spender of the staking output as well
+		if err := indexStakingUnbonding(tx, stakingHashBytes, txHashBytes); err != nil {
+			return err
+		}
+
+		if err := indexHeight(
+			tx, heightIndexUnbondingBucketName, ut.InclusionHeight, txHashBytes,
+		); err != nil {
+			return err
+		}
+
+		if applyHeight != 0 {
+			return addPendingUnbonding(tx, applyHeight, txHashBytes, stakingHashBytes)
+		}
+
+		return is.applyUnbonding(tx, stakingHashBytes)
+	})
+}
+
+// applyUnbonding marks the staking tx of the given hash as unbonding and
+// removes its stake from the confirmed tvl, the total score, and the active
+// stakes. A staking tx withdrawn in the meantime keeps its status
+func (is *IndexerStore) applyUnbonding(tx kvdb.RwTx, stakingHashBytes []byte) error {
+	stakingTxBucket := tx.ReadWriteBucket(stakingTxBucketName)
+	if stakingTxBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	maybeStakingTx := stakingTxBucket.Get(stakingHashBytes)
+	if maybeStakingTx == nil {
+		return ErrTransactionNotFound
+	}
+	var storedTxProto proto.StakingTransaction
+	if err := pm.Unmarshal(maybeStakingTx, &storedTxProto); err != nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	if storedTxProto.Status != proto.StakingStatus_STAKING_STATUS_WITHDRAWN {
+		storedTxProto.Status = proto.StakingStatus_STAKING_STATUS_UNBONDING
+		marshalledStakingTx, err := pm.Marshal(&storedTxProto)
+		if err != nil {
+			return err
+		}
+		if err := stakingTxBucket.Put(stakingHashBytes, marshalledStakingTx); err != nil {
+			return err
+		}
+	}
+
+	// if the staking tx is an overflow, we don't decrement the confirmed tvl,
+	// the total score, and the active stakes of the staker and the finality
+	// provider as they were never added
+	if storedTxProto.IsOverflow {
+		return nil
+	}
+
+	if err := is.subtractActiveStakes(
+		tx, storedTxProto.StakerPk, storedTxProto.FinalityProviderPk, storedTxProto.StakingValue,
+	); err != nil {
+		return err
+	}
+
+	if err := is.subtractTotalScore(tx, storedTxProto.Score); err != nil {
+		return err
+	}
+
+	return is.subtractConfirmedTvl(
+		tx, storedTxProto.StakingValue,
+	)
+}
+
+// GetUnbondingTransaction retrieves the stored unbonding transaction by the given hash
+// it returns (nil, nil) if the transaction is not found
+func (is *IndexerStore) GetUnbondingTransaction(txHash *chainhash.Hash) (*StoredUnbondingTransaction, error) {
+	var storedTx *StoredUnbondingTransaction
+	txHashBytes := txHash.CloneBytes()
+
+	err := is.view(func(tx kvdb.RTx) error {
+		txBucket := tx.ReadBucket(unbondingTxBucketName)
+		if txBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		maybeTx := txBucket.Get(txHashBytes)
+		if maybeTx == nil {
+			return ErrTransactionNotFound
+		}
+
+		var storedTxProto proto.UnbondingTransaction
+		if err := pm.Unmarshal(maybeTx, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		txFromDb, err := protoUnbondingTxToStoredUnbondingTx(&storedTxProto)
+		if err != nil {
+			return err
+		}
+
+		storedTx = txFromDb
+		return nil
+	}, func() {})
+
+	if err != nil && !errors.Is(err, ErrTransactionNotFound) {
+		return nil, err
+	}
+
+	return storedTx, nil
+}
+
+// GetUnbondingWithStaking retrieves the stored unbonding transaction by the
+// given hash along with the stored staking transaction it spends in a single
+// read, it returns (nil, nil, nil) if the unbonding transaction is not found
+func (is *IndexerStore) GetUnbondingWithStaking(
+	unbondingTxHash *chainhash.Hash,
+) (*StoredUnbondingTransaction, *StoredStakingTransaction, error) {
+	var (
+		storedUnbondingTx *StoredUnbondingTransaction
+		storedStakingTx   *StoredStakingTransaction
+	)
+
+	err := is.view(func(tx kvdb.RTx) error {
+		unbondingTxBucket := tx.ReadBucket(unbondingTxBucketName)
+		if unbondingTxBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		maybeUnbondingTx := unbondingTxBucket.Get(unbondingTxHash[:])
+		if maybeUnbondingTx == nil {
+			return ErrTransactionNotFound
+		}
+
+		var unbondingTxProto proto.UnbondingTransaction
+		if err := pm.Unmarshal(maybeUnbondingTx, &unbondingTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		unbondingTxFromDb, err := protoUnbondingTxToStoredUnbondingTx(&unbondingTxProto)
+		if err != nil {
+			return err
+		}
+
+		stakingTxBucket := tx.ReadBucket(stakingTxBucketName)
+		if stakingTxBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		maybeStakingTx := stakingTxBucket.Get(unbondingTxFromDb.StakingTxHash[:])
+		if maybeStakingTx == nil {
+			// the unbonding txs are stored only if their staking txs are
+			return ErrCorruptedTransactionsDb
+		}
+
+		var stakingTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(maybeStakingTx, &stakingTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		stakingTxFromDb, err := protoStakingTxToStoredStakingTx(&stakingTxProto)
+		if err != nil {
+			return err
+		}
+
+		storedUnbondingTx = unbondingTxFromDb
+		storedStakingTx = stakingTxFromDb
+		return nil
+	}, func() {
+		storedUnbondingTx = nil
+		storedStakingTx = nil
+	})
+
+	if err != nil && !errors.Is(err, ErrTransactionNotFound) {
+		return nil, nil, err
+	}
+
+	return storedUnbondingTx, storedStakingTx, nil
+}
+
+// indexStakingUnbonding records the unbonding tx spending the staking tx
+func indexStakingUnbonding(tx kvdb.RwTx, stakingHashBytes, unbondingHashBytes []byte) error {
+	indexBucket := tx.ReadWriteBucket(stakingUnbondingIndexBucketName)
+	if indexBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	return indexBucket.Put(stakingHashBytes, unbondingHashBytes)
+}
+
+// GetUnbondingTransactionByStakingTxHash retrieves the stored unbonding
+// transaction spending the staking transaction of the given hash
+// it returns (nil, nil) if the staking transaction is not unbonded
+func (is *IndexerStore) GetUnbondingTransactionByStakingTxHash(stakingTxHash *chainhash.Hash) (*StoredUnbondingTransaction, error) {
+	var storedTx *StoredUnbondingTransaction
+
+	err := is.view(func(tx kvdb.RTx) error {
+		indexBucket := tx.ReadBucket(stakingUnbondingIndexBucketName)
+		if indexBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		unbondingHashBytes := indexBucket.Get(stakingTxHash[:])
+		if unbondingHashBytes == nil {
+			return ErrTransactionNotFound
+		}
+
+		txBucket := tx.ReadBucket(unbondingTxBucketName)
+		if txBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		maybeTx := txBucket.Get(unbondingHashBytes)
+		if maybeTx == nil {
+			// the index should be consistent with the unbonding txs
+			return ErrCorruptedTransactionsDb
+		}
+
+		var storedTxProto proto.UnbondingTransaction
+		if err := pm.Unmarshal(maybeTx, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		txFromDb, err := protoUnbondingTxToStoredUnbondingTx(&storedTxProto)
+		if err != nil {
+			return err
+		}
+
+		storedTx = txFromDb
+		return nil
+	}, func() {
+		storedTx = nil
+	})
+
+	if err != nil && !errors.Is(err, ErrTransactionNotFound) {
+		return nil, err
+	}
+
+	return storedTx, nil
+}
+
+func (is *IndexerStore) TxExists(txHash *chainhash.Hash) (bool, error) {
+	txHashBytes := txHash.CloneBytes()
+
+	existed := false
+
+	err := is.view(func(tx kvdb.RTx) error {
+		stakingTxBucket := tx.ReadBucket(stakingTxBucketName)
+		if stakingTxBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		maybeTx := stakingTxBucket.Get(txHashBytes)
+		if maybeTx != nil {
+			existed = true
+			return nil
+		}
+
+		unbondingTxBucket := tx.ReadBucket(unbondingTxBucketName)
+		if unbondingTxBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		maybeTx = unbondingTxBucket.Get(txHashBytes)
+		if maybeTx != nil {
+			existed = true
+			return nil
+		}
+
+		return nil
+	}, func() {})
+
+	if err != nil {
+		return false, err
+	}
+
+	return existed, nil
+}
+
+func protoUnbondingTxToStoredUnbondingTx(protoTx *proto.UnbondingTransaction) (*StoredUnbondingTransaction, error) {
+	var unbondingTx wire.MsgTx
+	err := unbondingTx.Deserialize(bytes.NewReader(protoTx.TransactionBytes))
+	if err != nil {
+		return nil, fmt.Errorf("invalid unbonding tx: %w", err)
+	}
+
+	stakingTxHash, err := chainhash.NewHash(protoTx.StakingTxHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid staking tx hash")
+	}
+
+	return &StoredUnbondingTransaction{
+		Tx:                 &unbondingTx,
+		StakingTxHash:      stakingTxHash,
+		InclusionHeight:    protoTx.InclusionHeight,
+		InclusionTimestamp: protoTx.InclusionTimestamp,
+	}, nil
+}
+
+func getConfirmedTvlKey() []byte {
+	return []byte("confirmedtvl")
+}
+
+// incrementConfirmedTvl increments the confirmed tvl
+func (is *IndexerStore) incrementConfirmedTvl(
+	tx kvdb.RwTx, tvlIncrement uint64,
+) error {
+	tvlBucket := tx.ReadWriteBucket(confirmedTvlBucketName)
+	key := getConfirmedTvlKey()
+	if tvlBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	currentTvl := tvlBucket.Get(key)
+	var confirmedTvl uint64
+	if currentTvl != nil {
+		var err error
+		confirmedTvl, err = uint64FromBytes(currentTvl)
+		if err != nil {
+			return err
+		}
+	}
+
+	newTvl, err := utils.AddUint64(confirmedTvl, tvlIncrement)
+	if err != nil {
+		return fmt.Errorf("failed to increment the confirmed tvl: %w", err)
+	}
+	newTvlBytes := uint64ToBytes(newTvl)
+
+	return tvlBucket.Put(key, newTvlBytes)
+}
+
+// SubtractConfirmedTvl subtracts the confirmed tvl
+func (is *IndexerStore) subtractConfirmedTvl(
+	tx kvdb.RwTx, tvlSubtract uint64,
+) error {
+	key := getConfirmedTvlKey()
+	tvlBucket := tx.ReadWriteBucket(confirmedTvlBucketName)
+	if tvlBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	currentTvl := tvlBucket.Get(key)
+	if currentTvl == nil {
+		// This should never happen, return an error
+		return ErrCorruptedStateDb
+	}
+	confirmedTvl, err := uint64FromBytes(currentTvl)
+	if err != nil {
+		return err
+	}
+
+	if tvlSubtract > confirmedTvl {
+		return ErrNegativeTvl
+	}
+
+	newTvlBytes := uint64ToBytes(confirmedTvl - tvlSubtract)
+
+	return tvlBucket.Put(key, newTvlBytes)
+}
+
+// GetConfirmedTvl returns the confirmed tvl
+func (is *IndexerStore) GetConfirmedTvl() (uint64, error) {
+	key := getConfirmedTvlKey()
+
+	var confirmedTvl uint64
+	err := is.view(func(tx kvdb.RTx) error {
+		tvlBucket := tx.ReadBucket(confirmedTvlBucketName)
+		if tvlBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		v := tvlBucket.Get(key)
+		if v == nil {
+			// This could happen if the indexer is started for the first time
+			confirmedTvl = 0
+			return nil
+		}
+
+		tvl, err := uint64FromBytes(v)
+		if err != nil {
+			return err
+		}
+
+		confirmedTvl = tvl
+
+		return nil
+	}, func() {})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return confirmedTvl, nil
+}
+
+func getTotalScoreKey() []byte {
+	return []byte("totalscore")
+}
+
+// incrementTotalScore increments the total score of the active staking txs
+func (is *IndexerStore) incrementTotalScore(
+	tx kvdb.RwTx, scoreIncrement uint64,
+) error {
+	scoreBucket := tx.ReadWriteBucket(confirmedTvlBucketName)
+	if scoreBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	var totalScore uint64
+	if currentScore := scoreBucket.Get(getTotalScoreKey()); currentScore != nil {
+		var err error
+		totalScore, err = uint64FromBytes(currentScore)
+		if err != nil {
+			return err
+		}
+	}
+
+	newTotalScore, err := utils.AddUint64(totalScore, scoreIncrement)
+	if err != nil {
+		return fmt.Errorf("failed to increment the total score: %w", err)
+	}
+
+	return scoreBucket.Put(getTotalScoreKey(), uint64ToBytes(newTotalScore))
+}
+
+// subtractTotalScore subtracts the total score of the active staking txs
+func (is *IndexerStore) subtractTotalScore(
+	tx kvdb.RwTx, scoreSubtract uint64,
+) error {
+	scoreBucket := tx.ReadWriteBucket(confirmedTvlBucketName)
+	if scoreBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	currentScore := scoreBucket.Get(getTotalScoreKey())
+	if currentScore == nil {
+		// This should never happen, return an error
+		return ErrCorruptedStateDb
+	}
+	totalScore, err := uint64FromBytes(currentScore)
+	if err != nil {
+		return err
+	}
+
+	if scoreSubtract > totalScore {
+		return ErrNegativeScore
+	}
+
+	return scoreBucket.Put(getTotalScoreKey(), uint64ToBytes(totalScore-scoreSubtract))
+}
+
+// GetTotalScore returns the total score of the active staking txs
+func (is *IndexerStore) GetTotalScore() (uint64, error) {
+	var totalScore uint64
+	err := is.view(func(tx kvdb.RTx) error {
+		scoreBucket := tx.ReadBucket(confirmedTvlBucketName)
+		if scoreBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		v := scoreBucket.Get(getTotalScoreKey())
+		if v == nil {
+			totalScore = 0
+			return nil
+		}
+
+		score, err := uint64FromBytes(v)
+		if err != nil {
+			return err
+		}
+
+		totalScore = score
+
+		return nil
+	}, func() {})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return totalScore, nil
+}
+
+// incrementActiveStakes increments the active stakes of the given staker
+// and finality provider
+func (is *IndexerStore) incrementActiveStakes(
+	tx kvdb.RwTx, stakerPkBytes, fpPkBytes []byte, stakeIncrement uint64,
+) error {
+	if err := is.incrementActiveStake(tx, stakerActiveStakeBucketName, stakerPkBytes, stakeIncrement); err != nil {
+		return fmt.Errorf("failed to increment the active stake of the staker: %w", err)
+	}
+
+	if err := is.incrementActiveStake(tx, fpActiveStakeBucketName, fpPkBytes, stakeIncrement); err != nil {
+		return fmt.Errorf("failed to increment the active stake of the finality provider: %w", err)
+	}
+
+	return nil
+}
+
+// subtractActiveStakes subtracts the active stakes of the given staker and
+// finality provider
+func (is *IndexerStore) subtractActiveStakes(
+	tx kvdb.RwTx, stakerPkBytes, fpPkBytes []byte, stakeSubtract uint64,
+) error {
+	if err := is.subtractActiveStake(tx, stakerActiveStakeBucketName, stakerPkBytes, stakeSubtract); err != nil {
+		return err
+	}
+
+	return is.subtractActiveStake(tx, fpActiveStakeBucketName, fpPkBytes, stakeSubtract)
+}
+
+// incrementActiveStake increments the active stake of the given pk in the
+// given bucket
+func (is *IndexerStore) incrementActiveStake(
+	tx kvdb.RwTx, bucketName, pkBytes []byte, stakeIncrement uint64,
+) error {
+	stakeBucket := tx.ReadWriteBucket(bucketName)
+	if stakeBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	var activeStake uint64
+	if currentStake := stakeBucket.Get(pkBytes); currentStake != nil {
+		var err error
+		activeStake, err = uint64FromBytes(currentStake)
+		if err != nil {
+			return err
+		}
+	}
+
+	newActiveStake, err := utils.AddUint64(activeStake, stakeIncrement)
+	if err != nil {
+		return err
+	}
+
+	return stakeBucket.Put(pkBytes, uint64ToBytes(newActiveStake))
+}
+
+// subtractActiveStake subtracts the active stake of the given pk in the
+// given bucket
+func (is *IndexerStore) subtractActiveStake(
+	tx kvdb.RwTx, bucketName, pkBytes []byte, stakeSubtract uint64,
+) error {
+	stakeBucket := tx.ReadWriteBucket(bucketName)
+	if stakeBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	currentStake := stakeBucket.Get(pkBytes)
+	if currentStake == nil {
+		// This should never happen, return an error
+		return ErrCorruptedStateDb
+	}
+	activeStake, err := uint64FromBytes(currentStake)
+	if err != nil {
+		return err
+	}
+
+	if stakeSubtract > activeStake {
+		return ErrNegativeTvl
+	}
+
+	return stakeBucket.Put(pkBytes, uint64ToBytes(activeStake-stakeSubtract))
+}
+
+// GetStakerActiveStake returns the amount actively staked by the given staker
+func (is *IndexerStore) GetStakerActiveStake(stakerPk *btcec.PublicKey) (uint64, error) {
+	return is.getActiveStake(stakerActiveStakeBucketName, stakerPk)
+}
+
+// GetFinalityProviderActiveStake returns the amount actively staked to the
+// given finality provider
+func (is *IndexerStore) GetFinalityProviderActiveStake(fpPk *btcec.PublicKey) (uint64, error) {
+	return is.getActiveStake(fpActiveStakeBucketName, fpPk)
+}
+
+func (is *IndexerStore) getActiveStake(bucketName []byte, pk *btcec.PublicKey) (uint64, error) {
+	key := schnorr.SerializePubKey(pk)
+
+	var activeStake uint64
+	err := is.view(func(tx kvdb.RTx) error {
+		stakeBucket := tx.ReadBucket(bucketName)
+		if stakeBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		v := stakeBucket.Get(key)
+		if v == nil {
+			// the pk has no active stake
+			activeStake = 0
+			return nil
+		}
+
+		stake, err := uint64FromBytes(v)
+		if err != nil {
+			return err
+		}
+
+		activeStake = stake
+
+		return nil
+	}, func() {})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return activeStake, nil
+}
+
+func getTotalWithdrawnValueKey() []byte {
+	return []byte("totalwithdrawnvalue")
+}
+
+// AddWithdrawalTransaction records the withdrawal of the given staking tx by
+// the withdrawal tx of the given hash included at the given height, which
+// spends the given staking or unbonding outpoint, and adds the withdrawn value
+// to the total withdrawn value. It returns ErrDuplicateTransaction if the
+// withdrawal of the staking tx is already recorded, and
+// ErrStakingOutputAlreadySpent if another tx is known to spend the outpoint
+func (is *IndexerStore) AddWithdrawalTransaction(
+	stakingTxHash *chainhash.Hash,
+	withdrawalTxHash *chainhash.Hash,
+	spentOutpoint *wire.OutPoint,
+	withdrawnValue uint64,
+	height uint64,
+	timestamp int64,
+) error {
+	key := getTotalWithdrawnValueKey()
+
+	marshalled, err := pm.Marshal(&proto.WithdrawnStakingTransaction{
+		WithdrawnValue: withdrawnValue,
+		Height:         height,
+		Timestamp:      timestamp,
+	})
+	if err != nil {
+		return err
+	}
+
+	return is.batch(func(tx kvdb.RwTx) error {
+		withdrawnBucket := tx.ReadWriteBucket(withdrawnStakingTxBucketName)
+		if withdrawnBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		// a staking tx can only be withdrawn once
+		if withdrawnBucket.Get(stakingTxHash[:]) != nil {
+			return ErrDuplicateTransaction
+		}
+
+		if err := withdrawnBucket.Put(stakingTxHash[:], marshalled); err != nil {
+			return err
+		}
+
+		if err := indexSpendingTx(tx, spentOutpoint, withdrawalTxHash[:]); err != nil {
+			return err
+		}
+
+		if err := indexHeight(
+			tx, heightIndexWithdrawalBucketName, height, stakingTxHash[:],
+		); err != nil {
+			return err
+		}
+
+		if err := setStakingStatus(
+			tx, stakingTxHash[:], proto.StakingStatus_STAKING_STATUS_WITHDRAWN,
+		); err != nil {
+			return err
+		}
+
+		stateBucket := tx.ReadWriteBucket(indexerStateBucketName)
+		if stateBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		var totalWithdrawnValue uint64
+		if v := stateBucket.Get(key); v != nil {
+			var err error
+			totalWithdrawnValue, err = uint64FromBytes(v)
+			if err != nil {
+				return err
+			}
+		}
+
+		newTotalWithdrawnValue, err := utils.AddUint64(totalWithdrawnValue, withdrawnValue)
+		if err != nil {
+			return fmt.Errorf("failed to add the withdrawn value: %w", err)
+		}
+
+		return stateBucket.Put(key, uint64ToBytes(newTotalWithdrawnValue))
+	})
+}
+
+// setStakingStatus sets the lifecycle status of the stored staking tx of the
+// given hash, it does nothing if the staking tx is not found
+func setStakingStatus(tx kvdb.RwTx, stakingHashBytes []byte, status proto.StakingStatus) error {
+	txBucket := tx.ReadWriteBucket(stakingTxBucketName)
+	if txBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	maybeTx := txBucket.Get(stakingHashBytes)
+	if maybeTx == nil {
+		return nil
 	}
 
-	return &StoredStakingTransaction{
-		Tx:                 &stakingTx,
-		StakingOutputIdx:   protoTx.StakingOutputIdx,
-		InclusionHeight:    protoTx.InclusionHeight,
-		StakerPk:           stakerPk,
-		StakingTime:        protoTx.StakingTime,
-		FinalityProviderPk: fpPk,
-		IsOverflow:         protoTx.IsOverflow,
-		StakingValue:       protoTx.StakingValue,
-	}, nil
-}
+	var storedTxProto proto.StakingTransaction
+	if err := pm.Unmarshal(maybeTx, &storedTxProto); err != nil {
+		return ErrCorruptedTransactionsDb
+	}
 
-func (is *IndexerStore) AddUnbondingTransaction(
-	tx *wire.MsgTx,
-	stakingTxHash *chainhash.Hash,
-) error {
-	txHash := tx.TxHash()
-	serializedTx, err := utils.SerializeBtcTransaction(tx)
+	storedTxProto.Status = status
 
+	marshalled, err := pm.Marshal(&storedTxProto)
 	if err != nil {
 		return err
 	}
 
-	stakingTxHashBytes := stakingTxHash.CloneBytes()
-	msg := proto.UnbondingTransaction{
-		TransactionBytes: serializedTx,
-		StakingTxHash:    stakingTxHash.CloneBytes(),
-	}
-
-	return is.addUnbondingTransaction(txHash[:], stakingTxHashBytes, &msg)
+	return txBucket.Put(stakingHashBytes, marshalled)
 }
 
-func (is *IndexerStore) addUnbondingTransaction(
-	txHashBytes []byte,
-	stakingHashBytes []byte,
-	ut *proto.UnbondingTransaction,
-) error {
-	return kvdb.Batch(is.db, func(tx kvdb.RwTx) error {
-		stakingTxBucket := tx.ReadWriteBucket(stakingTxBucketName)
-		if stakingTxBucket == nil {
+// OverrideEligibility manually sets whether the staking tx of the given hash
+// is overflow and the inactive reason at the given unix timestamp, and marks
+// its eligibility as overridden, keeping the eligibility of the staking tx
+// when it is included if it is overridden the first time. The confirmed TVL, the total score, and the active stake of
+// the staker are adjusted if the eligibility changes, unless the staking tx
+// is already unbonded. It returns the staking tx before the override, or
+// ErrTransactionNotFound if the staking tx is not found
+func (is *IndexerStore) OverrideEligibility(
+	txHash *chainhash.Hash,
+	isOverflow bool,
+	inactiveReason InactiveReason,
+	timestamp int64,
+) (*StoredStakingTransaction, error) {
+	var previous *StoredStakingTransaction
+
+	err := is.batch(func(tx kvdb.RwTx) error {
+		txBucket := tx.ReadWriteBucket(stakingTxBucketName)
+		if txBucket == nil {
 			return ErrCorruptedTransactionsDb
 		}
 
-		// we need to ensure the staking tx already exists
-		maybeStakingTx := stakingTxBucket.Get(stakingHashBytes)
-		if maybeStakingTx == nil {
+		maybeTx := txBucket.Get(txHash[:])
+		if maybeTx == nil {
 			return ErrTransactionNotFound
 		}
-		// parse it, make sure it's valid
+
 		var storedTxProto proto.StakingTransaction
-		if err := pm.Unmarshal(maybeStakingTx, &storedTxProto); err != nil {
+		if err := pm.Unmarshal(maybeTx, &storedTxProto); err != nil {
 			return ErrCorruptedTransactionsDb
 		}
 
-		unbondingTxBucket := tx.ReadWriteBucket(unbondingTxBucketName)
-		if unbondingTxBucket == nil {
-			return ErrCorruptedTransactionsDb
+		storedTx, err := protoStakingTxToStoredStakingTx(&storedTxProto)
+		if err != nil {
+			return err
 		}
+		previous = storedTx
 
-		// check duplicate
-		maybeTx := unbondingTxBucket.Get(txHashBytes)
-		if maybeTx != nil {
-			return ErrDuplicateTransaction
+		wasOverflow := storedTxProto.IsOverflow
+		if !storedTxProto.EligibilityOverridden {
+			storedTxProto.OriginalIsOverflow = storedTxProto.IsOverflow
+			storedTxProto.OriginalInactiveReason = storedTxProto.InactiveReason
 		}
+		storedTxProto.IsOverflow = isOverflow
+		storedTxProto.InactiveReason = proto.InactiveReason(inactiveReason)
+		storedTxProto.EligibilityOverridden = true
+		storedTxProto.EligibilityOverriddenTimestamp = timestamp
 
-		marshalled, err := pm.Marshal(ut)
+		marshalled, err := pm.Marshal(&storedTxProto)
 		if err != nil {
 			return err
 		}
+		if err := txBucket.Put(txHash[:], marshalled); err != nil {
+			return err
+		}
 
-		err = unbondingTxBucket.Put(txHashBytes, marshalled)
+		if wasOverflow == isOverflow {
+			return nil
+		}
+
+		// the stake of an unbonded staking tx is already subtracted
+		// if it was active, and it is never added back. The stake of a
+		// staking tx of which the unbonding is pending is adjusted as
+		// for a staked one, as it is subtracted once the unbonding is
+		// applied by the overridden eligibility
+		unbonded, err := isUnbondingApplied(tx, txHash[:])
 		if err != nil {
 			return err
 		}
-
-		// if the staking tx is an overflow, we don't decrement the confirmed tvl
-		// as it was never added
-		if storedTxProto.IsOverflow {
+		if unbonded {
 			return nil
 		}
 
-		return is.subtractConfirmedTvl(
-			tx, storedTxProto.StakingValue,
-		)
+		if isOverflow {
+			if err := is.subtractActiveStakes(
+				tx, storedTxProto.StakerPk, storedTxProto.FinalityProviderPk, storedTxProto.StakingValue,
+			); err != nil {
+				return err
+			}
+
+			if err := is.subtractTotalScore(tx, storedTxProto.Score); err != nil {
+				return err
+			}
+
+			return is.subtractConfirmedTvl(tx, storedTxProto.StakingValue)
+		}
+
+		if err := is.incrementActiveStakes(
+			tx, storedTxProto.StakerPk, storedTxProto.FinalityProviderPk, storedTxProto.StakingValue,
+		); err != nil {
+			return err
+		}
+
+		if err := is.incrementTotalScore(tx, storedTxProto.Score); err != nil {
+			return err
+		}
+
+		return is.incrementConfirmedTvl(tx, storedTxProto.StakingValue)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return previous, nil
 }
 
-// GetUnbondingTransaction retrieves the stored unbonding transaction by the given hash
-// it returns (nil, nil) if the transaction is not found
-func (is *IndexerStore) GetUnbondingTransaction(txHash *chainhash.Hash) (*StoredUnbondingTransaction, error) {
-	var storedTx *StoredUnbondingTransaction
-	txHashBytes := txHash.CloneBytes()
+// GetWithdrawnStakingTransaction retrieves the recorded withdrawal of the
+// staking transaction of the given hash
+// it returns (nil, nil) if the staking transaction is not withdrawn
+func (is *IndexerStore) GetWithdrawnStakingTransaction(stakingTxHash *chainhash.Hash) (*StoredWithdrawnStakingTransaction, error) {
+	var withdrawn *StoredWithdrawnStakingTransaction
 
-	err := is.db.View(func(tx kvdb.RTx) error {
-		txBucket := tx.ReadBucket(unbondingTxBucketName)
-		if txBucket == nil {
+	err := is.view(func(tx kvdb.RTx) error {
+		withdrawnBucket := tx.ReadBucket(withdrawnStakingTxBucketName)
+		if withdrawnBucket == nil {
 			return ErrCorruptedTransactionsDb
 		}
 
-		maybeTx := txBucket.Get(txHashBytes)
-		if maybeTx == nil {
-			return ErrTransactionNotFound
+		v := withdrawnBucket.Get(stakingTxHash[:])
+		if v == nil {
+			return nil
 		}
 
-		var storedTxProto proto.UnbondingTransaction
-		if err := pm.Unmarshal(maybeTx, &storedTxProto); err != nil {
+		var withdrawnProto proto.WithdrawnStakingTransaction
+		if err := pm.Unmarshal(v, &withdrawnProto); err != nil {
 			return ErrCorruptedTransactionsDb
 		}
 
-		txFromDb, err := protoUnbondingTxToStoredUnbondingTx(&storedTxProto)
-		if err != nil {
-			return err
+		withdrawn = &StoredWithdrawnStakingTransaction{
+			WithdrawnValue: withdrawnProto.WithdrawnValue,
+			Height:         withdrawnProto.Height,
+			Timestamp:      withdrawnProto.Timestamp,
 		}
 
-		storedTx = txFromDb
 		return nil
-	}, func() {})
+	}, func() {
+		withdrawn = nil
+	})
 
-	if err != nil && !errors.Is(err, ErrTransactionNotFound) {
+	if err != nil {
 		return nil, err
 	}
 
-	return storedTx, nil
+	return withdrawn, nil
 }
 
-func (is *IndexerStore) TxExists(txHash *chainhash.Hash) (bool, error) {
-	txHashBytes := txHash.CloneBytes()
-
-	existed := false
+// GetTotalWithdrawnValue returns the total staking value of all the
+// withdrawn staking txs, whether they are withdrawn from the staking or
+// the unbonding output
+func (is *IndexerStore) GetTotalWithdrawnValue() (btcutil.Amount, error) {
+	key := getTotalWithdrawnValueKey()
 
-	err := is.db.View(func(tx kvdb.RTx) error {
-		stakingTxBucket := tx.ReadBucket(stakingTxBucketName)
-		if stakingTxBucket == nil {
-			return ErrCorruptedTransactionsDb
+	var totalWithdrawnValue uint64
+	err := is.view(func(tx kvdb.RTx) error {
+		stateBucket := tx.ReadBucket(indexerStateBucketName)
+		if stateBucket == nil {
+			return ErrCorruptedStateDb
 		}
 
-		maybeTx := stakingTxBucket.Get(txHashBytes)
-		if maybeTx != nil {
-			existed = true
+		v := stateBucket.Get(key)
+		if v == nil {
+			// nothing has been withdrawn yet
+			totalWithdrawnValue = 0
 			return nil
 		}
 
-		unbondingTxBucket := tx.ReadBucket(unbondingTxBucketName)
-		if unbondingTxBucket == nil {
-			return ErrCorruptedTransactionsDb
+		value, err := uint64FromBytes(v)
+		if err != nil {
+			return err
 		}
 
-		maybeTx = unbondingTxBucket.Get(txHashBytes)
-		if maybeTx != nil {
-			existed = true
-			return nil
-		}
+		totalWithdrawnValue = value
 
 		return nil
 	}, func() {})
 
 	if err != nil {
-		return false, err
+		return 0, err
 	}
 
-	return existed, nil
+	return utils.AmountFromUint64(totalWithdrawnValue)
 }
 
-func protoUnbondingTxToStoredUnbondingTx(protoTx *proto.UnbondingTransaction) (*StoredUnbondingTransaction, error) {
-	var unbondingTx wire.MsgTx
-	err := unbondingTx.Deserialize(bytes.NewReader(protoTx.TransactionBytes))
+// GetStakingValueStats returns the minimum, maximum, and mean (rounded down)
+// staking values of all the stored staking txs along with their count,
+// computed in a single iteration over the staking txs. The values are all 0
+// if there is no staking tx
+func (is *IndexerStore) GetStakingValueStats() (min, max, mean btcutil.Amount, count int, err error) {
+	var minValue, maxValue, totalValue uint64
+	var numTxs int
+
+	err = is.view(func(tx kvdb.RTx) error {
+		txBucket := tx.ReadBucket(stakingTxBucketName)
+		if txBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		return txBucket.ForEach(func(_, v []byte) error {
+			var storedTxProto proto.StakingTransaction
+			if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			value := storedTxProto.StakingValue
+			if numTxs == 0 || value < minValue {
+				minValue = value
+			}
+			if value > maxValue {
+				maxValue = value
+			}
+			sum, err := utils.AddUint64(totalValue, value)
+			if err != nil {
+				return err
+			}
+			totalValue = sum
+			numTxs++
+
+			return nil
+		})
+	}, func() {
+		minValue, maxValue, totalValue = 0, 0, 0
+		numTxs = 0
+	})
+
 	if err != nil {
-		return nil, fmt.Errorf("invalid unbonding tx: %w", err)
+		return 0, 0, 0, 0, err
 	}
 
-	stakingTxHash, err := chainhash.NewHash(protoTx.StakingTxHash)
-	if err != nil {
-		return nil, fmt.Errorf("invalid staking tx hash")
+	if numTxs == 0 {
+		return 0, 0, 0, 0, nil
 	}
 
-	return &StoredUnbondingTransaction{
-		Tx:            &unbondingTx,
-		StakingTxHash: stakingTxHash,
-	}, nil
+	return btcutil.Amount(minValue), btcutil.Amount(maxValue),
+		btcutil.Amount(totalValue / uint64(numTxs)), numTxs, nil
 }
 
-func getConfirmedTvlKey() []byte {
-	return []byte("confirmedtvl")
-}
+// GetStakingTxCountsByInactiveReason returns the number of the stored
+// staking txs per inactive reason, in which the active ones are counted
+// under InactiveReasonNone
+func (is *IndexerStore) GetStakingTxCountsByInactiveReason() (map[InactiveReason]int, error) {
+	counts := make(map[InactiveReason]int)
 
-// incrementConfirmedTvl increments the confirmed tvl
-func (is *IndexerStore) incrementConfirmedTvl(
-	tx kvdb.RwTx, tvlIncrement uint64,
-) error {
-	tvlBucket := tx.ReadWriteBucket(confirmedTvlBucketName)
-	key := getConfirmedTvlKey()
-	if tvlBucket == nil {
-		return ErrCorruptedStateDb
+	err := is.view(func(tx kvdb.RTx) error {
+		txBucket := tx.ReadBucket(stakingTxBucketName)
+		if txBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		return txBucket.ForEach(func(_, v []byte) error {
+			var storedTxProto proto.StakingTransaction
+			if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			counts[InactiveReason(storedTxProto.InactiveReason)]++
+
+			return nil
+		})
+	}, func() {
+		counts = make(map[InactiveReason]int)
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	currentTvl := tvlBucket.Get(key)
-	var confirmedTvl uint64
-	if currentTvl != nil {
+	return counts, nil
+}
+
+// GetRecordCounts returns the number of the stored staking txs, unbonding
+// txs, and withdrawals
+func (is *IndexerStore) GetRecordCounts() (stakingCount, unbondingCount, withdrawalCount int, err error) {
+	err = is.view(func(tx kvdb.RTx) error {
 		var err error
-		confirmedTvl, err = uint64FromBytes(currentTvl)
+		stakingCount, err = countKeys(tx, stakingTxBucketName)
 		if err != nil {
 			return err
 		}
-	}
 
-	newTvl := confirmedTvl + tvlIncrement
-	newTvlBytes := uint64ToBytes(newTvl)
+		unbondingCount, err = countKeys(tx, unbondingTxBucketName)
+		if err != nil {
+			return err
+		}
 
-	return tvlBucket.Put(key, newTvlBytes)
-}
+		withdrawalCount, err = countKeys(tx, withdrawnStakingTxBucketName)
 
-// SubtractConfirmedTvl subtracts the confirmed tvl
-func (is *IndexerStore) subtractConfirmedTvl(
-	tx kvdb.RwTx, tvlSubtract uint64,
-) error {
-	key := getConfirmedTvlKey()
-	tvlBucket := tx.ReadWriteBucket(confirmedTvlBucketName)
-	if tvlBucket == nil {
-		return ErrCorruptedStateDb
-	}
+		return err
+	}, func() {
+		stakingCount, unbondingCount, withdrawalCount = 0, 0, 0
+	})
 
-	currentTvl := tvlBucket.Get(key)
-	if currentTvl == nil {
-		// This should never happen, return an error
-		return ErrCorruptedStateDb
-	}
-	confirmedTvl, err := uint64FromBytes(currentTvl)
 	if err != nil {
-		return err
+		return 0, 0, 0, err
 	}
 
-	if tvlSubtract > confirmedTvl {
-		return ErrNegativeTvl
+	return stakingCount, unbondingCount, withdrawalCount, nil
+}
+
+// countKeys returns the number of the keys in the given top level bucket
+// without decoding the values
+func countKeys(tx kvdb.RTx, bucketName []byte) (int, error) {
+	bucket := tx.ReadBucket(bucketName)
+	if bucket == nil {
+		return 0, ErrCorruptedTransactionsDb
 	}
 
-	newTvlBytes := uint64ToBytes(confirmedTvl - tvlSubtract)
+	var count int
+	c := bucket.ReadCursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		count++
+	}
 
-	return tvlBucket.Put(key, newTvlBytes)
+	return count, nil
 }
 
-// GetConfirmedTvl returns the confirmed tvl
-func (is *IndexerStore) GetConfirmedTvl() (uint64, error) {
-	key := getConfirmedTvlKey()
+// GetStakingTransactionsExpiringBetween returns the staking txs that are
+// still staked, i.e., neither unbonded nor withdrawn, and of which the
+// staking timelock expires at a height between the given heights, both
+// inclusive. The timelock of a staking tx expires at its inclusion height
+// plus its staking time. The staking txs of which the unbonding is pending
+// are excluded, as their stake is not to be withdrawn through the timelock
+func (is *IndexerStore) GetStakingTransactionsExpiringBetween(fromHeight, toHeight uint64) ([]*StoredStakingTransaction, error) {
+	var storedTxs []*StoredStakingTransaction
 
-	var confirmedTvl uint64
-	err := is.db.View(func(tx kvdb.RTx) error {
-		tvlBucket := tx.ReadBucket(confirmedTvlBucketName)
-		if tvlBucket == nil {
+	err := is.view(func(tx kvdb.RTx) error {
+		txBucket := tx.ReadBucket(stakingTxBucketName)
+		if txBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		unbondingIndexBucket := tx.ReadBucket(stakingUnbondingIndexBucketName)
+		if unbondingIndexBucket == nil {
 			return ErrCorruptedStateDb
 		}
 
-		v := tvlBucket.Get(key)
-		if v == nil {
-			// This could happen if the indexer is started for the first time
-			confirmedTvl = 0
+		return txBucket.ForEach(func(k, v []byte) error {
+			var storedTxProto proto.StakingTransaction
+			if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			// the staking tx stays staked while its unbonding is pending
+			if storedTxProto.Status != proto.StakingStatus_STAKING_STATUS_STAKED ||
+				unbondingIndexBucket.Get(k) != nil {
+				return nil
+			}
+
+			expiryHeight := storedTxProto.InclusionHeight + uint64(storedTxProto.StakingTime)
+			if expiryHeight < fromHeight || expiryHeight > toHeight {
+				return nil
+			}
+
+			storedTx, err := protoStakingTxToStoredStakingTx(&storedTxProto)
+			if err != nil {
+				return err
+			}
+			storedTxs = append(storedTxs, storedTx)
+
 			return nil
+		})
+	}, func() {
+		storedTxs = nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return storedTxs, nil
+}
+
+// ForEachStakingTransaction calls the given function with each stored
+// staking tx in the order of the tx hashes, along with whether the staking
+// tx is unbonded. A staking tx of which the unbonding is pending is not
+// unbonded until the unbonding is applied, as it is still staked. The
+// iteration stops at the first error returned by the function, which is
+// returned as is
+func (is *IndexerStore) ForEachStakingTransaction(f func(storedTx *StoredStakingTransaction, isUnbonded bool) error) error {
+	return is.view(func(tx kvdb.RTx) error {
+		txBucket := tx.ReadBucket(stakingTxBucketName)
+		if txBucket == nil {
+			return ErrCorruptedTransactionsDb
 		}
 
-		tvl, err := uint64FromBytes(v)
+		unbondingIndexBucket := tx.ReadBucket(stakingUnbondingIndexBucketName)
+		if unbondingIndexBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		pendingBucket := tx.ReadBucket(pendingUnbondingBucketName)
+		if pendingBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		// the pending unbondings are few, so that they are read once
+		// instead of being looked up for each staking tx
+		pendingStakingTxs := make(map[string]struct{})
+		err := pendingBucket.ForEach(func(_, v []byte) error {
+			pendingStakingTxs[string(v)] = struct{}{}
+			return nil
+		})
 		if err != nil {
 			return err
 		}
 
-		confirmedTvl = tvl
+		return txBucket.ForEach(func(k, v []byte) error {
+			var storedTxProto proto.StakingTransaction
+			if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
 
-		return nil
+			storedTx, err := protoStakingTxToStoredStakingTx(&storedTxProto)
+			if err != nil {
+				return err
+			}
+
+			_, isPending := pendingStakingTxs[string(k)]
+
+			return f(storedTx, unbondingIndexBucket.Get(k) != nil && !isPending)
+		})
 	}, func() {})
+}
+
+// ReadAllStakingTransactions returns all the stored staking txs in the order
+// of the tx hashes, which are read in a single db transaction into a slice
+// pre-sized to the number of the stored staking txs. It is meant for tools
+// that need every staking tx at once, e.g., offline analysis, as all the
+// parsed txs are held in memory, which takes a few times the serialized size
+// of the txs, i.e., in the order of 1 KB per tx or 1 GB per million txs.
+// ForEachStakingTransaction should be preferred otherwise
+func (is *IndexerStore) ReadAllStakingTransactions() ([]*StoredStakingTransaction, error) {
+	var storedTxs []*StoredStakingTransaction
+
+	err := is.view(func(tx kvdb.RTx) error {
+		txBucket := tx.ReadBucket(stakingTxBucketName)
+		if txBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		// counting the keys only walks the pages without
+		// unmarshalling the values
+		n := 0
+		c := txBucket.ReadCursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			n++
+		}
+
+		storedTxs = make([]*StoredStakingTransaction, 0, n)
+		return txBucket.ForEach(func(_, v []byte) error {
+			var storedTxProto proto.StakingTransaction
+			if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
 
+			storedTx, err := protoStakingTxToStoredStakingTx(&storedTxProto)
+			if err != nil {
+				return err
+			}
+			storedTxs = append(storedTxs, storedTx)
+
+			return nil
+		})
+	}, func() {
+		storedTxs = nil
+	})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return confirmedTvl, nil
+	return storedTxs, nil
 }
 
 func getLastProcessedHeightKey() []byte {
@@ -491,7 +2265,7 @@ func (is *IndexerStore) SaveLastProcessedHeight(height uint64) error {
 	key := getLastProcessedHeightKey()
 	heightBytes := uint64ToBytes(height)
 
-	return kvdb.Batch(is.db, func(tx kvdb.RwTx) error {
+	return is.batch(func(tx kvdb.RwTx) error {
 		stateBucket := tx.ReadWriteBucket(indexerStateBucketName)
 		if stateBucket == nil {
 			return ErrCorruptedStateDb
@@ -506,7 +2280,7 @@ func (is *IndexerStore) GetLastProcessedHeight() (uint64, error) {
 
 	var lastProcessedHeight uint64
 
-	err := is.db.View(func(tx kvdb.RTx) error {
+	err := is.view(func(tx kvdb.RTx) error {
 		stateBucket := tx.ReadBucket(indexerStateBucketName)
 		if stateBucket == nil {
 			return ErrCorruptedStateDb
@@ -533,17 +2307,3 @@ func (is *IndexerStore) GetLastProcessedHeight() (uint64, error) {
 
 	return lastProcessedHeight, nil
 }
-
-func uint64ToBytes(v uint64) []byte {
-	var buf [8]byte
-	binary.BigEndian.PutUint64(buf[:], v)
-	return buf[:]
-}
-
-func uint64FromBytes(b []byte) (uint64, error) {
-	if len(b) != 8 {
-		return 0, fmt.Errorf("invalid uint64 bytes length: %d", len(b))
-	}
-
-	return binary.BigEndian.Uint64(b), nil
-}
@@ -1,16 +1,27 @@
 package indexerstore_test
 
 import (
+	"bytes"
+	"encoding/hex"
+	"math"
 	"math/rand"
 	"testing"
 	"time"
 
 	bbndatagen "github.com/babylonlabs-io/babylon/testutil/datagen"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/stretchr/testify/require"
+	pm "google.golang.org/protobuf/proto"
 
 	"github.com/babylonlabs-io/staking-indexer/indexerstore"
+	"github.com/babylonlabs-io/staking-indexer/proto"
 	"github.com/babylonlabs-io/staking-indexer/testutils"
 	"github.com/babylonlabs-io/staking-indexer/testutils/datagen"
+	"github.com/babylonlabs-io/staking-indexer/utils"
 )
 
 func TestEmptyStore(t *testing.T) {
@@ -22,9 +33,16 @@ func TestEmptyStore(t *testing.T) {
 	stakingTx, err := s.GetStakingTransaction(&hash)
 	require.Nil(t, stakingTx)
 	require.NoError(t, err)
+	stakingTxBytes, err := s.GetStakingTransactionBytes(&hash)
+	require.Nil(t, stakingTxBytes)
+	require.NoError(t, err)
 	unbondingTx, err := s.GetUnbondingTransaction(&hash)
 	require.Nil(t, unbondingTx)
 	require.NoError(t, err)
+	unbondingTx, stakingTx, err = s.GetUnbondingWithStaking(&hash)
+	require.Nil(t, unbondingTx)
+	require.Nil(t, stakingTx)
+	require.NoError(t, err)
 }
 
 func FuzzStoringTxs(f *testing.F) {
@@ -41,16 +59,22 @@ func FuzzStoringTxs(f *testing.F) {
 		stakingtxs := datagen.GenNStoredStakingTxs(t, r, numTx, 200)
 
 		// add staking txs to store
+		expectedTotalScore := uint64(0)
 		for _, storedTx := range stakingtxs {
+			expectedTotalScore += storedTx.Score
 			err := s.AddStakingTransaction(
 				storedTx.Tx,
 				storedTx.StakingOutputIdx,
 				storedTx.InclusionHeight,
+				storedTx.InclusionTimestamp,
 				storedTx.StakerPk,
 				storedTx.StakingTime,
 				storedTx.FinalityProviderPk,
 				storedTx.StakingValue,
 				storedTx.IsOverflow,
+				storedTx.InactiveReason,
+				storedTx.OpReturnVersion,
+				storedTx.Score,
 			)
 			require.NoError(t, err)
 		}
@@ -64,12 +88,41 @@ func FuzzStoringTxs(f *testing.F) {
 			require.True(t, testutils.PubKeysEqual(storedTx.StakerPk, tx.StakerPk))
 			require.Equal(t, storedTx.StakingTime, tx.StakingTime)
 			require.True(t, testutils.PubKeysEqual(storedTx.FinalityProviderPk, tx.FinalityProviderPk))
+			require.Equal(t, storedTx.OpReturnVersion, tx.OpReturnVersion)
+			require.Equal(t, storedTx.Score, tx.Score)
+			require.Equal(t, storedTx.InclusionTimestamp, tx.InclusionTimestamp)
+
+			// the staking tx is not unbonded yet
+			unbondingTx, err := s.GetUnbondingTransactionByStakingTxHash(&hash)
+			require.NoError(t, err)
+			require.Nil(t, unbondingTx)
+
+			// the raw bytes should be the serialization of the stored tx
+			txBytes, err := s.GetStakingTransactionBytes(&hash)
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			err = tx.Tx.Serialize(&buf)
+			require.NoError(t, err)
+			require.Equal(t, buf.Bytes(), txBytes)
+
+			activeStake, err := s.GetStakerActiveStake(storedTx.StakerPk)
+			require.NoError(t, err)
+			require.Equal(t, storedTx.StakingValue, activeStake)
+			activeStake, err = s.GetFinalityProviderActiveStake(storedTx.FinalityProviderPk)
+			require.NoError(t, err)
+			require.Equal(t, storedTx.StakingValue, activeStake)
+
+			require.Equal(t, indexerstore.StakingStatusStaked, tx.Status)
 		}
 
+		totalScore, err := s.GetTotalScore()
+		require.NoError(t, err)
+		require.Equal(t, expectedTotalScore, totalScore)
+
 		// add unbonding txs to store
 		unbondingTxs := datagen.GenStoredUnbondingTxs(r, stakingtxs)
 		for _, storedTx := range unbondingTxs {
-			err := s.AddUnbondingTransaction(storedTx.Tx, storedTx.StakingTxHash)
+			err := s.AddUnbondingTransaction(storedTx.Tx, storedTx.StakingTxHash, storedTx.InclusionHeight, storedTx.InclusionTimestamp)
 			require.NoError(t, err)
 		}
 
@@ -80,20 +133,1063 @@ func FuzzStoringTxs(f *testing.F) {
 			require.NoError(t, err)
 			require.Equal(t, storedTx.Tx, tx.Tx)
 			require.True(t, storedTx.StakingTxHash.IsEqual(tx.StakingTxHash))
+			require.Equal(t, storedTx.InclusionHeight, tx.InclusionHeight)
+			require.Equal(t, storedTx.InclusionTimestamp, tx.InclusionTimestamp)
+
+			// the unbonding tx can be found by the staking tx
+			txByStakingTx, err := s.GetUnbondingTransactionByStakingTxHash(storedTx.StakingTxHash)
+			require.NoError(t, err)
+			require.Equal(t, hash, txByStakingTx.Tx.TxHash())
+
+			stakingTx, err := s.GetStakingTransaction(storedTx.StakingTxHash)
+			require.NoError(t, err)
+			require.Equal(t, indexerstore.StakingStatusUnbonding, stakingTx.Status)
+
+			// the joined lookup matches the separate lookups
+			joinedUnbondingTx, joinedStakingTx, err := s.GetUnbondingWithStaking(&hash)
+			require.NoError(t, err)
+			require.Equal(t, tx, joinedUnbondingTx)
+			require.Equal(t, stakingTx, joinedStakingTx)
 		}
 
+		// the unbonded stake should be subtracted from the active stakes
+		for _, storedTx := range stakingtxs {
+			activeStake, err := s.GetStakerActiveStake(storedTx.StakerPk)
+			require.NoError(t, err)
+			require.Zero(t, activeStake)
+			activeStake, err = s.GetFinalityProviderActiveStake(storedTx.FinalityProviderPk)
+			require.NoError(t, err)
+			require.Zero(t, activeStake)
+		}
+		totalScore, err = s.GetTotalScore()
+		require.NoError(t, err)
+		require.Zero(t, totalScore)
+
+		// re-adding the same unbonding txs is a duplicate while another
+		// unbonding tx spending the same staking tx conflicts
+		conflictingUnbondingTxs := datagen.GenStoredUnbondingTxs(r, stakingtxs)
+		for i, storedTx := range unbondingTxs {
+			err := s.AddUnbondingTransaction(storedTx.Tx, storedTx.StakingTxHash, storedTx.InclusionHeight, storedTx.InclusionTimestamp)
+			require.ErrorIs(t, err, indexerstore.ErrDuplicateTransaction)
+
+			conflictingTx := conflictingUnbondingTxs[i]
+			err = s.AddUnbondingTransaction(conflictingTx.Tx, conflictingTx.StakingTxHash, conflictingTx.InclusionHeight, conflictingTx.InclusionTimestamp)
+			require.ErrorIs(t, err, indexerstore.ErrStakingOutputAlreadySpent)
+		}
+		totalScore, err = s.GetTotalScore()
+		require.NoError(t, err)
+		require.Zero(t, totalScore)
+
 		// add unbonding txs that do not spend previous staking tx
 		// should expect error
 		// add unbonding txs to store
 		notStoredStakingTxs := datagen.GenNStoredStakingTxs(t, r, numTx, 200)
 		wrongUnbondingTxs := datagen.GenStoredUnbondingTxs(r, notStoredStakingTxs)
 		for _, storedTx := range wrongUnbondingTxs {
-			err := s.AddUnbondingTransaction(storedTx.Tx, storedTx.StakingTxHash)
+			err := s.AddUnbondingTransaction(storedTx.Tx, storedTx.StakingTxHash, storedTx.InclusionHeight, storedTx.InclusionTimestamp)
 			require.ErrorIs(t, err, indexerstore.ErrTransactionNotFound)
 		}
+
+		// the unbonded staking txs are withdrawn at last
+		for _, storedTx := range unbondingTxs {
+			stakingTx, err := s.GetStakingTransaction(storedTx.StakingTxHash)
+			require.NoError(t, err)
+			unbondingTxHash := storedTx.Tx.TxHash()
+			stakingOutpoint := wire.NewOutPoint(storedTx.StakingTxHash, stakingTx.StakingOutputIdx)
+			unbondingOutpoint := wire.NewOutPoint(&unbondingTxHash, 0)
+			withdrawalTxHash := bbndatagen.GenRandomBtcdHash(r)
+
+			// the staking output is already spent by the unbonding tx
+			err = s.AddWithdrawalTransaction(storedTx.StakingTxHash, &withdrawalTxHash, stakingOutpoint, stakingTx.StakingValue, storedTx.InclusionHeight+1, storedTx.InclusionTimestamp+1)
+			require.ErrorIs(t, err, indexerstore.ErrStakingOutputAlreadySpent)
+			withdrawn, err := s.GetWithdrawnStakingTransaction(storedTx.StakingTxHash)
+			require.NoError(t, err)
+			require.Nil(t, withdrawn)
+
+			err = s.AddWithdrawalTransaction(storedTx.StakingTxHash, &withdrawalTxHash, unbondingOutpoint, stakingTx.StakingValue, storedTx.InclusionHeight+1, storedTx.InclusionTimestamp+1)
+			require.NoError(t, err)
+
+			stakingTx, err = s.GetStakingTransaction(storedTx.StakingTxHash)
+			require.NoError(t, err)
+			require.Equal(t, indexerstore.StakingStatusWithdrawn, stakingTx.Status)
+
+			// the unbonding tx and the withdrawal tx are the spenders
+			spendingTxHash, err := s.GetSpendingTx(stakingOutpoint)
+			require.NoError(t, err)
+			require.Equal(t, &unbondingTxHash, spendingTxHash)
+			spendingTxHash, err = s.GetSpendingTx(unbondingOutpoint)
+			require.NoError(t, err)
+			require.Equal(t, &withdrawalTxHash, spendingTxHash)
+		}
+	})
+}
+
+func FuzzGetStakingTransactions(f *testing.F) {
+	// only 3 seeds as this is pretty slow test opening/closing db
+	bbndatagen.AddRandomSeedsToFuzzer(f, 3)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+		db := testutils.MakeTestBackend(t)
+		s, err := indexerstore.NewIndexerStore(db)
+		require.NoError(t, err)
+		numTx := r.Intn(30) + 1
+		stakingtxs := datagen.GenNStoredStakingTxs(t, r, numTx, 200)
+
+		// only store a random subset of the generated txs
+		storedHashes := make(map[chainhash.Hash]*indexerstore.StoredStakingTransaction)
+		hashes := make([]*chainhash.Hash, 0, numTx)
+		for _, storedTx := range stakingtxs {
+			hash := storedTx.Tx.TxHash()
+			hashes = append(hashes, &hash)
+			if r.Intn(2) == 0 {
+				continue
+			}
+			err := s.AddStakingTransaction(
+				storedTx.Tx,
+				storedTx.StakingOutputIdx,
+				storedTx.InclusionHeight,
+				storedTx.InclusionTimestamp,
+				storedTx.StakerPk,
+				storedTx.StakingTime,
+				storedTx.FinalityProviderPk,
+				storedTx.StakingValue,
+				storedTx.IsOverflow,
+				storedTx.InactiveReason,
+				storedTx.OpReturnVersion,
+				storedTx.Score,
+			)
+			require.NoError(t, err)
+			storedHashes[hash] = storedTx
+		}
+
+		txs, err := s.GetStakingTransactions(hashes)
+		require.NoError(t, err)
+		require.Len(t, txs, len(storedHashes))
+		for hash, storedTx := range storedHashes {
+			tx, ok := txs[hash]
+			require.True(t, ok)
+			require.Equal(t, storedTx.Tx, tx.Tx)
+			require.Equal(t, storedTx.StakingValue, tx.StakingValue)
+			require.True(t, testutils.PubKeysEqual(storedTx.StakerPk, tx.StakerPk))
+		}
+	})
+}
+
+func TestStakingValueStats(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// the stats of an empty store are all zeros
+	minValue, maxValue, meanValue, count, err := s.GetStakingValueStats()
+	require.NoError(t, err)
+	require.Zero(t, minValue)
+	require.Zero(t, maxValue)
+	require.Zero(t, meanValue)
+	require.Zero(t, count)
+
+	// the overflow staking txs are counted as well
+	values := []uint64{3000, 1000, 6001, 2000}
+	stakingTxs := datagen.GenNStoredStakingTxs(t, r, len(values), 200)
+	for i, storedTx := range stakingTxs {
+		err := s.AddStakingTransaction(
+			storedTx.Tx,
+			storedTx.StakingOutputIdx,
+			storedTx.InclusionHeight,
+			storedTx.InclusionTimestamp,
+			storedTx.StakerPk,
+			storedTx.StakingTime,
+			storedTx.FinalityProviderPk,
+			values[i],
+			i == 0,
+			storedTx.InactiveReason,
+			storedTx.OpReturnVersion,
+			values[i],
+		)
+		require.NoError(t, err)
+	}
+
+	minValue, maxValue, meanValue, count, err = s.GetStakingValueStats()
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(1000), minValue)
+	require.Equal(t, btcutil.Amount(6001), maxValue)
+	// the mean is rounded down
+	require.Equal(t, btcutil.Amount(3000), meanValue)
+	require.Equal(t, len(values), count)
+}
+
+func FuzzStakingOutputIndex(f *testing.F) {
+	// only 3 seeds as this is pretty slow test opening/closing db
+	bbndatagen.AddRandomSeedsToFuzzer(f, 3)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+		db := testutils.MakeTestBackend(t)
+		s, err := indexerstore.NewIndexerStore(db)
+		require.NoError(t, err)
+		numTx := r.Intn(30) + 1
+		stakingtxs := datagen.GenNStoredStakingTxs(t, r, numTx, 200)
+
+		// the staking output of a random subset of the txs does not exist
+		// and the txs should be stored without being indexed
+		indexed := make(map[chainhash.Hash]struct{})
+		for _, storedTx := range stakingtxs {
+			if r.Intn(2) == 0 {
+				storedTx.StakingOutputIdx = 0
+				indexed[storedTx.Tx.TxHash()] = struct{}{}
+			} else {
+				storedTx.StakingOutputIdx = uint32(len(storedTx.Tx.TxOut))
+			}
+			err := s.AddStakingTransaction(
+				storedTx.Tx,
+				storedTx.StakingOutputIdx,
+				storedTx.InclusionHeight,
+				storedTx.InclusionTimestamp,
+				storedTx.StakerPk,
+				storedTx.StakingTime,
+				storedTx.FinalityProviderPk,
+				storedTx.StakingValue,
+				storedTx.IsOverflow,
+				storedTx.InactiveReason,
+				storedTx.OpReturnVersion,
+				storedTx.Score,
+			)
+			require.NoError(t, err)
+		}
+
+		for _, storedTx := range stakingtxs {
+			hash := storedTx.Tx.TxHash()
+			indexedTxs, err := s.GetStakingTransactionsByPkScript(storedTx.Tx.TxOut[0].PkScript)
+			require.NoError(t, err)
+			if _, ok := indexed[hash]; !ok {
+				require.Empty(t, indexedTxs)
+				continue
+			}
+			require.Len(t, indexedTxs, 1)
+			require.Equal(t, storedTx.Tx, indexedTxs[0].Tx)
+			require.Equal(t, storedTx.StakingValue, indexedTxs[0].StakingValue)
+		}
+	})
+}
+
+func FuzzProtoConversion(f *testing.F) {
+	// only 3 seeds as this is pretty slow test opening/closing db
+	bbndatagen.AddRandomSeedsToFuzzer(f, 3)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+		db := testutils.MakeTestBackend(t)
+		s, err := indexerstore.NewIndexerStore(db)
+		require.NoError(t, err)
+		numTx := r.Intn(10) + 1
+		stakingtxs := datagen.GenNStoredStakingTxs(t, r, numTx, 200)
+		unbondingTxs := datagen.GenStoredUnbondingTxs(r, stakingtxs)
+
+		for i, storedTx := range stakingtxs {
+			// round trip through the serialized proto message
+			stakingTxProto, err := storedTx.ToProto()
+			require.NoError(t, err)
+			marshalled, err := pm.Marshal(stakingTxProto)
+			require.NoError(t, err)
+			var unmarshalled proto.StakingTransaction
+			err = pm.Unmarshal(marshalled, &unmarshalled)
+			require.NoError(t, err)
+			var stakingTx indexerstore.StoredStakingTransaction
+			err = stakingTx.FromProto(&unmarshalled)
+			require.NoError(t, err)
+			require.Equal(t, storedTx.Tx, stakingTx.Tx)
+			require.True(t, testutils.PubKeysEqual(storedTx.StakerPk, stakingTx.StakerPk))
+			require.True(t, testutils.PubKeysEqual(storedTx.FinalityProviderPk, stakingTx.FinalityProviderPk))
+			require.Equal(t, storedTx.StakingValue, stakingTx.StakingValue)
+			require.Equal(t, storedTx.Score, stakingTx.Score)
+			require.Equal(t, storedTx.OpReturnVersion, stakingTx.OpReturnVersion)
+
+			// the tx read from the store converts to the same message
+			err = s.AddStakingTransaction(
+				storedTx.Tx,
+				storedTx.StakingOutputIdx,
+				storedTx.InclusionHeight,
+				storedTx.InclusionTimestamp,
+				storedTx.StakerPk,
+				storedTx.StakingTime,
+				storedTx.FinalityProviderPk,
+				storedTx.StakingValue,
+				storedTx.IsOverflow,
+				storedTx.InactiveReason,
+				storedTx.OpReturnVersion,
+				storedTx.Score,
+			)
+			require.NoError(t, err)
+			hash := storedTx.Tx.TxHash()
+			txFromDb, err := s.GetStakingTransaction(&hash)
+			require.NoError(t, err)
+			protoFromDb, err := txFromDb.ToProto()
+			require.NoError(t, err)
+			require.True(t, pm.Equal(stakingTxProto, protoFromDb))
+
+			unbondingTxProto, err := unbondingTxs[i].ToProto()
+			require.NoError(t, err)
+			var unbondingTx indexerstore.StoredUnbondingTransaction
+			err = unbondingTx.FromProto(unbondingTxProto)
+			require.NoError(t, err)
+			require.Equal(t, unbondingTxs[i].Tx, unbondingTx.Tx)
+			require.True(t, unbondingTxs[i].StakingTxHash.IsEqual(unbondingTx.StakingTxHash))
+		}
+
+		// invalid messages are rejected
+		var stakingTx indexerstore.StoredStakingTransaction
+		err = stakingTx.FromProto(&proto.StakingTransaction{TransactionBytes: bbndatagen.GenRandomByteArray(r, 10)})
+		require.Error(t, err)
+		var unbondingTx indexerstore.StoredUnbondingTransaction
+		err = unbondingTx.FromProto(&proto.UnbondingTransaction{TransactionBytes: bbndatagen.GenRandomByteArray(r, 10)})
+		require.Error(t, err)
+	})
+}
+
+// TestToProtoMissingFields tests that converting a staking or an unbonding tx
+// missing a required field returns an error instead of panicking
+func TestToProtoMissingFields(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for _, tc := range []struct {
+		name            string
+		modifyStaking   func(st *indexerstore.StoredStakingTransaction)
+		modifyUnbonding func(ut *indexerstore.StoredUnbondingTransaction)
+	}{
+		{name: "staking tx", modifyStaking: func(st *indexerstore.StoredStakingTransaction) {
+			st.Tx = nil
+		}},
+		{name: "staker public key", modifyStaking: func(st *indexerstore.StoredStakingTransaction) {
+			st.StakerPk = nil
+		}},
+		{name: "finality provider public key", modifyStaking: func(st *indexerstore.StoredStakingTransaction) {
+			st.FinalityProviderPk = nil
+		}},
+		{name: "unbonding tx", modifyUnbonding: func(ut *indexerstore.StoredUnbondingTransaction) {
+			ut.Tx = nil
+		}},
+		{name: "staking tx hash", modifyUnbonding: func(ut *indexerstore.StoredUnbondingTransaction) {
+			ut.StakingTxHash = nil
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stakingTxs := datagen.GenNStoredStakingTxs(t, r, 1, 200)
+			unbondingTxs := datagen.GenStoredUnbondingTxs(r, stakingTxs)
+
+			if tc.modifyStaking != nil {
+				tc.modifyStaking(stakingTxs[0])
+				_, err := stakingTxs[0].ToProto()
+				require.ErrorIs(t, err, indexerstore.ErrIncompleteTransaction)
+			} else {
+				tc.modifyUnbonding(unbondingTxs[0])
+				_, err := unbondingTxs[0].ToProto()
+				require.ErrorIs(t, err, indexerstore.ErrIncompleteTransaction)
+			}
+		})
+	}
+}
+
+func FuzzTotalWithdrawnValue(f *testing.F) {
+	// only 3 seeds as this is pretty slow test opening/closing db
+	bbndatagen.AddRandomSeedsToFuzzer(f, 3)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+		db := testutils.MakeTestBackend(t)
+		s, err := indexerstore.NewIndexerStore(db)
+		require.NoError(t, err)
+
+		totalWithdrawnValue, err := s.GetTotalWithdrawnValue()
+		require.NoError(t, err)
+		require.Zero(t, totalWithdrawnValue)
+
+		numWithdrawals := r.Intn(30) + 1
+		expectedTotal := btcutil.Amount(0)
+		for i := 0; i < numWithdrawals; i++ {
+			stakingTxHash := bbndatagen.GenRandomBtcdHash(r)
+			value := uint64(r.Int63n(100000) + 1)
+			height := uint64(r.Int63n(10000) + 1)
+			timestamp := r.Int63n(time.Now().Unix()) + 1
+
+			withdrawn, err := s.GetWithdrawnStakingTransaction(&stakingTxHash)
+			require.NoError(t, err)
+			require.Nil(t, withdrawn)
+
+			withdrawalTxHash := bbndatagen.GenRandomBtcdHash(r)
+			spentOutpoint := wire.NewOutPoint(&stakingTxHash, 0)
+			err = s.AddWithdrawalTransaction(&stakingTxHash, &withdrawalTxHash, spentOutpoint, value, height, timestamp)
+			require.NoError(t, err)
+			expectedTotal += btcutil.Amount(value)
+
+			withdrawn, err = s.GetWithdrawnStakingTransaction(&stakingTxHash)
+			require.NoError(t, err)
+			require.Equal(t, &indexerstore.StoredWithdrawnStakingTransaction{
+				WithdrawnValue: value,
+				Height:         height,
+				Timestamp:      timestamp,
+			}, withdrawn)
+
+			// withdrawing the same staking tx again should not be counted
+			err = s.AddWithdrawalTransaction(&stakingTxHash, &withdrawalTxHash, spentOutpoint, value, height, timestamp)
+			require.ErrorIs(t, err, indexerstore.ErrDuplicateTransaction)
+		}
+
+		totalWithdrawnValue, err = s.GetTotalWithdrawnValue()
+		require.NoError(t, err)
+		require.Equal(t, expectedTotal, totalWithdrawnValue)
+	})
+}
+
+func TestTotalWithdrawnValueOverflow(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	stakingTxHash := bbndatagen.GenRandomBtcdHash(r)
+	withdrawalTxHash := bbndatagen.GenRandomBtcdHash(r)
+	err = s.AddWithdrawalTransaction(&stakingTxHash, &withdrawalTxHash, wire.NewOutPoint(&stakingTxHash, 0), math.MaxUint64, 1, time.Now().Unix())
+	require.NoError(t, err)
+
+	// the total does not wrap and the withdrawal is not recorded
+	otherStakingTxHash := bbndatagen.GenRandomBtcdHash(r)
+	otherWithdrawalTxHash := bbndatagen.GenRandomBtcdHash(r)
+	err = s.AddWithdrawalTransaction(&otherStakingTxHash, &otherWithdrawalTxHash, wire.NewOutPoint(&otherStakingTxHash, 0), 1, 2, time.Now().Unix())
+	require.ErrorIs(t, err, utils.ErrAmountOverflow)
+	withdrawn, err := s.GetWithdrawnStakingTransaction(&otherStakingTxHash)
+	require.NoError(t, err)
+	require.Nil(t, withdrawn)
+
+	// the total does not fit in an amount
+	_, err = s.GetTotalWithdrawnValue()
+	require.ErrorIs(t, err, utils.ErrAmountOverflow)
+}
+
+// TestReadAllStakingTransactions tests that reading all the staking txs at
+// once returns the same txs as reading them one by one
+func TestReadAllStakingTransactions(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	storedTxs, err := s.ReadAllStakingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, storedTxs)
+
+	for _, storedTx := range datagen.GenNStoredStakingTxs(t, r, r.Intn(50)+1, 200) {
+		addStakingTx(t, s, storedTx)
+	}
+
+	var iterated []*indexerstore.StoredStakingTransaction
+	err = s.ForEachStakingTransaction(func(storedTx *indexerstore.StoredStakingTransaction, _ bool) error {
+		iterated = append(iterated, storedTx)
+		return nil
+	})
+	require.NoError(t, err)
+
+	storedTxs, err = s.ReadAllStakingTransactions()
+	require.NoError(t, err)
+	require.Equal(t, iterated, storedTxs)
+	for _, storedTx := range storedTxs {
+		txHash := storedTx.Tx.TxHash()
+		expected, err := s.GetStakingTransaction(&txHash)
+		require.NoError(t, err)
+		require.Equal(t, expected, storedTx)
+	}
+}
+
+// TestListFinalityProviders tests that the finality providers are listed
+// once each regardless of the number of their staking txs
+func TestListFinalityProviders(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	fpPks, err := s.ListFinalityProviders()
+	require.NoError(t, err)
+	require.Empty(t, fpPks)
+
+	// the first finality provider receives several staking txs, including
+	// an overflow one, while each of the others receives one
+	stakingTxs := datagen.GenNStoredStakingTxs(t, r, r.Intn(10)+5, 200)
+	numRepeated := 3
+	for i := 1; i < numRepeated; i++ {
+		stakingTxs[i].FinalityProviderPk = stakingTxs[0].FinalityProviderPk
+	}
+	stakingTxs[1].IsOverflow = true
+	stakingTxs[1].InactiveReason = indexerstore.InactiveReasonStakingCap
+
+	expectedFpPks := make(map[string]struct{})
+	for _, storedTx := range stakingTxs {
+		err := s.AddStakingTransaction(
+			storedTx.Tx,
+			storedTx.StakingOutputIdx,
+			storedTx.InclusionHeight,
+			storedTx.InclusionTimestamp,
+			storedTx.StakerPk,
+			storedTx.StakingTime,
+			storedTx.FinalityProviderPk,
+			storedTx.StakingValue,
+			storedTx.IsOverflow,
+			storedTx.InactiveReason,
+			storedTx.OpReturnVersion,
+			storedTx.Score,
+		)
+		require.NoError(t, err)
+		expectedFpPks[hex.EncodeToString(schnorr.SerializePubKey(storedTx.FinalityProviderPk))] = struct{}{}
+	}
+
+	fpPks, err = s.ListFinalityProviders()
+	require.NoError(t, err)
+	require.Len(t, fpPks, len(stakingTxs)-numRepeated+1)
+	listedFpPks := make(map[string]struct{})
+	for _, fpPk := range fpPks {
+		listedFpPks[hex.EncodeToString(schnorr.SerializePubKey(fpPk))] = struct{}{}
+	}
+	require.Equal(t, expectedFpPks, listedFpPks)
+
+	// the staking txs can be looked up by the finality provider
+	indexedTxs, err := s.GetStakingTransactionsByFinalityProvider(stakingTxs[0].FinalityProviderPk)
+	require.NoError(t, err)
+	require.Len(t, indexedTxs, numRepeated)
+}
+
+// TestGetStakerDelegationCount tests that the delegations of a staker are
+// counted regardless of their eligibility and an unknown staker has none
+func TestGetStakerDelegationCount(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// the first staker has several staking txs, including an
+	// overflow one, while each of the others has one
+	stakingTxs := datagen.GenNStoredStakingTxs(t, r, r.Intn(10)+5, 200)
+	numRepeated := 3
+	for i := 1; i < numRepeated; i++ {
+		stakingTxs[i].StakerPk = stakingTxs[0].StakerPk
+	}
+	stakingTxs[1].IsOverflow = true
+	stakingTxs[1].InactiveReason = indexerstore.InactiveReasonStakingCap
+	for _, storedTx := range stakingTxs {
+		addStakingTx(t, s, storedTx)
+	}
+
+	count, err := s.GetStakerDelegationCount(stakingTxs[0].StakerPk)
+	require.NoError(t, err)
+	require.Equal(t, numRepeated, count)
+	// the overflow staking tx is counted but its stake is not active
+	activeStake, err := s.GetStakerActiveStake(stakingTxs[0].StakerPk)
+	require.NoError(t, err)
+	require.Equal(t, stakingTxs[0].StakingValue+stakingTxs[2].StakingValue, activeStake)
+
+	count, err = s.GetStakerDelegationCount(stakingTxs[numRepeated].StakerPk)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	unknownSk, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	count, err = s.GetStakerDelegationCount(unknownSk.PubKey())
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+// TestGetActiveStakeSince tests that the active stake since a timestamp
+// only counts the staking txs included since then that are still staked,
+// regardless of the order of the timestamps of the blocks
+func TestGetActiveStakeSince(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	now := time.Now().Unix()
+	since := now - 3600
+	stakingTxs := datagen.GenNStoredStakingTxs(t, r, 4, 200)
+	for i, ts := range []int64{
+		// far before the timestamp, which stops the walk
+		since - 3*3600,
+		// within the window
+		now - 600,
+		// a following block with an earlier timestamp out of the window
+		since - 60,
+		// within the window but unbonded
+		now,
+	} {
+		stakingTxs[i].InclusionHeight = uint64(100 + i)
+		stakingTxs[i].InclusionTimestamp = ts
+		addStakingTx(t, s, stakingTxs[i])
+	}
+	unbondedTxHash := stakingTxs[3].Tx.TxHash()
+	err = s.AddUnbondingTransaction(bbndatagen.GenRandomTx(r), &unbondedTxHash, 104, now)
+	require.NoError(t, err)
+
+	stake, err := s.GetActiveStakeSince(since)
+	require.NoError(t, err)
+	require.Equal(t, stakingTxs[1].StakingValue, stake)
+
+	// all the staking txs except the unbonded one
+	stake, err = s.GetActiveStakeSince(0)
+	require.NoError(t, err)
+	require.Equal(t, stakingTxs[0].StakingValue+stakingTxs[1].StakingValue+stakingTxs[2].StakingValue, stake)
+}
+
+// TestGetStakingTransactionsByTag tests that the staking txs are looked up
+// by the staking tag of their OP_RETURN data
+func TestGetStakingTransactionsByTag(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	params := datagen.GenerateGlobalParamsVersions(r, t).Versions[0]
+	tag1 := []byte{0x01, 0x02, 0x03, 0x04}
+	tag2 := []byte{0x05, 0x06, 0x07, 0x08}
+
+	// three staking txs carry the first tag and two carry the second one
+	expectedHashes := map[string]map[chainhash.Hash]struct{}{
+		string(tag1): {},
+		string(tag2): {},
+	}
+	for i := 0; i < 5; i++ {
+		tag := tag1
+		if i >= 3 {
+			tag = tag2
+		}
+		params.Tag = tag
+		stakingData := datagen.GenerateTestStakingData(t, r, params)
+		_, stakingTx := datagen.GenerateStakingTxFromTestData(t, r, params, stakingData)
+		err := s.AddStakingTransaction(
+			stakingTx.MsgTx(),
+			0,
+			uint64(r.Int63n(10000)+1),
+			time.Now().Unix(),
+			stakingData.StakerKey,
+			uint32(stakingData.StakingTime),
+			stakingData.FinalityProviderKey,
+			uint64(stakingData.StakingAmount),
+			false,
+			indexerstore.InactiveReasonNone,
+			0,
+			uint64(stakingData.StakingAmount),
+		)
+		require.NoError(t, err)
+		expectedHashes[string(tag)][*stakingTx.Hash()] = struct{}{}
+	}
+
+	// a staking tx without OP_RETURN data is not indexed by any tag
+	addStakingTx(t, s, datagen.GenNStoredStakingTxs(t, r, 1, 200)[0])
+
+	for _, tag := range [][]byte{tag1, tag2} {
+		indexedTxs, err := s.GetStakingTransactionsByTag(tag)
+		require.NoError(t, err)
+		indexedHashes := make(map[chainhash.Hash]struct{})
+		for _, indexedTx := range indexedTxs {
+			indexedHashes[indexedTx.Tx.TxHash()] = struct{}{}
+		}
+		require.Equal(t, expectedHashes[string(tag)], indexedHashes)
+	}
+
+	indexedTxs, err := s.GetStakingTransactionsByTag([]byte{0x09, 0x0a, 0x0b, 0x0c})
+	require.NoError(t, err)
+	require.Empty(t, indexedTxs)
+}
+
+// TestIndexedBlock tests that the full data of a stored block is retrieved
+// with the same header and txs
+func TestIndexedBlock(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	blocks := datagen.GetRandomIndexedBlocks(r, uint64(r.Int63n(10000)+1), 3)
+	for _, b := range blocks {
+		err := s.AddIndexedBlock(b)
+		require.NoError(t, err)
+	}
+
+	for _, expected := range blocks {
+		b, err := s.GetIndexedBlock(uint64(expected.Height))
+		require.NoError(t, err)
+		require.NotNil(t, b)
+		require.Equal(t, expected.Height, b.Height)
+		require.Equal(t, expected.BlockHash(), b.BlockHash())
+		require.Len(t, b.Txs, len(expected.Txs))
+		for i := range b.Txs {
+			require.Equal(t, expected.Txs[i].Hash(), b.Txs[i].Hash())
+			require.Equal(t, expected.Txs[i].WitnessHash(), b.Txs[i].WitnessHash())
+		}
+	}
+
+	// a height without a stored block
+	b, err := s.GetIndexedBlock(uint64(blocks[len(blocks)-1].Height) + 1)
+	require.NoError(t, err)
+	require.Nil(t, b)
+}
+
+// TestIndexKeyHash tests that the staking txs are looked up by the staker
+// and the finality provider under the hashed index keys, both for the txs
+// indexed before the hash is set and the ones indexed after it, and after
+// the store is reopened or the hash is unset
+func TestIndexKeyHash(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	err = s.SetIndexKeyHash(indexerstore.IndexKeyHash("unknown"))
+	require.Error(t, err)
+
+	// the first staker and the first finality provider have several txs
+	stakingTxs := datagen.GenNStoredStakingTxs(t, r, r.Intn(10)+6, 200)
+	numRepeated := 3
+	for i := 1; i < numRepeated; i++ {
+		stakingTxs[i].StakerPk = stakingTxs[0].StakerPk
+		stakingTxs[i+numRepeated].FinalityProviderPk = stakingTxs[0].FinalityProviderPk
+	}
+	addStakingTx := func(storedTx *indexerstore.StoredStakingTransaction) {
+		err := s.AddStakingTransaction(
+			storedTx.Tx,
+			storedTx.StakingOutputIdx,
+			storedTx.InclusionHeight,
+			storedTx.InclusionTimestamp,
+			storedTx.StakerPk,
+			storedTx.StakingTime,
+			storedTx.FinalityProviderPk,
+			storedTx.StakingValue,
+			storedTx.IsOverflow,
+			storedTx.InactiveReason,
+			storedTx.OpReturnVersion,
+			storedTx.Score,
+		)
+		require.NoError(t, err)
+	}
+
+	requireIndexed := func(s *indexerstore.IndexerStore) {
+		stakerTxs, err := s.GetStakingTransactionsByStaker(stakingTxs[0].StakerPk)
+		require.NoError(t, err)
+		require.Len(t, stakerTxs, numRepeated)
+		count, err := s.GetStakerDelegationCount(stakingTxs[0].StakerPk)
+		require.NoError(t, err)
+		require.Equal(t, numRepeated, count)
+
+		fpTxs, err := s.GetStakingTransactionsByFinalityProvider(stakingTxs[0].FinalityProviderPk)
+		require.NoError(t, err)
+		require.Len(t, fpTxs, numRepeated)
+
+		for _, storedTx := range stakingTxs[2*numRepeated:] {
+			stakerTxs, err := s.GetStakingTransactionsByStaker(storedTx.StakerPk)
+			require.NoError(t, err)
+			require.Len(t, stakerTxs, 1)
+			require.Equal(t, storedTx.Tx.TxHash(), stakerTxs[0].Tx.TxHash())
+
+			fpTxs, err := s.GetStakingTransactionsByFinalityProvider(storedTx.FinalityProviderPk)
+			require.NoError(t, err)
+			require.Len(t, fpTxs, 1)
+			require.Equal(t, storedTx.Tx.TxHash(), fpTxs[0].Tx.TxHash())
+		}
+
+		_, unknownPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+		require.NoError(t, err)
+		unknownTxs, err := s.GetStakingTransactionsByStaker(unknownPk)
+		require.NoError(t, err)
+		require.Empty(t, unknownTxs)
+
+		// the finality providers are listed in the order of their pks
+		fpPks, err := s.ListFinalityProviders()
+		require.NoError(t, err)
+		require.Len(t, fpPks, len(stakingTxs)-numRepeated+1)
+		for i := 1; i < len(fpPks); i++ {
+			require.Negative(t, bytes.Compare(schnorr.SerializePubKey(fpPks[i-1]), schnorr.SerializePubKey(fpPks[i])))
+		}
+	}
+
+	half := len(stakingTxs) / 2
+	for _, storedTx := range stakingTxs[:half] {
+		addStakingTx(storedTx)
+	}
+	err = s.SetIndexKeyHash(indexerstore.IndexKeyHashSha256)
+	require.NoError(t, err)
+	for _, storedTx := range stakingTxs[half:] {
+		addStakingTx(storedTx)
+	}
+	requireIndexed(s)
+
+	// the hash is kept when the store is reopened
+	reopened, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+	requireIndexed(reopened)
+
+	err = s.SetIndexKeyHash(indexerstore.IndexKeyHashNone)
+	require.NoError(t, err)
+	requireIndexed(s)
+}
+
+// BenchmarkReadAllStakingTransactions measures reading all the staking txs
+// at once against iterating them, the memory of the former is dominated by
+// the parsed txs held at once
+func BenchmarkReadAllStakingTransactions(b *testing.B) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(b)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(b, err)
+
+	// each staking tx is added in its own db transaction, so
+	// a larger store makes the setup slow
+	numTxs := 2000
+	for _, storedTx := range datagen.GenNStoredStakingTxs(b, r, numTxs, 200) {
+		addStakingTx(b, s, storedTx)
+	}
+
+	b.Run("ReadAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			storedTxs, err := s.ReadAllStakingTransactions()
+			require.NoError(b, err)
+			require.Len(b, storedTxs, numTxs)
+		}
+	})
+
+	b.Run("ForEach", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var storedTxs []*indexerstore.StoredStakingTransaction
+			err := s.ForEachStakingTransaction(func(storedTx *indexerstore.StoredStakingTransaction, _ bool) error {
+				storedTxs = append(storedTxs, storedTx)
+				return nil
+			})
+			require.NoError(b, err)
+			require.Len(b, storedTxs, numTxs)
+		}
 	})
 }
 
+func FuzzStoringDeadLetters(f *testing.F) {
+	// only 3 seeds as this is pretty slow test opening/closing db
+	bbndatagen.AddRandomSeedsToFuzzer(f, 3)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+		db := testutils.MakeTestBackend(t)
+		s, err := indexerstore.NewIndexerStore(db)
+		require.NoError(t, err)
+
+		deadLetters, err := s.GetDeadLetters()
+		require.NoError(t, err)
+		require.Empty(t, deadLetters)
+
+		numTxs := r.Intn(30) + 1
+		expected := make(map[chainhash.Hash]*indexerstore.StoredDeadLetter)
+		for i := 0; i < numTxs; i++ {
+			deadLetter := &indexerstore.StoredDeadLetter{
+				Tx:     datagen.GenRandomTx(r),
+				Height: uint64(r.Int63n(10000) + 1),
+				Error:  bbndatagen.GenRandomHexStr(r, 10),
+			}
+			err := s.AddDeadLetter(deadLetter.Tx, deadLetter.Height, deadLetter.Error)
+			require.NoError(t, err)
+			expected[deadLetter.Tx.TxHash()] = deadLetter
+
+			err = s.AddDeadLetter(deadLetter.Tx, deadLetter.Height, deadLetter.Error)
+			require.ErrorIs(t, err, indexerstore.ErrDuplicateTransaction)
+		}
+
+		deadLetters, err = s.GetDeadLetters()
+		require.NoError(t, err)
+		require.Len(t, deadLetters, len(expected))
+		for _, deadLetter := range deadLetters {
+			expectedDeadLetter, ok := expected[deadLetter.Tx.TxHash()]
+			require.True(t, ok)
+			require.Equal(t, expectedDeadLetter, deadLetter)
+		}
+	})
+}
+
+func FuzzProcessingErrorLog(f *testing.F) {
+	// only 3 seeds as this is pretty slow test opening/closing db
+	bbndatagen.AddRandomSeedsToFuzzer(f, 3)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+		db := testutils.MakeTestBackend(t)
+		s, err := indexerstore.NewIndexerStore(db)
+		require.NoError(t, err)
+
+		processingErrors, err := s.GetRecentProcessingErrors(10)
+		require.NoError(t, err)
+		require.Empty(t, processingErrors)
+
+		maxErrors := uint64(r.Intn(10) + 1)
+		numErrors := r.Intn(30) + 1
+		added := make([]*indexerstore.StoredProcessingError, 0, numErrors)
+		for i := 0; i < numErrors; i++ {
+			txHash := bbndatagen.GenRandomBtcdHash(r)
+			processingError := &indexerstore.StoredProcessingError{
+				TxHash: &txHash,
+				Height: uint64(i),
+				Error:  bbndatagen.GenRandomHexStr(r, 10),
+			}
+			err := s.AddProcessingError(processingError.TxHash, processingError.Height, processingError.Error, maxErrors)
+			require.NoError(t, err)
+			added = append(added, processingError)
+		}
+
+		// only the most recent errors are kept, ordered from the most recent
+		n := r.Intn(numErrors+5) + 1
+		expectedLen := n
+		if expectedLen > numErrors {
+			expectedLen = numErrors
+		}
+		if expectedLen > int(maxErrors) {
+			expectedLen = int(maxErrors)
+		}
+		processingErrors, err = s.GetRecentProcessingErrors(n)
+		require.NoError(t, err)
+		require.Len(t, processingErrors, expectedLen)
+		for i, processingError := range processingErrors {
+			require.Equal(t, added[numErrors-1-i], processingError)
+		}
+
+		// processing a kept tx again replaces its error in place
+		reprocessed := added[numErrors-1-r.Intn(expectedLen)]
+		reprocessed.Error = bbndatagen.GenRandomHexStr(r, 10)
+		err = s.AddProcessingError(reprocessed.TxHash, reprocessed.Height, reprocessed.Error, maxErrors)
+		require.NoError(t, err)
+		processingErrorsAfter, err := s.GetRecentProcessingErrors(n)
+		require.NoError(t, err)
+		require.Len(t, processingErrorsAfter, expectedLen)
+		for i, processingError := range processingErrorsAfter {
+			require.Equal(t, added[numErrors-1-i], processingError)
+		}
+
+		// reducing the size removes the older errors
+		txHash := bbndatagen.GenRandomBtcdHash(r)
+		err = s.AddProcessingError(&txHash, uint64(numErrors), "reduced", 1)
+		require.NoError(t, err)
+		processingErrors, err = s.GetRecentProcessingErrors(numErrors + 1)
+		require.NoError(t, err)
+		require.Len(t, processingErrors, 1)
+		require.Equal(t, "reduced", processingErrors[0].Error)
+	})
+}
+
+func FuzzPruningDiagnosticLogs(f *testing.F) {
+	// only 3 seeds as this is pretty slow test opening/closing db
+	bbndatagen.AddRandomSeedsToFuzzer(f, 3)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+		db := testutils.MakeTestBackend(t)
+		s, err := indexerstore.NewIndexerStore(db)
+		require.NoError(t, err)
+
+		// the heights are distinct so that the pruned ones are determined
+		numEntries := r.Intn(30) + 1
+		for i := 0; i < numEntries; i++ {
+			height := uint64(i + 1)
+			err := s.AddDeadLetter(datagen.GenRandomTx(r), height, bbndatagen.GenRandomHexStr(r, 10))
+			require.NoError(t, err)
+
+			txHash := bbndatagen.GenRandomBtcdHash(r)
+			err = s.AddProcessingError(&txHash, height, bbndatagen.GenRandomHexStr(r, 10), uint64(numEntries))
+			require.NoError(t, err)
+		}
+
+		deadLetterCount, err := s.GetDeadLetterCount()
+		require.NoError(t, err)
+		require.Equal(t, numEntries, deadLetterCount)
+		processingErrorCount, err := s.GetProcessingErrorCount()
+		require.NoError(t, err)
+		require.Equal(t, numEntries, processingErrorCount)
+
+		// nothing is pruned without any retention
+		pruned, err := s.PruneDeadLetters(0, 0)
+		require.NoError(t, err)
+		require.Zero(t, pruned)
+		pruned, err = s.PruneProcessingErrors(0)
+		require.NoError(t, err)
+		require.Zero(t, pruned)
+
+		// the entries below the min height are pruned
+		minHeight := uint64(r.Intn(numEntries) + 1)
+		expectedLeft := numEntries - int(minHeight) + 1
+		pruned, err = s.PruneDeadLetters(minHeight, 0)
+		require.NoError(t, err)
+		require.Equal(t, numEntries-expectedLeft, pruned)
+		pruned, err = s.PruneProcessingErrors(minHeight)
+		require.NoError(t, err)
+		require.Equal(t, numEntries-expectedLeft, pruned)
+
+		processingErrors, err := s.GetRecentProcessingErrors(numEntries)
+		require.NoError(t, err)
+		require.Len(t, processingErrors, expectedLeft)
+		for _, processingError := range processingErrors {
+			require.GreaterOrEqual(t, processingError.Height, minHeight)
+		}
+
+		// the dead letters of the lowest heights are pruned
+		// once the limit is exceeded
+		maxEntries := uint64(r.Intn(expectedLeft) + 1)
+		pruned, err = s.PruneDeadLetters(minHeight, maxEntries)
+		require.NoError(t, err)
+		require.Equal(t, expectedLeft-int(maxEntries), pruned)
+
+		deadLetters, err := s.GetDeadLetters()
+		require.NoError(t, err)
+		require.Len(t, deadLetters, int(maxEntries))
+		for _, deadLetter := range deadLetters {
+			require.Greater(t, deadLetter.Height, uint64(numEntries)-maxEntries)
+		}
+		deadLetterCount, err = s.GetDeadLetterCount()
+		require.NoError(t, err)
+		require.Equal(t, int(maxEntries), deadLetterCount)
+	})
+}
+
+// TestPendingEvents tests that the pending events are returned in the order
+// of the heights and the sequence numbers, an event saved again under the
+// same key is replaced, and an emitted event is deleted
+func TestPendingEvents(t *testing.T) {
+	db := testutils.MakeTestBackend(t)
+	s, err := indexerstore.NewIndexerStore(db)
+	require.NoError(t, err)
+
+	events, err := s.GetPendingEvents()
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	for _, e := range []*indexerstore.StoredPendingEvent{
+		{Height: 11, Seq: 0, EmitHeight: 15, Event: []byte("c")},
+		{Height: 10, Seq: 1, EmitHeight: 16, Event: []byte("b")},
+		{Height: 10, Seq: 0, EmitHeight: 14, Event: []byte("a")},
+		// the block is handled again
+		{Height: 11, Seq: 0, EmitHeight: 15, Event: []byte("c")},
+	} {
+		err := s.AddPendingEvent(e)
+		require.NoError(t, err)
+	}
+
+	events, err = s.GetPendingEvents()
+	require.NoError(t, err)
+	require.Equal(t, []*indexerstore.StoredPendingEvent{
+		{Height: 10, Seq: 0, EmitHeight: 14, Event: []byte("a")},
+		{Height: 10, Seq: 1, EmitHeight: 16, Event: []byte("b")},
+		{Height: 11, Seq: 0, EmitHeight: 15, Event: []byte("c")},
+	}, events)
+
+	err = s.DeletePendingEvent(10, 0)
+	require.NoError(t, err)
+	events, err = s.GetPendingEvents()
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, []byte("b"), events[0].Event)
+}
+
 func FuzzStoringIndexerState(f *testing.F) {
 	// only 3 seeds as this is pretty slow test opening/closing db
 	bbndatagen.AddRandomSeedsToFuzzer(f, 3)
@@ -0,0 +1,113 @@
+package indexerstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/kvdb"
+)
+
+// The buckets iterate their keys in the byte-wise order, so the keys that
+// are meant to be iterated in a logical order, e.g., by height, value, or
+// timestamp, are encoded such that the byte-wise order matches it:
+//   - an uint64 is encoded as 8 big-endian bytes
+//   - an int64, e.g., a timestamp, is encoded as the uint64 of which the
+//     sign bit is flipped, so that the negative ones come first
+//   - a composite key concatenates the fixed-size encodings of its parts,
+//     e.g., a height followed by a tx hash, so that the keys are ordered by
+//     the first part and the ties are broken by the next ones
+
+const (
+	// uint64KeyLen is the length of an encoded uint64 or int64
+	uint64KeyLen = 8
+	// uint64TxKeyLen is the length of an encoded uint64 followed by a tx hash
+	uint64TxKeyLen = uint64KeyLen + chainhash.HashSize
+	// outpointKeyLen is the length of an encoded outpoint, i.e., a tx hash
+	// followed by the 4 big-endian bytes of the output index
+	outpointKeyLen = chainhash.HashSize + 4
+)
+
+func uint64ToBytes(v uint64) []byte {
+	var buf [uint64KeyLen]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return buf[:]
+}
+
+func uint64FromBytes(b []byte) (uint64, error) {
+	if len(b) != uint64KeyLen {
+		return 0, fmt.Errorf("invalid uint64 bytes length: %d", len(b))
+	}
+
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// int64ToBytes encodes the given int64 such that the encoded keys are
+// ordered as the values
+func int64ToBytes(v int64) []byte {
+	return uint64ToBytes(uint64(v) ^ (1 << 63))
+}
+
+func int64FromBytes(b []byte) (int64, error) {
+	v, err := uint64FromBytes(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(v ^ (1 << 63)), nil
+}
+
+// uint64TxKey returns the key of the given tx under the given uint64,
+// e.g., the inclusion height or the staking value of the tx
+func uint64TxKey(v uint64, txHash *chainhash.Hash) []byte {
+	key := make([]byte, 0, uint64TxKeyLen)
+	key = append(key, uint64ToBytes(v)...)
+	return append(key, txHash[:]...)
+}
+
+// uint64TxFromKey decodes the key encoded by uint64TxKey
+func uint64TxFromKey(k []byte) (uint64, *chainhash.Hash, error) {
+	if len(k) != uint64TxKeyLen {
+		return 0, nil, fmt.Errorf("invalid uint64 tx key length: %d", len(k))
+	}
+
+	v, err := uint64FromBytes(k[:uint64KeyLen])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	txHash, err := chainhash.NewHash(k[uint64KeyLen:])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return v, txHash, nil
+}
+
+// seekLastUint64Key moves the cursor to the last key of which the leading
+// uint64 is not higher than maxValue, e.g., the latest tx included up to a
+// height. It returns a nil key if there is no such key
+func seekLastUint64Key(c kvdb.RCursor, maxValue uint64) ([]byte, []byte) {
+	if maxValue == math.MaxUint64 {
+		return c.Last()
+	}
+
+	// the first key above maxValue, or the end of the bucket
+	k, _ := c.Seek(uint64ToBytes(maxValue + 1))
+	if k == nil {
+		return c.Last()
+	}
+
+	return c.Prev()
+}
+
+// outpointKey returns the key of the given outpoint, i.e., the tx hash
+// followed by the output index
+func outpointKey(op *wire.OutPoint) []byte {
+	key := make([]byte, outpointKeyLen)
+	copy(key, op.Hash[:])
+	binary.BigEndian.PutUint32(key[chainhash.HashSize:], op.Index)
+	return key
+}
@@ -0,0 +1,169 @@
+package indexerstore
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	bbndatagen "github.com/babylonlabs-io/babylon/testutil/datagen"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/kvdb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonlabs-io/staking-indexer/testutils"
+)
+
+// boundaryUint64s are the values around which an encoding not preserving
+// the order across the full uint64 range would break
+var boundaryUint64s = []uint64{
+	0, 1, 255, 256, math.MaxUint32 - 1, math.MaxUint32, math.MaxUint32 + 1,
+	1 << 63, math.MaxInt64, math.MaxUint64 - 1, math.MaxUint64,
+}
+
+func genHash(r *rand.Rand) *chainhash.Hash {
+	var h chainhash.Hash
+	r.Read(h[:])
+	return &h
+}
+
+func FuzzUint64KeyOrdering(f *testing.F) {
+	bbndatagen.AddRandomSeedsToFuzzer(f, 10)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+
+		values := append([]uint64(nil), boundaryUint64s...)
+		for i := 0; i < 50; i++ {
+			values = append(values, r.Uint64(), uint64(r.Uint32()))
+		}
+
+		for _, a := range values {
+			for _, b := range values[:len(boundaryUint64s)+2] {
+				ka, kb := uint64ToBytes(a), uint64ToBytes(b)
+				require.Equal(t, compareUint64(a, b), bytes.Compare(ka, kb), "%d vs %d", a, b)
+
+				ia, ib := int64(a), int64(b)
+				require.Equal(t, compareInt64(ia, ib), bytes.Compare(int64ToBytes(ia), int64ToBytes(ib)), "%d vs %d", ia, ib)
+			}
+
+			decoded, err := uint64FromBytes(uint64ToBytes(a))
+			require.NoError(t, err)
+			require.Equal(t, a, decoded)
+
+			decodedInt, err := int64FromBytes(int64ToBytes(int64(a)))
+			require.NoError(t, err)
+			require.Equal(t, int64(a), decodedInt)
+
+			txHash := genHash(r)
+			decodedValue, decodedHash, err := uint64TxFromKey(uint64TxKey(a, txHash))
+			require.NoError(t, err)
+			require.Equal(t, a, decodedValue)
+			require.Equal(t, txHash, decodedHash)
+		}
+
+		// the composite keys are ordered by the value first and the ties
+		// are broken by the tx hash
+		for _, a := range values {
+			for _, b := range boundaryUint64s {
+				hashA, hashB := genHash(r), genHash(r)
+				expected := compareUint64(a, b)
+				if expected == 0 {
+					expected = bytes.Compare(hashA[:], hashB[:])
+				}
+				require.Equal(t, expected,
+					bytes.Compare(uint64TxKey(a, hashA), uint64TxKey(b, hashB)), "%d vs %d", a, b)
+			}
+		}
+
+		_, err := uint64FromBytes(make([]byte, uint64KeyLen-1))
+		require.Error(t, err)
+		_, _, err = uint64TxFromKey(uint64ToBytes(r.Uint64()))
+		require.Error(t, err)
+	})
+}
+
+func TestSeekLastUint64Key(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	bucketName := []byte("testkeys")
+
+	values := append([]uint64(nil), boundaryUint64s[1:len(boundaryUint64s)-1]...)
+	err := kvdb.Update(db, func(tx kvdb.RwTx) error {
+		bucket, err := tx.CreateTopLevelBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			if err := bucket.Put(uint64TxKey(v, genHash(r)), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() {})
+	require.NoError(t, err)
+
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	// expectedLast returns the highest stored value not higher than maxValue
+	expectedLast := func(maxValue uint64) (uint64, bool) {
+		i := sort.Search(len(values), func(i int) bool { return values[i] > maxValue })
+		if i == 0 {
+			return 0, false
+		}
+		return values[i-1], true
+	}
+
+	err = kvdb.View(db, func(tx kvdb.RTx) error {
+		c := tx.ReadBucket(bucketName).ReadCursor()
+
+		// the keys are iterated in the order of the values
+		var iterated []uint64
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			v, _, err := uint64TxFromKey(k)
+			require.NoError(t, err)
+			iterated = append(iterated, v)
+		}
+		require.Equal(t, values, iterated)
+
+		for _, maxValue := range append(boundaryUint64s, r.Uint64(), uint64(r.Uint32())) {
+			k, _ := seekLastUint64Key(c, maxValue)
+			expected, found := expectedLast(maxValue)
+			if !found {
+				require.Nil(t, k, "max value %d", maxValue)
+				continue
+			}
+
+			v, _, err := uint64TxFromKey(k)
+			require.NoError(t, err)
+			require.Equal(t, expected, v, "max value %d", maxValue)
+		}
+
+		return nil
+	}, func() {})
+	require.NoError(t, err)
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,34 @@
+package indexerstore
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	dbTxTypeRead  = "read"
+	dbTxTypeWrite = "write"
+)
+
+var (
+	dbTxDurationHistogram = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "si_db_tx_duration_seconds",
+			Help:    "The duration of the db transactions in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16),
+		},
+		[]string{
+			"tx_type",
+		},
+	)
+
+	failedDbTxsCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "si_failed_db_txs_counter",
+			Help: "Total number of failed db transactions",
+		},
+		[]string{
+			"tx_type",
+		},
+	)
+)
@@ -0,0 +1,787 @@
+package indexerstore
+
+import (
+	"fmt"
+
+	"github.com/lightningnetwork/lnd/kvdb"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+// migration upgrades the on-disk representation by one db version
+type migration func(tx kvdb.RwTx) error
+
+// migrations is the ordered list of migrations, the db version
+// is the number of migrations that have been applied to the db
+var migrations = []migration{
+	migrateOpReturnVersion,
+	migrateInactiveReason,
+	migrateStakerActiveStake,
+	migrateStakingOutputIndex,
+	migrateStakingScore,
+	migrateStakingUnbondingIndex,
+	migrateWithdrawnStakingTxs,
+	migrateStakingStatus,
+	migrateStakerIndex,
+	migrateHeightIndex,
+	migrateFinalityProviderActiveStake,
+	migrateFinalityProviderIndex,
+	migrateTagIndex,
+	migrateWithdrawnValue,
+}
+
+func getDbVersionKey() []byte {
+	return []byte("dbversion")
+}
+
+// GetDbVersion returns the version of the db, i.e., the number of the
+// migrations applied to it
+func (is *IndexerStore) GetDbVersion() (uint64, error) {
+	var dbVersion uint64
+	err := is.view(func(tx kvdb.RTx) error {
+		stateBucket := tx.ReadBucket(indexerStateBucketName)
+		if stateBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		// a db without the version key is considered as version 0
+		v := stateBucket.Get(getDbVersionKey())
+		if v == nil {
+			return nil
+		}
+
+		var err error
+		dbVersion, err = uint64FromBytes(v)
+
+		return err
+	}, func() {
+		dbVersion = 0
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return dbVersion, nil
+}
+
+// readDbVersion returns the version of the db, a db without the state
+// bucket or the version key is considered as version 0
+func readDbVersion(tx kvdb.RTx) (uint64, error) {
+	stateBucket := tx.ReadBucket(indexerStateBucketName)
+	if stateBucket == nil {
+		return 0, nil
+	}
+
+	v := stateBucket.Get(getDbVersionKey())
+	if v == nil {
+		return 0, nil
+	}
+
+	return uint64FromBytes(v)
+}
+
+// runMigrations applies the migrations that have not been applied to the
+// db of the given version yet and records the new db version
+func runMigrations(tx kvdb.RwTx, dbVersion uint64) error {
+	stateBucket := tx.ReadWriteBucket(indexerStateBucketName)
+	if stateBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	latestVersion := uint64(len(migrations))
+	if dbVersion == latestVersion {
+		return nil
+	}
+
+	for _, m := range migrations[dbVersion:] {
+		if err := m(tx); err != nil {
+			return err
+		}
+	}
+
+	return stateBucket.Put(getDbVersionKey(), uint64ToBytes(latestVersion))
+}
+
+// checkDbVersion returns an error if the db is not of the latest
+// version, i.e., it has to be migrated or it is written by a newer binary
+func (is *IndexerStore) checkDbVersion() error {
+	var dbVersion uint64
+	err := is.view(func(tx kvdb.RTx) error {
+		var err error
+		dbVersion, err = readDbVersion(tx)
+
+		return err
+	}, func() {
+		dbVersion = 0
+	})
+	if err != nil {
+		return err
+	}
+
+	latestVersion := uint64(len(migrations))
+	if dbVersion > latestVersion {
+		return fmt.Errorf("%w: db version %d, latest supported version %d",
+			ErrIncompatibleDbVersion, dbVersion, latestVersion)
+	}
+	if dbVersion < latestVersion {
+		return fmt.Errorf("%w: db version %d, latest version %d",
+			ErrOutdatedDbVersion, dbVersion, latestVersion)
+	}
+
+	return nil
+}
+
+// migrateOpReturnVersion sets the OP_RETURN version of the staking txs
+// stored before the field is introduced to 0
+func migrateOpReturnVersion(tx kvdb.RwTx) error {
+	txBucket := tx.ReadWriteBucket(stakingTxBucketName)
+	if txBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	migrated := make(map[string][]byte)
+	err := txBucket.ForEach(func(k, v []byte) error {
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		storedTxProto.OpReturnVersion = 0
+
+		marshalled, err := pm.Marshal(&storedTxProto)
+		if err != nil {
+			return err
+		}
+		migrated[string(k)] = marshalled
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the bucket should not be modified while iterating it
+	for k, v := range migrated {
+		if err := txBucket.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateInactiveReason sets the inactive reason of the overflow staking txs
+// stored before the field is introduced to the global staking cap, which
+// was the only reason for a staking tx to be overflow
+func migrateInactiveReason(tx kvdb.RwTx) error {
+	txBucket := tx.ReadWriteBucket(stakingTxBucketName)
+	if txBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	migrated := make(map[string][]byte)
+	err := txBucket.ForEach(func(k, v []byte) error {
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		if !storedTxProto.IsOverflow {
+			return nil
+		}
+
+		storedTxProto.InactiveReason = proto.InactiveReason_INACTIVE_REASON_STAKING_CAP
+
+		marshalled, err := pm.Marshal(&storedTxProto)
+		if err != nil {
+			return err
+		}
+		migrated[string(k)] = marshalled
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the bucket should not be modified while iterating it
+	for k, v := range migrated {
+		if err := txBucket.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateStakerActiveStake fills the active stake of each staker from the
+// stored active staking txs that have not been unbonded
+func migrateStakerActiveStake(tx kvdb.RwTx) error {
+	stakingTxBucket := tx.ReadBucket(stakingTxBucketName)
+	if stakingTxBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	unbondingTxBucket := tx.ReadBucket(unbondingTxBucketName)
+	if unbondingTxBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	stakeBucket := tx.ReadWriteBucket(stakerActiveStakeBucketName)
+	if stakeBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	unbondedStakingTxs := make(map[string]struct{})
+	err := unbondingTxBucket.ForEach(func(_, v []byte) error {
+		var unbondingTxProto proto.UnbondingTransaction
+		if err := pm.Unmarshal(v, &unbondingTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+		unbondedStakingTxs[string(unbondingTxProto.StakingTxHash)] = struct{}{}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	activeStakes := make(map[string]uint64)
+	err = stakingTxBucket.ForEach(func(k, v []byte) error {
+		var stakingTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(v, &stakingTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		if stakingTxProto.IsOverflow {
+			return nil
+		}
+
+		if _, unbonded := unbondedStakingTxs[string(k)]; unbonded {
+			return nil
+		}
+
+		activeStakes[string(stakingTxProto.StakerPk)] += stakingTxProto.StakingValue
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for stakerPk, stake := range activeStakes {
+		if err := stakeBucket.Put([]byte(stakerPk), uint64ToBytes(stake)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateStakingOutputIndex indexes the stored staking txs by the pk script
+// of their staking output
+func migrateStakingOutputIndex(tx kvdb.RwTx) error {
+	txBucket := tx.ReadBucket(stakingTxBucketName)
+	if txBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	stakingTxs := make(map[string]*proto.StakingTransaction)
+	err := txBucket.ForEach(func(k, v []byte) error {
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+		stakingTxs[string(k)] = &storedTxProto
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, st := range stakingTxs {
+		if err := indexStakingOutput(tx, []byte(k), st); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateStakingScore sets the score of the staking txs stored before the
+// field is introduced to their staking value, which is the default score,
+// and fills the total score from the active staking txs that have not been
+// unbonded
+func migrateStakingScore(tx kvdb.RwTx) error {
+	stakingTxBucket := tx.ReadWriteBucket(stakingTxBucketName)
+	if stakingTxBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	unbondingTxBucket := tx.ReadBucket(unbondingTxBucketName)
+	if unbondingTxBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	scoreBucket := tx.ReadWriteBucket(confirmedTvlBucketName)
+	if scoreBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	unbondedStakingTxs := make(map[string]struct{})
+	err := unbondingTxBucket.ForEach(func(_, v []byte) error {
+		var unbondingTxProto proto.UnbondingTransaction
+		if err := pm.Unmarshal(v, &unbondingTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+		unbondedStakingTxs[string(unbondingTxProto.StakingTxHash)] = struct{}{}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var totalScore uint64
+	migrated := make(map[string][]byte)
+	err = stakingTxBucket.ForEach(func(k, v []byte) error {
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		storedTxProto.Score = storedTxProto.StakingValue
+
+		marshalled, err := pm.Marshal(&storedTxProto)
+		if err != nil {
+			return err
+		}
+		migrated[string(k)] = marshalled
+
+		if storedTxProto.IsOverflow {
+			return nil
+		}
+
+		if _, unbonded := unbondedStakingTxs[string(k)]; unbonded {
+			return nil
+		}
+
+		totalScore += storedTxProto.Score
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the bucket should not be modified while iterating it
+	for k, v := range migrated {
+		if err := stakingTxBucket.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+
+	return scoreBucket.Put(getTotalScoreKey(), uint64ToBytes(totalScore))
+}
+
+// migrateStakingUnbondingIndex indexes the stored unbonding txs by the hash
+// of the staking tx they spend
+func migrateStakingUnbondingIndex(tx kvdb.RwTx) error {
+	txBucket := tx.ReadBucket(unbondingTxBucketName)
+	if txBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	unbondingTxs := make(map[string][]byte)
+	err := txBucket.ForEach(func(k, v []byte) error {
+		var unbondingTxProto proto.UnbondingTransaction
+		if err := pm.Unmarshal(v, &unbondingTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+		unbondingTxs[string(unbondingTxProto.StakingTxHash)] = append([]byte(nil), k...)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for stakingHash, unbondingHash := range unbondingTxs {
+		if err := indexStakingUnbonding(tx, []byte(stakingHash), unbondingHash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateWithdrawnStakingTxs converts the withdrawn values recorded before
+// the withdrawal height and timestamp are introduced to withdrawal records,
+// of which the height and timestamp are unknown
+func migrateWithdrawnStakingTxs(tx kvdb.RwTx) error {
+	withdrawnBucket := tx.ReadWriteBucket(withdrawnStakingTxBucketName)
+	if withdrawnBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	migrated := make(map[string][]byte)
+	err := withdrawnBucket.ForEach(func(k, v []byte) error {
+		withdrawnValue, err := uint64FromBytes(v)
+		if err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		marshalled, err := pm.Marshal(&proto.WithdrawnStakingTransaction{
+			WithdrawnValue: withdrawnValue,
+		})
+		if err != nil {
+			return err
+		}
+		migrated[string(k)] = marshalled
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the bucket should not be modified while iterating it
+	for k, v := range migrated {
+		if err := withdrawnBucket.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateStakingStatus sets the status of the staking txs stored before the
+// field is introduced from the unbonding index and the withdrawal records,
+// the status of the others is left as staked
+func migrateStakingStatus(tx kvdb.RwTx) error {
+	indexBucket := tx.ReadBucket(stakingUnbondingIndexBucketName)
+	if indexBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	withdrawnBucket := tx.ReadBucket(withdrawnStakingTxBucketName)
+	if withdrawnBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	statuses := make(map[string]proto.StakingStatus)
+	err := indexBucket.ForEach(func(k, _ []byte) error {
+		statuses[string(k)] = proto.StakingStatus_STAKING_STATUS_UNBONDING
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// a withdrawn staking tx might have been unbonded before
+	err = withdrawnBucket.ForEach(func(k, _ []byte) error {
+		statuses[string(k)] = proto.StakingStatus_STAKING_STATUS_WITHDRAWN
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, status := range statuses {
+		if err := setStakingStatus(tx, []byte(k), status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateStakerIndex indexes the stored staking txs by the pk of their staker
+func migrateStakerIndex(tx kvdb.RwTx) error {
+	txBucket := tx.ReadBucket(stakingTxBucketName)
+	if txBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	stakingTxs := make(map[string]*proto.StakingTransaction)
+	err := txBucket.ForEach(func(k, v []byte) error {
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+		stakingTxs[string(k)] = &storedTxProto
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, st := range stakingTxs {
+		if err := indexStaker(tx, []byte(k), st); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateHeightIndex indexes the stored staking, unbonding, and withdrawal
+// txs by their inclusion height, the withdrawals of which the height is
+// unknown are not indexed
+func migrateHeightIndex(tx kvdb.RwTx) error {
+	stakingTxBucket := tx.ReadBucket(stakingTxBucketName)
+	if stakingTxBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+	unbondingTxBucket := tx.ReadBucket(unbondingTxBucketName)
+	if unbondingTxBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+	withdrawnBucket := tx.ReadBucket(withdrawnStakingTxBucketName)
+	if withdrawnBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	stakingHeights := make(map[string]uint64)
+	err := stakingTxBucket.ForEach(func(k, v []byte) error {
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+		stakingHeights[string(k)] = storedTxProto.InclusionHeight
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	unbondingHeights := make(map[string]uint64)
+	err = unbondingTxBucket.ForEach(func(k, v []byte) error {
+		var storedTxProto proto.UnbondingTransaction
+		if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+		unbondingHeights[string(k)] = storedTxProto.InclusionHeight
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	withdrawalHeights := make(map[string]uint64)
+	err = withdrawnBucket.ForEach(func(k, v []byte) error {
+		var withdrawnProto proto.WithdrawnStakingTransaction
+		if err := pm.Unmarshal(v, &withdrawnProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+		if withdrawnProto.Height != 0 {
+			withdrawalHeights[string(k)] = withdrawnProto.Height
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for typeBucketName, heights := range map[string]map[string]uint64{
+		string(heightIndexStakingBucketName):    stakingHeights,
+		string(heightIndexUnbondingBucketName):  unbondingHeights,
+		string(heightIndexWithdrawalBucketName): withdrawalHeights,
+	} {
+		for k, height := range heights {
+			if err := indexHeight(tx, []byte(typeBucketName), height, []byte(k)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// migrateFinalityProviderActiveStake fills the active stake of each finality
+// provider from the stored active staking txs that have not been unbonded
+func migrateFinalityProviderActiveStake(tx kvdb.RwTx) error {
+	stakingTxBucket := tx.ReadBucket(stakingTxBucketName)
+	if stakingTxBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	unbondingIndexBucket := tx.ReadBucket(stakingUnbondingIndexBucketName)
+	if unbondingIndexBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	stakeBucket := tx.ReadWriteBucket(fpActiveStakeBucketName)
+	if stakeBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	activeStakes := make(map[string]uint64)
+	err := stakingTxBucket.ForEach(func(k, v []byte) error {
+		var stakingTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(v, &stakingTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		if stakingTxProto.IsOverflow {
+			return nil
+		}
+
+		if unbondingIndexBucket.Get(k) != nil {
+			return nil
+		}
+
+		activeStakes[string(stakingTxProto.FinalityProviderPk)] += stakingTxProto.StakingValue
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for fpPk, stake := range activeStakes {
+		if err := stakeBucket.Put([]byte(fpPk), uint64ToBytes(stake)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateFinalityProviderIndex indexes the stored staking txs by the pk of
+// their finality provider
+func migrateFinalityProviderIndex(tx kvdb.RwTx) error {
+	txBucket := tx.ReadBucket(stakingTxBucketName)
+	if txBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	stakingTxs := make(map[string]*proto.StakingTransaction)
+	err := txBucket.ForEach(func(k, v []byte) error {
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+		stakingTxs[string(k)] = &storedTxProto
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, st := range stakingTxs {
+		if err := indexFinalityProvider(tx, []byte(k), st); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateTagIndex indexes the stored staking txs by the staking tag of
+// their OP_RETURN data
+func migrateTagIndex(tx kvdb.RwTx) error {
+	txBucket := tx.ReadBucket(stakingTxBucketName)
+	if txBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	stakingTxs := make(map[string]*proto.StakingTransaction)
+	err := txBucket.ForEach(func(k, v []byte) error {
+		var storedTxProto proto.StakingTransaction
+		if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+		stakingTxs[string(k)] = &storedTxProto
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, st := range stakingTxs {
+		if err := indexTag(tx, []byte(k), st); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateWithdrawnValue sets the withdrawn value of the staking txs withdrawn
+// from the unbonding output to their staking value, which was recorded net
+// of the unbonding fee, and updates the total withdrawn value accordingly
+func migrateWithdrawnValue(tx kvdb.RwTx) error {
+	withdrawnBucket := tx.ReadWriteBucket(withdrawnStakingTxBucketName)
+	if withdrawnBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	stakingTxBucket := tx.ReadBucket(stakingTxBucketName)
+	if stakingTxBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	indexBucket := tx.ReadBucket(stakingUnbondingIndexBucketName)
+	if indexBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	var totalWithdrawnValue uint64
+	migrated := make(map[string][]byte)
+	err := withdrawnBucket.ForEach(func(k, v []byte) error {
+		var withdrawnProto proto.WithdrawnStakingTransaction
+		if err := pm.Unmarshal(v, &withdrawnProto); err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		maybeStakingTx := stakingTxBucket.Get(k)
+		if indexBucket.Get(k) != nil && maybeStakingTx != nil {
+			var stakingTxProto proto.StakingTransaction
+			if err := pm.Unmarshal(maybeStakingTx, &stakingTxProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			if withdrawnProto.WithdrawnValue != stakingTxProto.StakingValue {
+				withdrawnProto.WithdrawnValue = stakingTxProto.StakingValue
+				marshalled, err := pm.Marshal(&withdrawnProto)
+				if err != nil {
+					return err
+				}
+				migrated[string(k)] = marshalled
+			}
+		}
+
+		var err error
+		totalWithdrawnValue, err = utils.AddUint64(totalWithdrawnValue, withdrawnProto.WithdrawnValue)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// the bucket should not be modified while iterating it
+	for k, v := range migrated {
+		if err := withdrawnBucket.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+
+	stateBucket := tx.ReadWriteBucket(indexerStateBucketName)
+	if stateBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	return stateBucket.Put(getTotalWithdrawnValueKey(), uint64ToBytes(totalWithdrawnValue))
+}
@@ -0,0 +1,713 @@
+package indexerstore
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/babylonlabs-io/babylon/btcstaking"
+	bbndatagen "github.com/babylonlabs-io/babylon/testutil/datagen"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/kvdb"
+	"github.com/stretchr/testify/require"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+	"github.com/babylonlabs-io/staking-indexer/testutils"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+func getDbVersion(t *testing.T, db kvdb.Backend) []byte {
+	var dbVersion []byte
+	err := db.View(func(tx kvdb.RTx) error {
+		dbVersion = tx.ReadBucket(indexerStateBucketName).Get(getDbVersionKey())
+		return nil
+	}, func() {})
+	require.NoError(t, err)
+
+	return dbVersion
+}
+
+// versionBefore returns the db version right before the given migration
+// is applied
+func versionBefore(t *testing.T, m migration) uint64 {
+	for i, applied := range migrations {
+		if reflect.ValueOf(applied).Pointer() == reflect.ValueOf(m).Pointer() {
+			return uint64(i)
+		}
+	}
+	require.FailNow(t, "the migration is not found")
+
+	return 0
+}
+
+// genLegacyStakingTx generates a staking tx record of the given staker
+// without the fields introduced by migrations
+func genLegacyStakingTx(t *testing.T, r *rand.Rand, stakerPk *btcec.PublicKey) (chainhash.Hash, *proto.StakingTransaction) {
+	btcTx := bbndatagen.GenRandomTx(r)
+	txBytes, err := utils.SerializeBtcTransaction(btcTx)
+	require.NoError(t, err)
+	_, fpPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+
+	return btcTx.TxHash(), &proto.StakingTransaction{
+		TransactionBytes:   txBytes,
+		InclusionHeight:    uint64(r.Int63n(10000) + 1),
+		StakerPk:           schnorr.SerializePubKey(stakerPk),
+		FinalityProviderPk: schnorr.SerializePubKey(fpPk),
+		StakingTime:        uint32(r.Int31n(1000) + 1),
+		StakingValue:       uint64(r.Int63n(100000) + 1),
+	}
+}
+
+// putLegacyRecords writes the given records and removes the db version to
+// simulate a db written before any migration
+func putLegacyRecords(t *testing.T, db kvdb.Backend, bucket []byte, records map[chainhash.Hash]pm.Message) {
+	err := kvdb.Batch(db, func(tx kvdb.RwTx) error {
+		for k, v := range records {
+			marshalled, err := pm.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if err := tx.ReadWriteBucket(bucket).Put(k[:], marshalled); err != nil {
+				return err
+			}
+		}
+		return tx.ReadWriteBucket(indexerStateBucketName).Delete(getDbVersionKey())
+	})
+	require.NoError(t, err)
+	require.Nil(t, getDbVersion(t, db))
+}
+
+func TestMigrateOpReturnVersion(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	// simulate a record written before the OP_RETURN version is persisted
+	// in a db without the version key
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	txHash, legacyTx := genLegacyStakingTx(t, r, stakerPk)
+	putLegacyRecords(t, db, stakingTxBucketName, map[chainhash.Hash]pm.Message{txHash: legacyTx})
+
+	// re-opening the store runs the migration
+	s, err = NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	storedTx, err := s.GetStakingTransaction(&txHash)
+	require.NoError(t, err)
+	require.NotNil(t, storedTx)
+	require.Equal(t, uint32(0), storedTx.OpReturnVersion)
+	require.Equal(t, legacyTx.StakingValue, storedTx.StakingValue)
+}
+
+func TestMigrateInactiveReasonActiveStakeAndScore(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// the staker has an active tx, an overflow tx and an unbonded tx
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	activeTxHash, activeTx := genLegacyStakingTx(t, r, stakerPk)
+	overflowTxHash, overflowTx := genLegacyStakingTx(t, r, stakerPk)
+	overflowTx.IsOverflow = true
+	unbondedTxHash, unbondedTx := genLegacyStakingTx(t, r, stakerPk)
+	putLegacyRecords(t, db, stakingTxBucketName, map[chainhash.Hash]pm.Message{
+		activeTxHash:   activeTx,
+		overflowTxHash: overflowTx,
+		unbondedTxHash: unbondedTx,
+	})
+	unbondingTx := bbndatagen.GenRandomTx(r)
+	unbondingTxBytes, err := utils.SerializeBtcTransaction(unbondingTx)
+	require.NoError(t, err)
+	putLegacyRecords(t, db, unbondingTxBucketName, map[chainhash.Hash]pm.Message{
+		unbondingTx.TxHash(): &proto.UnbondingTransaction{
+			TransactionBytes: unbondingTxBytes,
+			StakingTxHash:    unbondedTxHash[:],
+		},
+	})
+
+	// re-opening the store runs the migrations
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	storedTx, err := s.GetStakingTransaction(&overflowTxHash)
+	require.NoError(t, err)
+	require.Equal(t, InactiveReasonStakingCap, storedTx.InactiveReason)
+	storedTx, err = s.GetStakingTransaction(&activeTxHash)
+	require.NoError(t, err)
+	require.Equal(t, InactiveReasonNone, storedTx.InactiveReason)
+
+	activeStake, err := s.GetStakerActiveStake(stakerPk)
+	require.NoError(t, err)
+	require.Equal(t, activeTx.StakingValue, activeStake)
+
+	// the score defaults to the staking value and the total score only
+	// counts the active tx
+	for txHash, legacyTx := range map[chainhash.Hash]*proto.StakingTransaction{
+		activeTxHash:   activeTx,
+		overflowTxHash: overflowTx,
+		unbondedTxHash: unbondedTx,
+	} {
+		storedTx, err := s.GetStakingTransaction(&txHash)
+		require.NoError(t, err)
+		require.Equal(t, legacyTx.StakingValue, storedTx.Score)
+	}
+	totalScore, err := s.GetTotalScore()
+	require.NoError(t, err)
+	require.Equal(t, activeTx.StakingValue, totalScore)
+}
+
+func TestMigrateStakingOutputIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// simulate a record written before the staking output index is
+	// introduced, the staking output of the legacy record is the first one
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	txHash, legacyTx := genLegacyStakingTx(t, r, stakerPk)
+	putLegacyRecords(t, db, stakingTxBucketName, map[chainhash.Hash]pm.Message{txHash: legacyTx})
+
+	// re-opening the store runs the migration
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	var btcTx wire.MsgTx
+	err = btcTx.Deserialize(bytes.NewReader(legacyTx.TransactionBytes))
+	require.NoError(t, err)
+	indexedTxs, err := s.GetStakingTransactionsByPkScript(btcTx.TxOut[0].PkScript)
+	require.NoError(t, err)
+	require.Len(t, indexedTxs, 1)
+	require.Equal(t, txHash, indexedTxs[0].Tx.TxHash())
+}
+
+func TestMigrateUnbondingIndexAndWithdrawals(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// simulate an unbonded and withdrawn staking tx recorded before the
+	// unbonding index and the withdrawal records are introduced
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	stakingTxHash, legacyTx := genLegacyStakingTx(t, r, stakerPk)
+	putLegacyRecords(t, db, stakingTxBucketName, map[chainhash.Hash]pm.Message{stakingTxHash: legacyTx})
+	unbondingTx := bbndatagen.GenRandomTx(r)
+	unbondingTxBytes, err := utils.SerializeBtcTransaction(unbondingTx)
+	require.NoError(t, err)
+	putLegacyRecords(t, db, unbondingTxBucketName, map[chainhash.Hash]pm.Message{
+		unbondingTx.TxHash(): &proto.UnbondingTransaction{
+			TransactionBytes: unbondingTxBytes,
+			StakingTxHash:    stakingTxHash[:],
+		},
+	})
+	err = kvdb.Batch(db, func(tx kvdb.RwTx) error {
+		return tx.ReadWriteBucket(withdrawnStakingTxBucketName).Put(stakingTxHash[:], uint64ToBytes(legacyTx.StakingValue))
+	})
+	require.NoError(t, err)
+
+	// re-opening the store runs the migrations
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	storedUnbondingTx, err := s.GetUnbondingTransactionByStakingTxHash(&stakingTxHash)
+	require.NoError(t, err)
+	require.Equal(t, unbondingTx.TxHash(), storedUnbondingTx.Tx.TxHash())
+	require.Zero(t, storedUnbondingTx.InclusionHeight)
+
+	// the height and timestamp of the withdrawal are unknown
+	withdrawn, err := s.GetWithdrawnStakingTransaction(&stakingTxHash)
+	require.NoError(t, err)
+	require.Equal(t, &StoredWithdrawnStakingTransaction{WithdrawnValue: legacyTx.StakingValue}, withdrawn)
+}
+
+func TestMigrateStakingStatus(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// simulate a staked, an unbonded, an unbonded and withdrawn, and a
+	// withdrawn staking tx stored before the status is introduced
+	legacyTxs := make(map[chainhash.Hash]pm.Message)
+	var hashes []chainhash.Hash
+	for i := 0; i < 4; i++ {
+		_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+		require.NoError(t, err)
+		stakingTxHash, legacyTx := genLegacyStakingTx(t, r, stakerPk)
+		legacyTxs[stakingTxHash] = legacyTx
+		hashes = append(hashes, stakingTxHash)
+	}
+	putLegacyRecords(t, db, stakingTxBucketName, legacyTxs)
+
+	legacyUnbondingTxs := make(map[chainhash.Hash]pm.Message)
+	for _, stakingTxHash := range hashes[1:3] {
+		unbondingTx := bbndatagen.GenRandomTx(r)
+		unbondingTxBytes, err := utils.SerializeBtcTransaction(unbondingTx)
+		require.NoError(t, err)
+		legacyUnbondingTxs[unbondingTx.TxHash()] = &proto.UnbondingTransaction{
+			TransactionBytes: unbondingTxBytes,
+			StakingTxHash:    stakingTxHash[:],
+		}
+	}
+	putLegacyRecords(t, db, unbondingTxBucketName, legacyUnbondingTxs)
+
+	err = kvdb.Batch(db, func(tx kvdb.RwTx) error {
+		for _, stakingTxHash := range hashes[2:] {
+			value := legacyTxs[stakingTxHash].(*proto.StakingTransaction).StakingValue
+			if err := tx.ReadWriteBucket(withdrawnStakingTxBucketName).Put(stakingTxHash[:], uint64ToBytes(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// re-opening the store runs the migrations
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	expectedStatuses := []StakingStatus{
+		StakingStatusStaked,
+		StakingStatusUnbonding,
+		StakingStatusWithdrawn,
+		StakingStatusWithdrawn,
+	}
+	for i, stakingTxHash := range hashes {
+		storedTx, err := s.GetStakingTransaction(&stakingTxHash)
+		require.NoError(t, err)
+		require.Equal(t, expectedStatuses[i], storedTx.Status)
+	}
+}
+
+func TestDbVersionMismatch(t *testing.T) {
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	setDbVersion := func(version uint64) {
+		err := kvdb.Batch(db, func(tx kvdb.RwTx) error {
+			return tx.ReadWriteBucket(indexerStateBucketName).Put(getDbVersionKey(), uint64ToBytes(version))
+		})
+		require.NoError(t, err)
+	}
+
+	// a db written by a newer binary is refused
+	setDbVersion(uint64(len(migrations)) + 1)
+	_, err = NewIndexerStore(db)
+	require.ErrorIs(t, err, ErrIncompatibleDbVersion)
+	_, err = OpenIndexerStore(db)
+	require.ErrorIs(t, err, ErrIncompatibleDbVersion)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))+1), getDbVersion(t, db))
+
+	// a db written by a newer binary is left unmodified, e.g., the buckets
+	// it does not have are not created
+	newerDb := testutils.MakeTestBackend(t)
+	err = kvdb.Batch(newerDb, func(tx kvdb.RwTx) error {
+		stateBucket, err := tx.CreateTopLevelBucket(indexerStateBucketName)
+		if err != nil {
+			return err
+		}
+		return stateBucket.Put(getDbVersionKey(), uint64ToBytes(uint64(len(migrations))+1))
+	})
+	require.NoError(t, err)
+	_, err = NewIndexerStore(newerDb)
+	require.ErrorIs(t, err, ErrIncompatibleDbVersion)
+	var bucketNames []string
+	err = newerDb.View(func(tx kvdb.RTx) error {
+		return tx.ForEachBucket(func(k []byte) error {
+			bucketNames = append(bucketNames, string(k))
+			return nil
+		})
+	}, func() {
+		bucketNames = nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{string(indexerStateBucketName)}, bucketNames)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))+1), getDbVersion(t, newerDb))
+
+	// a db written by an older binary is only opened once migrated
+	setDbVersion(uint64(len(migrations)) - 1)
+	_, err = OpenIndexerStore(db)
+	require.ErrorIs(t, err, ErrOutdatedDbVersion)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))-1), getDbVersion(t, db))
+	_, err = NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+	_, err = OpenIndexerStore(db)
+	require.NoError(t, err)
+
+	// an uninitialized db is not opened
+	_, err = OpenIndexerStore(testutils.MakeTestBackend(t))
+	require.ErrorIs(t, err, ErrOutdatedDbVersion)
+}
+
+func TestMigrateStakerIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// simulate the records of two stakers written before the staker
+	// index is introduced
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	_, otherStakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	records := make(map[chainhash.Hash]pm.Message)
+	stakerTxHashes := make(map[chainhash.Hash]struct{})
+	for i := 0; i < 3; i++ {
+		txHash, legacyTx := genLegacyStakingTx(t, r, stakerPk)
+		records[txHash] = legacyTx
+		stakerTxHashes[txHash] = struct{}{}
+	}
+	otherTxHash, otherLegacyTx := genLegacyStakingTx(t, r, otherStakerPk)
+	records[otherTxHash] = otherLegacyTx
+	putLegacyRecords(t, db, stakingTxBucketName, records)
+
+	// re-opening the store runs the migration
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	indexedTxs, err := s.GetStakingTransactionsByStaker(stakerPk)
+	require.NoError(t, err)
+	require.Len(t, indexedTxs, len(stakerTxHashes))
+	for _, indexedTx := range indexedTxs {
+		require.Contains(t, stakerTxHashes, indexedTx.Tx.TxHash())
+	}
+
+	indexedTxs, err = s.GetStakingTransactionsByStaker(otherStakerPk)
+	require.NoError(t, err)
+	require.Len(t, indexedTxs, 1)
+	require.Equal(t, otherTxHash, indexedTxs[0].Tx.TxHash())
+}
+
+func TestMigrateHeightIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// simulate the records written before the height index is introduced,
+	// i.e., two staking txs at the same height, an unbonding tx, and the
+	// withdrawals with and without the height
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	height := uint64(r.Int63n(10000) + 1)
+	stakingRecords := make(map[chainhash.Hash]pm.Message)
+	stakingTxHashes := make([]chainhash.Hash, 0, 2)
+	for i := 0; i < 2; i++ {
+		txHash, legacyTx := genLegacyStakingTx(t, r, stakerPk)
+		legacyTx.InclusionHeight = height
+		stakingRecords[txHash] = legacyTx
+		stakingTxHashes = append(stakingTxHashes, txHash)
+	}
+	putLegacyRecords(t, db, stakingTxBucketName, stakingRecords)
+
+	unbondingTx := bbndatagen.GenRandomTx(r)
+	unbondingTxBytes, err := utils.SerializeBtcTransaction(unbondingTx)
+	require.NoError(t, err)
+	putLegacyRecords(t, db, unbondingTxBucketName, map[chainhash.Hash]pm.Message{
+		unbondingTx.TxHash(): &proto.UnbondingTransaction{
+			TransactionBytes: unbondingTxBytes,
+			StakingTxHash:    stakingTxHashes[0][:],
+			InclusionHeight:  height + 1,
+		},
+	})
+
+	putLegacyRecords(t, db, withdrawnStakingTxBucketName, map[chainhash.Hash]pm.Message{
+		stakingTxHashes[0]: &proto.WithdrawnStakingTransaction{
+			WithdrawnValue: uint64(r.Int63n(100000) + 1),
+			Height:         height + 2,
+		},
+		// the height of the withdrawals migrated from the withdrawn values
+		// is unknown
+		stakingTxHashes[1]: &proto.WithdrawnStakingTransaction{
+			WithdrawnValue: uint64(r.Int63n(100000) + 1),
+		},
+	})
+	// the withdrawal records are in the format of the version right before
+	// the height index is introduced
+	err = kvdb.Batch(db, func(tx kvdb.RwTx) error {
+		return tx.ReadWriteBucket(indexerStateBucketName).Put(
+			getDbVersionKey(), uint64ToBytes(versionBefore(t, migrateHeightIndex)),
+		)
+	})
+	require.NoError(t, err)
+
+	// re-opening the store runs the migration
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	for h, expected := range map[uint64][3]int{
+		0:          {0, 0, 0},
+		height:     {2, 0, 0},
+		height + 1: {0, 1, 0},
+		height + 2: {0, 0, 1},
+	} {
+		stakingCount, unbondingCount, withdrawalCount, err := s.GetBlockStats(h)
+		require.NoError(t, err)
+		require.Equal(t, expected, [3]int{stakingCount, unbondingCount, withdrawalCount})
+	}
+}
+
+func TestMigrateFinalityProviderActiveStake(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// the finality provider has an active tx, an overflow tx and an
+	// unbonded tx, and another finality provider has an active tx
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	_, fpPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	records := make(map[chainhash.Hash]pm.Message)
+	var activeTx *proto.StakingTransaction
+	var unbondedTxHash chainhash.Hash
+	for i := 0; i < 3; i++ {
+		txHash, legacyTx := genLegacyStakingTx(t, r, stakerPk)
+		legacyTx.FinalityProviderPk = schnorr.SerializePubKey(fpPk)
+		switch i {
+		case 0:
+			activeTx = legacyTx
+		case 1:
+			legacyTx.IsOverflow = true
+		case 2:
+			unbondedTxHash = txHash
+		}
+		records[txHash] = legacyTx
+	}
+	otherTxHash, otherTx := genLegacyStakingTx(t, r, stakerPk)
+	records[otherTxHash] = otherTx
+	putLegacyRecords(t, db, stakingTxBucketName, records)
+
+	unbondingTx := bbndatagen.GenRandomTx(r)
+	unbondingTxBytes, err := utils.SerializeBtcTransaction(unbondingTx)
+	require.NoError(t, err)
+	putLegacyRecords(t, db, unbondingTxBucketName, map[chainhash.Hash]pm.Message{
+		unbondingTx.TxHash(): &proto.UnbondingTransaction{
+			TransactionBytes: unbondingTxBytes,
+			StakingTxHash:    unbondedTxHash[:],
+		},
+	})
+
+	// re-opening the store runs the migrations
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	activeStake, err := s.GetFinalityProviderActiveStake(fpPk)
+	require.NoError(t, err)
+	require.Equal(t, activeTx.StakingValue, activeStake)
+
+	otherFpPk, err := schnorr.ParsePubKey(otherTx.FinalityProviderPk)
+	require.NoError(t, err)
+	activeStake, err = s.GetFinalityProviderActiveStake(otherFpPk)
+	require.NoError(t, err)
+	require.Equal(t, otherTx.StakingValue, activeStake)
+}
+
+func TestMigrateFinalityProviderIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// simulate the records of two staking txs delegating to the same
+	// finality provider written before the finality provider index is
+	// introduced
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	records := make(map[chainhash.Hash]pm.Message)
+	txHash1, legacyTx1 := genLegacyStakingTx(t, r, stakerPk)
+	txHash2, legacyTx2 := genLegacyStakingTx(t, r, stakerPk)
+	legacyTx2.FinalityProviderPk = legacyTx1.FinalityProviderPk
+	records[txHash1] = legacyTx1
+	records[txHash2] = legacyTx2
+	putLegacyRecords(t, db, stakingTxBucketName, records)
+
+	// re-opening the store runs the migration
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	fpPks, err := s.ListFinalityProviders()
+	require.NoError(t, err)
+	require.Len(t, fpPks, 1)
+	require.Equal(t, legacyTx1.FinalityProviderPk, schnorr.SerializePubKey(fpPks[0]))
+
+	indexedTxs, err := s.GetStakingTransactionsByFinalityProvider(fpPks[0])
+	require.NoError(t, err)
+	require.Len(t, indexedTxs, 2)
+}
+
+func TestMigrateTagIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// simulate the records of a staking tx carrying a staking tag and a
+	// staking tx without OP_RETURN data written before the tag index is
+	// introduced
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	_, legacyTx := genLegacyStakingTx(t, r, stakerPk)
+	fpPk, err := schnorr.ParsePubKey(legacyTx.FinalityProviderPk)
+	require.NoError(t, err)
+	tag := []byte{0x01, 0x02, 0x03, 0x04}
+	opReturnData, err := btcstaking.NewV0OpReturnDataFromParsed(tag, stakerPk, fpPk, uint16(legacyTx.StakingTime))
+	require.NoError(t, err)
+	opReturnOutput, err := opReturnData.ToTxOutput()
+	require.NoError(t, err)
+	btcTx := bbndatagen.GenRandomTx(r)
+	btcTx.AddTxOut(opReturnOutput)
+	legacyTx.TransactionBytes, err = utils.SerializeBtcTransaction(btcTx)
+	require.NoError(t, err)
+	untaggedTxHash, untaggedTx := genLegacyStakingTx(t, r, stakerPk)
+	putLegacyRecords(t, db, stakingTxBucketName, map[chainhash.Hash]pm.Message{
+		btcTx.TxHash(): legacyTx,
+		untaggedTxHash: untaggedTx,
+	})
+
+	// re-opening the store runs the migration
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	indexedTxs, err := s.GetStakingTransactionsByTag(tag)
+	require.NoError(t, err)
+	require.Len(t, indexedTxs, 1)
+	require.Equal(t, btcTx.TxHash(), indexedTxs[0].Tx.TxHash())
+}
+
+func TestMigrateWithdrawnValue(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// simulate a staking tx withdrawn from the unbonding output, of which
+	// the withdrawn value is net of the unbonding fee, and a staking tx
+	// withdrawn from the staking output
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	unbondedTxHash, unbondedTx := genLegacyStakingTx(t, r, stakerPk)
+	withdrawnTxHash, withdrawnTx := genLegacyStakingTx(t, r, stakerPk)
+	putLegacyRecords(t, db, stakingTxBucketName, map[chainhash.Hash]pm.Message{
+		unbondedTxHash:  unbondedTx,
+		withdrawnTxHash: withdrawnTx,
+	})
+	unbondingTxHash := bbndatagen.GenRandomBtcdHash(r)
+	err = kvdb.Batch(db, func(tx kvdb.RwTx) error {
+		if err := tx.ReadWriteBucket(stakingUnbondingIndexBucketName).Put(unbondedTxHash[:], unbondingTxHash[:]); err != nil {
+			return err
+		}
+		for k, v := range map[chainhash.Hash]uint64{
+			unbondedTxHash:  unbondedTx.StakingValue - 1,
+			withdrawnTxHash: withdrawnTx.StakingValue,
+		} {
+			marshalled, err := pm.Marshal(&proto.WithdrawnStakingTransaction{WithdrawnValue: v})
+			if err != nil {
+				return err
+			}
+			if err := tx.ReadWriteBucket(withdrawnStakingTxBucketName).Put(k[:], marshalled); err != nil {
+				return err
+			}
+		}
+		return tx.ReadWriteBucket(indexerStateBucketName).Put(
+			getDbVersionKey(), uint64ToBytes(versionBefore(t, migrateWithdrawnValue)),
+		)
+	})
+	require.NoError(t, err)
+
+	// re-opening the store runs the migration
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	withdrawn, err := s.GetWithdrawnStakingTransaction(&unbondedTxHash)
+	require.NoError(t, err)
+	require.Equal(t, unbondedTx.StakingValue, withdrawn.WithdrawnValue)
+	withdrawn, err = s.GetWithdrawnStakingTransaction(&withdrawnTxHash)
+	require.NoError(t, err)
+	require.Equal(t, withdrawnTx.StakingValue, withdrawn.WithdrawnValue)
+	totalWithdrawnValue, err := s.GetTotalWithdrawnValue()
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(unbondedTx.StakingValue+withdrawnTx.StakingValue), totalWithdrawnValue)
+}
+
+// TestSpendingTxOfMigratedUnbondingTx tests that the unbonding txs stored
+// before the staking unbonding index are found as the spenders of the
+// staking outputs once the index is migrated
+func TestSpendingTxOfMigratedUnbondingTx(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	db := testutils.MakeTestBackend(t)
+	_, err := NewIndexerStore(db)
+	require.NoError(t, err)
+
+	// simulate the records of an unbonded staking tx and an unspent one
+	// written before the staking unbonding index
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	stakingTxHash, stakingTx := genLegacyStakingTx(t, r, stakerPk)
+	stakingTx.StakingOutputIdx = 1
+	unspentTxHash, unspentTx := genLegacyStakingTx(t, r, stakerPk)
+	putLegacyRecords(t, db, stakingTxBucketName, map[chainhash.Hash]pm.Message{
+		stakingTxHash: stakingTx,
+		unspentTxHash: unspentTx,
+	})
+	unbondingTx := bbndatagen.GenRandomTx(r)
+	unbondingTxBytes, err := utils.SerializeBtcTransaction(unbondingTx)
+	require.NoError(t, err)
+	unbondingTxHash := unbondingTx.TxHash()
+	putLegacyRecords(t, db, unbondingTxBucketName, map[chainhash.Hash]pm.Message{
+		unbondingTxHash: &proto.UnbondingTransaction{
+			TransactionBytes: unbondingTxBytes,
+			StakingTxHash:    stakingTxHash[:],
+		},
+	})
+
+	// re-opening the store runs the migrations
+	s, err := NewIndexerStore(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64ToBytes(uint64(len(migrations))), getDbVersion(t, db))
+
+	spendingTxHash, err := s.GetSpendingTx(wire.NewOutPoint(&stakingTxHash, 1))
+	require.NoError(t, err)
+	require.NotNil(t, spendingTxHash)
+	require.Equal(t, unbondingTxHash, *spendingTxHash)
+
+	for _, outpoint := range []*wire.OutPoint{
+		wire.NewOutPoint(&stakingTxHash, 0),
+		wire.NewOutPoint(&unspentTxHash, 0),
+	} {
+		spendingTxHash, err := s.GetSpendingTx(outpoint)
+		require.NoError(t, err)
+		require.Nil(t, spendingTxHash)
+	}
+}
@@ -0,0 +1,116 @@
+package indexerstore
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/lightningnetwork/lnd/kvdb"
+)
+
+var (
+	// mapping inclusion height and sequence number of the event within
+	// the block -> emit height and the serialized event held back
+	pendingEventBucketName = []byte("pendingevents")
+)
+
+const (
+	// pendingEventKeyLen is the length of the key of a pending event, i.e.,
+	// the inclusion height followed by the 4 big-endian bytes of the
+	// sequence number
+	pendingEventKeyLen = uint64KeyLen + 4
+)
+
+// StoredPendingEvent is an event of a confirmed tx that is held back until
+// the tx reaches the configured number of confirmations
+type StoredPendingEvent struct {
+	// Height is the inclusion height of the tx
+	Height uint64
+	// Seq is the sequence number of the event among the held back events
+	// of the txs in the block
+	Seq uint32
+	// EmitHeight is the lowest tip height at which the event can be emitted
+	EmitHeight uint64
+	// Event is the serialized event, which is opaque to the store
+	Event []byte
+}
+
+func pendingEventKey(height uint64, seq uint32) []byte {
+	key := make([]byte, 0, pendingEventKeyLen)
+	key = append(key, uint64ToBytes(height)...)
+	return binary.BigEndian.AppendUint32(key, seq)
+}
+
+// AddPendingEvent saves the given pending event, the pending event saved
+// before with the same height and sequence number is replaced, e.g., when
+// the block is handled again after restart
+func (is *IndexerStore) AddPendingEvent(e *StoredPendingEvent) error {
+	value := make([]byte, 0, uint64KeyLen+len(e.Event))
+	value = append(value, uint64ToBytes(e.EmitHeight)...)
+	value = append(value, e.Event...)
+
+	return is.batch(func(tx kvdb.RwTx) error {
+		pendingBucket := tx.ReadWriteBucket(pendingEventBucketName)
+		if pendingBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		return pendingBucket.Put(pendingEventKey(e.Height, e.Seq), value)
+	})
+}
+
+// GetPendingEvents returns all the pending events in the order they are
+// held back, i.e., by the inclusion heights and the sequence numbers
+func (is *IndexerStore) GetPendingEvents() ([]*StoredPendingEvent, error) {
+	var events []*StoredPendingEvent
+	err := is.view(func(tx kvdb.RTx) error {
+		pendingBucket := tx.ReadBucket(pendingEventBucketName)
+		if pendingBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		return pendingBucket.ForEach(func(k, v []byte) error {
+			if len(k) != pendingEventKeyLen || len(v) < uint64KeyLen {
+				return fmt.Errorf("%w: invalid pending event record", ErrCorruptedStateDb)
+			}
+
+			height, err := uint64FromBytes(k[:uint64KeyLen])
+			if err != nil {
+				return err
+			}
+			emitHeight, err := uint64FromBytes(v[:uint64KeyLen])
+			if err != nil {
+				return err
+			}
+
+			events = append(events, &StoredPendingEvent{
+				Height:     height,
+				Seq:        binary.BigEndian.Uint32(k[uint64KeyLen:]),
+				EmitHeight: emitHeight,
+				// the values are only valid during the db transaction
+				Event: append([]byte(nil), v[uint64KeyLen:]...),
+			})
+
+			return nil
+		})
+	}, func() {
+		events = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// DeletePendingEvent deletes the pending event of the given height and
+// sequence number once it is emitted, it does nothing if it is not found
+func (is *IndexerStore) DeletePendingEvent(height uint64, seq uint32) error {
+	return is.batch(func(tx kvdb.RwTx) error {
+		pendingBucket := tx.ReadWriteBucket(pendingEventBucketName)
+		if pendingBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		return pendingBucket.Delete(pendingEventKey(height, seq))
+	})
+}
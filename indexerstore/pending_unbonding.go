@@ -0,0 +1,225 @@
+package indexerstore
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/kvdb"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+)
+
+var (
+	// mapping height at which the unbonding is applied and unbonding tx
+	// hash -> hash of the staking tx the pending unbonding tx spends
+	pendingUnbondingBucketName = []byte("pendingunbondings")
+)
+
+// AddPendingUnbondingTransaction stores the unbonding tx like
+// AddUnbondingTransaction, but holds applying it to the staking tx pending
+// until ApplyPendingUnbondingTransactions is called with a height not lower
+// than the given applyHeight. Until then, the staking tx stays staked and its
+// stake is kept in the confirmed tvl, the total score, and the active stakes
+func (is *IndexerStore) AddPendingUnbondingTransaction(
+	tx *wire.MsgTx,
+	stakingTxHash *chainhash.Hash,
+	inclusionHeight uint64,
+	inclusionTimestamp int64,
+	applyHeight uint64,
+) error {
+	txHash := tx.TxHash()
+	ut := &StoredUnbondingTransaction{
+		Tx:                 tx,
+		StakingTxHash:      stakingTxHash,
+		InclusionHeight:    inclusionHeight,
+		InclusionTimestamp: inclusionTimestamp,
+	}
+
+	msg, err := ut.ToProto()
+	if err != nil {
+		return err
+	}
+
+	return is.addUnbondingTransaction(txHash[:], stakingTxHash.CloneBytes(), msg, applyHeight)
+}
+
+func addPendingUnbonding(tx kvdb.RwTx, applyHeight uint64, txHashBytes, stakingHashBytes []byte) error {
+	pendingBucket := tx.ReadWriteBucket(pendingUnbondingBucketName)
+	if pendingBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	txHash, err := chainhash.NewHash(txHashBytes)
+	if err != nil {
+		return err
+	}
+
+	return pendingBucket.Put(uint64TxKey(applyHeight, txHash), stakingHashBytes)
+}
+
+// ApplyPendingUnbondingTransactions applies the pending unbonding txs of
+// which the apply height is not higher than the given height to the staking
+// txs they spend, and returns the hashes of these staking txs in the order
+// of the apply heights
+func (is *IndexerStore) ApplyPendingUnbondingTransactions(height uint64) ([]*chainhash.Hash, error) {
+	var stakingTxHashes []*chainhash.Hash
+	err := is.batch(func(tx kvdb.RwTx) error {
+		stakingTxHashes = nil
+
+		pendingBucket := tx.ReadWriteBucket(pendingUnbondingBucketName)
+		if pendingBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		var keys [][]byte
+		c := pendingBucket.ReadCursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			applyHeight, _, err := uint64TxFromKey(k)
+			if err != nil {
+				return err
+			}
+			if applyHeight > height {
+				break
+			}
+
+			if err := is.applyUnbonding(tx, v); err != nil {
+				return err
+			}
+
+			stakingTxHash, err := chainhash.NewHash(v)
+			if err != nil {
+				return err
+			}
+			stakingTxHashes = append(stakingTxHashes, stakingTxHash)
+			keys = append(keys, append([]byte{}, k...))
+		}
+
+		for _, k := range keys {
+			if err := pendingBucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stakingTxHashes, nil
+}
+
+// GetPendingUnbondingStakingTxs returns the staking txs spent by the pending
+// unbonding txs of which the apply height is not higher than the given
+// height, in the order of the apply heights
+func (is *IndexerStore) GetPendingUnbondingStakingTxs(height uint64) ([]*StoredStakingTransaction, error) {
+	var stakingTxs []*StoredStakingTransaction
+	err := is.view(func(tx kvdb.RTx) error {
+		pendingBucket := tx.ReadBucket(pendingUnbondingBucketName)
+		if pendingBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		stakingTxBucket := tx.ReadBucket(stakingTxBucketName)
+		if stakingTxBucket == nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		c := pendingBucket.ReadCursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			applyHeight, _, err := uint64TxFromKey(k)
+			if err != nil {
+				return err
+			}
+			if applyHeight > height {
+				break
+			}
+
+			maybeStakingTx := stakingTxBucket.Get(v)
+			if maybeStakingTx == nil {
+				return ErrTransactionNotFound
+			}
+			var storedTxProto proto.StakingTransaction
+			if err := pm.Unmarshal(maybeStakingTx, &storedTxProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+			storedTx, err := protoStakingTxToStoredStakingTx(&storedTxProto)
+			if err != nil {
+				return err
+			}
+			stakingTxs = append(stakingTxs, storedTx)
+		}
+
+		return nil
+	}, func() {
+		stakingTxs = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stakingTxs, nil
+}
+
+// IsUnbondingPending returns whether the staking tx of the given hash is
+// spent by an unbonding tx that is not applied yet
+func (is *IndexerStore) IsUnbondingPending(stakingTxHash *chainhash.Hash) (bool, error) {
+	var pending bool
+	err := is.view(func(tx kvdb.RTx) error {
+		var err error
+		pending, err = hasPendingUnbonding(tx, stakingTxHash[:])
+		return err
+	}, func() {
+		pending = false
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return pending, nil
+}
+
+// hasPendingUnbonding returns whether the staking tx of the given hash is
+// spent by an unbonding tx that is not applied yet
+func hasPendingUnbonding(tx kvdb.RTx, stakingHashBytes []byte) (bool, error) {
+	pendingBucket := tx.ReadBucket(pendingUnbondingBucketName)
+	if pendingBucket == nil {
+		return false, ErrCorruptedStateDb
+	}
+
+	var pending bool
+	err := pendingBucket.ForEach(func(_, v []byte) error {
+		if bytes.Equal(v, stakingHashBytes) {
+			pending = true
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return pending, nil
+}
+
+// isUnbondingApplied returns whether the staking tx of the given hash is
+// spent by an unbonding tx that is applied, i.e., the unbonding tx is
+// recorded and not pending, so that the stake of the staking tx is
+// subtracted if it was active
+func isUnbondingApplied(tx kvdb.RTx, stakingHashBytes []byte) (bool, error) {
+	indexBucket := tx.ReadBucket(stakingUnbondingIndexBucketName)
+	if indexBucket == nil {
+		return false, ErrCorruptedStateDb
+	}
+	if indexBucket.Get(stakingHashBytes) == nil {
+		return false, nil
+	}
+
+	pending, err := hasPendingUnbonding(tx, stakingHashBytes)
+	if err != nil {
+		return false, err
+	}
+
+	return !pending, nil
+}
@@ -0,0 +1,155 @@
+package indexerstore
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	bbndatagen "github.com/babylonlabs-io/babylon/testutil/datagen"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+	"github.com/babylonlabs-io/staking-indexer/testutils"
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+// TestOverrideEligibilityPendingUnbonding tests that overriding the
+// eligibility of a staking tx of which the unbonding is pending adjusts the
+// counters as for a staked tx, so that applying the unbonding afterwards
+// leaves the counters as if the staking tx never counted
+func TestOverrideEligibilityPendingUnbonding(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for _, tc := range []struct {
+		name        string
+		wasOverflow bool
+		isOverflow  bool
+		reason      InactiveReason
+		expectedTvl func(kept, overridden uint64) uint64
+	}{
+		{"active to ineligible", false, true, InactiveReasonManual, func(kept, _ uint64) uint64 {
+			return kept
+		}},
+		{"ineligible to eligible", true, false, InactiveReasonNone, func(kept, overridden uint64) uint64 {
+			return kept + overridden
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := NewIndexerStore(testutils.MakeTestBackend(t))
+			require.NoError(t, err)
+
+			// the kept tx stays active so that the counters are not 0
+			_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+			require.NoError(t, err)
+			keptHash, keptTx := genLegacyStakingTx(t, r, stakerPk)
+			keptTx.Score = keptTx.StakingValue
+			err = s.addStakingTransaction(keptHash[:], keptTx)
+			require.NoError(t, err)
+
+			txHash, stakingTx := genLegacyStakingTx(t, r, stakerPk)
+			stakingTx.Score = stakingTx.StakingValue
+			stakingTx.IsOverflow = tc.wasOverflow
+			if tc.wasOverflow {
+				stakingTx.InactiveReason = proto.InactiveReason(InactiveReasonStakingCap)
+			}
+			err = s.addStakingTransaction(txHash[:], stakingTx)
+			require.NoError(t, err)
+
+			unbondingTx := bbndatagen.GenRandomTx(r)
+			unbondingTxBytes, err := utils.SerializeBtcTransaction(unbondingTx)
+			require.NoError(t, err)
+			unbondingTxHash := unbondingTx.TxHash()
+			applyHeight := stakingTx.InclusionHeight + 10
+			err = s.addUnbondingTransaction(unbondingTxHash[:], txHash[:], &proto.UnbondingTransaction{
+				TransactionBytes: unbondingTxBytes,
+				StakingTxHash:    txHash[:],
+			}, applyHeight)
+			require.NoError(t, err)
+
+			requireCounters := func(tvl uint64, fpStake uint64) {
+				confirmedTvl, err := s.GetConfirmedTvl()
+				require.NoError(t, err)
+				require.Equal(t, tvl, confirmedTvl)
+				totalScore, err := s.GetTotalScore()
+				require.NoError(t, err)
+				require.Equal(t, tvl, totalScore)
+				stakerStake, err := s.GetStakerActiveStake(stakerPk)
+				require.NoError(t, err)
+				require.Equal(t, tvl, stakerStake)
+				fpPk, err := schnorr.ParsePubKey(stakingTx.FinalityProviderPk)
+				require.NoError(t, err)
+				stake, err := s.GetFinalityProviderActiveStake(fpPk)
+				require.NoError(t, err)
+				require.Equal(t, fpStake, stake)
+			}
+
+			_, err = s.OverrideEligibility(&txHash, tc.isOverflow, tc.reason, time.Now().Unix())
+			require.NoError(t, err)
+			overriddenTvl := tc.expectedTvl(keptTx.StakingValue, stakingTx.StakingValue)
+			requireCounters(overriddenTvl, overriddenTvl-keptTx.StakingValue)
+
+			// applying the unbonding subtracts the stake if
+			// the staking tx is active after the override
+			stakingTxHashes, err := s.ApplyPendingUnbondingTransactions(applyHeight)
+			require.NoError(t, err)
+			require.Len(t, stakingTxHashes, 1)
+			requireCounters(keptTx.StakingValue, 0)
+
+			// the stake of the unbonded tx is not adjusted
+			// by the overrides afterwards
+			reason := InactiveReasonNone
+			if tc.wasOverflow {
+				reason = InactiveReasonManual
+			}
+			_, err = s.OverrideEligibility(&txHash, tc.wasOverflow, reason, time.Now().Unix())
+			require.NoError(t, err)
+			requireCounters(keptTx.StakingValue, 0)
+		})
+	}
+}
+
+// TestForEachStakingTransactionPendingUnbonding tests that a staking tx of
+// which the unbonding is pending is not reported as unbonded until the
+// unbonding is applied
+func TestForEachStakingTransactionPendingUnbonding(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	s, err := NewIndexerStore(testutils.MakeTestBackend(t))
+	require.NoError(t, err)
+
+	_, stakerPk, err := bbndatagen.GenRandomBTCKeyPair(r)
+	require.NoError(t, err)
+	txHash, stakingTx := genLegacyStakingTx(t, r, stakerPk)
+	err = s.addStakingTransaction(txHash[:], stakingTx)
+	require.NoError(t, err)
+
+	unbondingTx := bbndatagen.GenRandomTx(r)
+	unbondingTxBytes, err := utils.SerializeBtcTransaction(unbondingTx)
+	require.NoError(t, err)
+	unbondingTxHash := unbondingTx.TxHash()
+	applyHeight := stakingTx.InclusionHeight + 10
+	err = s.addUnbondingTransaction(unbondingTxHash[:], txHash[:], &proto.UnbondingTransaction{
+		TransactionBytes: unbondingTxBytes,
+		StakingTxHash:    txHash[:],
+	}, applyHeight)
+	require.NoError(t, err)
+
+	requireUnbonded := func(expected bool) {
+		n := 0
+		err := s.ForEachStakingTransaction(func(storedTx *StoredStakingTransaction, isUnbonded bool) error {
+			require.Equal(t, txHash, storedTx.Tx.TxHash())
+			require.Equal(t, expected, isUnbonded)
+			n++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	}
+
+	requireUnbonded(false)
+
+	_, err = s.ApplyPendingUnbondingTransactions(applyHeight)
+	require.NoError(t, err)
+	requireUnbonded(true)
+}
@@ -0,0 +1,95 @@
+package indexerstore
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/kvdb"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+)
+
+var (
+	// mapping height -> header of the processed block at the height
+	processedHeaderBucketName = []byte("processedheaders")
+)
+
+// StoredProcessedHeader is the header of a processed confirmed block
+type StoredProcessedHeader struct {
+	Hash      chainhash.Hash
+	PrevHash  chainhash.Hash
+	Height    uint64
+	Timestamp time.Time
+}
+
+// AddProcessedHeader saves the header of the processed block, the header
+// saved before at the same height is replaced
+func (is *IndexerStore) AddProcessedHeader(header *StoredProcessedHeader) error {
+	marshalled, err := pm.Marshal(&proto.ProcessedHeader{
+		Hash:      header.Hash[:],
+		PrevHash:  header.PrevHash[:],
+		Height:    header.Height,
+		Timestamp: header.Timestamp.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return is.batch(func(tx kvdb.RwTx) error {
+		headerBucket := tx.ReadWriteBucket(processedHeaderBucketName)
+		if headerBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		return headerBucket.Put(uint64ToBytes(header.Height), marshalled)
+	})
+}
+
+// GetProcessedHeader returns the header of the processed block at the given
+// height, it returns nil if no block at the height has been processed since
+// the headers are stored
+func (is *IndexerStore) GetProcessedHeader(height uint64) (*StoredProcessedHeader, error) {
+	var header *StoredProcessedHeader
+	err := is.view(func(tx kvdb.RTx) error {
+		headerBucket := tx.ReadBucket(processedHeaderBucketName)
+		if headerBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		v := headerBucket.Get(uint64ToBytes(height))
+		if v == nil {
+			return nil
+		}
+
+		var headerProto proto.ProcessedHeader
+		if err := pm.Unmarshal(v, &headerProto); err != nil {
+			return ErrCorruptedStateDb
+		}
+
+		hash, err := chainhash.NewHash(headerProto.Hash)
+		if err != nil {
+			return ErrCorruptedStateDb
+		}
+		prevHash, err := chainhash.NewHash(headerProto.PrevHash)
+		if err != nil {
+			return ErrCorruptedStateDb
+		}
+
+		header = &StoredProcessedHeader{
+			Hash:      *hash,
+			PrevHash:  *prevHash,
+			Height:    headerProto.Height,
+			Timestamp: time.Unix(headerProto.Timestamp, 0),
+		}
+
+		return nil
+	}, func() {
+		header = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
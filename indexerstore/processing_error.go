@@ -0,0 +1,226 @@
+package indexerstore
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/kvdb"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+)
+
+var (
+	// mapping sequence number -> processing error
+	processingErrorBucketName = []byte("processingerrors")
+)
+
+// StoredProcessingError is an error of processing a confirmed tx,
+// e.g., an invalid unbonding tx
+type StoredProcessingError struct {
+	TxHash *chainhash.Hash
+	Height uint64
+	Error  string
+}
+
+// AddProcessingError records the error of processing the given tx. Only the
+// most recent maxErrors errors are kept, the older ones are removed. The
+// error of a tx processed again at the same height, e.g., after restarts,
+// replaces the recorded one in place rather than being appended
+func (is *IndexerStore) AddProcessingError(txHash *chainhash.Hash, height uint64, processErr string, maxErrors uint64) error {
+	msg := proto.ProcessingError{
+		TxHash: txHash.CloneBytes(),
+		Height: height,
+		Error:  processErr,
+	}
+
+	marshalled, err := pm.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	return is.batch(func(tx kvdb.RwTx) error {
+		errorBucket := tx.ReadWriteBucket(processingErrorBucketName)
+		if errorBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		existingKey, err := findProcessingError(errorBucket, txHash, height)
+		if err != nil {
+			return err
+		}
+		if existingKey != nil {
+			return errorBucket.Put(existingKey, marshalled)
+		}
+
+		// the sequence number keeps increasing so that the keys
+		// are ordered from the oldest to the most recent
+		seq, err := errorBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		if err := errorBucket.Put(uint64ToBytes(seq), marshalled); err != nil {
+			return err
+		}
+
+		if seq <= maxErrors {
+			return nil
+		}
+
+		// remove all the older errors in case the size has been reduced
+		oldestKept := seq - maxErrors + 1
+		c := errorBucket.ReadWriteCursor()
+		for k, _ := c.First(); k != nil; k, _ = c.First() {
+			keySeq, err := uint64FromBytes(k)
+			if err != nil {
+				return ErrCorruptedStateDb
+			}
+
+			if keySeq >= oldestKept {
+				break
+			}
+
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// findProcessingError returns the key of the recorded error of the given tx
+// included at the given height, or nil if it is not recorded. The bucket is
+// bounded by the log size so it is scanned rather than indexed
+func findProcessingError(errorBucket kvdb.RBucket, txHash *chainhash.Hash, height uint64) ([]byte, error) {
+	c := errorBucket.ReadCursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var errorProto proto.ProcessingError
+		if err := pm.Unmarshal(v, &errorProto); err != nil {
+			return nil, ErrCorruptedStateDb
+		}
+
+		if errorProto.Height == height && bytes.Equal(errorProto.TxHash, txHash[:]) {
+			// the keys are only valid during the db transaction
+			return append([]byte(nil), k...), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GetRecentProcessingErrors returns at most n of the most recent processing
+// errors, ordered from the most recent one
+func (is *IndexerStore) GetRecentProcessingErrors(n int) ([]*StoredProcessingError, error) {
+	var processingErrors []*StoredProcessingError
+
+	err := is.view(func(tx kvdb.RTx) error {
+		errorBucket := tx.ReadBucket(processingErrorBucketName)
+		if errorBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		c := errorBucket.ReadCursor()
+		for k, v := c.Last(); k != nil && len(processingErrors) < n; k, v = c.Prev() {
+			var errorProto proto.ProcessingError
+			if err := pm.Unmarshal(v, &errorProto); err != nil {
+				return ErrCorruptedStateDb
+			}
+
+			txHash, err := chainhash.NewHash(errorProto.TxHash)
+			if err != nil {
+				return fmt.Errorf("invalid processing error tx hash: %w", err)
+			}
+
+			processingErrors = append(processingErrors, &StoredProcessingError{
+				TxHash: txHash,
+				Height: errorProto.Height,
+				Error:  errorProto.Error,
+			})
+		}
+
+		return nil
+	}, func() {
+		processingErrors = nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return processingErrors, nil
+}
+
+// PruneProcessingErrors removes the processing errors of the txs included
+// below minHeight. It returns the number of the removed errors
+func (is *IndexerStore) PruneProcessingErrors(minHeight uint64) (int, error) {
+	var pruned int
+
+	err := is.batch(func(tx kvdb.RwTx) error {
+		errorBucket := tx.ReadWriteBucket(processingErrorBucketName)
+		if errorBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		var expired [][]byte
+		err := errorBucket.ForEach(func(k, v []byte) error {
+			var errorProto proto.ProcessingError
+			if err := pm.Unmarshal(v, &errorProto); err != nil {
+				return ErrCorruptedStateDb
+			}
+
+			if errorProto.Height < minHeight {
+				// the keys are only valid during the db transaction
+				expired = append(expired, append([]byte(nil), k...))
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// the bucket should not be modified while iterating it
+		for _, k := range expired {
+			if err := errorBucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		pruned = len(expired)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return pruned, nil
+}
+
+// GetProcessingErrorCount returns the number of the stored processing errors
+func (is *IndexerStore) GetProcessingErrorCount() (int, error) {
+	var count int
+
+	err := is.view(func(tx kvdb.RTx) error {
+		errorBucket := tx.ReadBucket(processingErrorBucketName)
+		if errorBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		return errorBucket.ForEach(func(_, _ []byte) error {
+			count++
+			return nil
+		})
+	}, func() {
+		count = 0
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
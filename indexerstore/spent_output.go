@@ -0,0 +1,113 @@
+package indexerstore
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/kvdb"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+)
+
+var (
+	// mapping spent staking or unbonding outpoint -> hash of the withdrawal
+	// tx spending it, the unbonding txs spending the staking outputs are
+	// recorded by the staking unbonding index instead
+	spentOutputBucketName = []byte("spentoutputs")
+)
+
+// getSpendingTx returns the hash of the tx spending the given outpoint, i.e.,
+// the recorded withdrawal tx, or the unbonding tx of the staking unbonding
+// index if the outpoint is the staking output of a stored staking tx. It
+// returns nil if the outpoint is not known to be spent
+func getSpendingTx(tx kvdb.RTx, outpoint *wire.OutPoint) ([]byte, error) {
+	spentBucket := tx.ReadBucket(spentOutputBucketName)
+	if spentBucket == nil {
+		return nil, ErrCorruptedTransactionsDb
+	}
+
+	if v := spentBucket.Get(outpointKey(outpoint)); v != nil {
+		return v, nil
+	}
+
+	stakingTxBucket := tx.ReadBucket(stakingTxBucketName)
+	if stakingTxBucket == nil {
+		return nil, ErrCorruptedTransactionsDb
+	}
+
+	maybeStakingTx := stakingTxBucket.Get(outpoint.Hash[:])
+	if maybeStakingTx == nil {
+		return nil, nil
+	}
+
+	var stakingTxProto proto.StakingTransaction
+	if err := pm.Unmarshal(maybeStakingTx, &stakingTxProto); err != nil {
+		return nil, ErrCorruptedTransactionsDb
+	}
+	if stakingTxProto.StakingOutputIdx != outpoint.Index {
+		return nil, nil
+	}
+
+	indexBucket := tx.ReadBucket(stakingUnbondingIndexBucketName)
+	if indexBucket == nil {
+		return nil, ErrCorruptedStateDb
+	}
+
+	return indexBucket.Get(outpoint.Hash[:]), nil
+}
+
+// indexSpendingTx records the tx of the given hash as the spender of the
+// given outpoint. Recording the same spender again is a no-op, while a
+// different spender conflicts with the known one
+func indexSpendingTx(tx kvdb.RwTx, outpoint *wire.OutPoint, spendingTxHashBytes []byte) error {
+	existing, err := getSpendingTx(tx, outpoint)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if !bytes.Equal(existing, spendingTxHashBytes) {
+			return ErrStakingOutputAlreadySpent
+		}
+
+		return nil
+	}
+
+	spentBucket := tx.ReadWriteBucket(spentOutputBucketName)
+	if spentBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	return spentBucket.Put(outpointKey(outpoint), spendingTxHashBytes)
+}
+
+// GetSpendingTx returns the hash of the unbonding or withdrawal tx spending
+// the given staking or unbonding outpoint, it returns nil if the outpoint
+// is not known to be spent
+func (is *IndexerStore) GetSpendingTx(outpoint *wire.OutPoint) (*chainhash.Hash, error) {
+	var spendingTxHash *chainhash.Hash
+	err := is.view(func(tx kvdb.RTx) error {
+		v, err := getSpendingTx(tx, outpoint)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return nil
+		}
+
+		spendingTxHash, err = chainhash.NewHash(v)
+		if err != nil {
+			return ErrCorruptedTransactionsDb
+		}
+
+		return nil
+	}, func() {
+		spendingTxHash = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return spendingTxHash, nil
+}
@@ -0,0 +1,172 @@
+package indexerstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/kvdb"
+	pm "google.golang.org/protobuf/proto"
+
+	"github.com/babylonlabs-io/staking-indexer/proto"
+)
+
+var (
+	// mapping height -> the state hash after processing the block at the height
+	stateHashBucketName = []byte("statehash")
+)
+
+// AddStateHash computes and saves the state hash of the given height, which
+// commits to the state hash of the previous height, the staking, unbonding,
+// and withdrawal txs stored from the block at the height, and the confirmed
+// tvl and the total score after processing the block. The state hash of a
+// height is computed once and kept unchanged when the block is processed
+// again, and it is returned
+func (is *IndexerStore) AddStateHash(height uint64) (*chainhash.Hash, error) {
+	var stateHash chainhash.Hash
+	err := is.batch(func(tx kvdb.RwTx) error {
+		hashBucket := tx.ReadWriteBucket(stateHashBucketName)
+		if hashBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		key := uint64ToBytes(height)
+		if v := hashBucket.Get(key); v != nil {
+			return stateHash.SetBytes(v)
+		}
+
+		// the state hash of the first processed height
+		// commits to an all-zero previous state hash
+		var prevHash []byte
+		if height > 0 {
+			if k, v := seekLastUint64Key(hashBucket.ReadCursor(), height-1); k != nil {
+				prevHash = v
+			}
+		}
+		if prevHash == nil {
+			prevHash = make([]byte, chainhash.HashSize)
+		}
+
+		h := sha256.New()
+		h.Write(prevHash)
+		h.Write(key)
+		if err := writeHeightRecords(tx, h, height); err != nil {
+			return err
+		}
+
+		tvlBucket := tx.ReadBucket(confirmedTvlBucketName)
+		if tvlBucket == nil {
+			return ErrCorruptedStateDb
+		}
+		for _, k := range [][]byte{getConfirmedTvlKey(), getTotalScoreKey()} {
+			// a missing value is committed as 0
+			v := tvlBucket.Get(k)
+			if v == nil {
+				v = uint64ToBytes(0)
+			}
+			h.Write(v)
+		}
+
+		copy(stateHash[:], h.Sum(nil))
+
+		return hashBucket.Put(key, stateHash[:])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &stateHash, nil
+}
+
+// writeHeightRecords writes the txs indexed at the given height to the given
+// state hash in the order of the height index, the eligibility of the
+// staking txs is written along with their hashes
+func writeHeightRecords(tx kvdb.RTx, h hash.Hash, height uint64) error {
+	indexBucket := tx.ReadBucket(heightIndexBucketName)
+	if indexBucket == nil {
+		return ErrCorruptedStateDb
+	}
+
+	stakingTxBucket := tx.ReadBucket(stakingTxBucketName)
+	if stakingTxBucket == nil {
+		return ErrCorruptedTransactionsDb
+	}
+
+	prefix := uint64ToBytes(height)
+	for _, typeBucketName := range [][]byte{
+		heightIndexStakingBucketName,
+		heightIndexUnbondingBucketName,
+		heightIndexWithdrawalBucketName,
+	} {
+		typeBucket := indexBucket.NestedReadBucket(typeBucketName)
+		if typeBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		c := typeBucket.ReadCursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			_, txHash, err := uint64TxFromKey(k)
+			if err != nil {
+				return err
+			}
+
+			h.Write(typeBucketName)
+			h.Write(txHash[:])
+
+			if !bytes.Equal(typeBucketName, heightIndexStakingBucketName) {
+				continue
+			}
+
+			v := stakingTxBucket.Get(txHash[:])
+			if v == nil {
+				return ErrCorruptedTransactionsDb
+			}
+			var storedTxProto proto.StakingTransaction
+			if err := pm.Unmarshal(v, &storedTxProto); err != nil {
+				return ErrCorruptedTransactionsDb
+			}
+
+			isOverflow := byte(0)
+			if storedTxProto.IsOverflow {
+				isOverflow = 1
+			}
+			h.Write([]byte{isOverflow})
+			h.Write(uint64ToBytes(uint64(storedTxProto.InactiveReason)))
+		}
+	}
+
+	return nil
+}
+
+// GetStateHash returns the state hash of the given height, it returns nil
+// if the state hash of the height is not computed
+func (is *IndexerStore) GetStateHash(height uint64) (*chainhash.Hash, error) {
+	var stateHash *chainhash.Hash
+	err := is.view(func(tx kvdb.RTx) error {
+		hashBucket := tx.ReadBucket(stateHashBucketName)
+		if hashBucket == nil {
+			return ErrCorruptedStateDb
+		}
+
+		v := hashBucket.Get(uint64ToBytes(height))
+		if v == nil {
+			return nil
+		}
+
+		h, err := chainhash.NewHash(v)
+		if err != nil {
+			return ErrCorruptedStateDb
+		}
+		stateHash = h
+
+		return nil
+	}, func() {
+		stateHash = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stateHash, nil
+}
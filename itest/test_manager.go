@@ -132,7 +132,7 @@ func StartWithBitcoinHandler(t *testing.T, h *BitcoindTestHandler, minerAddress
 	require.NoError(t, err)
 	versionedParams := paramsRetriever.VersionedParams()
 	require.NoError(t, err)
-	scanner, err := btcscanner.NewBTCScanner(versionedParams.Versions[0].ConfirmationDepth, logger, btcClient, btcNotifier)
+	scanner, err := btcscanner.NewBTCScanner(versionedParams.Versions[0].ConfirmationDepth, cfg.BackfillChunkSize, logger, btcClient, btcNotifier)
 	require.NoError(t, err)
 
 	// create event consumer
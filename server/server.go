@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"sync/atomic"
 
@@ -105,7 +106,19 @@ func (s *Server) RunUntilShutdown(startHeight uint64) error {
 		}
 	}()
 
-	if err := s.si.Start(startHeight); err != nil {
+	// abort the start of the indexer if a shutdown signal
+	// is received during the startup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.interceptor.ShutdownChannel():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := s.si.StartWithContext(ctx, startHeight); err != nil {
 		return fmt.Errorf("failed to start the staking indexer app: %w", err)
 	}
 	defer func() {
@@ -50,7 +50,9 @@ func GenerateGlobalParamsVersions(r *rand.Rand, t *testing.T) *parser.ParsedGlob
 		minStakingTime := uint16(r.Intn(1000)) + 1
 		maxStakingTime := uint16(r.Intn(10000)) + minStakingTime + 1
 
-		activationHeight := int32(r.Intn(100)) + lastActivationHeight + 1
+		// the versions are at least 2 blocks apart so that the
+		// height after the activation height is of the same version
+		activationHeight := int32(r.Intn(100)) + lastActivationHeight + 2
 		lastActivationHeight = activationHeight
 
 		// 1/3 chance to have a time-based cap
@@ -3,6 +3,7 @@ package datagen
 import (
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/babylonlabs-io/babylon/btcstaking"
 	bbndatagen "github.com/babylonlabs-io/babylon/testutil/datagen"
@@ -171,7 +172,7 @@ func GenerateWithdrawalTxFromUnbonding(t *testing.T, r *rand.Rand, params *parse
 	return btcutil.NewTx(withdrawalTx)
 }
 
-func GenNStoredStakingTxs(t *testing.T, r *rand.Rand, n int, maxStakingTime uint16) []*indexerstore.StoredStakingTransaction {
+func GenNStoredStakingTxs(t testing.TB, r *rand.Rand, n int, maxStakingTime uint16) []*indexerstore.StoredStakingTransaction {
 	storedTxs := make([]*indexerstore.StoredStakingTransaction, n)
 
 	startingHeight := uint64(r.Int63n(10000) + 1)
@@ -221,7 +222,7 @@ func GenRandomTx(r *rand.Rand) *wire.MsgTx {
 	return tx
 }
 
-func genStoredStakingTx(t *testing.T, r *rand.Rand, maxStakingTime uint16, inclusionHeight uint64) *indexerstore.StoredStakingTransaction {
+func genStoredStakingTx(t testing.TB, r *rand.Rand, maxStakingTime uint16, inclusionHeight uint64) *indexerstore.StoredStakingTransaction {
 	btcTx := GenRandomTx(r)
 	outputIdx := r.Uint32()
 	stakingTime := r.Int31n(int32(maxStakingTime)) + 1
@@ -243,8 +244,11 @@ func genStoredStakingTx(t *testing.T, r *rand.Rand, maxStakingTime uint16, inclu
 		FinalityProviderPk: fpPirvKey.PubKey(),
 		StakerPk:           stakerPrivKey.PubKey(),
 		InclusionHeight:    inclusionHeight,
+		InclusionTimestamp: r.Int63n(time.Now().Unix()) + 1,
 		StakingValue:       uint64(stakingValue),
 		IsOverflow:         false,
+		OpReturnVersion:    uint32(r.Intn(256)),
+		Score:              uint64(r.Int63n(int64(stakingValue)) + 1),
 	}
 }
 
@@ -252,7 +256,9 @@ func genStoredUnbondingTx(r *rand.Rand, stakingTxHash *chainhash.Hash) *indexers
 	btcTx := GenRandomTx(r)
 
 	return &indexerstore.StoredUnbondingTransaction{
-		Tx:            btcTx,
-		StakingTxHash: stakingTxHash,
+		Tx:                 btcTx,
+		StakingTxHash:      stakingTxHash,
+		InclusionHeight:    uint64(r.Int63n(10000) + 1),
+		InclusionTimestamp: r.Int63n(time.Now().Unix()) + 1,
 	}
 }
@@ -7,6 +7,7 @@ package mocks
 import (
 	reflect "reflect"
 
+	consumer "github.com/babylonlabs-io/staking-indexer/consumer"
 	client "github.com/babylonlabs-io/staking-queue-client/client"
 	gomock "github.com/golang/mock/gomock"
 )
@@ -131,3 +132,40 @@ func (mr *MockEventConsumerMockRecorder) Stop() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockEventConsumer)(nil).Stop))
 }
+
+// MockBlockEventsConsumer is a mock of BlockEventsConsumer interface.
+type MockBlockEventsConsumer struct {
+	ctrl     *gomock.Controller
+	recorder *MockBlockEventsConsumerMockRecorder
+}
+
+// MockBlockEventsConsumerMockRecorder is the mock recorder for MockBlockEventsConsumer.
+type MockBlockEventsConsumerMockRecorder struct {
+	mock *MockBlockEventsConsumer
+}
+
+// NewMockBlockEventsConsumer creates a new mock instance.
+func NewMockBlockEventsConsumer(ctrl *gomock.Controller) *MockBlockEventsConsumer {
+	mock := &MockBlockEventsConsumer{ctrl: ctrl}
+	mock.recorder = &MockBlockEventsConsumerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBlockEventsConsumer) EXPECT() *MockBlockEventsConsumerMockRecorder {
+	return m.recorder
+}
+
+// PushBlockEvents mocks base method.
+func (m *MockBlockEventsConsumer) PushBlockEvents(evs *consumer.BlockEvents) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PushBlockEvents", evs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PushBlockEvents indicates an expected call of PushBlockEvents.
+func (mr *MockBlockEventsConsumerMockRecorder) PushBlockEvents(evs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushBlockEvents", reflect.TypeOf((*MockBlockEventsConsumer)(nil).PushBlockEvents), evs)
+}
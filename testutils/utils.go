@@ -52,7 +52,7 @@ func PubKeysEqual(pk1, pk2 *btcec.PublicKey) bool {
 	return bytes.Equal(schnorr.SerializePubKey(pk1), schnorr.SerializePubKey(pk2))
 }
 
-func MakeTestBackend(t *testing.T) kvdb.Backend {
+func MakeTestBackend(t testing.TB) kvdb.Backend {
 	// First, create a temporary directory to be used for the duration of
 	// this test.
 	tempDirName := t.TempDir()
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// ErrAmountOverflow the result of the arithmetic on amounts overflows
+var ErrAmountOverflow = errors.New("amount overflow")
+
+// maxExactFloatSatoshis is the largest amount in satoshis of which all
+// lower amounts can be exactly represented as float64
+const maxExactFloatSatoshis = btcutil.Amount(1 << 53)
+
+// AmountToBtc converts the given amount in satoshis to BTC. Amounts that
+// cannot be exactly represented as float64 are split into the whole BTC
+// and the remaining satoshis before the conversion so that the sub-BTC
+// part is not lost
+func AmountToBtc(amount btcutil.Amount) float64 {
+	if amount <= maxExactFloatSatoshis && amount >= -maxExactFloatSatoshis {
+		// a single division of exact values is correctly rounded
+		return float64(amount) / btcutil.SatoshiPerBitcoin
+	}
+
+	whole := amount / btcutil.SatoshiPerBitcoin
+	remainder := amount % btcutil.SatoshiPerBitcoin
+
+	return float64(whole) + float64(remainder)/btcutil.SatoshiPerBitcoin
+}
+
+// AddAmounts returns the sum of the given amounts, or ErrAmountOverflow
+// if it overflows int64 instead of wrapping
+func AddAmounts(a, b btcutil.Amount) (btcutil.Amount, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, fmt.Errorf("%w: %d + %d", ErrAmountOverflow, a, b)
+	}
+
+	return a + b, nil
+}
+
+// SubAmounts returns a - b, or ErrAmountOverflow if it overflows int64
+// instead of wrapping
+func SubAmounts(a, b btcutil.Amount) (btcutil.Amount, error) {
+	if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+		return 0, fmt.Errorf("%w: %d - %d", ErrAmountOverflow, a, b)
+	}
+
+	return a - b, nil
+}
+
+// AmountFromUint64 converts the given value in satoshis, e.g., a counter
+// stored as uint64, to an amount, or returns ErrAmountOverflow if it does
+// not fit in int64
+func AmountFromUint64(v uint64) (btcutil.Amount, error) {
+	if v > math.MaxInt64 {
+		return 0, fmt.Errorf("%w: %d", ErrAmountOverflow, v)
+	}
+
+	return btcutil.Amount(v), nil
+}
+
+// AddUint64 returns the sum of the given values in satoshis, e.g., of the
+// counters stored as uint64, or ErrAmountOverflow if it overflows uint64
+func AddUint64(a, b uint64) (uint64, error) {
+	sum, carry := bits.Add64(a, b, 0)
+	if carry != 0 {
+		return 0, fmt.Errorf("%w: %d + %d", ErrAmountOverflow, a, b)
+	}
+
+	return sum, nil
+}
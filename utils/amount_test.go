@@ -0,0 +1,123 @@
+package utils_test
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+// exactBtc returns the float64 nearest to the exact BTC value of the amount
+func exactBtc(amount btcutil.Amount) float64 {
+	f, _ := new(big.Rat).SetFrac64(int64(amount), btcutil.SatoshiPerBitcoin).Float64()
+	return f
+}
+
+func TestAmountToBtc(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	// the valid amounts are converted to the nearest float64
+	for _, amount := range []btcutil.Amount{0, 1, btcutil.SatoshiPerBitcoin, btcutil.MaxSatoshi, -btcutil.MaxSatoshi} {
+		require.Equal(t, exactBtc(amount), utils.AmountToBtc(amount))
+	}
+	for i := 0; i < 1000; i++ {
+		amount := btcutil.Amount(r.Int63n(btcutil.MaxSatoshi + 1))
+		require.Equal(t, exactBtc(amount), utils.AmountToBtc(amount))
+	}
+
+	// the larger amounts stay within one ulp of the exact value
+	for _, amount := range []btcutil.Amount{(1 << 53) + 1, math.MaxInt64, math.MinInt64 + 1} {
+		expected := exactBtc(amount)
+		actual := utils.AmountToBtc(amount)
+		require.LessOrEqual(t, math.Abs(expected-actual), math.Abs(math.Nextafter(expected, 0)-expected))
+	}
+	for i := 0; i < 1000; i++ {
+		amount := btcutil.Amount(r.Int63n(math.MaxInt64-(1<<53)) + (1 << 53))
+		expected := exactBtc(amount)
+		actual := utils.AmountToBtc(amount)
+		require.LessOrEqual(t, math.Abs(expected-actual), math.Abs(math.Nextafter(expected, 0)-expected))
+	}
+}
+
+func TestCheckedAmountArithmetic(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for _, tc := range []struct {
+		a, b         btcutil.Amount
+		sumOverflow  bool
+		diffOverflow bool
+		expectedSum  btcutil.Amount
+		expectedDiff btcutil.Amount
+	}{
+		{math.MaxInt64, 0, false, false, math.MaxInt64, math.MaxInt64},
+		{math.MaxInt64, 1, true, false, 0, math.MaxInt64 - 1},
+		{math.MaxInt64 - 1, 1, false, false, math.MaxInt64, math.MaxInt64 - 2},
+		{math.MaxInt64, -1, false, true, math.MaxInt64 - 1, 0},
+		{math.MaxInt64, math.MaxInt64, true, false, 0, 0},
+		{math.MinInt64, -1, true, false, 0, math.MinInt64 + 1},
+		{math.MinInt64, 1, false, true, math.MinInt64 + 1, 0},
+		{0, math.MinInt64, false, true, math.MinInt64, 0},
+		{-1, math.MinInt64, true, false, 0, math.MaxInt64},
+		{btcutil.MaxSatoshi, btcutil.MaxSatoshi, false, false, 2 * btcutil.MaxSatoshi, 0},
+	} {
+		sum, err := utils.AddAmounts(tc.a, tc.b)
+		if tc.sumOverflow {
+			require.ErrorIs(t, err, utils.ErrAmountOverflow, "%d + %d", tc.a, tc.b)
+		} else {
+			require.NoError(t, err, "%d + %d", tc.a, tc.b)
+			require.Equal(t, tc.expectedSum, sum)
+		}
+
+		diff, err := utils.SubAmounts(tc.a, tc.b)
+		if tc.diffOverflow {
+			require.ErrorIs(t, err, utils.ErrAmountOverflow, "%d - %d", tc.a, tc.b)
+		} else {
+			require.NoError(t, err, "%d - %d", tc.a, tc.b)
+			require.Equal(t, tc.expectedDiff, diff)
+		}
+	}
+
+	// the results agree with the exact arithmetic
+	for i := 0; i < 1000; i++ {
+		a, b := btcutil.Amount(r.Uint64()), btcutil.Amount(r.Uint64())
+		exactSum := new(big.Int).Add(big.NewInt(int64(a)), big.NewInt(int64(b)))
+		sum, err := utils.AddAmounts(a, b)
+		if exactSum.IsInt64() {
+			require.NoError(t, err)
+			require.Equal(t, exactSum.Int64(), int64(sum))
+		} else {
+			require.ErrorIs(t, err, utils.ErrAmountOverflow)
+		}
+
+		exactDiff := new(big.Int).Sub(big.NewInt(int64(a)), big.NewInt(int64(b)))
+		diff, err := utils.SubAmounts(a, b)
+		if exactDiff.IsInt64() {
+			require.NoError(t, err)
+			require.Equal(t, exactDiff.Int64(), int64(diff))
+		} else {
+			require.ErrorIs(t, err, utils.ErrAmountOverflow)
+		}
+	}
+}
+
+func TestCheckedUint64Arithmetic(t *testing.T) {
+	sum, err := utils.AddUint64(math.MaxUint64-1, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(math.MaxUint64), sum)
+	_, err = utils.AddUint64(math.MaxUint64, 1)
+	require.ErrorIs(t, err, utils.ErrAmountOverflow)
+	_, err = utils.AddUint64(math.MaxUint64/2+1, math.MaxUint64/2+1)
+	require.ErrorIs(t, err, utils.ErrAmountOverflow)
+
+	amount, err := utils.AmountFromUint64(math.MaxInt64)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(math.MaxInt64), amount)
+	_, err = utils.AmountFromUint64(math.MaxInt64 + 1)
+	require.ErrorIs(t, err, utils.ErrAmountOverflow)
+}
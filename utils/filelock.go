@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrFileLocked the file is locked by another process or another open
+// file of the same process
+var ErrFileLocked = errors.New("file is locked")
+
+// FileLock is an exclusive advisory lock on a file
+type FileLock struct {
+	file *os.File
+}
+
+// LockFile creates the file of the given path if it does not exist and
+// acquires an exclusive advisory lock on it. It fails fast with
+// ErrFileLocked if the lock is held by another process instead of waiting
+// for the lock to be released
+func LockFile(path string) (*FileLock, error) {
+	if err := MakeDirectory(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the lock file %s: %w", path, err)
+	}
+
+	if err := tryLock(f); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	return &FileLock{file: f}, nil
+}
+
+// Unlock releases the lock, it is a no-op on a nil lock
+func (l *FileLock) Unlock() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	err := unlock(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+
+	return err
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package utils
+
+import "os"
+
+// the advisory lock is not supported on the platform, the database is
+// still protected by the lock bolt holds on the database file
+
+func tryLock(_ *os.File) error {
+	return nil
+}
+
+func unlock(_ *os.File) error {
+	return nil
+}
@@ -0,0 +1,35 @@
+package utils_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+// TestLockFile tests that a file cannot be locked again while the lock is
+// held and it can be locked after the lock is released
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "indexer.db.lock")
+
+	lock, err := utils.LockFile(path)
+	require.NoError(t, err)
+
+	// the second open fails fast while the first one holds the lock
+	_, err = utils.LockFile(path)
+	require.ErrorIs(t, err, utils.ErrFileLocked)
+
+	require.NoError(t, lock.Unlock())
+	// unlocking twice is a no-op
+	require.NoError(t, lock.Unlock())
+
+	lock, err = utils.LockFile(path)
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+
+	// a nil lock can be unlocked, e.g., when locking is disabled
+	var nilLock *utils.FileLock
+	require.NoError(t, nilLock.Unlock())
+}
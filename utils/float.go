@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"strconv"
+)
+
+// RoundFloat rounds the given value to the given number of decimal places.
+// The value is rounded through its decimal representation rather than by
+// scaling, so that e.g. 1.005 is rounded as it is printed and the same
+// value is always rounded the same way regardless of where it is reported
+func RoundFloat(v float64, precision uint32) float64 {
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(v, 'f', int(precision), 64), 64)
+	if err != nil {
+		// the formatted value is always parsable
+		return v
+	}
+
+	return rounded
+}
@@ -0,0 +1,43 @@
+package utils_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+func TestRoundFloat(t *testing.T) {
+	testCases := []struct {
+		v         float64
+		precision uint32
+		expected  float64
+	}{
+		{0, 2, 0},
+		{1.23456789, 0, 1},
+		{1.23456789, 2, 1.23},
+		{1.23556789, 2, 1.24},
+		{-1.23556789, 2, -1.24},
+		{33.333333333333336, 4, 33.3333},
+		{21_000_000, 8, 21_000_000},
+		{0.00000001, 8, 0.00000001},
+		{0.000000005, 8, 0.00000001},
+		{1.23, 15, 1.23},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.expected, utils.RoundFloat(tc.v, tc.precision), "%v rounded to %d", tc.v, tc.precision)
+	}
+
+	// rounding is idempotent
+	for _, v := range []float64{1.23556789, 66.66666666666667, 123.456789} {
+		rounded := utils.RoundFloat(v, 3)
+		require.Equal(t, rounded, utils.RoundFloat(rounded, 3))
+	}
+
+	// the infinities and NaN are not rounded
+	require.True(t, math.IsInf(utils.RoundFloat(math.Inf(1), 2), 1))
+	require.True(t, math.IsNaN(utils.RoundFloat(math.NaN(), 2)))
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// MerkleBranch returns the hashes of the siblings along the path from the tx
+// at the given index to the merkle root, in the order from the bottom to the
+// top. The merkle tree is built by blockchain.BuildMerkleTreeStore from the
+// given number of txs
+func MerkleBranch(merkleTree []*chainhash.Hash, numTxs, idx int) ([]chainhash.Hash, error) {
+	if idx < 0 || idx >= numTxs {
+		return nil, fmt.Errorf("the tx index %d is out of the range of %d txs", idx, numTxs)
+	}
+
+	// the bottom level is padded to the next power of two
+	width := 1
+	for width < numTxs {
+		width <<= 1
+	}
+	if len(merkleTree) != 2*width-1 {
+		return nil, fmt.Errorf("the merkle tree of %d nodes is not built from %d txs", len(merkleTree), numTxs)
+	}
+
+	var branch []chainhash.Hash
+	for offset := 0; width > 1; width >>= 1 {
+		// a node without a sibling is hashed with itself
+		sibling := merkleTree[offset+(idx^1)]
+		if sibling == nil {
+			sibling = merkleTree[offset+idx]
+		}
+		branch = append(branch, *sibling)
+
+		offset += width
+		idx >>= 1
+	}
+
+	return branch, nil
+}
+
+// VerifyMerkleBranch checks whether the given branch proves the inclusion
+// of the tx of the given hash at the given index under the given merkle root
+func VerifyMerkleBranch(txHash *chainhash.Hash, idx uint32, branch []chainhash.Hash, merkleRoot *chainhash.Hash) bool {
+	h := *txHash
+	for i := range branch {
+		if idx&1 == 0 {
+			h = blockchain.HashMerkleBranches(&h, &branch[i])
+		} else {
+			h = blockchain.HashMerkleBranches(&branch[i], &h)
+		}
+		idx >>= 1
+	}
+
+	// the index should be fully consumed by the branch
+	return idx == 0 && h.IsEqual(merkleRoot)
+}
@@ -0,0 +1,57 @@
+package utils_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	bbndatagen "github.com/babylonlabs-io/babylon/testutil/datagen"
+	btcctypes "github.com/babylonlabs-io/babylon/x/btccheckpoint/types"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonlabs-io/staking-indexer/utils"
+)
+
+func TestMerkleBranch(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for numTxs := 1; numTxs <= 17; numTxs++ {
+		txs := make([]*btcutil.Tx, 0, numTxs)
+		txsBytes := make([][]byte, 0, numTxs)
+		for i := 0; i < numTxs; i++ {
+			tx := bbndatagen.GenRandomTx(r)
+			txBytes, err := utils.SerializeBtcTransaction(tx)
+			require.NoError(t, err)
+			txs = append(txs, btcutil.NewTx(tx))
+			txsBytes = append(txsBytes, txBytes)
+		}
+		merkleTree := blockchain.BuildMerkleTreeStore(txs, false)
+		merkleRoot := merkleTree[len(merkleTree)-1]
+
+		for idx, tx := range txs {
+			branch, err := utils.MerkleBranch(merkleTree, numTxs, idx)
+			require.NoError(t, err)
+
+			// the branch is the same as the one of the SPV proofs of babylon
+			expectedBranch, err := btcctypes.CreateProofForIdx(txsBytes, uint(idx))
+			require.NoError(t, err)
+			require.Len(t, branch, len(expectedBranch))
+			for i := range branch {
+				require.Equal(t, *expectedBranch[i], branch[i])
+			}
+
+			require.True(t, utils.VerifyMerkleBranch(tx.Hash(), uint32(idx), branch, merkleRoot))
+			// the branch does not prove the tx at another index
+			require.False(t, utils.VerifyMerkleBranch(tx.Hash(), uint32(idx+1<<len(branch)), branch, merkleRoot))
+			if numTxs > 1 {
+				otherIdx := (idx + 1) % numTxs
+				require.False(t, utils.VerifyMerkleBranch(txs[otherIdx].Hash(), uint32(idx), branch, merkleRoot))
+			}
+		}
+
+		_, err := utils.MerkleBranch(merkleTree, numTxs, numTxs)
+		require.Error(t, err)
+	}
+}
@@ -2,8 +2,12 @@ package utils
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
@@ -15,6 +19,27 @@ func SerializeBtcTransaction(tx *wire.MsgTx) ([]byte, error) {
 	return txBuf.Bytes(), nil
 }
 
+// GetOutputAddress derives the address of the output at the given index
+// of the tx under the given network. An error is returned if the output
+// does not exist or its pk script does not pay to a standard address
+func GetOutputAddress(tx *wire.MsgTx, outputIdx uint32, net *chaincfg.Params) (btcutil.Address, error) {
+	if int(outputIdx) >= len(tx.TxOut) {
+		return nil, fmt.Errorf("output index %d out of range, the tx has %d outputs",
+			outputIdx, len(tx.TxOut))
+	}
+
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(tx.TxOut[outputIdx].PkScript, net)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addrs) != 1 {
+		return nil, fmt.Errorf("the output does not pay to a single address")
+	}
+
+	return addrs[0], nil
+}
+
 func GetWrappedTxs(msg *wire.MsgBlock) []*btcutil.Tx {
 	btcTxs := []*btcutil.Tx{}
 
@@ -27,3 +52,39 @@ func GetWrappedTxs(msg *wire.MsgBlock) []*btcutil.Tx {
 
 	return btcTxs
 }
+
+// SortTxsByDependency returns the given txs ordered such that a tx always
+// comes after the txs whose outputs it spends. The relative order of
+// independent txs is preserved
+func SortTxsByDependency(txs []*btcutil.Tx) []*btcutil.Tx {
+	txsByHash := make(map[chainhash.Hash]*btcutil.Tx, len(txs))
+	for _, tx := range txs {
+		txsByHash[*tx.Hash()] = tx
+	}
+
+	sorted := make([]*btcutil.Tx, 0, len(txs))
+	visited := make(map[chainhash.Hash]bool, len(txs))
+
+	var visit func(tx *btcutil.Tx)
+	visit = func(tx *btcutil.Tx) {
+		if visited[*tx.Hash()] {
+			return
+		}
+		visited[*tx.Hash()] = true
+
+		// the txs spent by this tx should come first
+		for _, txIn := range tx.MsgTx().TxIn {
+			if parent, ok := txsByHash[txIn.PreviousOutPoint.Hash]; ok {
+				visit(parent)
+			}
+		}
+
+		sorted = append(sorted, tx)
+	}
+
+	for _, tx := range txs {
+		visit(tx)
+	}
+
+	return sorted
+}